@@ -0,0 +1,198 @@
+package cli
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/spf13/cobra"
+
+	acmeserver "github.com/giantswarm/certctl/v2/service/acme-server"
+)
+
+type acmeFlags struct {
+	// Server
+	Address              string
+	AuditLogFile         string
+	ExternalAccountsFile string
+	ExternalURL          string
+	MetricsAddress       string
+	TLSCertFile          string
+	TLSKeyFile           string
+
+	// Challenges
+	ChallengeTypes []string
+	DNSResolver    string
+
+	// Certificates
+	TTL string
+
+	// Role
+	AllowedDomains   []string
+	AllowBareDomains bool
+	AllowedURISANs   []string
+	RoleTTL          string
+}
+
+// externalAccountsFile is the format of the file given by
+// --external-accounts-file.
+type externalAccountsFile struct {
+	ExternalAccounts []acmeserver.ExternalAccount `json:"externalAccounts"`
+}
+
+var (
+	acmeCmd = &cobra.Command{
+		Use:   "acme",
+		Short: "Serve ACME (RFC 8555) to order certificates signed by the PKI backends of the clusters accounts are bound to.",
+		Run:   acmeRun,
+	}
+
+	newACMEFlags = &acmeFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(acmeCmd)
+
+	acmeCmd.Flags().StringVar(&newACMEFlags.Address, "address", ":8443", "Address ACME is served on with TLS.")
+	acmeCmd.Flags().StringVar(&newACMEFlags.AuditLogFile, "audit-log-file", "", "File path audit log entries of all requests are appended to as JSON. Defaults to writing them to stderr regardless of --log-level.")
+	acmeCmd.Flags().StringVar(&newACMEFlags.ExternalAccountsFile, "external-accounts-file", "", "File path of the YAML file holding the external account keys accounts are bound to, and the cluster IDs and domains of each key.")
+	acmeCmd.Flags().StringVar(&newACMEFlags.ExternalURL, "external-url", "", "URL ACME clients reach the server with, e.g. behind a proxy. Defaults to the scheme and host of each request.")
+	acmeCmd.Flags().StringVar(&newACMEFlags.MetricsAddress, "metrics-address", "", "Address the metrics are served on under /metrics without TLS. Metrics are not served if empty.")
+	acmeCmd.Flags().StringVar(&newACMEFlags.TLSCertFile, "tls-cert-file", "", "File path of the PEM encoded server certificate.")
+	acmeCmd.Flags().StringVar(&newACMEFlags.TLSKeyFile, "tls-key-file", "", "File path of the PEM encoded server private key.")
+
+	acmeCmd.Flags().StringSliceVar(&newACMEFlags.ChallengeTypes, "challenge-types", []string{acmeserver.ChallengeHTTP01, acmeserver.ChallengeDNS01}, "Comma separated types of the challenges offered to prove control over domains.")
+	acmeCmd.Flags().StringVar(&newACMEFlags.DNSResolver, "dns-resolver", "", "Address of the DNS server dns-01 challenges are validated with, e.g. '10.0.0.10:53'. Defaults to the system's resolver.")
+
+	acmeCmd.Flags().StringVar(&newACMEFlags.TTL, "ttl", "2160h", "TTL of ordered certificates.") // 90 days
+
+	acmeCmd.Flags().StringSliceVar(&newACMEFlags.AllowedDomains, "allowed-domains", nil, "Comma separated domains allowed by roles created for clusters ordered from the first time.")
+	acmeCmd.Flags().BoolVar(&newACMEFlags.AllowBareDomains, "allow-bare-domains", false, "Allow bare domains in roles created for clusters ordered from the first time. (Default false)")
+	acmeCmd.Flags().StringSliceVar(&newACMEFlags.AllowedURISANs, "allowed-uri-sans", nil, "Comma separated URI SANs allowed by roles created for clusters ordered from the first time.")
+	acmeCmd.Flags().StringVar(&newACMEFlags.RoleTTL, "role-ttl", "8640h", "TTL of roles created for clusters ordered from the first time.") // 1 year
+}
+
+func acmeValidate(newACMEFlags *acmeFlags) error {
+	err := backendValidate()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if newACMEFlags.Address == "" {
+		return microerror.Maskf(invalidConfigError, "--address must not be empty")
+	}
+	if newACMEFlags.ExternalAccountsFile == "" {
+		return microerror.Maskf(invalidConfigError, "--external-accounts-file must not be empty")
+	}
+	if newACMEFlags.TLSCertFile == "" || newACMEFlags.TLSKeyFile == "" {
+		return microerror.Maskf(invalidConfigError, "--tls-cert-file and --tls-key-file must not be empty")
+	}
+	if len(newACMEFlags.ChallengeTypes) == 0 {
+		return microerror.Maskf(invalidConfigError, "--challenge-types must not be empty")
+	}
+	for _, t := range newACMEFlags.ChallengeTypes {
+		if t != acmeserver.ChallengeHTTP01 && t != acmeserver.ChallengeDNS01 {
+			return microerror.Maskf(invalidConfigError, "--challenge-types must only contain %s and %s", acmeserver.ChallengeHTTP01, acmeserver.ChallengeDNS01)
+		}
+	}
+
+	return nil
+}
+
+func acmeRun(cmd *cobra.Command, args []string) {
+	err := acmeValidate(newACMEFlags)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// The server runs until it is interrupted or terminated. --timeout bounds
+	// each request instead.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	var externalAccounts externalAccountsFile
+	err = readYAMLFile(newACMEFlags.ExternalAccountsFile, &externalAccounts)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// ACME clients authenticate with their account keys, so that client
+	// certificates are not requested.
+	tlsConfig, err := newServerTLSConfig(newACMEFlags.TLSCertFile, newACMEFlags.TLSKeyFile, "", tls.NoClientCert)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	auditLogger, closeAuditLog, err := newAuditLogger(newACMEFlags.AuditLogFile)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+	defer closeAuditLog()
+
+	newCertSigner := newCertSignerFromFlags()
+
+	validators := map[string]acmeserver.Validator{}
+	for _, t := range newACMEFlags.ChallengeTypes {
+		switch t {
+		case acmeserver.ChallengeHTTP01:
+			validators[t] = acmeserver.HTTP01Validator{}
+		case acmeserver.ChallengeDNS01:
+			validators[t] = acmeserver.DNS01Validator{Resolver: newDNSResolver(newACMEFlags.DNSResolver)}
+		}
+	}
+
+	var handler http.Handler
+	{
+		acmeServerConfig := acmeserver.DefaultConfig()
+		acmeServerConfig.AuditLogger = auditLogger
+		acmeServerConfig.CertSigner = newCertSigner
+		acmeServerConfig.Logger = logger
+		acmeServerConfig.Validators = validators
+		acmeServerConfig.ExternalAccounts = externalAccounts.ExternalAccounts
+		acmeServerConfig.ExternalURL = newACMEFlags.ExternalURL
+		acmeServerConfig.TTL = newACMEFlags.TTL
+		acmeServerConfig.AllowedDomains = newACMEFlags.AllowedDomains
+		acmeServerConfig.AllowBareDomains = newACMEFlags.AllowBareDomains
+		acmeServerConfig.AllowedURISANs = newACMEFlags.AllowedURISANs
+		acmeServerConfig.RoleTTL = newACMEFlags.RoleTTL
+		acmeServerConfig.Timeout = timeout
+		handler, err = acmeserver.New(acmeServerConfig)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+	}
+
+	server := &http.Server{
+		Addr:              newACMEFlags.Address,
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	logger.LogCtx(ctx, "level", "info", "message", "serving ACME", "address", newACMEFlags.Address)
+
+	err = serveUntilDone(ctx, server, newACMEFlags.MetricsAddress)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+}
+
+// newDNSResolver returns a resolver querying the DNS server at the given
+// address, or the system's resolver if the address is empty.
+func newDNSResolver(address string) *net.Resolver {
+	if address == "" {
+		return net.DefaultResolver
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, address)
+		},
+	}
+}
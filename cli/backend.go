@@ -0,0 +1,311 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+	vaultclient "github.com/hashicorp/vault/api"
+
+	certsigner "github.com/giantswarm/certctl/v2/service/cert-signer"
+	localca "github.com/giantswarm/certctl/v2/service/local-ca"
+	mountpath "github.com/giantswarm/certctl/v2/service/mount-path"
+	"github.com/giantswarm/certctl/v2/service/pki"
+	"github.com/giantswarm/certctl/v2/service/retry"
+	"github.com/giantswarm/certctl/v2/service/spec"
+	"github.com/giantswarm/certctl/v2/service/token"
+	vaultfactory "github.com/giantswarm/certctl/v2/service/vault-factory"
+)
+
+const (
+	// BackendVault selects Vault's PKI backends to issue certificates with.
+	BackendVault = "vault"
+
+	// BackendLocal selects local CAs stored in an encrypted directory to
+	// issue certificates with, e.g. for local development without Vault.
+	BackendLocal = "local"
+)
+
+// defaultLocalPath is the directory of the local backend relative to the
+// user's configuration directory.
+var defaultLocalPath = filepath.Join("certctl", "local")
+
+var (
+	// backend selects the backend certificates are issued with, either
+	// BackendVault or BackendLocal.
+	backend string
+
+	// newLocalFlags holds the flags configuring the local backend.
+	newLocalFlags = &localFlags{}
+)
+
+// localFlags configures the directory and passphrase of the local backend.
+type localFlags struct {
+	Directory          string
+	PassphraseFilePath string
+}
+
+func init() {
+	CLICmd.PersistentFlags().StringVar(&backend, "backend", BackendVault, fmt.Sprintf("Backend certificates are issued with, either '%s' or '%s'. The local backend keeps root CAs in an encrypted directory instead of Vault and supports setup, inspect, cleanup, issue, revoke, serve, est and acme.", BackendVault, BackendLocal))
+	CLICmd.PersistentFlags().StringVar(&newLocalFlags.Directory, "local-dir", "", fmt.Sprintf("Directory the local backend stores its encrypted root CAs in. Defaults to '%s' in the user's configuration directory.", defaultLocalPath))
+	CLICmd.PersistentFlags().StringVar(&newLocalFlags.PassphraseFilePath, "local-passphrase-file", "", fmt.Sprintf("File path used to read the passphrase of the local backend from. Defaults to the value of %s.", EnvLocalPassphrase))
+}
+
+// backendValidate validates the flags of the backend selected by --backend,
+// for commands supporting all backends.
+func backendValidate() error {
+	switch backend {
+	case BackendVault:
+		if newVaultFlags.Token == "" {
+			return microerror.Maskf(invalidConfigError, "Vault token must not be empty")
+		}
+	case BackendLocal:
+		if newLocalFlags.Directory == "" {
+			newLocalFlags.Directory = userLocalPath()
+		}
+		if newLocalFlags.Directory == "" {
+			return microerror.Maskf(invalidConfigError, "--local-dir must not be empty")
+		}
+	default:
+		return microerror.Maskf(invalidConfigError, "--backend must be '%s' or '%s'", BackendVault, BackendLocal)
+	}
+
+	return nil
+}
+
+// vaultBackendValidate ensures --backend selects Vault, for commands relying
+// on features only Vault provides.
+func vaultBackendValidate(command string) error {
+	if backend != BackendVault {
+		return microerror.Maskf(notSupportedError, "%s is only supported by --backend %s", command, BackendVault)
+	}
+
+	return nil
+}
+
+// userLocalPath returns the default directory of the local backend in the
+// user's configuration directory.
+func userLocalPath() string {
+	dir := userConfigDir()
+	if dir == "" {
+		return ""
+	}
+
+	return filepath.Join(dir, defaultLocalPath)
+}
+
+// readLocalPassphrase reads the passphrase of the local backend from the
+// given file, or from the environment if no file is given.
+func readLocalPassphrase(path string) ([]byte, error) {
+	var passphrase string
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+		passphrase = strings.TrimRight(string(b), "\r\n")
+	} else {
+		passphrase = os.Getenv(EnvLocalPassphrase)
+	}
+
+	if passphrase == "" {
+		return nil, microerror.Maskf(invalidConfigError, "local passphrase must not be empty, use --local-passphrase-file or %s", EnvLocalPassphrase)
+	}
+
+	return []byte(passphrase), nil
+}
+
+// newLocalStore opens the store of the local backend configured by the
+// --local-* flags. It is created in case it does not exist yet.
+func newLocalStore() (localca.Store, error) {
+	passphrase, err := readLocalPassphrase(newLocalFlags.PassphraseFilePath)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	storeConfig := localca.DefaultConfig()
+	storeConfig.Logger = logger
+	storeConfig.Directory = newLocalFlags.Directory
+	storeConfig.Passphrase = passphrase
+	store, err := localca.New(storeConfig)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return store, nil
+}
+
+// vaultDependencies holds the dependencies shared by all services talking to
+// Vault.
+type vaultDependencies struct {
+	MountPathScheme mountpath.Scheme
+	RetryPolicy     retry.Policy
+	VaultClient     *vaultclient.Client
+}
+
+// newVaultDependenciesFromFlags creates the mount path scheme, Vault client
+// and retry policy configured by the --vault-* and --retry-* flags.
+func newVaultDependenciesFromFlags() vaultDependencies {
+	// Create a mount path scheme shared by all services.
+	newMountPathSchemeConfig := mountpath.DefaultConfig()
+	newMountPathSchemeConfig.Format = newVaultFlags.MountPathFormat
+	newMountPathScheme, err := mountpath.New(newMountPathSchemeConfig)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// Create a Vault client factory.
+	newVaultFactoryConfig := vaultfactory.DefaultConfig()
+	newVaultFactoryConfig.Logger = logger
+	newVaultFactoryConfig.Addresses = vaultAddresses(newVaultFlags.Address)
+	newVaultFactoryConfig.AdminToken = newVaultFlags.Token
+	newVaultFactoryConfig.TLS = newVaultFlags.TLS
+	newVaultFactoryConfig.Namespace = newVaultFlags.Namespace
+	newVaultFactoryConfig.DisableClientRetries = retryConfig.MaxAttempts > 1
+	newVaultFactory, err := vaultfactory.New(newVaultFactoryConfig)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// Create a Vault client and configure it with the provided admin token
+	// through the factory.
+	newVaultClient, err := newVaultFactory.NewClient()
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// Create a retry policy for operations safe to be retried.
+	newRetryPolicy, err := newRetryPolicy()
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	return vaultDependencies{
+		MountPathScheme: newMountPathScheme,
+		RetryPolicy:     newRetryPolicy,
+		VaultClient:     newVaultClient,
+	}
+}
+
+// newPKIServiceFromFlags creates the PKI service of the backend selected by
+// --backend, and for Vault the token service and Vault client it uses. The
+// local backend has neither tokens nor a Vault client, so both are nil then.
+func newPKIServiceFromFlags() (pki.Service, token.Service, *vaultclient.Client) {
+	if backend == BackendLocal {
+		store, err := newLocalStore()
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+
+		return newLocalPKIService(store), nil, nil
+	}
+
+	deps := newVaultDependenciesFromFlags()
+
+	// Create a token generator to manage the cluster's policies and tokens.
+	tokenConfig := token.DefaultServiceConfig()
+	tokenConfig.Logger = logger
+	tokenConfig.MountPathScheme = deps.MountPathScheme
+	tokenConfig.VaultClient = deps.VaultClient
+	tokenService, err := token.NewService(tokenConfig)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	return newVaultPKIService(deps), tokenService, deps.VaultClient
+}
+
+// newCertSignerFromFlags creates the cert signer of the backend selected by
+// --backend, which commands issue and revoke certificates with.
+func newCertSignerFromFlags() spec.CertSigner {
+	if backend == BackendLocal {
+		store, err := newLocalStore()
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+
+		return newLocalCertSigner(store)
+	}
+
+	return newVaultCertSigner(newVaultDependenciesFromFlags())
+}
+
+// newCertSignerAndPKIServiceFromFlags creates the cert signer and PKI service
+// of the backend selected by --backend, for commands issuing certificates and
+// looking up root CAs. Both share the same store or Vault client.
+func newCertSignerAndPKIServiceFromFlags() (spec.CertSigner, pki.Service) {
+	if backend == BackendLocal {
+		store, err := newLocalStore()
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+
+		return newLocalCertSigner(store), newLocalPKIService(store)
+	}
+
+	deps := newVaultDependenciesFromFlags()
+
+	return newVaultCertSigner(deps), newVaultPKIService(deps)
+}
+
+// newVaultPKIService creates a PKI controller to manage the cluster's PKI
+// backend including its root CA and role.
+func newVaultPKIService(deps vaultDependencies) pki.Service {
+	pkiConfig := pki.DefaultServiceConfig()
+	pkiConfig.Logger = logger
+	pkiConfig.MountPathScheme = deps.MountPathScheme
+	pkiConfig.RetryPolicy = deps.RetryPolicy
+	pkiConfig.VaultClient = deps.VaultClient
+	pkiService, err := pki.NewService(pkiConfig)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	return pkiService
+}
+
+// newVaultCertSigner creates a certificate signer to issue certificates and
+// sign CSRs with Vault.
+func newVaultCertSigner(deps vaultDependencies) spec.CertSigner {
+	newCertSignerConfig := certsigner.DefaultConfig()
+	newCertSignerConfig.Logger = logger
+	newCertSignerConfig.MountPathScheme = deps.MountPathScheme
+	newCertSignerConfig.RetryPolicy = deps.RetryPolicy
+	newCertSignerConfig.VaultClient = deps.VaultClient
+	newCertSigner, err := certsigner.New(newCertSignerConfig)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	return newCertSigner
+}
+
+// newLocalPKIService creates a PKI service managing the root CAs of the
+// given local store.
+func newLocalPKIService(store localca.Store) pki.Service {
+	pkiConfig := pki.DefaultLocalServiceConfig()
+	pkiConfig.Logger = logger
+	pkiConfig.Store = store
+	pkiService, err := pki.NewLocalService(pkiConfig)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	return pkiService
+}
+
+// newLocalCertSigner creates a certificate signer issuing certificates with
+// the root CAs of the given local store.
+func newLocalCertSigner(store localca.Store) spec.CertSigner {
+	newCertSignerConfig := certsigner.DefaultLocalConfig()
+	newCertSignerConfig.Logger = logger
+	newCertSignerConfig.Store = store
+	newCertSigner, err := certsigner.NewLocal(newCertSignerConfig)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	return newCertSigner
+}
@@ -0,0 +1,254 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+	vaultclient "github.com/hashicorp/vault/api"
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/v2/service/backup"
+	mountpath "github.com/giantswarm/certctl/v2/service/mount-path"
+	"github.com/giantswarm/certctl/v2/service/pki"
+	"github.com/giantswarm/certctl/v2/service/token"
+	vaultfactory "github.com/giantswarm/certctl/v2/service/vault-factory"
+)
+
+type backupFlags struct {
+	// Cluster
+	ClusterID string
+
+	// Backup
+	CAKeySourceFilePath string
+	OutFilePath         string
+	PassphraseFilePath  string
+}
+
+var (
+	backupCmd = &cobra.Command{
+		Use:   "backup",
+		Short: "Back up the root CA, roles, policies and mount settings of a cluster's PKI backend into an encrypted archive.",
+		Run:   backupRun,
+	}
+
+	newBackupFlags = &backupFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(backupCmd)
+
+	backupCmd.Flags().StringVar(&newBackupFlags.ClusterID, "cluster-id", "", "Cluster ID of the PKI backend to back up.")
+
+	backupCmd.Flags().StringVar(&newBackupFlags.CAKeySourceFilePath, "ca-key-source", "", "Archive of an earlier backup, e.g. the one written by setup with --backup-file, used to obtain the root CA's private key. Vault never returns it.")
+	backupCmd.Flags().StringVar(&newBackupFlags.OutFilePath, "out-file", "", "File path used to write the encrypted archive to.")
+	backupCmd.Flags().StringVar(&newBackupFlags.PassphraseFilePath, "backup-passphrase-file", "", fmt.Sprintf("File path used to read the archive passphrase from. Defaults to the value of %s.", EnvBackupPassphrase))
+}
+
+func backupValidate(newBackupFlags *backupFlags) error {
+	err := vaultBackendValidate("backup")
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if newVaultFlags.Token == "" {
+		return microerror.Maskf(invalidConfigError, "Vault token must not be empty")
+	}
+	err = mountpath.ValidateClusterID(newBackupFlags.ClusterID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if newBackupFlags.CAKeySourceFilePath == "" {
+		return microerror.Maskf(invalidConfigError, "--ca-key-source must not be empty")
+	}
+	if newBackupFlags.OutFilePath == "" {
+		return microerror.Maskf(invalidConfigError, "--out-file must not be empty")
+	}
+
+	return nil
+}
+
+func backupRun(cmd *cobra.Command, args []string) {
+	err := backupValidate(newBackupFlags)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	passphrase, err := readBackupPassphrase(newBackupFlags.PassphraseFilePath)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// The private key of the root CA is taken from the earlier archive. It
+	// must belong to the same cluster.
+	var caPrivateKey string
+	{
+		source, err := readArchiveFile(newBackupFlags.CAKeySourceFilePath, passphrase)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+		if source.Header.ClusterID != newBackupFlags.ClusterID {
+			fatal(microerror.Maskf(invalidConfigError, "archive '%s' belongs to cluster ID '%s'", newBackupFlags.CAKeySourceFilePath, source.Header.ClusterID))
+		}
+		caPrivateKey = source.Payload.CA.PrivateKey
+	}
+
+	newBackupService := newBackupServiceFromFlags(newVaultFlags.Address, newVaultFlags.Token, newVaultFlags.Namespace, newVaultFlags.TLS, newVaultFlags.MountPathFormat)
+
+	backupConfig := backup.BackupConfig{
+		ClusterID:    newBackupFlags.ClusterID,
+		CAPrivateKey: caPrivateKey,
+	}
+	archive, err := newBackupService.BackupWithContext(ctx, backupConfig)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	err = writeArchiveFile(newBackupFlags.OutFilePath, archive, passphrase)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	fmt.Printf("Backed up PKI backend for cluster ID '%s' to '%s':\n", newBackupFlags.ClusterID, newBackupFlags.OutFilePath)
+	fmt.Printf("\n")
+	fmt.Printf("    - root CA including its private key\n")
+	fmt.Printf("    - %d role(s)\n", len(archive.Payload.Roles))
+	fmt.Printf("    - %d policy(ies)\n", len(archive.Payload.Policies))
+	fmt.Printf("    - mount settings\n")
+	fmt.Printf("\n")
+}
+
+// newBackupServiceFromFlags wires up a backup service and all its
+// dependencies from the given flag values.
+func newBackupServiceFromFlags(address, vaultToken, namespace string, tlsConfig *vaultclient.TLSConfig, mountPathFormat string) backup.Service {
+	// Create a mount path scheme shared by all services.
+	newMountPathSchemeConfig := mountpath.DefaultConfig()
+	newMountPathSchemeConfig.Format = mountPathFormat
+	newMountPathScheme, err := mountpath.New(newMountPathSchemeConfig)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// Create a Vault client factory.
+	newVaultFactoryConfig := vaultfactory.DefaultConfig()
+	newVaultFactoryConfig.Logger = logger
+	newVaultFactoryConfig.Addresses = vaultAddresses(address)
+	newVaultFactoryConfig.AdminToken = vaultToken
+	newVaultFactoryConfig.TLS = tlsConfig
+	newVaultFactoryConfig.Namespace = namespace
+	newVaultFactory, err := vaultfactory.New(newVaultFactoryConfig)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// Create a Vault client and configure it with the provided admin token
+	// through the factory.
+	newVaultClient, err := newVaultFactory.NewClient()
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	var pkiService pki.Service
+	{
+		pkiConfig := pki.DefaultServiceConfig()
+		pkiConfig.Logger = logger
+		pkiConfig.MountPathScheme = newMountPathScheme
+		pkiConfig.VaultClient = newVaultClient
+		pkiService, err = pki.NewService(pkiConfig)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+	}
+
+	var tokenService token.Service
+	{
+		tokenConfig := token.DefaultServiceConfig()
+		tokenConfig.Logger = logger
+		tokenConfig.MountPathScheme = newMountPathScheme
+		tokenConfig.VaultClient = newVaultClient
+		tokenService, err = token.NewService(tokenConfig)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+	}
+
+	var backupService backup.Service
+	{
+		backupConfig := backup.DefaultConfig()
+		backupConfig.Logger = logger
+		backupConfig.PKIService = pkiService
+		backupConfig.TokenService = tokenService
+		backupConfig.VaultClient = newVaultClient
+		backupService, err = backup.New(backupConfig)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+	}
+
+	return backupService
+}
+
+// readBackupPassphrase reads the archive passphrase from the file at path, or
+// from the environment in case path is empty. A trailing newline is ignored.
+func readBackupPassphrase(path string) ([]byte, error) {
+	var passphrase string
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+		passphrase = strings.TrimRight(string(b), "\r\n")
+	} else {
+		passphrase = os.Getenv(EnvBackupPassphrase)
+	}
+
+	if passphrase == "" {
+		return nil, microerror.Maskf(invalidConfigError, "backup passphrase must not be empty, use --backup-passphrase-file or %s", EnvBackupPassphrase)
+	}
+
+	return []byte(passphrase), nil
+}
+
+// readArchiveFile reads and decrypts the archive at path.
+func readArchiveFile(path string, passphrase []byte) (backup.Archive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return backup.Archive{}, microerror.Mask(err)
+	}
+	defer f.Close()
+
+	archive, err := backup.ReadArchive(f, passphrase)
+	if err != nil {
+		return backup.Archive{}, microerror.Mask(err)
+	}
+
+	return archive, nil
+}
+
+// writeArchiveFile encrypts the given archive and writes it to path, only
+// readable and writable by the current user. The archive is written to a
+// temporary file first, so that an existing archive at path is only replaced
+// by a complete one.
+func writeArchiveFile(path string, archive backup.Archive, passphrase []byte) error {
+	var buf bytes.Buffer
+	err := backup.WriteArchive(&buf, archive, passphrase)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	tmpPath := path + ".tmp"
+	err = writeSecretFile(tmpPath, buf.Bytes())
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/spf13/cobra"
+
+	mountpath "github.com/giantswarm/certctl/v2/service/mount-path"
+	"github.com/giantswarm/certctl/v2/service/pki"
+	vaultfactory "github.com/giantswarm/certctl/v2/service/vault-factory"
+)
+
+const (
+	certStatusExpired = "expired"
+	certStatusRevoked = "revoked"
+	certStatusValid   = "valid"
+)
+
+type certsListFlags struct {
+	// Cluster
+	ClusterID string
+
+	// Filter
+	CommonName     string
+	ExpiringWithin time.Duration
+
+	// Output
+	Output string
+}
+
+// certListItem is the representation of a certificate as printed by certs
+// list.
+type certListItem struct {
+	pki.Certificate
+	Status string `json:"status"`
+}
+
+var (
+	certsCmd = &cobra.Command{
+		Use:   "certs",
+		Short: "Manage the certificates issued for a specific cluster.",
+		Run:   cliRun,
+	}
+
+	certsListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the certificates issued for a specific cluster including their expiry and revocation status.",
+		Run:   certsListRun,
+	}
+
+	newCertsListFlags = &certsListFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(certsCmd)
+	certsCmd.AddCommand(certsListCmd)
+
+	certsListCmd.Flags().StringVar(&newCertsListFlags.ClusterID, "cluster-id", "", "Cluster ID to list the issued certificates of.")
+
+	certsListCmd.Flags().StringVar(&newCertsListFlags.CommonName, "common-name", "", "Only list certificates whose common name matches this shell pattern, e.g. '*.giantswarm.io'.")
+	certsListCmd.Flags().DurationVar(&newCertsListFlags.ExpiringWithin, "expiring-within", 0, "Only list certificates expiring within this duration, including already expired ones, e.g. '720h'. (Default 0, no filter)")
+
+	certsListCmd.Flags().StringVar(&newCertsListFlags.Output, "output", OutputText, "Output format, either 'text' or 'json'.")
+}
+
+func certsListValidate(newCertsListFlags *certsListFlags) error {
+	err := vaultBackendValidate("certs list")
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if newVaultFlags.Token == "" {
+		return microerror.Maskf(invalidConfigError, "Vault token must not be empty")
+	}
+	err = mountpath.ValidateClusterID(newCertsListFlags.ClusterID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if newCertsListFlags.ExpiringWithin < 0 {
+		return microerror.Maskf(invalidConfigError, "--expiring-within must not be negative")
+	}
+	if newCertsListFlags.CommonName != "" {
+		_, err := path.Match(newCertsListFlags.CommonName, "")
+		if err != nil {
+			return microerror.Maskf(invalidConfigError, "--common-name must be a valid pattern: %s", err)
+		}
+	}
+	err = outputValidate(newCertsListFlags.Output)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func certsListRun(cmd *cobra.Command, args []string) {
+	err := certsListValidate(newCertsListFlags)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	// Create a mount path scheme shared by all services.
+	newMountPathSchemeConfig := mountpath.DefaultConfig()
+	newMountPathSchemeConfig.Format = newVaultFlags.MountPathFormat
+	newMountPathScheme, err := mountpath.New(newMountPathSchemeConfig)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// Create a Vault client factory.
+	newVaultFactoryConfig := vaultfactory.DefaultConfig()
+	newVaultFactoryConfig.Logger = logger
+	newVaultFactoryConfig.Addresses = vaultAddresses(newVaultFlags.Address)
+	newVaultFactoryConfig.AdminToken = newVaultFlags.Token
+	newVaultFactoryConfig.TLS = newVaultFlags.TLS
+	newVaultFactoryConfig.Namespace = newVaultFlags.Namespace
+	newVaultFactory, err := vaultfactory.New(newVaultFactoryConfig)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// Create a Vault client and configure it with the provided admin token
+	// through the factory.
+	newVaultClient, err := newVaultFactory.NewClient()
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// Create a PKI controller to look up the issued certificates.
+	var pkiService pki.Service
+	{
+		pkiConfig := pki.DefaultServiceConfig()
+		pkiConfig.Logger = logger
+		pkiConfig.MountPathScheme = newMountPathScheme
+		pkiConfig.VaultClient = newVaultClient
+		pkiService, err = pki.NewService(pkiConfig)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+	}
+
+	serialNumbers, err := pkiService.ListCertificatesWithContext(ctx, newCertsListFlags.ClusterID)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	now := time.Now()
+	var deadline time.Time
+	if newCertsListFlags.ExpiringWithin > 0 {
+		deadline = now.Add(newCertsListFlags.ExpiringWithin)
+	}
+
+	items := []certListItem{}
+	for _, serialNumber := range serialNumbers {
+		crt, err := pkiService.CertificateWithContext(ctx, newCertsListFlags.ClusterID, serialNumber)
+		if pki.IsCertificateNotFound(err) {
+			// The certificate may have been tidied in the meantime.
+			continue
+		} else if err != nil {
+			fatal(microerror.Mask(err))
+		}
+
+		// The root CA is stored along with the issued certificates, but is
+		// shown by inspect.
+		if crt.IsCA {
+			continue
+		}
+		if !deadline.IsZero() && crt.NotAfter.After(deadline) {
+			continue
+		}
+		if newCertsListFlags.CommonName != "" {
+			matched, _ := path.Match(newCertsListFlags.CommonName, crt.CommonName)
+			if !matched {
+				continue
+			}
+		}
+
+		item := certListItem{
+			Certificate: crt,
+			Status:      certStatusValid,
+		}
+		if crt.RevocationTime != nil {
+			item.Status = certStatusRevoked
+		} else if crt.NotAfter.Before(now) {
+			item.Status = certStatusExpired
+		}
+
+		items = append(items, item)
+	}
+
+	// Certificates expiring first are listed first.
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].NotAfter.Before(items[j].NotAfter)
+	})
+
+	if newCertsListFlags.Output == OutputJSON {
+		err = printJSON(items)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "SERIAL\tCOMMON NAME\tSANS\tORGANIZATIONS\tEXPIRY\tSTATUS\n")
+	for _, item := range items {
+		var sans []string
+		sans = append(sans, item.DNSNames...)
+		sans = append(sans, item.IPAddresses...)
+		sans = append(sans, item.URIs...)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", item.SerialNumber, item.CommonName, orDash(strings.Join(sans, ",")), orDash(strings.Join(item.Organizations, ",")), item.NotAfter.UTC().Format(time.RFC3339), item.Status)
+	}
+	err = w.Flush()
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+}
+
+// orDash returns s, or "-" in case s is empty, to keep table columns aligned.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
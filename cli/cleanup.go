@@ -1,26 +1,33 @@
 package cli
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
-	"log"
+	"strings"
+	"time"
 
 	"github.com/giantswarm/microerror"
-	vaultclient "github.com/hashicorp/vault/api"
 	"github.com/spf13/cobra"
 
+	mountpath "github.com/giantswarm/certctl/v2/service/mount-path"
 	"github.com/giantswarm/certctl/v2/service/pki"
 	"github.com/giantswarm/certctl/v2/service/token"
-	vaultfactory "github.com/giantswarm/certctl/v2/service/vault-factory"
 )
 
 type cleanupFlags struct {
-	// Vault
-	VaultAddress string
-	VaultToken   string
-	VaultTLS     *vaultclient.TLSConfig
-
 	// Cluster
 	ClusterID string
+
+	// Backup
+	BackupFilePath     string
+	BackupMaxAge       time.Duration
+	Force              bool
+	PassphraseFilePath string
+
+	// Plan
+	DryRun bool
+	Yes    bool
 }
 
 var (
@@ -30,32 +37,34 @@ var (
 		Run:   cleanupRun,
 	}
 
-	newCleanupFlags = &cleanupFlags{
-		VaultTLS: &vaultclient.TLSConfig{},
-	}
+	newCleanupFlags = &cleanupFlags{}
 )
 
 func init() {
 	CLICmd.AddCommand(cleanupCmd)
 
-	cleanupCmd.Flags().StringVar(&newCleanupFlags.VaultAddress, "vault-addr", fromEnvToString(EnvVaultAddress, "http://127.0.0.1:8200"), "Address used to connect to Vault.")
-	cleanupCmd.Flags().StringVar(&newCleanupFlags.VaultToken, "vault-token", fromEnvToString(EnvVaultToken, ""), "Token used to authenticate against Vault.")
-	cleanupCmd.Flags().StringVar(&newCleanupFlags.VaultTLS.CACert, "vault-cacert", fromEnvToString(EnvVaultCACert, ""), "The path to a PEM-encoded CA cert file to use to verify the Vault server SSL certificate.")
-	cleanupCmd.Flags().StringVar(&newCleanupFlags.VaultTLS.CAPath, "vault-capath", fromEnvToString(EnvVaultCAPath, ""), "The path to a directory of PEM-encoded CA cert files to verify the Vault server SSL certificate.")
-	cleanupCmd.Flags().StringVar(&newCleanupFlags.VaultTLS.ClientCert, "vault-client-cert", fromEnvToString(EnvVaultClientCert, ""), "The path to the certificate for Vault communication.")
-	cleanupCmd.Flags().StringVar(&newCleanupFlags.VaultTLS.ClientKey, "vault-client-key", fromEnvToString(EnvVaultClientKey, ""), "The path to the private key for Vault communication.")
-	cleanupCmd.Flags().StringVar(&newCleanupFlags.VaultTLS.TLSServerName, "vault-tls-server-name", fromEnvToString(EnvVaultTLSServerName, ""), "If set, is used to set the SNI host when connecting via TLS.")
-	cleanupCmd.Flags().BoolVar(&newCleanupFlags.VaultTLS.Insecure, "vault-tls-skip-verify", fromEnvBool(EnvVaultInsecure, false), "Do not verify TLS certificate.")
-
 	cleanupCmd.Flags().StringVar(&newCleanupFlags.ClusterID, "cluster-id", "", "Cluster ID used to generate a new root CA for.")
+
+	cleanupCmd.Flags().StringVar(&newCleanupFlags.BackupFilePath, "backup-file", "", "Backup archive of the cluster's PKI backend, as written by setup or backup. Cleanup refuses to delete a PKI backend without a recent backup unless --force is given.")
+	cleanupCmd.Flags().DurationVar(&newCleanupFlags.BackupMaxAge, "backup-max-age", 24*time.Hour, "Maximum age of the backup archive given with --backup-file.")
+	cleanupCmd.Flags().StringVar(&newCleanupFlags.PassphraseFilePath, "backup-passphrase-file", "", fmt.Sprintf("File path used to read the passphrase of the archive given with --backup-file from. Defaults to the value of %s.", EnvBackupPassphrase))
+	cleanupCmd.Flags().BoolVar(&newCleanupFlags.Force, "force", false, "Delete the PKI backend even without a recent backup, irrecoverably losing its root CA. (Default false)")
+
+	cleanupCmd.Flags().BoolVar(&newCleanupFlags.DryRun, "dry-run", false, "Only print the actions cleanup would take without changing anything. (Default false)")
+	cleanupCmd.Flags().BoolVar(&newCleanupFlags.Yes, "yes", false, "Do not ask for confirmation before irrecoverably deleting the cluster's PKI backend. Required when stdin is not a terminal. (Default false)")
 }
 
 func cleanupValidate(newCleanupFlags *cleanupFlags) error {
-	if newCleanupFlags.VaultToken == "" {
-		return microerror.Maskf(invalidConfigError, "Vault token must not be empty")
+	err := backendValidate()
+	if err != nil {
+		return microerror.Mask(err)
 	}
-	if newCleanupFlags.ClusterID == "" {
-		return microerror.Maskf(invalidConfigError, "cluster ID must not be empty")
+	if backend == BackendLocal && newCleanupFlags.BackupFilePath != "" {
+		return microerror.Maskf(notSupportedError, "--backup-file is only supported by --backend %s", BackendVault)
+	}
+	err = mountpath.ValidateClusterID(newCleanupFlags.ClusterID)
+	if err != nil {
+		return microerror.Mask(err)
 	}
 
 	return nil
@@ -64,68 +73,77 @@ func cleanupValidate(newCleanupFlags *cleanupFlags) error {
 func cleanupRun(cmd *cobra.Command, args []string) {
 	err := cleanupValidate(newCleanupFlags)
 	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
+		fatal(microerror.Mask(err))
 	}
 
-	// Create a Vault client factory.
-	newVaultFactoryConfig := vaultfactory.DefaultConfig()
-	newVaultFactoryConfig.Address = newCleanupFlags.VaultAddress
-	newVaultFactoryConfig.AdminToken = newCleanupFlags.VaultToken
-	newVaultFactoryConfig.TLS = newCleanupFlags.VaultTLS
-	newVaultFactory, err := vaultfactory.New(newVaultFactoryConfig)
-	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
-	}
+	ctx, cancel := newContext()
+	defer cancel()
 
-	// Create a Vault client and configure it with the provided admin token
-	// through the factory.
-	newVaultClient, err := newVaultFactory.NewClient()
+	// Create the services of the selected backend. The local backend has no
+	// policies, so tokenService is nil then.
+	pkiService, tokenService, _ := newPKIServiceFromFlags()
+
+	// Compute the actions necessary to clean up the cluster. In case of a dry
+	// run, they are only printed.
+	actions, err := cleanupPlan(ctx, pkiService, tokenService, newCleanupFlags.ClusterID)
 	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
+		fatal(microerror.Mask(err))
+	}
+	printPlan(newCleanupFlags.ClusterID, actions)
+	if newCleanupFlags.DryRun {
+		fmt.Printf("Dry run, no changes have been made.\n")
+		return
+	}
+	if len(actions) == 0 {
+		return
 	}
 
-	// Create a PKI controller to cleanup PKI backend specific operations.
-	var pkiService pki.Service
-	{
-		pkiConfig := pki.DefaultServiceConfig()
-		pkiConfig.VaultClient = newVaultClient
-		pkiService, err = pki.NewService(pkiConfig)
+	// Deleting the PKI backend destroys the root CA, so there has to be a
+	// recent backup to restore it from.
+	if !newCleanupFlags.Force {
+		mounted, err := pkiService.IsMountedWithContext(ctx, newCleanupFlags.ClusterID)
 		if err != nil {
-			log.Fatalf("%#v\n", microerror.Mask(err))
+			fatal(microerror.Mask(err))
+		}
+		if mounted {
+			err = cleanupCheckBackup(ctx, pkiService, newCleanupFlags)
+			if err != nil {
+				fatal(microerror.Mask(err))
+			}
 		}
 	}
 
-	// Create a token generator to cleanup token specific operations.
-	var tokenService token.Service
-	{
-		tokenConfig := token.DefaultServiceConfig()
-		tokenConfig.VaultClient = newVaultClient
-		tokenService, err = token.NewService(tokenConfig)
+	// Deleting the PKI backend destroys the root CA, so a typo in the cluster
+	// ID must not be enough to do so.
+	if !newCleanupFlags.Yes {
+		err = confirm(newCleanupFlags.ClusterID)
 		if err != nil {
-			log.Fatalf("%#v\n", microerror.Mask(err))
+			fatal(microerror.Mask(err))
 		}
 	}
 
-	err = pkiService.Delete(newCleanupFlags.ClusterID)
+	err = pkiService.DeleteWithContext(ctx, newCleanupFlags.ClusterID)
 	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
+		fatal(microerror.Mask(err))
 	}
-	err = tokenService.DeleteOrgPolicy(newCleanupFlags.ClusterID)
-	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
-	}
-	err = tokenService.DeletePolicy(newCleanupFlags.ClusterID)
-	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
+	if tokenService != nil {
+		err = tokenService.DeleteOrgPolicyWithContext(ctx, newCleanupFlags.ClusterID)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+		err = tokenService.DeletePolicyWithContext(ctx, newCleanupFlags.ClusterID)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
 	}
 
 	fmt.Printf("Cleaning up cluster for ID '%s':\n", newCleanupFlags.ClusterID)
 	fmt.Printf("\n")
-	fmt.Printf("    - PKI backend unmounted\n")
-	fmt.Printf("    - Root CA deleted\n")
-	fmt.Printf("    - PKI role deleted\n")
-	fmt.Printf("    - PKI policy deleted\n")
+	printDone(actions)
 	fmt.Printf("\n")
+	if tokenService == nil {
+		return
+	}
 	fmt.Printf("Tokens may have been generated for this cluster. Created tokens\n")
 	fmt.Printf("cannot be revoked here as they are secret. Tokens need to be\n")
 	fmt.Printf("revoked manually. In case a cluster with the same ID will be\n")
@@ -134,3 +152,100 @@ func cleanupRun(cmd *cobra.Command, args []string) {
 	fmt.Printf("needs to be looked up directly from the location of the cluster's\n")
 	fmt.Printf("installation.\n")
 }
+
+// cleanupCheckBackup ensures the backup archive given by the flags belongs to
+// the cluster being cleaned up, is not older than allowed and holds the
+// current root CA of the cluster. The archive is decrypted, so that neither a
+// modified header nor a wrong passphrase go unnoticed until the archive is
+// needed for restoring.
+func cleanupCheckBackup(ctx context.Context, pkiService pki.Service, newCleanupFlags *cleanupFlags) error {
+	// The local backend has no backups, so its root CAs are only deleted
+	// with --force.
+	if backend == BackendLocal {
+		return microerror.Maskf(invalidConfigError, "refusing to delete the local CA of cluster ID '%s' as --backend %s has no backups, use --force", newCleanupFlags.ClusterID, BackendLocal)
+	}
+
+	if newCleanupFlags.BackupFilePath == "" {
+		return microerror.Maskf(invalidConfigError, "refusing to delete the PKI backend of cluster ID '%s' without a backup, use --backup-file or --force", newCleanupFlags.ClusterID)
+	}
+
+	passphrase, err := readBackupPassphrase(newCleanupFlags.PassphraseFilePath)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	archive, err := readArchiveFile(newCleanupFlags.BackupFilePath, passphrase)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	header := archive.Header
+	if header.ClusterID != newCleanupFlags.ClusterID {
+		return microerror.Maskf(invalidConfigError, "backup archive '%s' belongs to cluster ID '%s'", newCleanupFlags.BackupFilePath, header.ClusterID)
+	}
+	if age := time.Since(header.CreatedAt); age > newCleanupFlags.BackupMaxAge {
+		return microerror.Maskf(invalidConfigError, "backup archive '%s' is %s old, which exceeds --backup-max-age %s", newCleanupFlags.BackupFilePath, age.Round(time.Second), newCleanupFlags.BackupMaxAge)
+	}
+
+	// Restoring an archive of a previous root CA, e.g. taken before the
+	// cluster was cleaned up and set up again, would not bring back the root
+	// CA being deleted now.
+	ca, err := pkiService.CAWithContext(ctx, newCleanupFlags.ClusterID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if strings.TrimSpace(archive.Payload.CA.Certificate) != strings.TrimSpace(ca.Certificate) {
+		return microerror.Maskf(invalidConfigError, "backup archive '%s' does not hold the current root CA of cluster ID '%s'", newCleanupFlags.BackupFilePath, newCleanupFlags.ClusterID)
+	}
+	_, err = tls.X509KeyPair([]byte(archive.Payload.CA.Certificate), []byte(archive.Payload.CA.PrivateKey))
+	if err != nil {
+		return microerror.Maskf(invalidConfigError, "backup archive '%s' holds a private key not matching the root CA of cluster ID '%s'", newCleanupFlags.BackupFilePath, newCleanupFlags.ClusterID)
+	}
+
+	return nil
+}
+
+// cleanupPlan computes the actions cleanup takes for the given cluster ID,
+// based on what is set up in Vault.
+func cleanupPlan(ctx context.Context, pkiService pki.Service, tokenService token.Service, clusterID string) ([]planAction, error) {
+	var actions []planAction
+
+	mounted, err := pkiService.IsMountedWithContext(ctx, clusterID)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	if mounted {
+		actions = append(actions, planAction{
+			Plan: fmt.Sprintf("Unmount PKI backend at '%s', irrecoverably deleting its root CA and PKI roles", pkiService.MountPKIPath(clusterID)),
+			Done: "PKI backend unmounted, root CA and PKI roles deleted",
+		})
+	}
+
+	// The local backend has no policies.
+	if tokenService == nil {
+		return actions, nil
+	}
+
+	orgPolicyCreated, err := tokenService.IsOrgPolicyCreatedWithContext(ctx, clusterID)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	if orgPolicyCreated {
+		actions = append(actions, planAction{
+			Plan: fmt.Sprintf("Delete PKI org policy '%s'", tokenService.OrgPolicyName(clusterID)),
+			Done: "PKI org policy deleted",
+		})
+	}
+
+	policyCreated, err := tokenService.IsPolicyCreatedWithContext(ctx, clusterID)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	if policyCreated {
+		actions = append(actions, planAction{
+			Plan: fmt.Sprintf("Delete PKI policy '%s'", tokenService.PolicyName(clusterID)),
+			Done: "PKI policy deleted",
+		})
+	}
+
+	return actions, nil
+}
@@ -1,9 +1,21 @@
 package cli
 
 import (
+	"context"
+	"fmt"
+	"log"
 	"os"
+	"time"
 
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+	vaultclient "github.com/hashicorp/vault/api"
 	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/v2/service/exitcode"
+	"github.com/giantswarm/certctl/v2/service/metrics"
+	mountpath "github.com/giantswarm/certctl/v2/service/mount-path"
+	"github.com/giantswarm/certctl/v2/service/retry"
 )
 
 var (
@@ -12,10 +24,144 @@ var (
 		Short: "A command line tool able to request certificate generation from Vault to write certificate files to the local filesystem.",
 
 		Run: cliRun,
+
+		PersistentPreRun:  cliPersistentPreRun,
+		PersistentPostRun: cliPersistentPostRun,
+	}
+
+	// logger is used by all commands and the services they create. It is
+	// configured by --log-level and --log-format before any command runs.
+	logger micrologger.Logger
+
+	logLevel  string
+	logFormat string
+
+	// configPath and profileName select the configuration file and the
+	// profile in it flags default to.
+	configPath  string
+	profileName string
+
+	// newVaultFlags holds the flags shared by all commands talking to Vault.
+	newVaultFlags = &vaultFlags{
+		TLS: &vaultclient.TLSConfig{},
 	}
+
+	// metricsTextfile is the path the metrics of a command are written to
+	// when it exits, if set.
+	metricsTextfile string
+
+	// timeout bounds the time each command takes as a whole, including all
+	// requests to Vault. Zero means no timeout.
+	timeout time.Duration
+
+	// retryConfig configures retries of operations which are safe to be
+	// retried, like issuing certificates.
+	retryConfig = retry.DefaultConfig()
 )
 
+// vaultFlags configures the connection to Vault and the scheme PKI backends
+// are mounted with.
+type vaultFlags struct {
+	Address         string
+	Namespace       string
+	Token           string
+	TLS             *vaultclient.TLSConfig
+	MountPathFormat string
+}
+
+func init() {
+	CLICmd.PersistentFlags().StringVar(&configPath, "config", "", fmt.Sprintf("Path of the configuration file holding the profiles flags default to. Defaults to '%s' in the user's configuration directory.", defaultConfigPath))
+	CLICmd.PersistentFlags().StringVar(&profileName, "profile", "", "Name of the profile in the configuration file flags default to. Defaults to the profile named by the configuration file, if any.")
+
+	CLICmd.PersistentFlags().StringVar(&newVaultFlags.Address, "vault-addr", fromEnvToString(EnvVaultAddress, "http://127.0.0.1:8200"), "Address used to connect to Vault. Comma separate multiple addresses to fail over between them in the given order.")
+	CLICmd.PersistentFlags().StringVar(&newVaultFlags.Token, "vault-token", fromEnvToString(EnvVaultToken, ""), "Token used to authenticate against Vault.")
+	CLICmd.PersistentFlags().StringVar(&newVaultFlags.TLS.CACert, "vault-cacert", fromEnvToString(EnvVaultCACert, ""), "The path to a PEM-encoded CA cert file to use to verify the Vault server SSL certificate.")
+	CLICmd.PersistentFlags().StringVar(&newVaultFlags.TLS.CAPath, "vault-capath", fromEnvToString(EnvVaultCAPath, ""), "The path to a directory of PEM-encoded CA cert files to verify the Vault server SSL certificate.")
+	CLICmd.PersistentFlags().StringVar(&newVaultFlags.TLS.ClientCert, "vault-client-cert", fromEnvToString(EnvVaultClientCert, ""), "The path to the certificate for Vault communication.")
+	CLICmd.PersistentFlags().StringVar(&newVaultFlags.TLS.ClientKey, "vault-client-key", fromEnvToString(EnvVaultClientKey, ""), "The path to the private key for Vault communication.")
+	CLICmd.PersistentFlags().StringVar(&newVaultFlags.TLS.TLSServerName, "vault-tls-server-name", fromEnvToString(EnvVaultTLSServerName, ""), "If set, is used to set the SNI host when connecting via TLS.")
+	CLICmd.PersistentFlags().BoolVar(&newVaultFlags.TLS.Insecure, "vault-tls-skip-verify", fromEnvBool(EnvVaultInsecure, false), "Do not verify TLS certificate.")
+	CLICmd.PersistentFlags().StringVar(&newVaultFlags.Namespace, "vault-namespace", fromEnvToString(EnvVaultNamespace, ""), "Vault Enterprise namespace used for all requests. Defaults to the root namespace.")
+	CLICmd.PersistentFlags().StringVar(&newVaultFlags.MountPathFormat, "mount-path-format", mountpath.DefaultFormat, "Go template used to name the PKI backend mount of a cluster, e.g. 'clusters/{{.ClusterID}}/pki'.")
+
+	CLICmd.PersistentFlags().IntVar(&retryConfig.MaxAttempts, "retry-max-attempts", retryConfig.MaxAttempts, fmt.Sprintf("Maximum number of attempts of operations safe to be retried, like setup, issue and revoke, in case Vault is temporarily unavailable. 1 disables retries. Defaults to the value of %s.", EnvRetryMaxAttempts))
+	CLICmd.PersistentFlags().DurationVar(&retryConfig.MaxInterval, "retry-max-interval", retryConfig.MaxInterval, "Maximum time to wait between retries, which start at 500ms and grow exponentially with jitter.")
+	CLICmd.PersistentFlags().StringVar(&logLevel, "log-level", LogLevelInfo, fmt.Sprintf("Minimum level of log messages written to stderr, one of '%s', '%s', '%s' or '%s'. Stack traces of errors are logged at '%s'. Defaults to the value of %s.", LogLevelDebug, LogLevelInfo, LogLevelWarning, LogLevelError, LogLevelDebug, EnvLogLevel))
+	CLICmd.PersistentFlags().StringVar(&logFormat, "log-format", LogFormatText, fmt.Sprintf("Format of log messages, either '%s' or '%s'. Defaults to the value of %s.", LogFormatText, LogFormatJSON, EnvLogFormat))
+	CLICmd.PersistentFlags().StringVar(&metricsTextfile, "metrics-textfile", "", fmt.Sprintf("Path metrics are written to when the command exits, to be collected by the node-exporter's textfile collector, e.g. '/var/lib/node_exporter/textfile_collector/certctl.prom'. Defaults to the value of %s.", EnvMetricsTextfile))
+	CLICmd.PersistentFlags().DurationVar(&timeout, "timeout", 0, fmt.Sprintf("Maximum duration of the whole command including all requests to Vault, e.g. '30s'. Zero means no timeout. Defaults to the value of %s.", EnvTimeout))
+}
+
 func cliRun(cmd *cobra.Command, args []string) {
 	cmd.HelpFunc()(cmd, nil)
-	os.Exit(1)
+	os.Exit(exitcode.InvalidConfig)
+}
+
+func cliPersistentPreRun(cmd *cobra.Command, args []string) {
+	// Environment variables are bound first, since they may configure
+	// logging and the configuration file.
+	err := bindEnv(cmd.Flags())
+	if err != nil {
+		log.Printf("%s\n", microerror.Pretty(err, false))
+		os.Exit(exitcode.InvalidConfig)
+	}
+
+	logger, err = newLogger(logLevel, logFormat, os.Stderr)
+	if err != nil {
+		log.Printf("%s\n", microerror.Pretty(err, false))
+		os.Exit(exitcode.InvalidConfig)
+	}
+
+	err = bindProfile(cmd.Flags(), configPath, profileName)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+}
+
+func cliPersistentPostRun(cmd *cobra.Command, args []string) {
+	writeMetricsTextfile()
+}
+
+// writeMetricsTextfile writes the metrics collected so far to the file given
+// by --metrics-textfile, if any. Failing to do so does not fail the command,
+// since metrics are not essential to it.
+func writeMetricsTextfile() {
+	if metricsTextfile == "" {
+		return
+	}
+
+	err := metrics.WriteTextfile(metricsTextfile)
+	if err != nil {
+		logger.Log("level", "warning", "message", "cannot write metrics textfile", "error", microerror.Pretty(err, false))
+	}
+}
+
+// newContext returns the context all requests to Vault of a command are made
+// with. It is canceled once --timeout elapsed, so that a hanging Vault fails
+// the command instead of blocking it forever.
+func newContext() (context.Context, context.CancelFunc) {
+	return withTimeout(context.Background())
+}
+
+// withTimeout returns a child of the given context canceled once --timeout
+// elapsed, if set. Long-running commands bound each of their operations
+// this way instead of the whole command.
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// newRetryPolicy returns the retry policy configured by the --retry-* flags.
+func newRetryPolicy() (retry.Policy, error) {
+	newRetryConfig := retryConfig
+	newRetryConfig.Logger = logger
+	newRetryPolicy, err := retry.New(newRetryConfig)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return newRetryPolicy, nil
 }
@@ -0,0 +1,215 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/spf13/cobra"
+
+	mountpath "github.com/giantswarm/certctl/v2/service/mount-path"
+	"github.com/giantswarm/certctl/v2/service/pki"
+	"github.com/giantswarm/certctl/v2/service/token"
+	vaultfactory "github.com/giantswarm/certctl/v2/service/vault-factory"
+)
+
+type clustersListFlags struct {
+	// Filter
+	CAExpiringWithinDays int
+
+	// Output
+	Output string
+}
+
+// clusterListItem is the representation of a cluster as printed by
+// clusters list.
+type clusterListItem struct {
+	ClusterID        string     `json:"cluster_id"`
+	MountPath        string     `json:"mount_path"`
+	Description      string     `json:"description"`
+	CAGenerated      bool       `json:"ca_generated"`
+	CANotAfter       *time.Time `json:"ca_not_after,omitempty"`
+	RoleCount        int        `json:"role_count"`
+	PolicyCreated    bool       `json:"policy_created"`
+	OrgPolicyCreated bool       `json:"org_policy_created"`
+}
+
+var (
+	clustersCmd = &cobra.Command{
+		Use:   "clusters",
+		Short: "Manage the clusters set up in Vault.",
+		Run:   cliRun,
+	}
+
+	clustersListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List all clusters having a Vault PKI backend mounted according to the mount path scheme.",
+		Run:   clustersListRun,
+	}
+
+	newClustersListFlags = &clustersListFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(clustersCmd)
+	clustersCmd.AddCommand(clustersListCmd)
+
+	clustersListCmd.Flags().IntVar(&newClustersListFlags.CAExpiringWithinDays, "ca-expiring-within-days", 0, "Only list clusters whose root CA expires within this number of days. Clusters without root CA always match. (Default 0, no filter)")
+
+	clustersListCmd.Flags().StringVar(&newClustersListFlags.Output, "output", OutputText, "Output format, either 'text' or 'json'.")
+}
+
+func clustersListValidate(newClustersListFlags *clustersListFlags) error {
+	err := vaultBackendValidate("clusters list")
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if newVaultFlags.Token == "" {
+		return microerror.Maskf(invalidConfigError, "Vault token must not be empty")
+	}
+	if newClustersListFlags.CAExpiringWithinDays < 0 {
+		return microerror.Maskf(invalidConfigError, "--ca-expiring-within-days must not be negative")
+	}
+	err = outputValidate(newClustersListFlags.Output)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func clustersListRun(cmd *cobra.Command, args []string) {
+	err := clustersListValidate(newClustersListFlags)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	// Create a mount path scheme shared by all services.
+	newMountPathSchemeConfig := mountpath.DefaultConfig()
+	newMountPathSchemeConfig.Format = newVaultFlags.MountPathFormat
+	newMountPathScheme, err := mountpath.New(newMountPathSchemeConfig)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// Create a Vault client factory.
+	newVaultFactoryConfig := vaultfactory.DefaultConfig()
+	newVaultFactoryConfig.Logger = logger
+	newVaultFactoryConfig.Addresses = vaultAddresses(newVaultFlags.Address)
+	newVaultFactoryConfig.AdminToken = newVaultFlags.Token
+	newVaultFactoryConfig.TLS = newVaultFlags.TLS
+	newVaultFactoryConfig.Namespace = newVaultFlags.Namespace
+	newVaultFactory, err := vaultfactory.New(newVaultFactoryConfig)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// Create a Vault client and configure it with the provided admin token
+	// through the factory.
+	newVaultClient, err := newVaultFactory.NewClient()
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// Create a PKI controller to look up the PKI backends.
+	var pkiService pki.Service
+	{
+		pkiConfig := pki.DefaultServiceConfig()
+		pkiConfig.Logger = logger
+		pkiConfig.MountPathScheme = newMountPathScheme
+		pkiConfig.VaultClient = newVaultClient
+		pkiService, err = pki.NewService(pkiConfig)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+	}
+
+	// Create a token generator to look up the policies.
+	var tokenService token.Service
+	{
+		tokenConfig := token.DefaultServiceConfig()
+		tokenConfig.Logger = logger
+		tokenConfig.MountPathScheme = newMountPathScheme
+		tokenConfig.VaultClient = newVaultClient
+		tokenService, err = token.NewService(tokenConfig)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+	}
+
+	mounts, err := pkiService.ListWithContext(ctx)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	var deadline time.Time
+	if newClustersListFlags.CAExpiringWithinDays > 0 {
+		deadline = time.Now().AddDate(0, 0, newClustersListFlags.CAExpiringWithinDays)
+	}
+
+	items := []clusterListItem{}
+	for _, m := range mounts {
+		item := clusterListItem{
+			ClusterID:   m.ClusterID,
+			MountPath:   m.Path,
+			Description: m.Description,
+		}
+
+		ca, err := pkiService.CAWithContext(ctx, m.ClusterID)
+		if err != nil && !pki.IsCANotFound(err) {
+			fatal(microerror.Mask(err))
+		}
+		if err == nil {
+			item.CAGenerated = true
+			item.CANotAfter = &ca.NotAfter
+		}
+
+		if !deadline.IsZero() && item.CAGenerated && ca.NotAfter.After(deadline) {
+			continue
+		}
+
+		roles, err := pkiService.ListRolesWithContext(ctx, m.ClusterID)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+		item.RoleCount = len(roles)
+
+		item.PolicyCreated, err = tokenService.IsPolicyCreatedWithContext(ctx, m.ClusterID)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+		item.OrgPolicyCreated, err = tokenService.IsOrgPolicyCreatedWithContext(ctx, m.ClusterID)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+
+		items = append(items, item)
+	}
+
+	if newClustersListFlags.Output == OutputJSON {
+		err = printJSON(items)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "CLUSTER ID\tMOUNT PATH\tCA EXPIRY\tROLES\tPOLICY\tORG POLICY\tDESCRIPTION\n")
+	for _, item := range items {
+		expiry := "-"
+		if item.CANotAfter != nil {
+			expiry = item.CANotAfter.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%t\t%t\t%s\n", item.ClusterID, item.MountPath, expiry, item.RoleCount, item.PolicyCreated, item.OrgPolicyCreated, item.Description)
+	}
+	err = w.Flush()
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+}
@@ -3,16 +3,31 @@ package cli
 import (
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+
+	"github.com/giantswarm/certctl/v2/service/exitcode"
 )
 
 const (
+	EnvBackupPassphrase = "CERTCTL_BACKUP_PASSPHRASE"
+	EnvLocalPassphrase  = "CERTCTL_LOCAL_PASSPHRASE"
+	EnvLogFormat        = "CERTCTL_LOG_FORMAT"
+	EnvLogLevel         = "CERTCTL_LOG_LEVEL"
+	EnvMetricsTextfile  = "CERTCTL_METRICS_TEXTFILE"
+	EnvRetryMaxAttempts = "CERTCTL_RETRY_MAX_ATTEMPTS"
+	EnvTimeout          = "CERTCTL_TIMEOUT"
+
 	EnvVaultAddress       = "VAULT_ADDR"
 	EnvVaultCACert        = "VAULT_CACERT"
 	EnvVaultCAPath        = "VAULT_CAPATH"
 	EnvVaultClientCert    = "VAULT_CLIENT_CERT"
 	EnvVaultClientKey     = "VAULT_CLIENT_KEY"
 	EnvVaultInsecure      = "VAULT_SKIP_VERIFY"
+	EnvVaultNamespace     = "VAULT_NAMESPACE"
 	EnvVaultTLSServerName = "VAULT_TLS_SERVER_NAME"
 	EnvVaultToken         = "VAULT_TOKEN"
 )
@@ -38,3 +53,80 @@ func fromEnvBool(key string, def bool) bool {
 
 	return def
 }
+
+// fatal logs the given error and exits the command with the exit code the
+// error maps to, after writing the metrics textfile, if any.
+func fatal(err error) {
+	logError(logger, err)
+	exit(exitcode.FromError(err))
+}
+
+// exit exits the command with the given exit code, after writing the metrics
+// textfile, if any.
+func exit(code int) {
+	writeMetricsTextfile()
+	os.Exit(code)
+}
+
+// vaultAddresses splits the comma separated Vault addresses given via
+// --vault-addr.
+func vaultAddresses(value string) []string {
+	var addresses []string
+	for _, a := range strings.Split(value, ",") {
+		a = strings.TrimSpace(a)
+		if a != "" {
+			addresses = append(addresses, a)
+		}
+	}
+
+	return addresses
+}
+
+// writeSecretFile writes data to the file at path, only readable and writable
+// by the current user. Existing files are truncated and their permissions are
+// restricted accordingly.
+func writeSecretFile(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), os.FileMode(0744))
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(0600))
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = f.Chmod(os.FileMode(0600))
+	if err != nil {
+		f.Close()
+		return microerror.Mask(err)
+	}
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return microerror.Mask(err)
+	}
+
+	// Errors writing the data may only surface on closing the file, e.g. on
+	// full or network file systems.
+	err = f.Close()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// writeFile writes public data to the file at path, creating its directory if
+// necessary.
+func writeFile(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), os.FileMode(0744))
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	err = os.WriteFile(path, data, os.FileMode(0644))
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,267 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// EnvPrefix prefixes the environment variables every flag can be set
+	// with, e.g. CERTCTL_VAULT_ADDR sets --vault-addr.
+	EnvPrefix = "CERTCTL_"
+
+	// EnvXDGConfigHome overrides the user's configuration directory the
+	// default configuration file is read from.
+	EnvXDGConfigHome = "XDG_CONFIG_HOME"
+)
+
+// defaultConfigPath is the path of the configuration file relative to the
+// user's configuration directory, which is ~/.config unless overridden by
+// XDG_CONFIG_HOME.
+var defaultConfigPath = filepath.Join("certctl", "config.yaml")
+
+// configFile is the format of the configuration file given by --config.
+type configFile struct {
+	// Profile is the name of the profile used unless --profile is given.
+	Profile string `json:"profile"`
+
+	// Profiles holds the named profiles flags default to.
+	Profiles map[string]profile `json:"profiles"`
+}
+
+// profile holds the defaults of the flags configuring the backend, the Vault
+// connection, its authentication and the cluster commands operate on.
+type profile struct {
+	Backend         string       `json:"backend"`
+	ClusterID       string       `json:"clusterID"`
+	Local           profileLocal `json:"local"`
+	MountPathFormat string       `json:"mountPathFormat"`
+	Vault           profileVault `json:"vault"`
+}
+
+type profileLocal struct {
+	Directory      string `json:"directory"`
+	PassphraseFile string `json:"passphraseFile"`
+}
+
+type profileVault struct {
+	Address       string `json:"address"`
+	CACert        string `json:"cacert"`
+	CAPath        string `json:"capath"`
+	ClientCert    string `json:"clientCert"`
+	ClientKey     string `json:"clientKey"`
+	Namespace     string `json:"namespace"`
+	TLSServerName string `json:"tlsServerName"`
+	TLSSkipVerify bool   `json:"tlsSkipVerify"`
+	Token         string `json:"token"`
+}
+
+// flags returns the values of the profile by the names of the flags they
+// are defaults for. Unset values are omitted.
+func (p profile) flags() map[string]string {
+	values := map[string]string{
+		"backend":               p.Backend,
+		"cluster-id":            p.ClusterID,
+		"local-dir":             p.Local.Directory,
+		"local-passphrase-file": p.Local.PassphraseFile,
+		"mount-path-format":     p.MountPathFormat,
+		"vault-addr":            p.Vault.Address,
+		"vault-cacert":          p.Vault.CACert,
+		"vault-capath":          p.Vault.CAPath,
+		"vault-client-cert":     p.Vault.ClientCert,
+		"vault-client-key":      p.Vault.ClientKey,
+		"vault-namespace":       p.Vault.Namespace,
+		"vault-tls-server-name": p.Vault.TLSServerName,
+		"vault-token":           p.Vault.Token,
+	}
+	if p.Vault.TLSSkipVerify {
+		values["vault-tls-skip-verify"] = strconv.FormatBool(p.Vault.TLSSkipVerify)
+	}
+
+	for name, value := range values {
+		if value == "" {
+			delete(values, name)
+		}
+	}
+
+	return values
+}
+
+// flagEnv returns the name of the environment variable the flag with the
+// given name is bound to.
+func flagEnv(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// bindEnv sets all flags not given on the command line from their
+// environment variables, if set.
+func bindEnv(flags *pflag.FlagSet) error {
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || f.Name == "help" {
+			return
+		}
+
+		env := flagEnv(f.Name)
+		value := os.Getenv(env)
+		if value == "" {
+			return
+		}
+
+		setErr := flags.Set(f.Name, value)
+		if setErr != nil {
+			err = microerror.Maskf(invalidConfigError, "cannot parse %s: %s", env, setErr)
+		}
+	})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// bindProfile sets all flags neither given on the command line nor by their
+// environment variables from the selected profile of the configuration file,
+// if any. A missing configuration file is only an error if it was given
+// explicitly.
+func bindProfile(flags *pflag.FlagSet, path, name string) error {
+	explicit := path != ""
+	if !explicit {
+		path = userConfigPath()
+	}
+
+	var config configFile
+	if path != "" {
+		var err error
+		config, err = readConfigFile(path)
+		if errors.Is(err, os.ErrNotExist) && !explicit {
+			path = ""
+		} else if errors.Is(err, os.ErrNotExist) {
+			return microerror.Maskf(invalidConfigError, "configuration file %#q does not exist", path)
+		} else if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+	if path == "" {
+		if name != "" {
+			return microerror.Maskf(invalidConfigError, "profile %#q not found, there is no configuration file", name)
+		}
+
+		return nil
+	}
+
+	if name == "" {
+		name = config.Profile
+	}
+	if name == "" {
+		return nil
+	}
+
+	p, ok := config.Profiles[name]
+	if !ok {
+		return microerror.Maskf(invalidConfigError, "profile %#q not found in configuration file %#q", name, path)
+	}
+
+	// The cluster ID of the profile must not conflict with commands asked to
+	// operate on all clusters.
+	values := p.flags()
+	if all := flags.Lookup("all"); all != nil && all.Value.String() == "true" {
+		delete(values, "cluster-id")
+	}
+
+	names := make([]string, 0, len(values))
+	for n := range values {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		f := flags.Lookup(n)
+		if f == nil || f.Changed {
+			continue
+		}
+
+		err := flags.Set(n, values[n])
+		if err != nil {
+			return microerror.Maskf(invalidConfigError, "cannot parse %s of profile %#q: %s", n, name, err)
+		}
+	}
+
+	logger.Log("level", "debug", "message", fmt.Sprintf("using profile %#q of configuration file %#q", name, path))
+
+	return nil
+}
+
+// readConfigFile reads and parses the configuration file at path. Unknown
+// fields are rejected to surface typos.
+func readConfigFile(path string) (configFile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return configFile{}, microerror.Mask(err)
+	}
+
+	var config configFile
+	err = yaml.UnmarshalStrict(b, &config)
+	if err != nil {
+		return configFile{}, microerror.Maskf(invalidConfigError, "cannot parse configuration file %#q: %s", path, err)
+	}
+
+	// Profiles may hold Vault tokens, so others must not be able to read
+	// them.
+	info, err := os.Stat(path)
+	if err != nil {
+		return configFile{}, microerror.Mask(err)
+	}
+	if info.Mode().Perm()&0077 != 0 && hasToken(config) {
+		logger.Log("level", "warning", "message", fmt.Sprintf("configuration file %#q holds Vault tokens and is accessible by other users, restrict its permissions to 0600", path))
+	}
+
+	return config, nil
+}
+
+func hasToken(config configFile) bool {
+	for _, p := range config.Profiles {
+		if p.Vault.Token != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// userConfigPath returns the path of the configuration file in the user's
+// configuration directory. It is empty in case the home directory is
+// unknown, e.g. for system users.
+func userConfigPath() string {
+	dir := userConfigDir()
+	if dir == "" {
+		return ""
+	}
+
+	return filepath.Join(dir, defaultConfigPath)
+}
+
+// userConfigDir returns the user's configuration directory, which is
+// ~/.config unless overridden by XDG_CONFIG_HOME. Empty is returned in case
+// the user's home directory is unknown.
+func userConfigDir() string {
+	dir := os.Getenv(EnvXDGConfigHome)
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+
+	return dir
+}
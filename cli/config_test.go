@@ -0,0 +1,320 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+// setTestConfigEnv isolates the tests from the environment of the user by
+// unsetting all env vars the flags of newTestConfigFlags read, and pointing
+// the user's configuration directory to a temporary one, which is returned.
+func setTestConfigEnv(t *testing.T, env map[string]string) string {
+	for _, key := range []string{
+		EnvVaultAddress,
+		EnvVaultInsecure,
+		EnvVaultToken,
+		flagEnv("all"),
+		flagEnv("cluster-id"),
+		flagEnv("vault-addr"),
+		flagEnv("vault-tls-skip-verify"),
+		flagEnv("vault-token"),
+	} {
+		t.Setenv(key, "")
+	}
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+
+	dir := t.TempDir()
+	t.Setenv(EnvXDGConfigHome, dir)
+
+	return dir
+}
+
+// newTestConfigFlags creates flags the way commands do, defaulting to the
+// VAULT_ env vars.
+func newTestConfigFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.Bool("all", false, "")
+	flags.String("cluster-id", "", "")
+	flags.String("vault-addr", fromEnvToString(EnvVaultAddress, ""), "")
+	flags.Bool("vault-tls-skip-verify", fromEnvBool(EnvVaultInsecure, false), "")
+	flags.String("vault-token", fromEnvToString(EnvVaultToken, ""), "")
+
+	return flags
+}
+
+func newTestLogger(t *testing.T, w *bytes.Buffer) {
+	previous := logger
+	t.Cleanup(func() { logger = previous })
+
+	var err error
+	logger, err = newLogger(LogLevelDebug, LogFormatText, w)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+}
+
+func Test_bindEnv_bindProfile(t *testing.T) {
+	config := `
+profile: staging
+profiles:
+  staging:
+    clusterID: staging-id
+    vault:
+      address: https://profile.staging:8200
+      tlsSkipVerify: true
+      token: staging-token
+  production:
+    clusterID: production-id
+    vault:
+      address: https://profile.production:8200
+`
+
+	testCases := []struct {
+		name         string
+		args         []string
+		env          map[string]string
+		config       string
+		configPath   string
+		profile      string
+		expected     map[string]string
+		errorMatcher func(error) bool
+	}{
+		{
+			name: "VAULT_ env vars without configuration file",
+			env: map[string]string{
+				EnvVaultAddress: "https://env.vault:8200",
+				EnvVaultToken:   "env-vault-token",
+			},
+			expected: map[string]string{
+				"cluster-id":  "",
+				"vault-addr":  "https://env.vault:8200",
+				"vault-token": "env-vault-token",
+			},
+		},
+		{
+			name: "profile takes precedence over VAULT_ env vars",
+			env: map[string]string{
+				EnvVaultAddress:  "https://env.vault:8200",
+				EnvVaultInsecure: "false",
+			},
+			config: config,
+			expected: map[string]string{
+				"cluster-id":            "staging-id",
+				"vault-addr":            "https://profile.staging:8200",
+				"vault-tls-skip-verify": "true",
+				"vault-token":           "staging-token",
+			},
+		},
+		{
+			name: "CERTCTL_ env vars take precedence over profile",
+			env: map[string]string{
+				EnvVaultAddress:         "https://env.vault:8200",
+				flagEnv("cluster-id"):   "env-id",
+				flagEnv("vault-addr"):   "https://env.certctl:8200",
+				flagEnv("vault-token"):  "",
+				flagEnv("unknown-flag"): "ignored",
+			},
+			config: config,
+			expected: map[string]string{
+				"cluster-id":  "env-id",
+				"vault-addr":  "https://env.certctl:8200",
+				"vault-token": "staging-token",
+			},
+		},
+		{
+			name: "flags take precedence over CERTCTL_ env vars",
+			args: []string{"--cluster-id=flag-id", "--vault-addr=https://flag:8200"},
+			env: map[string]string{
+				flagEnv("cluster-id"): "env-id",
+				flagEnv("vault-addr"): "https://env.certctl:8200",
+			},
+			config: config,
+			expected: map[string]string{
+				"cluster-id":  "flag-id",
+				"vault-addr":  "https://flag:8200",
+				"vault-token": "staging-token",
+			},
+		},
+		{
+			name:    "selected profile takes precedence over the default one",
+			config:  config,
+			profile: "production",
+			expected: map[string]string{
+				"cluster-id":            "production-id",
+				"vault-addr":            "https://profile.production:8200",
+				"vault-tls-skip-verify": "false",
+				"vault-token":           "",
+			},
+		},
+		{
+			name:   "cluster ID of profile is ignored given --all",
+			args:   []string{"--all"},
+			config: config,
+			expected: map[string]string{
+				"cluster-id": "",
+				"vault-addr": "https://profile.staging:8200",
+			},
+		},
+		{
+			name: "cluster ID of profile is ignored given CERTCTL_ALL",
+			env: map[string]string{
+				flagEnv("all"): "true",
+			},
+			config: config,
+			expected: map[string]string{
+				"cluster-id": "",
+				"vault-addr": "https://profile.staging:8200",
+			},
+		},
+		{
+			name:         "unparsable CERTCTL_ env var",
+			env:          map[string]string{flagEnv("vault-tls-skip-verify"): "maybe"},
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name:         "selected profile does not exist",
+			config:       config,
+			profile:      "unknown",
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name:         "selected profile without configuration file",
+			profile:      "staging",
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name:         "given configuration file does not exist",
+			configPath:   "missing.yaml",
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name:         "unknown field in configuration file",
+			config:       "profiles:\n  staging:\n    vault:\n      adress: https://typo:8200\n",
+			errorMatcher: IsInvalidConfig,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := setTestConfigEnv(t, tc.env)
+			newTestLogger(t, &bytes.Buffer{})
+
+			if tc.config != "" {
+				path := filepath.Join(dir, defaultConfigPath)
+				err := os.MkdirAll(filepath.Dir(path), 0700)
+				if err != nil {
+					t.Fatalf("expected no error, got %#v", err)
+				}
+				err = os.WriteFile(path, []byte(tc.config), 0600)
+				if err != nil {
+					t.Fatalf("expected no error, got %#v", err)
+				}
+			}
+			configPath := tc.configPath
+			if configPath != "" {
+				configPath = filepath.Join(dir, configPath)
+			}
+
+			flags := newTestConfigFlags()
+			err := flags.Parse(tc.args)
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+
+			err = bindEnv(flags)
+			if err == nil {
+				err = bindProfile(flags, configPath, tc.profile)
+			}
+
+			switch {
+			case err == nil && tc.errorMatcher == nil:
+				// correct; carry on
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("expected no error, got %#v", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("expected error, got nil")
+			case !tc.errorMatcher(err):
+				t.Fatalf("unexpected error: %#v", err)
+			}
+			if tc.errorMatcher != nil {
+				return
+			}
+
+			for name, expected := range tc.expected {
+				value := flags.Lookup(name).Value.String()
+				if value != expected {
+					t.Fatalf("expected %s %q, got %q", name, expected, value)
+				}
+			}
+		})
+	}
+}
+
+func Test_readConfigFile_Permissions(t *testing.T) {
+	testCases := []struct {
+		name            string
+		config          string
+		perm            os.FileMode
+		expectedWarning bool
+	}{
+		{
+			name:            "token in file accessible by others",
+			config:          "profiles:\n  staging:\n    vault:\n      token: secret\n",
+			perm:            0644,
+			expectedWarning: true,
+		},
+		{
+			name:            "token in file accessible by group",
+			config:          "profiles:\n  staging:\n    vault:\n      token: secret\n",
+			perm:            0640,
+			expectedWarning: true,
+		},
+		{
+			name:            "token in file only accessible by owner",
+			config:          "profiles:\n  staging:\n    vault:\n      token: secret\n",
+			perm:            0600,
+			expectedWarning: false,
+		},
+		{
+			name:            "no token in file accessible by others",
+			config:          "profiles:\n  staging:\n    vault:\n      address: https://vault:8200\n",
+			perm:            0644,
+			expectedWarning: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var w bytes.Buffer
+			newTestLogger(t, &w)
+
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			err := os.WriteFile(path, []byte(tc.config), tc.perm)
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			// The umask may have dropped permissions.
+			err = os.Chmod(path, tc.perm)
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+
+			_, err = readConfigFile(path)
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+
+			warning := strings.Contains(w.String(), "accessible by other users")
+			if warning != tc.expectedWarning {
+				t.Fatalf("expected warning %t, got %t: %s", tc.expectedWarning, warning, w.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/spf13/cobra"
+
+	mountpath "github.com/giantswarm/certctl/v2/service/mount-path"
+	"github.com/giantswarm/certctl/v2/service/pki"
+	vaultfactory "github.com/giantswarm/certctl/v2/service/vault-factory"
+)
+
+type crlFlags struct {
+	// Cluster
+	ClusterID string
+
+	// Configure
+	PKIBaseURL string
+
+	// Fetch
+	OutFilePath string
+	Output      string
+}
+
+var (
+	crlCmd = &cobra.Command{
+		Use:   "crl",
+		Short: "Manage the certificate revocation list of a specific cluster.",
+		Run:   cliRun,
+	}
+
+	crlConfigureCmd = &cobra.Command{
+		Use:   "configure",
+		Short: "Configure the issuing certificate and CRL distribution point URLs embedded into issued certificates.",
+		Run:   crlConfigureRun,
+	}
+
+	crlFetchCmd = &cobra.Command{
+		Use:   "fetch",
+		Short: "Fetch the current CRL and print the revoked serial numbers.",
+		Run:   crlFetchRun,
+	}
+
+	crlRotateCmd = &cobra.Command{
+		Use:   "rotate",
+		Short: "Force Vault to rebuild the CRL, e.g. before it reaches its next update time.",
+		Run:   crlRotateRun,
+	}
+
+	newCRLFlags = &crlFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(crlCmd)
+	crlCmd.AddCommand(crlConfigureCmd)
+	crlCmd.AddCommand(crlFetchCmd)
+	crlCmd.AddCommand(crlRotateCmd)
+
+	crlCmd.PersistentFlags().StringVar(&newCRLFlags.ClusterID, "cluster-id", "", "Cluster ID of the PKI backend whose CRL is managed.")
+
+	crlConfigureCmd.Flags().StringVar(&newCRLFlags.PKIBaseURL, "pki-base-url", "", "Address under which clients reach Vault to fetch the root CA and the CRL, e.g. 'https://vault.example.com:8200'. Defaults to the first address of --vault-addr.")
+
+	crlFetchCmd.Flags().StringVar(&newCRLFlags.OutFilePath, "out-file", "", "If set, file path used to write the PEM encoded CRL to.")
+	crlFetchCmd.Flags().StringVar(&newCRLFlags.Output, "output", OutputText, "Output format, either 'text' or 'json'.")
+}
+
+func crlValidate(newCRLFlags *crlFlags) error {
+	err := vaultBackendValidate("crl")
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if newVaultFlags.Token == "" {
+		return microerror.Maskf(invalidConfigError, "Vault token must not be empty")
+	}
+	err = mountpath.ValidateClusterID(newCRLFlags.ClusterID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	err = outputValidate(newCRLFlags.Output)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func crlConfigureRun(cmd *cobra.Command, args []string) {
+	ctx, cancel := newContext()
+	defer cancel()
+
+	pkiService := newCRLPKIService(newCRLFlags)
+
+	pkiBaseURL := newCRLFlags.PKIBaseURL
+	if addresses := vaultAddresses(newVaultFlags.Address); pkiBaseURL == "" && len(addresses) > 0 {
+		pkiBaseURL = addresses[0]
+	}
+
+	urlsConfig := pki.URLsConfig{
+		ClusterID:  newCRLFlags.ClusterID,
+		PKIBaseURL: pkiBaseURL,
+	}
+	err := pkiService.ConfigureURLsWithContext(ctx, urlsConfig)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	urls, err := pkiService.URLsWithContext(ctx, newCRLFlags.ClusterID)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	fmt.Printf("Configured URLs for cluster ID '%s'. Certificates issued from now on embed them:\n", newCRLFlags.ClusterID)
+	fmt.Printf("\n")
+	printCRLURLs(urls)
+}
+
+func crlFetchRun(cmd *cobra.Command, args []string) {
+	ctx, cancel := newContext()
+	defer cancel()
+
+	pkiService := newCRLPKIService(newCRLFlags)
+
+	crl, err := pkiService.CRLWithContext(ctx, newCRLFlags.ClusterID)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	if newCRLFlags.OutFilePath != "" {
+		err = writeFile(newCRLFlags.OutFilePath, []byte(crl.PEM))
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+	}
+
+	if newCRLFlags.Output == OutputJSON {
+		err = printJSON(crl)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+		return
+	}
+
+	fmt.Printf("CRL for cluster ID '%s':\n", newCRLFlags.ClusterID)
+	fmt.Printf("\n")
+	fmt.Printf("    This update: %s\n", crl.ThisUpdate.Format(time.RFC3339))
+	fmt.Printf("    Next update: %s\n", crl.NextUpdate.Format(time.RFC3339))
+	fmt.Printf("    Revoked:     %d certificate(s)\n", len(crl.RevokedSerialNumbers))
+	fmt.Printf("\n")
+	for _, s := range crl.RevokedSerialNumbers {
+		fmt.Printf("    %s\n", s)
+	}
+	if len(crl.RevokedSerialNumbers) != 0 {
+		fmt.Printf("\n")
+	}
+	if newCRLFlags.OutFilePath != "" {
+		fmt.Printf("CRL written to '%s'.\n", newCRLFlags.OutFilePath)
+	}
+}
+
+func crlRotateRun(cmd *cobra.Command, args []string) {
+	ctx, cancel := newContext()
+	defer cancel()
+
+	pkiService := newCRLPKIService(newCRLFlags)
+
+	err := pkiService.RotateCRLWithContext(ctx, newCRLFlags.ClusterID)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	crl, err := pkiService.CRLWithContext(ctx, newCRLFlags.ClusterID)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	fmt.Printf("Rotated CRL for cluster ID '%s'. It is valid until %s.\n", newCRLFlags.ClusterID, crl.NextUpdate.Format(time.RFC3339))
+}
+
+// newCRLPKIService validates the given flags and wires up a PKI service from
+// them.
+func newCRLPKIService(newCRLFlags *crlFlags) pki.Service {
+	err := crlValidate(newCRLFlags)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// Create a mount path scheme shared by all services.
+	newMountPathSchemeConfig := mountpath.DefaultConfig()
+	newMountPathSchemeConfig.Format = newVaultFlags.MountPathFormat
+	newMountPathScheme, err := mountpath.New(newMountPathSchemeConfig)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// Create a Vault client factory.
+	newVaultFactoryConfig := vaultfactory.DefaultConfig()
+	newVaultFactoryConfig.Logger = logger
+	newVaultFactoryConfig.Addresses = vaultAddresses(newVaultFlags.Address)
+	newVaultFactoryConfig.AdminToken = newVaultFlags.Token
+	newVaultFactoryConfig.TLS = newVaultFlags.TLS
+	newVaultFactoryConfig.Namespace = newVaultFlags.Namespace
+	newVaultFactory, err := vaultfactory.New(newVaultFactoryConfig)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// Create a Vault client and configure it with the provided admin token
+	// through the factory.
+	newVaultClient, err := newVaultFactory.NewClient()
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	var pkiService pki.Service
+	{
+		pkiConfig := pki.DefaultServiceConfig()
+		pkiConfig.Logger = logger
+		pkiConfig.MountPathScheme = newMountPathScheme
+		pkiConfig.VaultClient = newVaultClient
+		pkiService, err = pki.NewService(pkiConfig)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+	}
+
+	return pkiService
+}
+
+func printCRLURLs(urls pki.URLs) {
+	for _, u := range urls.IssuingCertificates {
+		fmt.Printf("    Issuing certificate:    %s\n", u)
+	}
+	for _, u := range urls.CRLDistributionPoints {
+		fmt.Printf("    CRL distribution point: %s\n", u)
+	}
+	fmt.Printf("\n")
+}
@@ -12,3 +12,21 @@ var invalidConfigError = &microerror.Error{
 func IsInvalidConfig(err error) bool {
 	return microerror.Cause(err) == invalidConfigError
 }
+
+var notSupportedError = &microerror.Error{
+	Kind: "notSupportedError",
+}
+
+// IsNotSupported asserts notSupportedError.
+func IsNotSupported(err error) bool {
+	return microerror.Cause(err) == notSupportedError
+}
+
+var notConfirmedError = &microerror.Error{
+	Kind: "notConfirmedError",
+}
+
+// IsNotConfirmed asserts notConfirmedError.
+func IsNotConfirmed(err error) bool {
+	return microerror.Cause(err) == notConfirmedError
+}
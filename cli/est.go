@@ -0,0 +1,178 @@
+package cli
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/spf13/cobra"
+
+	estserver "github.com/giantswarm/certctl/v2/service/est-server"
+)
+
+type estFlags struct {
+	// Server
+	Address         string
+	AuditLogFile    string
+	ClientsFile     string
+	MetricsAddress  string
+	TLSCertFile     string
+	TLSClientCAFile string
+	TLSKeyFile      string
+
+	// Enrollment
+	DefaultClusterID string
+	Labels           map[string]string
+	TTL              string
+
+	// Role
+	AllowedDomains   []string
+	AllowBareDomains bool
+	AllowedURISANs   []string
+	RoleTTL          string
+}
+
+// estClientsFile is the format of the file given by --clients-file of the
+// est command.
+type estClientsFile struct {
+	Clients []estserver.Client `json:"clients"`
+}
+
+var (
+	estCmd = &cobra.Command{
+		Use:   "est",
+		Short: "Serve EST (RFC 7030) enrollment of certificates signed by the PKI backends of the clusters EST labels are mapped to.",
+		Run:   estRun,
+	}
+
+	newESTFlags = &estFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(estCmd)
+
+	estCmd.Flags().StringVar(&newESTFlags.Address, "address", ":8443", "Address EST is served on with TLS.")
+	estCmd.Flags().StringVar(&newESTFlags.AuditLogFile, "audit-log-file", "", "File path audit log entries of all requests are appended to as JSON. Defaults to writing them to stderr regardless of --log-level.")
+	estCmd.Flags().StringVar(&newESTFlags.ClientsFile, "clients-file", "", "File path of the YAML file holding the clients, their password hashes and the cluster IDs, domains and organizations they may enroll.")
+	estCmd.Flags().StringVar(&newESTFlags.MetricsAddress, "metrics-address", "", "Address the metrics are served on under /metrics without TLS. Metrics are not served if empty.")
+	estCmd.Flags().StringVar(&newESTFlags.TLSCertFile, "tls-cert-file", "", "File path of the PEM encoded server certificate.")
+	estCmd.Flags().StringVar(&newESTFlags.TLSClientCAFile, "tls-client-ca-file", "", "File path of the PEM encoded CA certificates client certificates of enrolling clients are verified with. Clients can only authenticate with HTTP basic auth if empty. Certificates presented for reenrolling are verified with the cluster's root CA instead.")
+	estCmd.Flags().StringVar(&newESTFlags.TLSKeyFile, "tls-key-file", "", "File path of the PEM encoded server private key.")
+
+	estCmd.Flags().StringVar(&newESTFlags.DefaultClusterID, "default-cluster-id", "", "Cluster ID whose PKI backend serves requests made without an EST label.")
+	estCmd.Flags().StringToStringVar(&newESTFlags.Labels, "labels", nil, "Comma separated EST labels mapped to the cluster IDs whose PKI backends serve them, e.g. 'routers=abc12,switches=def34'.")
+	estCmd.Flags().StringVar(&newESTFlags.TTL, "ttl", "8640h", "TTL of enrolled certificates.") // 1 year
+
+	estCmd.Flags().StringSliceVar(&newESTFlags.AllowedDomains, "allowed-domains", nil, "Comma separated domains allowed by roles created for organizations requested the first time.")
+	estCmd.Flags().BoolVar(&newESTFlags.AllowBareDomains, "allow-bare-domains", false, "Allow bare domains in roles created for organizations requested the first time. (Default false)")
+	estCmd.Flags().StringSliceVar(&newESTFlags.AllowedURISANs, "allowed-uri-sans", nil, "Comma separated URI SANs allowed by roles created for organizations requested the first time.")
+	estCmd.Flags().StringVar(&newESTFlags.RoleTTL, "role-ttl", "8640h", "TTL of roles created for organizations requested the first time.") // 1 year
+}
+
+func estValidate(newESTFlags *estFlags) error {
+	err := backendValidate()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if newESTFlags.Address == "" {
+		return microerror.Maskf(invalidConfigError, "--address must not be empty")
+	}
+	if newESTFlags.ClientsFile == "" {
+		return microerror.Maskf(invalidConfigError, "--clients-file must not be empty")
+	}
+	if newESTFlags.TLSCertFile == "" || newESTFlags.TLSKeyFile == "" {
+		return microerror.Maskf(invalidConfigError, "--tls-cert-file and --tls-key-file must not be empty")
+	}
+	if len(newESTFlags.Labels) == 0 && newESTFlags.DefaultClusterID == "" {
+		return microerror.Maskf(invalidConfigError, "--labels or --default-cluster-id must not be empty")
+	}
+
+	return nil
+}
+
+func estRun(cmd *cobra.Command, args []string) {
+	err := estValidate(newESTFlags)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// The server runs until it is interrupted or terminated. --timeout bounds
+	// each request instead.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	var clients estClientsFile
+	err = readYAMLFile(newESTFlags.ClientsFile, &clients)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// Client certificates are optional, since clients may authenticate with
+	// HTTP basic auth instead. They are verified by the EST server, with
+	// --tls-client-ca-file for enrolling and the cluster's root CA for
+	// reenrolling.
+	tlsConfig, err := newServerTLSConfig(newESTFlags.TLSCertFile, newESTFlags.TLSKeyFile, "", tls.NoClientCert)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+	tlsConfig.ClientAuth = tls.RequestClientCert
+
+	var clientCAs *x509.CertPool
+	if newESTFlags.TLSClientCAFile != "" {
+		clientCAs, err = readCertPool(newESTFlags.TLSClientCAFile)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+	}
+
+	auditLogger, closeAuditLog, err := newAuditLogger(newESTFlags.AuditLogFile)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+	defer closeAuditLog()
+
+	newCertSigner, pkiService := newCertSignerAndPKIServiceFromFlags()
+
+	var handler http.Handler
+	{
+		estServerConfig := estserver.DefaultConfig()
+		estServerConfig.AuditLogger = auditLogger
+		estServerConfig.CertSigner = newCertSigner
+		estServerConfig.Logger = logger
+		estServerConfig.PKIService = pkiService
+		estServerConfig.Clients = clients.Clients
+		estServerConfig.ClientCAs = clientCAs
+		estServerConfig.Labels = newESTFlags.Labels
+		estServerConfig.DefaultClusterID = newESTFlags.DefaultClusterID
+		estServerConfig.TTL = newESTFlags.TTL
+		estServerConfig.AllowedDomains = newESTFlags.AllowedDomains
+		estServerConfig.AllowBareDomains = newESTFlags.AllowBareDomains
+		estServerConfig.AllowedURISANs = newESTFlags.AllowedURISANs
+		estServerConfig.RoleTTL = newESTFlags.RoleTTL
+		estServerConfig.Timeout = timeout
+		handler, err = estserver.New(estServerConfig)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+	}
+
+	server := &http.Server{
+		Addr:              newESTFlags.Address,
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	logger.LogCtx(ctx, "level", "info", "message", "serving EST", "address", newESTFlags.Address)
+
+	err = serveUntilDone(ctx, server, newESTFlags.MetricsAddress)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+}
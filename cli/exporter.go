@@ -0,0 +1,189 @@
+package cli
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/v2/service/exporter"
+	"github.com/giantswarm/certctl/v2/service/metrics"
+	mountpath "github.com/giantswarm/certctl/v2/service/mount-path"
+	"github.com/giantswarm/certctl/v2/service/pki"
+	vaultfactory "github.com/giantswarm/certctl/v2/service/vault-factory"
+)
+
+type exporterFlags struct {
+	// Cluster
+	ClusterCAs bool
+	ClusterID  string
+
+	// Exporter
+	CertFiles      []string
+	Interval       time.Duration
+	MetricsAddress string
+}
+
+var (
+	exporterCmd = &cobra.Command{
+		Use:   "exporter",
+		Short: "Periodically scan certificate files and cluster root CAs and export their expiry as Prometheus metrics.",
+		Run:   exporterRun,
+	}
+
+	newExporterFlags = &exporterFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(exporterCmd)
+
+	exporterCmd.Flags().BoolVar(&newExporterFlags.ClusterCAs, "cluster-cas", false, "Also export the expiry of the root CAs of all clusters set up in Vault. Requires a Vault token. (Default false)")
+	exporterCmd.Flags().StringVar(&newExporterFlags.ClusterID, "cluster-id", "", "Cluster ID certificates read from files are labelled with.")
+
+	exporterCmd.Flags().StringSliceVar(&newExporterFlags.CertFiles, "cert-files", nil, "Comma separated paths or glob patterns of PEM encoded certificate files to export, e.g. '/etc/kubernetes/ssl/*.pem'.")
+	exporterCmd.Flags().DurationVar(&newExporterFlags.Interval, "interval", time.Minute, "Time between scans of all certificates.")
+	exporterCmd.Flags().StringVar(&newExporterFlags.MetricsAddress, "metrics-address", ":8000", "Address the metrics are served on under /metrics.")
+}
+
+func exporterValidate(newExporterFlags *exporterFlags) error {
+	if len(newExporterFlags.CertFiles) == 0 && !newExporterFlags.ClusterCAs {
+		return microerror.Maskf(invalidConfigError, "--cert-files or --cluster-cas must be given")
+	}
+	if newExporterFlags.ClusterCAs {
+		err := vaultBackendValidate("exporter --cluster-cas")
+		if err != nil {
+			return microerror.Mask(err)
+		}
+		if newVaultFlags.Token == "" {
+			return microerror.Maskf(invalidConfigError, "Vault token must not be empty")
+		}
+	}
+	if newExporterFlags.Interval <= 0 {
+		return microerror.Maskf(invalidConfigError, "--interval must be positive")
+	}
+	if newExporterFlags.MetricsAddress == "" {
+		return microerror.Maskf(invalidConfigError, "--metrics-address must not be empty")
+	}
+
+	return nil
+}
+
+func exporterRun(cmd *cobra.Command, args []string) {
+	err := exporterValidate(newExporterFlags)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// The exporter runs until it is interrupted or terminated. --timeout
+	// bounds each scan instead.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	var pkiService pki.Service
+	if newExporterFlags.ClusterCAs {
+		// Create a mount path scheme shared by all services.
+		newMountPathSchemeConfig := mountpath.DefaultConfig()
+		newMountPathSchemeConfig.Format = newVaultFlags.MountPathFormat
+		newMountPathScheme, err := mountpath.New(newMountPathSchemeConfig)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+
+		// Create a Vault client factory.
+		newVaultFactoryConfig := vaultfactory.DefaultConfig()
+		newVaultFactoryConfig.Logger = logger
+		newVaultFactoryConfig.Addresses = vaultAddresses(newVaultFlags.Address)
+		newVaultFactoryConfig.AdminToken = newVaultFlags.Token
+		newVaultFactoryConfig.TLS = newVaultFlags.TLS
+		newVaultFactoryConfig.Namespace = newVaultFlags.Namespace
+		newVaultFactory, err := vaultfactory.New(newVaultFactoryConfig)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+
+		// Create a Vault client and configure it with the provided admin token
+		// through the factory.
+		newVaultClient, err := newVaultFactory.NewClient()
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+
+		// Create a PKI controller to look up the root CAs.
+		pkiConfig := pki.DefaultServiceConfig()
+		pkiConfig.Logger = logger
+		pkiConfig.MountPathScheme = newMountPathScheme
+		pkiConfig.VaultClient = newVaultClient
+		pkiService, err = pki.NewService(pkiConfig)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+	}
+
+	var exporterService exporter.Service
+	{
+		exporterConfig := exporter.DefaultConfig()
+		exporterConfig.Logger = logger
+		exporterConfig.PKIService = pkiService
+		exporterConfig.ClusterID = newExporterFlags.ClusterID
+		exporterConfig.Files = newExporterFlags.CertFiles
+		exporterService, err = exporter.New(exporterConfig)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+	}
+
+	// Scan once before serving, so that the first scrape already sees all
+	// certificates.
+	exporterScan(ctx, exporterService)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	server := &http.Server{
+		Addr:              newExporterFlags.MetricsAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serveErrors := make(chan error, 1)
+	go func() {
+		serveErrors <- server.ListenAndServe()
+	}()
+
+	ticker := time.NewTicker(newExporterFlags.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer shutdownCancel()
+
+			err = server.Shutdown(shutdownCtx)
+			if err != nil {
+				fatal(microerror.Mask(err))
+			}
+			return
+		case err := <-serveErrors:
+			fatal(microerror.Mask(err))
+		case <-ticker.C:
+			exporterScan(ctx, exporterService)
+		}
+	}
+}
+
+// exporterScan scans all certificates, bounded by --timeout. Failures are
+// logged, since they are exported as metrics and the next scan may succeed.
+func exporterScan(ctx context.Context, exporterService exporter.Service) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	err := exporterService.Scan(ctx)
+	if err != nil {
+		logger.LogCtx(ctx, "level", "warning", "message", microerror.Pretty(err, false))
+	}
+}
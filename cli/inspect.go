@@ -2,25 +2,44 @@ package cli
 
 import (
 	"fmt"
-	"log"
+	"strings"
+	"time"
 
 	"github.com/giantswarm/microerror"
-	vaultclient "github.com/hashicorp/vault/api"
 	"github.com/spf13/cobra"
 
+	"github.com/giantswarm/certctl/v2/service/exitcode"
+	mountpath "github.com/giantswarm/certctl/v2/service/mount-path"
 	"github.com/giantswarm/certctl/v2/service/pki"
-	"github.com/giantswarm/certctl/v2/service/token"
-	vaultfactory "github.com/giantswarm/certctl/v2/service/vault-factory"
 )
 
 type inspectFlags struct {
-	// Vault
-	VaultAddress string
-	VaultToken   string
-	VaultTLS     *vaultclient.TLSConfig
-
 	// Cluster
 	ClusterID string
+
+	// Check
+	Check                  bool
+	CheckCAExpiryThreshold time.Duration
+
+	// Output
+	Output string
+}
+
+// inspectReport is the representation of a cluster as printed by inspect.
+type inspectReport struct {
+	ClusterID        string     `json:"cluster_id"`
+	Backend          string     `json:"backend"`
+	Mounted          bool       `json:"mounted"`
+	Mount            *pki.Mount `json:"mount,omitempty"`
+	CAGenerated      bool       `json:"ca_generated"`
+	CA               *pki.CA    `json:"ca,omitempty"`
+	RoleCreated      bool       `json:"role_created"`
+	Role             *pki.Role  `json:"role,omitempty"`
+	PolicyCreated    bool       `json:"policy_created"`
+	Policy           string     `json:"policy,omitempty"`
+	OrgPolicyCreated bool       `json:"org_policy_created"`
+	OrgPolicy        string     `json:"org_policy,omitempty"`
+	Problems         []string   `json:"problems,omitempty"`
 }
 
 var (
@@ -30,32 +49,32 @@ var (
 		Run:   inspectRun,
 	}
 
-	newInspectFlags = &inspectFlags{
-		VaultTLS: &vaultclient.TLSConfig{},
-	}
+	newInspectFlags = &inspectFlags{}
 )
 
 func init() {
 	CLICmd.AddCommand(inspectCmd)
 
-	inspectCmd.Flags().StringVar(&newInspectFlags.VaultAddress, "vault-addr", fromEnvToString(EnvVaultAddress, "http://127.0.0.1:8200"), "Address used to connect to Vault.")
-	inspectCmd.Flags().StringVar(&newInspectFlags.VaultToken, "vault-token", fromEnvToString(EnvVaultToken, ""), "Token used to authenticate against Vault.")
-	inspectCmd.Flags().StringVar(&newInspectFlags.VaultTLS.CACert, "vault-cacert", fromEnvToString(EnvVaultCACert, ""), "The path to a PEM-encoded CA cert file to use to verify the Vault server SSL certificate.")
-	inspectCmd.Flags().StringVar(&newInspectFlags.VaultTLS.CAPath, "vault-capath", fromEnvToString(EnvVaultCAPath, ""), "The path to a directory of PEM-encoded CA cert files to verify the Vault server SSL certificate.")
-	inspectCmd.Flags().StringVar(&newInspectFlags.VaultTLS.ClientCert, "vault-client-cert", fromEnvToString(EnvVaultClientCert, ""), "The path to the certificate for Vault communication.")
-	inspectCmd.Flags().StringVar(&newInspectFlags.VaultTLS.ClientKey, "vault-client-key", fromEnvToString(EnvVaultClientKey, ""), "The path to the private key for Vault communication.")
-	inspectCmd.Flags().StringVar(&newInspectFlags.VaultTLS.TLSServerName, "vault-tls-server-name", fromEnvToString(EnvVaultTLSServerName, ""), "If set, is used to set the SNI host when connecting via TLS.")
-	inspectCmd.Flags().BoolVar(&newInspectFlags.VaultTLS.Insecure, "vault-tls-skip-verify", fromEnvBool(EnvVaultInsecure, false), "Do not verify TLS certificate.")
-
 	inspectCmd.Flags().StringVar(&newInspectFlags.ClusterID, "cluster-id", "", "Cluster ID used to generate a new root CA for.")
+
+	inspectCmd.Flags().BoolVar(&newInspectFlags.Check, "check", false, "Exit non-zero in case any part of the setup is missing or the root CA expires within --check-ca-expiry-threshold. (Default false)")
+	inspectCmd.Flags().DurationVar(&newInspectFlags.CheckCAExpiryThreshold, "check-ca-expiry-threshold", 720*time.Hour, "Remaining validity of the root CA below which --check fails.") // 30 days
+
+	inspectCmd.Flags().StringVar(&newInspectFlags.Output, "output", OutputText, "Output format, either 'text' or 'json'.")
 }
 
 func inspectValidate(newInspectFlags *inspectFlags) error {
-	if newInspectFlags.VaultToken == "" {
-		return microerror.Maskf(invalidConfigError, "Vault token must not be empty")
+	err := backendValidate()
+	if err != nil {
+		return microerror.Mask(err)
 	}
-	if newInspectFlags.ClusterID == "" {
-		return microerror.Maskf(invalidConfigError, "cluster ID must not be empty")
+	err = mountpath.ValidateClusterID(newInspectFlags.ClusterID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	err = outputValidate(newInspectFlags.Output)
+	if err != nil {
+		return microerror.Mask(err)
 	}
 
 	return nil
@@ -64,72 +83,173 @@ func inspectValidate(newInspectFlags *inspectFlags) error {
 func inspectRun(cmd *cobra.Command, args []string) {
 	err := inspectValidate(newInspectFlags)
 	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
+		fatal(microerror.Mask(err))
 	}
 
-	// Create a Vault client factory.
-	newVaultFactoryConfig := vaultfactory.DefaultConfig()
-	newVaultFactoryConfig.Address = newInspectFlags.VaultAddress
-	newVaultFactoryConfig.AdminToken = newInspectFlags.VaultToken
-	newVaultFactoryConfig.TLS = newInspectFlags.VaultTLS
-	newVaultFactory, err := vaultfactory.New(newVaultFactoryConfig)
-	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
+	ctx, cancel := newContext()
+	defer cancel()
+
+	// Create the services of the selected backend. The local backend has no
+	// policies, so tokenService is nil then.
+	pkiService, tokenService, _ := newPKIServiceFromFlags()
+
+	report := inspectReport{
+		ClusterID: newInspectFlags.ClusterID,
+		Backend:   backend,
 	}
 
-	// Create a Vault client and configure it with the provided admin token
-	// through the factory.
-	newVaultClient, err := newVaultFactory.NewClient()
-	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
+	mount, err := pkiService.MountWithContext(ctx, newInspectFlags.ClusterID)
+	if err != nil && !pki.IsNotMounted(err) {
+		fatal(microerror.Mask(err))
+	}
+	if err == nil {
+		report.Mounted = true
+		report.Mount = &mount
 	}
 
-	// Create a PKI controller to check for PKI backend specific operations.
-	var pkiService pki.Service
-	{
-		pkiConfig := pki.DefaultServiceConfig()
-		pkiConfig.VaultClient = newVaultClient
-		pkiService, err = pki.NewService(pkiConfig)
+	ca, err := pkiService.CAWithContext(ctx, newInspectFlags.ClusterID)
+	if err != nil && !pki.IsCANotFound(err) {
+		fatal(microerror.Mask(err))
+	}
+	if err == nil {
+		report.CAGenerated = true
+		report.CA = &ca
+	}
+
+	role, err := pkiService.RoleWithContext(ctx, newInspectFlags.ClusterID)
+	if err != nil && !pki.IsRoleNotFound(err) {
+		fatal(microerror.Mask(err))
+	}
+	if err == nil {
+		report.RoleCreated = true
+		report.Role = &role
+	}
+
+	if tokenService != nil {
+		report.Policy, err = tokenService.PolicyWithContext(ctx, newInspectFlags.ClusterID)
 		if err != nil {
-			log.Fatalf("%#v\n", microerror.Mask(err))
+			fatal(microerror.Mask(err))
 		}
+		report.PolicyCreated = report.Policy != ""
+
+		report.OrgPolicy, err = tokenService.OrgPolicyWithContext(ctx, newInspectFlags.ClusterID)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+		report.OrgPolicyCreated = report.OrgPolicy != ""
 	}
 
-	// Create a token generator to check for token specific operations.
-	var tokenService token.Service
-	{
-		tokenConfig := token.DefaultServiceConfig()
-		tokenConfig.VaultClient = newVaultClient
-		tokenService, err = token.NewService(tokenConfig)
+	report.Problems = inspectProblems(report, newInspectFlags.CheckCAExpiryThreshold)
+
+	if newInspectFlags.Output == OutputJSON {
+		err = printJSON(report)
 		if err != nil {
-			log.Fatalf("%#v\n", microerror.Mask(err))
+			fatal(microerror.Mask(err))
 		}
+	} else {
+		printInspectReport(report)
 	}
 
-	mounted, err := pkiService.IsMounted(newInspectFlags.ClusterID)
-	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
+	if newInspectFlags.Check && len(report.Problems) > 0 {
+		exit(exitcode.CheckFailed)
 	}
-	generated, err := pkiService.IsCAGenerated(newInspectFlags.ClusterID)
-	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
+}
+
+// inspectProblems returns a description of everything missing from the
+// cluster's setup, and whether the root CA expires within threshold.
+func inspectProblems(report inspectReport, threshold time.Duration) []string {
+	var problems []string
+
+	if !report.Mounted {
+		problems = append(problems, "PKI backend is not mounted")
 	}
-	roleCreated, err := pkiService.IsRoleCreated(newInspectFlags.ClusterID)
-	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
+	if !report.CAGenerated {
+		problems = append(problems, "root CA is not generated")
+	} else if time.Until(report.CA.NotAfter) < threshold {
+		problems = append(problems, fmt.Sprintf("root CA expires at %s, within %s", report.CA.NotAfter.UTC().Format(time.RFC3339), threshold))
 	}
-	policyCreated, err := tokenService.IsPolicyCreated(newInspectFlags.ClusterID)
-	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
+	if !report.RoleCreated {
+		problems = append(problems, "PKI role is not created")
+	}
+	// The local backend has no policies.
+	if report.Backend == BackendLocal {
+		return problems
+	}
+	if !report.PolicyCreated {
+		problems = append(problems, "PKI policy is not created")
+	}
+	if !report.OrgPolicyCreated {
+		problems = append(problems, "PKI org policy is not created")
 	}
 
-	fmt.Printf("Inspecting cluster for ID '%s':\n", newInspectFlags.ClusterID)
+	return problems
+}
+
+func printInspectReport(report inspectReport) {
+	fmt.Printf("Inspecting cluster for ID '%s':\n", report.ClusterID)
 	fmt.Printf("\n")
-	fmt.Printf("    PKI backend mounted: %t\n", mounted)
-	fmt.Printf("    Root CA generated:   %t\n", generated)
-	fmt.Printf("    PKI role created:    %t\n", roleCreated)
-	fmt.Printf("    PKI policy created:  %t\n", policyCreated)
+	fmt.Printf("    PKI backend mounted:    %t\n", report.Mounted)
+	fmt.Printf("    Root CA generated:      %t\n", report.CAGenerated)
+	fmt.Printf("    PKI role created:       %t\n", report.RoleCreated)
+	if report.Backend != BackendLocal {
+		fmt.Printf("    PKI policy created:     %t\n", report.PolicyCreated)
+		fmt.Printf("    PKI org policy created: %t\n", report.OrgPolicyCreated)
+	}
 	fmt.Printf("\n")
+
+	if report.Mount != nil {
+		fmt.Printf("PKI backend:\n")
+		fmt.Printf("\n")
+		fmt.Printf("    Path:          %s\n", report.Mount.Path)
+		fmt.Printf("    Description:   %s\n", report.Mount.Description)
+		fmt.Printf("    Max lease TTL: %s\n", formatSeconds(report.Mount.MaxLeaseTTL))
+		fmt.Printf("\n")
+	}
+	if report.CA != nil {
+		fmt.Printf("Root CA:\n")
+		fmt.Printf("\n")
+		fmt.Printf("    Subject:       %s\n", report.CA.Subject)
+		fmt.Printf("    Serial number: %s\n", report.CA.SerialNumber)
+		fmt.Printf("    Not before:    %s\n", report.CA.NotBefore.UTC().Format(time.RFC3339))
+		fmt.Printf("    Not after:     %s\n", report.CA.NotAfter.UTC().Format(time.RFC3339))
+		fmt.Printf("    Key type:      %s\n", report.CA.KeyType)
+		fmt.Printf("\n")
+	}
+	if report.Role != nil {
+		fmt.Printf("PKI role '%s':\n", report.Role.Name)
+		fmt.Printf("\n")
+		fmt.Printf("    Allowed domains:    %s\n", strings.Join(report.Role.AllowedDomains, ","))
+		fmt.Printf("    Allow bare domains: %t\n", report.Role.AllowBareDomains)
+		fmt.Printf("    Allow subdomains:   %t\n", report.Role.AllowSubdomains)
+		fmt.Printf("    Allowed URI SANs:   %s\n", strings.Join(report.Role.AllowedURISANs, ","))
+		fmt.Printf("    Allowed other SANs: %s\n", strings.Join(report.Role.AllowedOtherSANs, ","))
+		fmt.Printf("    Organizations:      %s\n", strings.Join(report.Role.Organizations, ","))
+		fmt.Printf("    TTL:                %s\n", formatSeconds(report.Role.TTL))
+		fmt.Printf("    Max TTL:            %s\n", formatSeconds(report.Role.MaxTTL))
+		fmt.Printf("\n")
+	}
+	if report.Policy != "" {
+		fmt.Printf("PKI policy:\n")
+		fmt.Printf("%s\n", report.Policy)
+		fmt.Printf("\n")
+	}
+	if report.OrgPolicy != "" {
+		fmt.Printf("PKI org policy:\n")
+		fmt.Printf("%s\n", report.OrgPolicy)
+		fmt.Printf("\n")
+	}
+	if len(report.Problems) > 0 {
+		fmt.Printf("Problems found:\n")
+		fmt.Printf("\n")
+		for _, p := range report.Problems {
+			fmt.Printf("    - %s\n", p)
+		}
+		fmt.Printf("\n")
+	}
+
+	if report.Backend == BackendLocal {
+		return
+	}
 	fmt.Printf("Tokens may have been generated for this cluster. Created tokens\n")
 	fmt.Printf("cannot be shown as they are secret. Information about these\n")
 	fmt.Printf("secrets needs to be looked up directly from the location of the\n")
@@ -2,41 +2,41 @@ package cli
 
 import (
 	"fmt"
-	"log"
+	"net"
 	"os"
 	"path/filepath"
 
 	"github.com/giantswarm/microerror"
-	vaultclient "github.com/hashicorp/vault/api"
 	"github.com/spf13/cobra"
 
-	certsigner "github.com/giantswarm/certctl/v2/service/cert-signer"
+	mountpath "github.com/giantswarm/certctl/v2/service/mount-path"
 	"github.com/giantswarm/certctl/v2/service/spec"
-	vaultfactory "github.com/giantswarm/certctl/v2/service/vault-factory"
 )
 
 type issueFlags struct {
-	VaultAddress string
-	VaultToken   string
-	VaultTLS     *vaultclient.TLSConfig
-
 	// Cluster
 	ClusterID string
 
 	// Certificate
 	CommonName       string
-	IPSANs           string
-	AltNames         string
+	IPSANs           []net.IP
+	AltNames         []string
+	URISANs          []string
+	OtherSANs        []string
 	TTL              string
-	Organizations    string
-	AllowedDomains   string
+	Organizations    []string
+	AllowedDomains   []string
 	AllowBareDomains bool
+	AllowedURISANs   []string
+	AllowedOtherSANs []string
 	RoleTTL          string
+	WrapTTL          string
 
 	// Path
-	CrtFilePath string
-	KeyFilePath string
-	CAFilePath  string
+	CrtFilePath           string
+	KeyFilePath           string
+	CAFilePath            string
+	WrappingTokenFilePath string
 }
 
 var (
@@ -46,49 +46,59 @@ var (
 		Run:   issueRun,
 	}
 
-	newIssueFlags = &issueFlags{
-		VaultTLS: &vaultclient.TLSConfig{},
-	}
+	newIssueFlags = &issueFlags{}
 )
 
 func init() {
 	CLICmd.AddCommand(issueCmd)
 
-	issueCmd.Flags().StringVar(&newIssueFlags.VaultAddress, "vault-addr", fromEnvToString(EnvVaultAddress, "http://127.0.0.1:8200"), "Address used to connect to Vault.")
-	issueCmd.Flags().StringVar(&newIssueFlags.VaultToken, "vault-token", fromEnvToString(EnvVaultToken, ""), "Token used to authenticate against Vault.")
-	issueCmd.Flags().StringVar(&newIssueFlags.VaultTLS.CACert, "vault-cacert", fromEnvToString(EnvVaultCACert, ""), "The path to a PEM-encoded CA cert file to use to verify the Vault server SSL certificate.")
-	issueCmd.Flags().StringVar(&newIssueFlags.VaultTLS.CAPath, "vault-capath", fromEnvToString(EnvVaultCAPath, ""), "The path to a directory of PEM-encoded CA cert files to verify the Vault server SSL certificate.")
-	issueCmd.Flags().StringVar(&newIssueFlags.VaultTLS.ClientCert, "vault-client-cert", fromEnvToString(EnvVaultClientCert, ""), "The path to the certificate for Vault communication.")
-	issueCmd.Flags().StringVar(&newIssueFlags.VaultTLS.ClientKey, "vault-client-key", fromEnvToString(EnvVaultClientKey, ""), "The path to the private key for Vault communication.")
-	issueCmd.Flags().StringVar(&newIssueFlags.VaultTLS.TLSServerName, "vault-tls-server-name", fromEnvToString(EnvVaultTLSServerName, ""), "If set, is used to set the SNI host when connecting via TLS.")
-	issueCmd.Flags().BoolVar(&newIssueFlags.VaultTLS.Insecure, "vault-tls-skip-verify", fromEnvBool(EnvVaultInsecure, false), "Do not verify TLS certificate.")
-
 	issueCmd.Flags().StringVar(&newIssueFlags.ClusterID, "cluster-id", "", "Cluster ID used to generate a new signed certificate for.")
 
 	issueCmd.Flags().StringVar(&newIssueFlags.CommonName, "common-name", "", "Common name used to generate a new signed certificate for.")
-	issueCmd.Flags().StringVar(&newIssueFlags.IPSANs, "ip-sans", "", "IPSANs used to generate a new signed certificate for.")
-	issueCmd.Flags().StringVar(&newIssueFlags.AltNames, "alt-names", "", "Alternative names used to generate a new signed certificate for.")
+	issueCmd.Flags().IPSliceVar(&newIssueFlags.IPSANs, "ip-sans", nil, "Comma separated IP SANs used to generate a new signed certificate for.")
+	issueCmd.Flags().StringSliceVar(&newIssueFlags.AltNames, "alt-names", nil, "Comma separated alternative names used to generate a new signed certificate for.")
+	issueCmd.Flags().StringSliceVar(&newIssueFlags.URISANs, "uri-sans", nil, "Comma separated URI SANs, e.g. SPIFFE IDs, used to generate a new signed certificate for. The issued certificate is verified to contain exactly these URIs, so --wrap-ttl cannot be set.")
+	issueCmd.Flags().StringSliceVar(&newIssueFlags.OtherSANs, "other-sans", nil, "Comma separated custom OID/UTF8-string SANs in the format '<oid>;UTF8:<value>' used to generate a new signed certificate for. The role must allow them, see --allowed-other-sans.")
 	issueCmd.Flags().StringVar(&newIssueFlags.TTL, "ttl", "8640h", "TTL used to generate a new signed certificate for.") // 1 year
-	issueCmd.Flags().StringVar(&newIssueFlags.Organizations, "organizations", "", "Organizations that you want this new certificate to have in its subject.")
-	issueCmd.Flags().StringVar(&newIssueFlags.AllowedDomains, "allowed-domains", "", "Comma separated domains allowed to authenticate against the cluster's root CA.")
+	issueCmd.Flags().StringSliceVar(&newIssueFlags.Organizations, "organizations", nil, "Comma separated organizations that you want this new certificate to have in its subject.")
+	issueCmd.Flags().StringSliceVar(&newIssueFlags.AllowedDomains, "allowed-domains", nil, "Comma separated domains allowed to authenticate against the cluster's root CA.")
 	issueCmd.Flags().BoolVar(&newIssueFlags.AllowBareDomains, "allow-bare-domains", false, "Allow issuing certs for bare domains. (Default false)")
+	issueCmd.Flags().StringSliceVar(&newIssueFlags.AllowedURISANs, "allowed-uri-sans", nil, "Comma separated URI SANs allowed by the role that might get created (if it doesn't exist yet) while issuing this certificate. A '*' matches any sequence of characters.")
+	issueCmd.Flags().StringSliceVar(&newIssueFlags.AllowedOtherSANs, "allowed-other-sans", nil, "Comma separated custom OID/UTF8-string SANs allowed by the role that might get created (if it doesn't exist yet) while issuing this certificate. A '*' matches any sequence of characters.")
 	issueCmd.Flags().StringVar(&newIssueFlags.RoleTTL, "role-ttl", "8640h", "TTL used for the role that might get created (if it doesn't exist yet) while issuing this certificate.") // 1 year
+	issueCmd.Flags().StringVar(&newIssueFlags.WrapTTL, "wrap-ttl", "", "If set, write a single-use wrapping token valid for this TTL to --wrapping-token-file instead of the issued key pair. Use 'certctl unwrap' to obtain the key pair.")
 
 	issueCmd.Flags().StringVar(&newIssueFlags.CrtFilePath, "crt-file", "", "File path used to write the generated public key to.")
 	issueCmd.Flags().StringVar(&newIssueFlags.KeyFilePath, "key-file", "", "File path used to write the generated private key to.")
 	issueCmd.Flags().StringVar(&newIssueFlags.CAFilePath, "ca-file", "", "File path used to write the issuing root CA to.")
+	issueCmd.Flags().StringVar(&newIssueFlags.WrappingTokenFilePath, "wrapping-token-file", "", "File path used to write the wrapping token to when --wrap-ttl is set.")
 }
 
 func issueValidate(newIssueFlags *issueFlags) error {
-	if newIssueFlags.VaultToken == "" {
-		return microerror.Maskf(invalidConfigError, "Vault token must not be empty")
+	err := backendValidate()
+	if err != nil {
+		return microerror.Mask(err)
 	}
-	if newIssueFlags.ClusterID == "" {
-		return microerror.Maskf(invalidConfigError, "cluster ID must not be empty")
+	err = mountpath.ValidateClusterID(newIssueFlags.ClusterID)
+	if err != nil {
+		return microerror.Mask(err)
 	}
 	if newIssueFlags.CommonName == "" {
 		return microerror.Maskf(invalidConfigError, "--common-name must not be empty")
 	}
+	if backend == BackendLocal && (len(newIssueFlags.OtherSANs) != 0 || len(newIssueFlags.AllowedOtherSANs) != 0) {
+		return microerror.Maskf(notSupportedError, "--other-sans and --allowed-other-sans are only supported by --backend %s", BackendVault)
+	}
+	if newIssueFlags.WrapTTL != "" {
+		if newIssueFlags.WrappingTokenFilePath == "" {
+			return microerror.Maskf(invalidConfigError, "--wrapping-token-file must not be empty when --wrap-ttl is set")
+		}
+		if len(newIssueFlags.URISANs) != 0 {
+			return microerror.Maskf(invalidConfigError, "--uri-sans must be empty when --wrap-ttl is set")
+		}
+
+		return nil
+	}
 	if newIssueFlags.CrtFilePath == "" {
 		return microerror.Maskf(invalidConfigError, "--crt-file name must not be empty")
 	}
@@ -105,33 +115,15 @@ func issueValidate(newIssueFlags *issueFlags) error {
 func issueRun(cmd *cobra.Command, args []string) {
 	err := issueValidate(newIssueFlags)
 	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
-	}
-
-	// Create a Vault client factory.
-	newVaultFactoryConfig := vaultfactory.DefaultConfig()
-	newVaultFactoryConfig.Address = newIssueFlags.VaultAddress
-	newVaultFactoryConfig.AdminToken = newIssueFlags.VaultToken
-	newVaultFactoryConfig.TLS = newIssueFlags.VaultTLS
-	newVaultFactory, err := vaultfactory.New(newVaultFactoryConfig)
-	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
+		fatal(microerror.Mask(err))
 	}
 
-	// Create a Vault client and configure it with the provided admin token
-	// through the factory.
-	newVaultClient, err := newVaultFactory.NewClient()
-	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
-	}
+	ctx, cancel := newContext()
+	defer cancel()
 
-	// Create a certificate signer to generate a new signed certificate.
-	newCertSignerConfig := certsigner.DefaultConfig()
-	newCertSignerConfig.VaultClient = newVaultClient
-	newCertSigner, err := certsigner.New(newCertSignerConfig)
-	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
-	}
+	// Create a certificate signer of the selected backend to generate a new
+	// signed certificate.
+	newCertSigner := newCertSignerFromFlags()
 
 	// Generate a new signed certificate.
 	newIssueConfig := spec.IssueConfig{
@@ -140,39 +132,58 @@ func issueRun(cmd *cobra.Command, args []string) {
 		Organizations:    newIssueFlags.Organizations,
 		AllowedDomains:   newIssueFlags.AllowedDomains,
 		AllowBareDomains: newIssueFlags.AllowBareDomains,
+		AllowedURISANs:   newIssueFlags.AllowedURISANs,
+		AllowedOtherSANs: newIssueFlags.AllowedOtherSANs,
 		IPSANs:           newIssueFlags.IPSANs,
 		AltNames:         newIssueFlags.AltNames,
+		URISANs:          newIssueFlags.URISANs,
+		OtherSANs:        newIssueFlags.OtherSANs,
 		TTL:              newIssueFlags.TTL,
 		RoleTTL:          newIssueFlags.RoleTTL,
+		WrapTTL:          newIssueFlags.WrapTTL,
 	}
-	newIssueResponse, err := newCertSigner.Issue(newIssueConfig)
+	newIssueResponse, err := newCertSigner.IssueWithContext(ctx, newIssueConfig)
 	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
+		fatal(microerror.Mask(err))
+	}
+
+	// In case the response is wrapped, only the wrapping token is written.
+	// It grants access to the private key and is therefore treated as such.
+	if newIssueFlags.WrapTTL != "" {
+		err = writeSecretFile(newIssueFlags.WrappingTokenFilePath, []byte(newIssueResponse.WrappingToken))
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+
+		fmt.Printf("Issued new signed certificate wrapped for %s.\n", newIssueFlags.WrapTTL)
+		fmt.Printf("\n")
+		fmt.Printf("Wrapping token written to '%s'.\n", newIssueFlags.WrappingTokenFilePath)
+		return
 	}
 
 	err = os.MkdirAll(filepath.Dir(newIssueFlags.CrtFilePath), os.FileMode(0744))
 	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
+		fatal(microerror.Mask(err))
 	}
 	err = os.WriteFile(newIssueFlags.CrtFilePath, []byte(newIssueResponse.Certificate), os.FileMode(0644))
 	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
+		fatal(microerror.Mask(err))
 	}
 	err = os.MkdirAll(filepath.Dir(newIssueFlags.KeyFilePath), os.FileMode(0744))
 	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
+		fatal(microerror.Mask(err))
 	}
 	err = os.WriteFile(newIssueFlags.KeyFilePath, []byte(newIssueResponse.PrivateKey), os.FileMode(0600))
 	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
+		fatal(microerror.Mask(err))
 	}
 	err = os.MkdirAll(filepath.Dir(newIssueFlags.CAFilePath), os.FileMode(0744))
 	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
+		fatal(microerror.Mask(err))
 	}
 	err = os.WriteFile(newIssueFlags.CAFilePath, []byte(newIssueResponse.IssuingCA), os.FileMode(0644))
 	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
+		fatal(microerror.Mask(err))
 	}
 
 	fmt.Printf("Issued new signed certificate with the following serial number.\n")
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-stack/stack"
+)
+
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+
+	LogLevelDebug   = "debug"
+	LogLevelInfo    = "info"
+	LogLevelWarning = "warning"
+	LogLevelError   = "error"
+)
+
+// logValidate ensures the given log level and format are supported.
+func logValidate(level, format string) error {
+	switch level {
+	case LogLevelDebug, LogLevelInfo, LogLevelWarning, LogLevelError:
+	default:
+		return microerror.Maskf(invalidConfigError, "--log-level must be one of '%s', '%s', '%s' or '%s'", LogLevelDebug, LogLevelInfo, LogLevelWarning, LogLevelError)
+	}
+	if format != LogFormatText && format != LogFormatJSON {
+		return microerror.Maskf(invalidConfigError, "--log-format must be one of '%s' or '%s'", LogFormatText, LogFormatJSON)
+	}
+
+	return nil
+}
+
+// newLogger returns a logger writing to w in the given format, dropping all
+// messages below the given level.
+func newLogger(level, format string, w io.Writer) (micrologger.Logger, error) {
+	err := logValidate(level, format)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	var underlying micrologger.Logger
+	if format == LogFormatJSON {
+		// The caller is looked up one frame further up than by default,
+		// because of the activation logger wrapping the JSON logger.
+		c := micrologger.Config{
+			Caller: func() interface{} {
+				return fmt.Sprintf("%+v", stack.Caller(5))
+			},
+			IOWriter: w,
+		}
+		underlying, err = micrologger.New(c)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+	} else {
+		underlying = newTextLogger(w)
+	}
+
+	activationConfig := micrologger.ActivationLoggerConfig{
+		Underlying: underlying,
+		Activations: map[string]interface{}{
+			micrologger.KeyLevel: level,
+		},
+	}
+	newLogger, err := micrologger.NewActivation(activationConfig)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return newLogger, nil
+}
+
+// textLogger writes log messages as logfmt lines meant to be read by humans,
+// e.g. time=15:04:05 level=info message="..." cluster_id=123.
+type textLogger struct {
+	logger kitlog.Logger
+}
+
+func newTextLogger(w io.Writer) *textLogger {
+	logger := kitlog.NewLogfmtLogger(kitlog.NewSyncWriter(w))
+	logger = kitlog.With(logger, "time", kitlog.Valuer(func() interface{} {
+		return time.Now().Format("15:04:05")
+	}))
+
+	return &textLogger{
+		logger: logger,
+	}
+}
+
+func (l *textLogger) Log(keyVals ...interface{}) {
+	_ = l.logger.Log(keyVals...)
+}
+
+func (l *textLogger) LogCtx(ctx context.Context, keyVals ...interface{}) {
+	l.Log(keyVals...)
+}
+
+func (l *textLogger) With(keyVals ...interface{}) micrologger.Logger {
+	return &textLogger{
+		logger: kitlog.With(l.logger, keyVals...),
+	}
+}
+
+// logError logs the given error as a readable message. Its stack trace is
+// only logged at debug level.
+func logError(logger micrologger.Logger, err error) {
+	logger.Log("level", "error", "message", microerror.Pretty(err, false))
+	logger.Log("level", "debug", "message", "stack trace of the error above", "stack", microerror.JSON(err))
+}
@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/giantswarm/microerror"
+)
+
+const (
+	OutputJSON = "json"
+	OutputText = "text"
+)
+
+// outputValidate ensures the given output format is supported.
+func outputValidate(output string) error {
+	if output != OutputText && output != OutputJSON {
+		return microerror.Maskf(invalidConfigError, "--output must be one of '%s' or '%s'", OutputText, OutputJSON)
+	}
+
+	return nil
+}
+
+// printJSON writes v as indented JSON to stdout.
+func printJSON(v interface{}) error {
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "  ")
+
+	err := e.Encode(v)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// formatSeconds formats a duration given in seconds as returned by Vault.
+// Zero is formatted as "system default", because Vault falls back to the
+// defaults of the mount or the system then.
+func formatSeconds(seconds int) string {
+	if seconds == 0 {
+		return "system default"
+	}
+
+	return (time.Duration(seconds) * time.Second).String()
+}
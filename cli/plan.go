@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+)
+
+// planAction is a single change a command is about to make, or made, to
+// Vault.
+type planAction struct {
+	// Plan describes the action before it is executed.
+	Plan string
+	// Done describes the action after it was executed.
+	Done string
+}
+
+// printPlan prints the given actions as they are planned to be executed.
+func printPlan(clusterID string, actions []planAction) {
+	fmt.Printf("Planned actions for cluster ID '%s':\n", clusterID)
+	fmt.Printf("\n")
+	if len(actions) == 0 {
+		fmt.Printf("    - Nothing to do\n")
+	}
+	for _, a := range actions {
+		fmt.Printf("    - %s\n", a.Plan)
+	}
+	fmt.Printf("\n")
+}
+
+// printDone prints the given actions as they have been executed.
+func printDone(actions []planAction) {
+	if len(actions) == 0 {
+		fmt.Printf("    - Nothing to do\n")
+	}
+	for _, a := range actions {
+		fmt.Printf("    - %s\n", a.Done)
+	}
+}
+
+// confirm asks the user to confirm a destructive operation by typing the
+// expected value, e.g. the cluster ID. It fails in case stdin is not a
+// terminal, because then nobody can be asked.
+func confirm(expected string) error {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if fi.Mode()&os.ModeCharDevice == 0 {
+		return microerror.Maskf(invalidConfigError, "stdin is not a terminal, use --yes to confirm non-interactively")
+	}
+
+	fmt.Printf("This cannot be undone. Type '%s' to confirm: ", expected)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if strings.TrimSpace(answer) != expected {
+		return microerror.Maskf(notConfirmedError, "expected '%s'", expected)
+	}
+	fmt.Printf("\n")
+
+	return nil
+}
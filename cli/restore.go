@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/giantswarm/microerror"
+	"github.com/spf13/cobra"
+)
+
+type restoreFlags struct {
+	// Backup
+	InFilePath         string
+	PassphraseFilePath string
+}
+
+var (
+	restoreCmd = &cobra.Command{
+		Use:   "restore",
+		Short: "Restore a cluster's PKI backend including its identical root CA from an encrypted archive.",
+		Run:   restoreRun,
+	}
+
+	newRestoreFlags = &restoreFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(restoreCmd)
+
+	restoreCmd.Flags().StringVar(&newRestoreFlags.InFilePath, "in-file", "", "File path used to read the encrypted archive from.")
+	restoreCmd.Flags().StringVar(&newRestoreFlags.PassphraseFilePath, "backup-passphrase-file", "", fmt.Sprintf("File path used to read the archive passphrase from. Defaults to the value of %s.", EnvBackupPassphrase))
+}
+
+func restoreValidate(newRestoreFlags *restoreFlags) error {
+	err := vaultBackendValidate("restore")
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if newVaultFlags.Token == "" {
+		return microerror.Maskf(invalidConfigError, "Vault token must not be empty")
+	}
+	if newRestoreFlags.InFilePath == "" {
+		return microerror.Maskf(invalidConfigError, "--in-file must not be empty")
+	}
+
+	return nil
+}
+
+func restoreRun(cmd *cobra.Command, args []string) {
+	err := restoreValidate(newRestoreFlags)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	passphrase, err := readBackupPassphrase(newRestoreFlags.PassphraseFilePath)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+	archive, err := readArchiveFile(newRestoreFlags.InFilePath, passphrase)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	newBackupService := newBackupServiceFromFlags(newVaultFlags.Address, newVaultFlags.Token, newVaultFlags.Namespace, newVaultFlags.TLS, newVaultFlags.MountPathFormat)
+
+	err = newBackupService.RestoreWithContext(ctx, archive)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	fmt.Printf("Restored PKI backend for cluster ID '%s' from backup taken at %s:\n", archive.Header.ClusterID, archive.Header.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+	fmt.Printf("\n")
+	fmt.Printf("    - root CA including its private key\n")
+	fmt.Printf("    - %d role(s)\n", len(archive.Payload.Roles))
+	fmt.Printf("    - %d policy(ies)\n", len(archive.Payload.Policies))
+	fmt.Printf("    - mount settings\n")
+	fmt.Printf("\n")
+	fmt.Printf("Tokens are not part of the backup. Existing tokens keep working\n")
+	fmt.Printf("in case the policies have been restored under the same names.\n")
+	fmt.Printf("\n")
+}
@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/giantswarm/microerror"
+	"github.com/spf13/cobra"
+
+	mountpath "github.com/giantswarm/certctl/v2/service/mount-path"
+	"github.com/giantswarm/certctl/v2/service/pki"
+	"github.com/giantswarm/certctl/v2/service/spec"
+)
+
+type revokeFlags struct {
+	// Cluster
+	ClusterID string
+
+	// Certificate
+	SerialNumber string
+	CrtFilePath  string
+}
+
+var (
+	revokeCmd = &cobra.Command{
+		Use:   "revoke",
+		Short: "Revoke a certificate issued for a specific cluster, adding it to the cluster's CRL.",
+		Run:   revokeRun,
+	}
+
+	newRevokeFlags = &revokeFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(revokeCmd)
+
+	revokeCmd.Flags().StringVar(&newRevokeFlags.ClusterID, "cluster-id", "", "Cluster ID the certificate was issued for.")
+
+	revokeCmd.Flags().StringVar(&newRevokeFlags.SerialNumber, "serial", "", "Serial number of the certificate to revoke, as printed by issue, e.g. '39:dd:2e:90:...'.")
+	revokeCmd.Flags().StringVar(&newRevokeFlags.CrtFilePath, "crt-file", "", "File path used to read the certificate to revoke from.")
+}
+
+func revokeValidate(newRevokeFlags *revokeFlags) error {
+	err := backendValidate()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	err = mountpath.ValidateClusterID(newRevokeFlags.ClusterID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if newRevokeFlags.SerialNumber == "" && newRevokeFlags.CrtFilePath == "" {
+		return microerror.Maskf(invalidConfigError, "--serial or --crt-file must not be empty")
+	}
+	if newRevokeFlags.SerialNumber != "" && newRevokeFlags.CrtFilePath != "" {
+		return microerror.Maskf(invalidConfigError, "--serial and --crt-file must not be used together")
+	}
+
+	return nil
+}
+
+func revokeRun(cmd *cobra.Command, args []string) {
+	err := revokeValidate(newRevokeFlags)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	serialNumber := newRevokeFlags.SerialNumber
+	if newRevokeFlags.CrtFilePath != "" {
+		serialNumber, err = readSerialNumber(newRevokeFlags.CrtFilePath)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+	}
+
+	// Create a certificate signer of the selected backend to revoke the
+	// certificate.
+	newCertSigner := newCertSignerFromFlags()
+
+	newRevokeConfig := spec.RevokeConfig{
+		ClusterID:    newRevokeFlags.ClusterID,
+		SerialNumber: serialNumber,
+	}
+	newRevokeResponse, err := newCertSigner.RevokeWithContext(ctx, newRevokeConfig)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	fmt.Printf("Revoked certificate with the following serial number at %s.\n", newRevokeResponse.RevocationTime.Format("2006-01-02T15:04:05Z07:00"))
+	fmt.Printf("\n")
+	fmt.Printf("    %s\n", serialNumber)
+	fmt.Printf("\n")
+	fmt.Printf("The certificate is listed in the CRL of cluster ID '%s' from now on.\n", newRevokeFlags.ClusterID)
+}
+
+// readSerialNumber reads the PEM encoded certificate at path and returns its
+// serial number in the format used by Vault.
+func readSerialNumber(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", microerror.Maskf(invalidConfigError, "'%s' does not contain a PEM encoded certificate", path)
+	}
+	crt, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", microerror.Maskf(invalidConfigError, "'%s' does not contain a valid certificate: %s", path, err)
+	}
+
+	return pki.FormatSerialNumber(crt.SerialNumber.Bytes()), nil
+}
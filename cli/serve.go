@@ -0,0 +1,290 @@
+package cli
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	apiserver "github.com/giantswarm/certctl/v2/service/api-server"
+	"github.com/giantswarm/certctl/v2/service/metrics"
+)
+
+type serveFlags struct {
+	// Server
+	Address         string
+	AuditLogFile    string
+	ClientsFile     string
+	MetricsAddress  string
+	TLSCertFile     string
+	TLSClientCAFile string
+	TLSKeyFile      string
+
+	// Role
+	AllowedDomains   []string
+	AllowBareDomains bool
+	AllowedURISANs   []string
+	RoleTTL          string
+}
+
+// clientsFile is the format of the file given by --clients-file.
+type clientsFile struct {
+	Clients []apiserver.Client `json:"clients"`
+}
+
+var (
+	serveCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "Serve an HTTP API to issue certificates, sign CSRs, revoke certificates and retrieve root CAs, authenticated by client certificates.",
+		Run:   serveRun,
+	}
+
+	newServeFlags = &serveFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&newServeFlags.Address, "address", ":8443", "Address the API is served on with TLS.")
+	serveCmd.Flags().StringVar(&newServeFlags.AuditLogFile, "audit-log-file", "", "File path audit log entries of all requests are appended to as JSON. Defaults to writing them to stderr regardless of --log-level.")
+	serveCmd.Flags().StringVar(&newServeFlags.ClientsFile, "clients-file", "", "File path of the YAML file holding the clients and the cluster IDs, domains and organizations they may request.")
+	serveCmd.Flags().StringVar(&newServeFlags.MetricsAddress, "metrics-address", "", "Address the metrics are served on under /metrics without TLS. Metrics are not served if empty.")
+	serveCmd.Flags().StringVar(&newServeFlags.TLSCertFile, "tls-cert-file", "", "File path of the PEM encoded server certificate.")
+	serveCmd.Flags().StringVar(&newServeFlags.TLSClientCAFile, "tls-client-ca-file", "", "File path of the PEM encoded CA certificates client certificates are verified with.")
+	serveCmd.Flags().StringVar(&newServeFlags.TLSKeyFile, "tls-key-file", "", "File path of the PEM encoded server private key.")
+
+	serveCmd.Flags().StringSliceVar(&newServeFlags.AllowedDomains, "allowed-domains", nil, "Comma separated domains allowed by roles created for organizations requested the first time.")
+	serveCmd.Flags().BoolVar(&newServeFlags.AllowBareDomains, "allow-bare-domains", false, "Allow bare domains in roles created for organizations requested the first time. (Default false)")
+	serveCmd.Flags().StringSliceVar(&newServeFlags.AllowedURISANs, "allowed-uri-sans", nil, "Comma separated URI SANs allowed by roles created for organizations requested the first time.")
+	serveCmd.Flags().StringVar(&newServeFlags.RoleTTL, "role-ttl", "8640h", "TTL of roles created for organizations requested the first time.") // 1 year
+}
+
+func serveValidate(newServeFlags *serveFlags) error {
+	err := backendValidate()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if newServeFlags.Address == "" {
+		return microerror.Maskf(invalidConfigError, "--address must not be empty")
+	}
+	if newServeFlags.ClientsFile == "" {
+		return microerror.Maskf(invalidConfigError, "--clients-file must not be empty")
+	}
+	if newServeFlags.TLSCertFile == "" || newServeFlags.TLSKeyFile == "" {
+		return microerror.Maskf(invalidConfigError, "--tls-cert-file and --tls-key-file must not be empty")
+	}
+	if newServeFlags.TLSClientCAFile == "" {
+		return microerror.Maskf(invalidConfigError, "--tls-client-ca-file must not be empty")
+	}
+
+	return nil
+}
+
+func serveRun(cmd *cobra.Command, args []string) {
+	err := serveValidate(newServeFlags)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// The server runs until it is interrupted or terminated. --timeout bounds
+	// each request instead.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	var clients clientsFile
+	err = readYAMLFile(newServeFlags.ClientsFile, &clients)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	tlsConfig, err := newServerTLSConfig(newServeFlags.TLSCertFile, newServeFlags.TLSKeyFile, newServeFlags.TLSClientCAFile, tls.RequireAndVerifyClientCert)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	auditLogger, closeAuditLog, err := newAuditLogger(newServeFlags.AuditLogFile)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+	defer closeAuditLog()
+
+	newCertSigner, pkiService := newCertSignerAndPKIServiceFromFlags()
+
+	var handler http.Handler
+	{
+		apiServerConfig := apiserver.DefaultConfig()
+		apiServerConfig.AuditLogger = auditLogger
+		apiServerConfig.CertSigner = newCertSigner
+		apiServerConfig.Logger = logger
+		apiServerConfig.PKIService = pkiService
+		apiServerConfig.Clients = clients.Clients
+		apiServerConfig.AllowedDomains = newServeFlags.AllowedDomains
+		apiServerConfig.AllowBareDomains = newServeFlags.AllowBareDomains
+		apiServerConfig.AllowedURISANs = newServeFlags.AllowedURISANs
+		apiServerConfig.RoleTTL = newServeFlags.RoleTTL
+		apiServerConfig.Timeout = timeout
+		handler, err = apiserver.New(apiServerConfig)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+	}
+
+	server := &http.Server{
+		Addr:              newServeFlags.Address,
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	logger.LogCtx(ctx, "level", "info", "message", "serving API", "address", newServeFlags.Address)
+
+	err = serveUntilDone(ctx, server, newServeFlags.MetricsAddress)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+}
+
+// readYAMLFile reads the YAML file at the given path, e.g. a clients file,
+// into v. Unknown fields are rejected.
+func readYAMLFile(path string, v interface{}) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = yaml.UnmarshalStrict(b, v)
+	if err != nil {
+		return microerror.Maskf(invalidConfigError, "cannot parse file '%s': %s", path, err)
+	}
+
+	return nil
+}
+
+// newAuditLogger returns the logger audit log entries are written to. These
+// are appended to the file at the given path as JSON, or written to stderr in
+// the format of --log-format if the path is empty. Unlike the main logger, it
+// is never filtered by --log-level, so that no entry gets lost. The returned
+// function closes the file.
+func newAuditLogger(path string) (micrologger.Logger, func(), error) {
+	if path == "" {
+		if logFormat == LogFormatText {
+			return newTextLogger(os.Stderr), func() {}, nil
+		}
+
+		auditLogger, err := micrologger.New(micrologger.Config{IOWriter: os.Stderr})
+		if err != nil {
+			return nil, nil, microerror.Mask(err)
+		}
+
+		return auditLogger, func() {}, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, os.FileMode(0600))
+	if err != nil {
+		return nil, nil, microerror.Mask(err)
+	}
+
+	auditLogger, err := micrologger.New(micrologger.Config{IOWriter: f})
+	if err != nil {
+		f.Close()
+		return nil, nil, microerror.Mask(err)
+	}
+
+	return auditLogger, func() { f.Close() }, nil
+}
+
+// newServerTLSConfig returns the TLS configuration of servers using the given
+// server key pair. Client certificates are verified with the CAs in the
+// given file according to clientAuth. Client certificates are not requested
+// if the file is empty.
+func newServerTLSConfig(certFile, keyFile, clientCAFile string, clientAuth tls.ClientAuthType) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		clientCAs, err := readCertPool(clientCAFile)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+		tlsConfig.ClientAuth = clientAuth
+		tlsConfig.ClientCAs = clientCAs
+	}
+
+	return tlsConfig, nil
+}
+
+// readCertPool reads the PEM encoded CA certificates of the given file.
+func readCertPool(path string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(b) {
+		return nil, microerror.Maskf(invalidConfigError, "client CA file '%s' does not contain PEM encoded certificates", path)
+	}
+
+	return certPool, nil
+}
+
+// serveUntilDone serves the given TLS server, and the metrics on
+// metricsAddress if given, until the context is done. Then the servers are
+// shut down gracefully.
+func serveUntilDone(ctx context.Context, server *http.Server, metricsAddress string) error {
+	serveErrors := make(chan error, 2)
+	go func() {
+		serveErrors <- server.ListenAndServeTLS("", "")
+	}()
+
+	var metricsServer *http.Server
+	if metricsAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsServer = &http.Server{
+			Addr:              metricsAddress,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			serveErrors <- metricsServer.ListenAndServe()
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+	case err := <-serveErrors:
+		return microerror.Mask(err)
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer shutdownCancel()
+
+	err := server.Shutdown(shutdownCtx)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if metricsServer != nil {
+		err = metricsServer.Shutdown(shutdownCtx)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	return nil
+}
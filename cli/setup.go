@@ -1,24 +1,21 @@
 package cli
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"strings"
 
 	"github.com/giantswarm/microerror"
-	vaultclient "github.com/hashicorp/vault/api"
 	"github.com/spf13/cobra"
 
+	"github.com/giantswarm/certctl/v2/service/backup"
+	mountpath "github.com/giantswarm/certctl/v2/service/mount-path"
 	"github.com/giantswarm/certctl/v2/service/pki"
+	"github.com/giantswarm/certctl/v2/service/spiffe"
 	"github.com/giantswarm/certctl/v2/service/token"
-	vaultfactory "github.com/giantswarm/certctl/v2/service/vault-factory"
 )
 
 type setupFlags struct {
-	// Vault
-	VaultAddress string
-	VaultToken   string
-	VaultTLS     *vaultclient.TLSConfig
-
 	// Cluster
 	ClusterID string
 
@@ -27,10 +24,26 @@ type setupFlags struct {
 	CommonName       string
 	CATTL            string
 	AllowBareDomains bool
+	AllowedOtherSANs []string
+	PKIBaseURL       string
+	AutoTidyInterval string
+	TidySafetyBuffer string
+
+	// SPIFFE
+	SPIFFETrustDomain string
+	SPIFFEPathFormat  string
 
 	// Token
 	NumTokens int
 	TokenTTL  string
+	WrapTTL   string
+
+	// Backup
+	BackupFilePath     string
+	PassphraseFilePath string
+
+	// Plan
+	DryRun bool
 }
 
 var (
@@ -40,43 +53,58 @@ var (
 		Run:   setupRun,
 	}
 
-	newSetupFlags = &setupFlags{
-		VaultTLS: &vaultclient.TLSConfig{},
-	}
+	newSetupFlags = &setupFlags{}
 )
 
 func init() {
 	CLICmd.AddCommand(setupCmd)
 
-	setupCmd.Flags().StringVar(&newSetupFlags.VaultAddress, "vault-addr", fromEnvToString(EnvVaultAddress, "http://127.0.0.1:8200"), "Address used to connect to Vault.")
-	setupCmd.Flags().StringVar(&newSetupFlags.VaultToken, "vault-token", fromEnvToString(EnvVaultToken, ""), "Token used to authenticate against Vault.")
-	setupCmd.Flags().StringVar(&newSetupFlags.VaultTLS.CACert, "vault-cacert", fromEnvToString(EnvVaultCACert, ""), "The path to a PEM-encoded CA cert file to use to verify the Vault server SSL certificate.")
-	setupCmd.Flags().StringVar(&newSetupFlags.VaultTLS.CAPath, "vault-capath", fromEnvToString(EnvVaultCAPath, ""), "The path to a directory of PEM-encoded CA cert files to verify the Vault server SSL certificate.")
-	setupCmd.Flags().StringVar(&newSetupFlags.VaultTLS.ClientCert, "vault-client-cert", fromEnvToString(EnvVaultClientCert, ""), "The path to the certificate for Vault communication.")
-	setupCmd.Flags().StringVar(&newSetupFlags.VaultTLS.ClientKey, "vault-client-key", fromEnvToString(EnvVaultClientKey, ""), "The path to the private key for Vault communication.")
-	setupCmd.Flags().StringVar(&newSetupFlags.VaultTLS.TLSServerName, "vault-tls-server-name", fromEnvToString(EnvVaultTLSServerName, ""), "If set, is used to set the SNI host when connecting via TLS.")
-	setupCmd.Flags().BoolVar(&newSetupFlags.VaultTLS.Insecure, "vault-tls-skip-verify", fromEnvBool(EnvVaultInsecure, false), "Do not verify TLS certificate.")
-
 	setupCmd.Flags().StringVar(&newSetupFlags.ClusterID, "cluster-id", "", "Cluster ID used to generate a new root CA for.")
 
 	setupCmd.Flags().StringVar(&newSetupFlags.AllowedDomains, "allowed-domains", "", "Comma separated domains allowed to authenticate against the cluster's root CA.")
 	setupCmd.Flags().StringVar(&newSetupFlags.CommonName, "common-name", "", "Common name used to generate a new root CA for.")
 	setupCmd.Flags().StringVar(&newSetupFlags.CATTL, "ca-ttl", "86400h", "TTL used to generate a new root CA.") // 10 years
 	setupCmd.Flags().BoolVar(&newSetupFlags.AllowBareDomains, "allow-bare-domains", false, "Allow issuing certs for bare domains. (Default false)")
+	setupCmd.Flags().StringSliceVar(&newSetupFlags.AllowedOtherSANs, "allowed-other-sans", nil, "Comma separated custom OID/UTF8-string SANs allowed by the cluster's PKI role, in the format '<oid>;UTF8:<value>'. A '*' matches any sequence of characters.")
+	setupCmd.Flags().StringVar(&newSetupFlags.AutoTidyInterval, "auto-tidy-interval", "", "If set, let Vault remove expired certificates from the PKI backend in this interval, e.g. '24h'. Requires Vault 1.12 or later.")
+	setupCmd.Flags().StringVar(&newSetupFlags.TidySafetyBuffer, "tidy-safety-buffer", "72h", "Duration certificates must have been expired for before auto-tidy removes them.")
+	setupCmd.Flags().StringVar(&newSetupFlags.PKIBaseURL, "pki-base-url", "", "If set, configure the issuing certificate and CRL distribution point URLs embedded into issued certificates relative to this address, e.g. 'https://vault.example.com:8200'.")
+
+	setupCmd.Flags().StringVar(&newSetupFlags.SPIFFETrustDomain, "spiffe-trust-domain", "", "If set, allow the cluster's PKI role to issue certificates for SPIFFE IDs of this trust domain, e.g. 'example.org'.")
+	setupCmd.Flags().StringVar(&newSetupFlags.SPIFFEPathFormat, "spiffe-path-format", spiffe.DefaultPathFormat, "Go template of the SPIFFE ID paths allowed for the cluster, rendered with {{.ClusterID}}. A '*' matches any sequence of characters.")
 
 	setupCmd.Flags().IntVar(&newSetupFlags.NumTokens, "num-tokens", 1, "Number of tokens to generate.")
 	setupCmd.Flags().StringVar(&newSetupFlags.TokenTTL, "token-ttl", "720h", "TTL used to generate new tokens.")
+	setupCmd.Flags().StringVar(&newSetupFlags.WrapTTL, "wrap-ttl", "", "If set, print single-use wrapping tokens valid for this TTL instead of the generated tokens. Use 'certctl unwrap' to obtain the actual tokens.")
+
+	setupCmd.Flags().StringVar(&newSetupFlags.BackupFilePath, "backup-file", "", "If set, generate the root CA in exported mode and write an encrypted backup archive including its private key to this file path. Without it, the root CA cannot be restored once the PKI backend is deleted.")
+	setupCmd.Flags().StringVar(&newSetupFlags.PassphraseFilePath, "backup-passphrase-file", "", fmt.Sprintf("File path used to read the archive passphrase from. Defaults to the value of %s.", EnvBackupPassphrase))
+
+	setupCmd.Flags().BoolVar(&newSetupFlags.DryRun, "dry-run", false, "Only print the actions setup would take without changing anything. (Default false)")
 }
 
 func setupValidate(newSetupFlags *setupFlags) error {
-	if newSetupFlags.VaultToken == "" {
-		return microerror.Maskf(invalidConfigError, "Vault token must not be empty")
+	err := backendValidate()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if backend == BackendLocal {
+		if newSetupFlags.AutoTidyInterval != "" || newSetupFlags.PKIBaseURL != "" {
+			return microerror.Maskf(notSupportedError, "--auto-tidy-interval and --pki-base-url are only supported by --backend %s", BackendVault)
+		}
+		if newSetupFlags.WrapTTL != "" || newSetupFlags.BackupFilePath != "" {
+			return microerror.Maskf(notSupportedError, "--wrap-ttl and --backup-file are only supported by --backend %s", BackendVault)
+		}
+		if len(newSetupFlags.AllowedOtherSANs) != 0 {
+			return microerror.Maskf(notSupportedError, "--allowed-other-sans is only supported by --backend %s", BackendVault)
+		}
 	}
 	if newSetupFlags.AllowedDomains == "" {
 		return microerror.Maskf(invalidConfigError, "allowed domains must not be empty")
 	}
-	if newSetupFlags.ClusterID == "" {
-		return microerror.Maskf(invalidConfigError, "cluster ID must not be empty")
+	err = mountpath.ValidateClusterID(newSetupFlags.ClusterID)
+	if err != nil {
+		return microerror.Mask(err)
 	}
 	if newSetupFlags.CommonName == "" {
 		return microerror.Maskf(invalidConfigError, "common name must not be empty")
@@ -88,89 +116,270 @@ func setupValidate(newSetupFlags *setupFlags) error {
 func setupRun(cmd *cobra.Command, args []string) {
 	err := setupValidate(newSetupFlags)
 	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
+		fatal(microerror.Mask(err))
 	}
 
-	// Create a Vault client factory.
-	newVaultFactoryConfig := vaultfactory.DefaultConfig()
-	newVaultFactoryConfig.Address = newSetupFlags.VaultAddress
-	newVaultFactoryConfig.AdminToken = newSetupFlags.VaultToken
-	newVaultFactoryConfig.TLS = newSetupFlags.VaultTLS
-	newVaultFactory, err := vaultfactory.New(newVaultFactoryConfig)
-	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
-	}
+	ctx, cancel := newContext()
+	defer cancel()
 
-	// Create a Vault client and configure it with the provided admin token
-	// through the factory.
-	newVaultClient, err := newVaultFactory.NewClient()
-	if err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
-	}
+	// Create the services of the selected backend. The local backend has no
+	// tokens, so tokenService is nil then.
+	pkiService, tokenService, newVaultClient := newPKIServiceFromFlags()
 
-	// Create a PKI controller to setup the cluster's PKI backend including its
-	// root CA and role.
-	var pkiService pki.Service
-	{
-		pkiConfig := pki.DefaultServiceConfig()
-		pkiConfig.VaultClient = newVaultClient
-		pkiService, err = pki.NewService(pkiConfig)
+	// Compute the URI SANs allowed by the cluster's role in case SPIFFE IDs
+	// are requested.
+	var allowedURISANs []string
+	if newSetupFlags.SPIFFETrustDomain != "" {
+		spiffeConfig := spiffe.DefaultConfig()
+		spiffeConfig.TrustDomain = newSetupFlags.SPIFFETrustDomain
+		spiffeConfig.PathFormat = newSetupFlags.SPIFFEPathFormat
+		spiffeScheme, err := spiffe.New(spiffeConfig)
 		if err != nil {
-			log.Fatalf("%#v\n", microerror.Mask(err))
+			fatal(microerror.Mask(err))
 		}
+		allowedURISANs = append(allowedURISANs, spiffeScheme.AllowedURISAN(newSetupFlags.ClusterID))
 	}
 
-	// Create a token generator to create new tokens for the current cluster.
-	var tokenService token.Service
-	{
-		tokenConfig := token.DefaultServiceConfig()
-		tokenConfig.VaultClient = newVaultClient
-		tokenService, err = token.NewService(tokenConfig)
+	// Compute the actions necessary to set up the cluster. In case of a dry
+	// run, they are only printed.
+	// Read the backup passphrase before changing anything, so that a missing
+	// passphrase does not leave an exported root CA behind that cannot be
+	// written anywhere.
+	var passphrase []byte
+	if newSetupFlags.BackupFilePath != "" && !newSetupFlags.DryRun {
+		passphrase, err = readBackupPassphrase(newSetupFlags.PassphraseFilePath)
 		if err != nil {
-			log.Fatalf("%#v\n", microerror.Mask(err))
+			fatal(microerror.Mask(err))
 		}
 	}
 
+	actions, err := setupPlan(ctx, pkiService, tokenService, newSetupFlags, allowedURISANs)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+	if newSetupFlags.DryRun {
+		printPlan(newSetupFlags.ClusterID, actions)
+		fmt.Printf("Dry run, no changes have been made.\n")
+		return
+	}
+
 	// Setup PKI backend for cluster.
+	var createResponse pki.CreateResponse
 	{
 		createConfig := pki.CreateConfig{
 			AllowedDomains:   newSetupFlags.AllowedDomains,
+			AllowedURISANs:   allowedURISANs,
+			AllowedOtherSANs: newSetupFlags.AllowedOtherSANs,
 			ClusterID:        newSetupFlags.ClusterID,
 			CommonName:       newSetupFlags.CommonName,
+			ExportCA:         newSetupFlags.BackupFilePath != "",
 			TTL:              newSetupFlags.CATTL,
 			AllowBareDomains: newSetupFlags.AllowBareDomains,
+			PKIBaseURL:       newSetupFlags.PKIBaseURL,
+			AutoTidyInterval: newSetupFlags.AutoTidyInterval,
+			TidySafetyBuffer: newSetupFlags.TidySafetyBuffer,
+		}
+		createResponse, err = pkiService.CreateWithContext(ctx, createConfig)
+		if err != nil {
+			fatal(microerror.Mask(err))
 		}
-		err = pkiService.Create(createConfig)
+	}
+
+	// Back up the PKI backend including the exported root CA right away. The
+	// private key is never returned again, so it must not get lost in case
+	// any of the following steps fails.
+	var backupService backup.Service
+	if newSetupFlags.BackupFilePath != "" {
+		backupConfig := backup.DefaultConfig()
+		backupConfig.Logger = logger
+		backupConfig.PKIService = pkiService
+		backupConfig.TokenService = tokenService
+		backupConfig.VaultClient = newVaultClient
+		backupService, err = backup.New(backupConfig)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+
+		err = setupBackup(ctx, backupService, newSetupFlags, createResponse.CAPrivateKey, passphrase)
 		if err != nil {
-			log.Fatalf("%#v\n", microerror.Mask(err))
+			fatal(microerror.Mask(err))
 		}
 	}
 
 	// Generate tokens for the cluster VMs.
 	var tokens []string
-	{
+	if tokenService != nil {
 		createConfig := token.CreateConfig{
 			ClusterID: newSetupFlags.ClusterID,
 			Num:       newSetupFlags.NumTokens,
 			TTL:       newSetupFlags.TokenTTL,
+			WrapTTL:   newSetupFlags.WrapTTL,
+		}
+		tokens, err = tokenService.CreateWithContext(ctx, createConfig)
+		if err != nil {
+			fatal(microerror.Mask(err))
 		}
-		tokens, err = tokenService.Create(createConfig)
+	}
+
+	// The policies are created along with the tokens, so the backup is
+	// written again to include them.
+	if backupService != nil && tokenService != nil {
+		err = setupBackup(ctx, backupService, newSetupFlags, createResponse.CAPrivateKey, passphrase)
 		if err != nil {
-			log.Fatalf("%#v\n", microerror.Mask(err))
+			fatal(microerror.Mask(err))
 		}
 	}
 
 	fmt.Printf("Set up cluster for ID '%s':\n", newSetupFlags.ClusterID)
 	fmt.Printf("\n")
-	fmt.Printf("    - PKI backend mounted\n")
-	fmt.Printf("    - Root CA generated\n")
-	fmt.Printf("    - PKI role created\n")
-	fmt.Printf("    - PKI policy created\n")
+	printDone(actions)
 	fmt.Printf("\n")
-	fmt.Printf("The following tokens have been generated for this cluster:\n")
+	if tokenService == nil {
+		return
+	}
+	if newSetupFlags.WrapTTL != "" {
+		fmt.Printf("The following wrapping tokens have been generated for this cluster.\n")
+		fmt.Printf("Each of them can be unwrapped exactly once within %s:\n", newSetupFlags.WrapTTL)
+	} else {
+		fmt.Printf("The following tokens have been generated for this cluster:\n")
+	}
 	fmt.Printf("\n")
 	for _, t := range tokens {
 		fmt.Printf("    %s\n", t)
 	}
 	fmt.Printf("\n")
 }
+
+// setupBackup backs up the PKI backend of the cluster set up and writes the
+// archive to --backup-file.
+func setupBackup(ctx context.Context, backupService backup.Service, newSetupFlags *setupFlags, caPrivateKey string, passphrase []byte) error {
+	backupConfig := backup.BackupConfig{
+		ClusterID:    newSetupFlags.ClusterID,
+		CAPrivateKey: caPrivateKey,
+	}
+	archive, err := backupService.BackupWithContext(ctx, backupConfig)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	err = writeArchiveFile(newSetupFlags.BackupFilePath, archive, passphrase)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// setupPlan computes the actions setup takes for the given flags, based on
+// what is already set up in Vault.
+func setupPlan(ctx context.Context, pkiService pki.Service, tokenService token.Service, newSetupFlags *setupFlags, allowedURISANs []string) ([]planAction, error) {
+	var actions []planAction
+
+	mounted, err := pkiService.IsMountedWithContext(ctx, newSetupFlags.ClusterID)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	if !mounted {
+		actions = append(actions, planAction{
+			Plan: fmt.Sprintf("Mount PKI backend at '%s'", pkiService.MountPKIPath(newSetupFlags.ClusterID)),
+			Done: "PKI backend mounted",
+		})
+	}
+
+	generated, err := pkiService.IsCAGeneratedWithContext(ctx, newSetupFlags.ClusterID)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	if !generated {
+		actions = append(actions, planAction{
+			Plan: fmt.Sprintf("Generate root CA with common name '%s' and TTL %s", newSetupFlags.CommonName, newSetupFlags.CATTL),
+			Done: "Root CA generated",
+		})
+	}
+
+	roleCreated, err := pkiService.IsRoleCreatedWithContext(ctx, newSetupFlags.ClusterID)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	if !roleCreated {
+		actions = append(actions, planAction{
+			Plan: fmt.Sprintf("Create PKI role '%s' for allowed domains '%s'", pkiService.RoleName(newSetupFlags.ClusterID), newSetupFlags.AllowedDomains),
+			Done: "PKI role created",
+		})
+	}
+
+	// The allowed URI SANs are written on every call to setup, so that SPIFFE
+	// IDs can be enabled for existing clusters as well.
+	if len(allowedURISANs) != 0 {
+		actions = append(actions, planAction{
+			Plan: fmt.Sprintf("Allow URI SANs '%s' on PKI role '%s'", strings.Join(allowedURISANs, ","), pkiService.RoleName(newSetupFlags.ClusterID)),
+			Done: "URI SANs allowed on PKI role",
+		})
+	}
+	if len(newSetupFlags.AllowedOtherSANs) != 0 {
+		actions = append(actions, planAction{
+			Plan: fmt.Sprintf("Allow other SANs '%s' on PKI role '%s'", strings.Join(newSetupFlags.AllowedOtherSANs, ","), pkiService.RoleName(newSetupFlags.ClusterID)),
+			Done: "Other SANs allowed on PKI role",
+		})
+	}
+
+	// Auto-tidy is configured on every call to setup, so that a changed
+	// interval takes effect for existing clusters as well.
+	if newSetupFlags.AutoTidyInterval != "" {
+		actions = append(actions, planAction{
+			Plan: fmt.Sprintf("Enable auto-tidy every %s with safety buffer %s", newSetupFlags.AutoTidyInterval, newSetupFlags.TidySafetyBuffer),
+			Done: "Auto-tidy enabled",
+		})
+	}
+
+	// The URLs are written on every call to setup, so that changing them
+	// takes effect for existing clusters as well.
+	if newSetupFlags.PKIBaseURL != "" {
+		actions = append(actions, planAction{
+			Plan: fmt.Sprintf("Configure issuing certificate and CRL distribution point URLs below '%s'", newSetupFlags.PKIBaseURL),
+			Done: "Issuing certificate and CRL distribution point URLs configured",
+		})
+	}
+
+	// The local backend has neither policies nor tokens.
+	if tokenService != nil {
+		policyCreated, err := tokenService.IsPolicyCreatedWithContext(ctx, newSetupFlags.ClusterID)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+		if !policyCreated {
+			actions = append(actions, planAction{
+				Plan: fmt.Sprintf("Write PKI policy '%s'", tokenService.PolicyName(newSetupFlags.ClusterID)),
+				Done: "PKI policy created",
+			})
+		}
+
+		orgPolicyCreated, err := tokenService.IsOrgPolicyCreatedWithContext(ctx, newSetupFlags.ClusterID)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+		if !orgPolicyCreated {
+			actions = append(actions, planAction{
+				Plan: fmt.Sprintf("Write PKI org policy '%s'", tokenService.OrgPolicyName(newSetupFlags.ClusterID)),
+				Done: "PKI org policy created",
+			})
+		}
+
+		// Tokens are created on every call to setup.
+		actions = append(actions, planAction{
+			Plan: fmt.Sprintf("Create %d token(s) with TTL %s", newSetupFlags.NumTokens, newSetupFlags.TokenTTL),
+			Done: fmt.Sprintf("%d token(s) created", newSetupFlags.NumTokens),
+		})
+	}
+
+	if newSetupFlags.BackupFilePath != "" {
+		if generated {
+			return nil, microerror.Maskf(invalidConfigError, "root CA for cluster ID '%s' is already generated and cannot be exported for --backup-file anymore", newSetupFlags.ClusterID)
+		}
+		actions = append(actions, planAction{
+			Plan: fmt.Sprintf("Write encrypted backup archive including the root CA private key to '%s'", newSetupFlags.BackupFilePath),
+			Done: "Backup archive written",
+		})
+	}
+
+	return actions, nil
+}
@@ -0,0 +1,262 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/v2/service/exitcode"
+	mountpath "github.com/giantswarm/certctl/v2/service/mount-path"
+	"github.com/giantswarm/certctl/v2/service/pki"
+	vaultfactory "github.com/giantswarm/certctl/v2/service/vault-factory"
+)
+
+const (
+	tidyStateError    = "Error"
+	tidyStateFinished = "Finished"
+	tidyStateRunning  = "Running"
+
+	// tidyStateStarted is reported in case Vault does not provide the status
+	// of tidy operations, which is the case for older Vault versions.
+	tidyStateStarted = "Started"
+)
+
+type tidyFlags struct {
+	// Cluster
+	All       bool
+	ClusterID string
+
+	// Tidy
+	SafetyBuffer time.Duration
+	Wait         bool
+	WaitTimeout  time.Duration
+
+	// Output
+	Output string
+}
+
+// tidyReportItem is the result of tidying a single cluster as printed by
+// tidy.
+type tidyReportItem struct {
+	ClusterID string `json:"cluster_id"`
+	pki.TidyStatus
+}
+
+var (
+	tidyCmd = &cobra.Command{
+		Use:   "tidy",
+		Short: "Remove expired certificates from the certificate store and CRL of PKI backends.",
+		Run:   tidyRun,
+	}
+
+	newTidyFlags = &tidyFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(tidyCmd)
+
+	tidyCmd.Flags().BoolVar(&newTidyFlags.All, "all", false, "Tidy the PKI backends of all clusters mounted according to the mount path scheme. (Default false)")
+	tidyCmd.Flags().StringVar(&newTidyFlags.ClusterID, "cluster-id", "", "Cluster ID of the PKI backend to tidy.")
+
+	tidyCmd.Flags().DurationVar(&newTidyFlags.SafetyBuffer, "safety-buffer", 72*time.Hour, "Duration certificates must have been expired for before they are removed.")
+	tidyCmd.Flags().BoolVar(&newTidyFlags.Wait, "wait", true, "Wait for Vault to finish tidying to report the number of removed certificates.")
+	tidyCmd.Flags().DurationVar(&newTidyFlags.WaitTimeout, "wait-timeout", 10*time.Minute, "Maximum duration to wait for a single PKI backend to be tidied.")
+
+	tidyCmd.Flags().StringVar(&newTidyFlags.Output, "output", OutputText, "Output format, either 'text' or 'json'.")
+}
+
+func tidyValidate(newTidyFlags *tidyFlags) error {
+	err := vaultBackendValidate("tidy")
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if newVaultFlags.Token == "" {
+		return microerror.Maskf(invalidConfigError, "Vault token must not be empty")
+	}
+	if newTidyFlags.ClusterID == "" && !newTidyFlags.All {
+		return microerror.Maskf(invalidConfigError, "--cluster-id or --all must be given")
+	}
+	if newTidyFlags.ClusterID != "" && newTidyFlags.All {
+		return microerror.Maskf(invalidConfigError, "--cluster-id and --all must not be used together")
+	}
+	if newTidyFlags.ClusterID != "" {
+		err = mountpath.ValidateClusterID(newTidyFlags.ClusterID)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+	if newTidyFlags.SafetyBuffer <= 0 {
+		return microerror.Maskf(invalidConfigError, "--safety-buffer must be positive")
+	}
+	err = outputValidate(newTidyFlags.Output)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func tidyRun(cmd *cobra.Command, args []string) {
+	err := tidyValidate(newTidyFlags)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	// Create a mount path scheme shared by all services.
+	newMountPathSchemeConfig := mountpath.DefaultConfig()
+	newMountPathSchemeConfig.Format = newVaultFlags.MountPathFormat
+	newMountPathScheme, err := mountpath.New(newMountPathSchemeConfig)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// Create a Vault client factory.
+	newVaultFactoryConfig := vaultfactory.DefaultConfig()
+	newVaultFactoryConfig.Logger = logger
+	newVaultFactoryConfig.Addresses = vaultAddresses(newVaultFlags.Address)
+	newVaultFactoryConfig.AdminToken = newVaultFlags.Token
+	newVaultFactoryConfig.TLS = newVaultFlags.TLS
+	newVaultFactoryConfig.Namespace = newVaultFlags.Namespace
+	newVaultFactory, err := vaultfactory.New(newVaultFactoryConfig)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// Create a Vault client and configure it with the provided admin token
+	// through the factory.
+	newVaultClient, err := newVaultFactory.NewClient()
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// Create a PKI controller to tidy the PKI backends.
+	var pkiService pki.Service
+	{
+		pkiConfig := pki.DefaultServiceConfig()
+		pkiConfig.Logger = logger
+		pkiConfig.MountPathScheme = newMountPathScheme
+		pkiConfig.VaultClient = newVaultClient
+		pkiService, err = pki.NewService(pkiConfig)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+	}
+
+	clusterIDs := []string{newTidyFlags.ClusterID}
+	if newTidyFlags.All {
+		mounts, err := pkiService.ListWithContext(ctx)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+		clusterIDs = nil
+		for _, m := range mounts {
+			clusterIDs = append(clusterIDs, m.ClusterID)
+		}
+	}
+
+	// PKI backends are tidied one after another to not put all the load on
+	// Vault's storage at once.
+	items := []tidyReportItem{}
+	failed := false
+	for _, clusterID := range clusterIDs {
+		status, err := tidyCluster(ctx, pkiService, clusterID, newTidyFlags)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+		if status.State == tidyStateError {
+			failed = true
+		}
+
+		items = append(items, tidyReportItem{ClusterID: clusterID, TidyStatus: status})
+	}
+
+	if newTidyFlags.Output == OutputJSON {
+		err = printJSON(items)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintf(w, "CLUSTER ID\tSTATE\tCERTS REMOVED\tREVOKED REMOVED\tDURATION\tERROR\n")
+		for _, item := range items {
+			duration := "-"
+			if item.TimeStarted != nil && item.TimeFinished != nil {
+				duration = item.TimeFinished.Sub(*item.TimeStarted).Round(time.Millisecond).String()
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\n", item.ClusterID, item.State, item.CertStoreDeletedCount, item.RevokedCertDeletedCount, duration, orDash(item.Error))
+		}
+		err = w.Flush()
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+	}
+
+	if failed {
+		exit(exitcode.CheckFailed)
+	}
+}
+
+// tidyCluster starts tidying the PKI backend of the given cluster and, if
+// requested, waits for Vault to finish.
+func tidyCluster(ctx context.Context, pkiService pki.Service, clusterID string, newTidyFlags *tidyFlags) (pki.TidyStatus, error) {
+	// Vault keeps reporting the previous tidy operation until the new one is
+	// running, so the previous one is remembered to tell them apart.
+	previous, err := pkiService.TidyStatusWithContext(ctx, clusterID)
+	if err != nil && !pki.IsNotMounted(err) {
+		return pki.TidyStatus{}, microerror.Mask(err)
+	}
+
+	tidyConfig := pki.TidyConfig{
+		ClusterID:    clusterID,
+		SafetyBuffer: newTidyFlags.SafetyBuffer.String(),
+	}
+	err = pkiService.TidyWithContext(ctx, tidyConfig)
+	if err != nil {
+		return pki.TidyStatus{}, microerror.Mask(err)
+	}
+
+	if !newTidyFlags.Wait {
+		return pki.TidyStatus{State: tidyStateStarted}, nil
+	}
+
+	deadline := time.Now().Add(newTidyFlags.WaitTimeout)
+	for {
+		status, err := pkiService.TidyStatusWithContext(ctx, clusterID)
+		if pki.IsNotMounted(err) {
+			// The PKI backend was just tidied, so it is mounted and Vault is
+			// too old to report the status.
+			return pki.TidyStatus{State: tidyStateStarted}, nil
+		} else if err != nil {
+			return pki.TidyStatus{}, microerror.Mask(err)
+		}
+
+		if status.State != tidyStateRunning && !sameTime(status.TimeStarted, previous.TimeStarted) {
+			return status, nil
+		}
+		if time.Now().After(deadline) {
+			return status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return pki.TidyStatus{}, microerror.Mask(ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Equal(*b)
+}
@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+	"github.com/spf13/cobra"
+
+	vaultfactory "github.com/giantswarm/certctl/v2/service/vault-factory"
+	"github.com/giantswarm/certctl/v2/service/wrapping"
+)
+
+type unwrapFlags struct {
+	// Wrapping
+	WrappingToken         string
+	WrappingTokenFilePath string
+
+	// Path
+	OutFilePath string
+	CrtFilePath string
+	KeyFilePath string
+	CAFilePath  string
+}
+
+var (
+	unwrapCmd = &cobra.Command{
+		Use:   "unwrap",
+		Short: "Unwrap a wrapping token obtained from setup or issue and write its secret to files.",
+		Run:   unwrapRun,
+	}
+
+	newUnwrapFlags = &unwrapFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(unwrapCmd)
+
+	unwrapCmd.Flags().StringVar(&newUnwrapFlags.WrappingToken, "wrapping-token", "", "Wrapping token to unwrap. Prefer --wrapping-token-file to keep the token out of the process list.")
+	unwrapCmd.Flags().StringVar(&newUnwrapFlags.WrappingTokenFilePath, "wrapping-token-file", "", "File path used to read the wrapping token from.")
+
+	unwrapCmd.Flags().StringVar(&newUnwrapFlags.OutFilePath, "out-file", "", "File path used to write an unwrapped token to.")
+	unwrapCmd.Flags().StringVar(&newUnwrapFlags.CrtFilePath, "crt-file", "", "File path used to write an unwrapped public key to.")
+	unwrapCmd.Flags().StringVar(&newUnwrapFlags.KeyFilePath, "key-file", "", "File path used to write an unwrapped private key to.")
+	unwrapCmd.Flags().StringVar(&newUnwrapFlags.CAFilePath, "ca-file", "", "File path used to write an unwrapped root CA to.")
+}
+
+func unwrapValidate(newUnwrapFlags *unwrapFlags) error {
+	err := vaultBackendValidate("unwrap")
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if newUnwrapFlags.WrappingToken == "" && newUnwrapFlags.WrappingTokenFilePath == "" {
+		return microerror.Maskf(invalidConfigError, "--wrapping-token or --wrapping-token-file must not be empty")
+	}
+	if newUnwrapFlags.WrappingToken != "" && newUnwrapFlags.WrappingTokenFilePath != "" {
+		return microerror.Maskf(invalidConfigError, "--wrapping-token and --wrapping-token-file must not be used together")
+	}
+	if newUnwrapFlags.OutFilePath == "" && (newUnwrapFlags.CrtFilePath == "" || newUnwrapFlags.KeyFilePath == "" || newUnwrapFlags.CAFilePath == "") {
+		return microerror.Maskf(invalidConfigError, "--out-file or all of --crt-file, --key-file and --ca-file must not be empty")
+	}
+
+	return nil
+}
+
+func unwrapRun(cmd *cobra.Command, args []string) {
+	err := unwrapValidate(newUnwrapFlags)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	wrappingToken := newUnwrapFlags.WrappingToken
+	if newUnwrapFlags.WrappingTokenFilePath != "" {
+		b, err := os.ReadFile(newUnwrapFlags.WrappingTokenFilePath)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+		wrappingToken = strings.TrimSpace(string(b))
+	}
+
+	// Create a Vault client factory. Unwrapping is authenticated by the
+	// wrapping token itself, so no other token is required.
+	newVaultFactoryConfig := vaultfactory.DefaultConfig()
+	newVaultFactoryConfig.Logger = logger
+	newVaultFactoryConfig.Addresses = vaultAddresses(newVaultFlags.Address)
+	newVaultFactoryConfig.AdminToken = wrappingToken
+	newVaultFactoryConfig.TLS = newVaultFlags.TLS
+	newVaultFactoryConfig.Namespace = newVaultFlags.Namespace
+	newVaultFactory, err := vaultfactory.New(newVaultFactoryConfig)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	newVaultClient, err := newVaultFactory.NewClient()
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	// Create a wrapping service to unwrap the wrapped secret.
+	var wrappingService wrapping.Service
+	{
+		wrappingConfig := wrapping.DefaultConfig()
+		wrappingConfig.Logger = logger
+		wrappingConfig.VaultClient = newVaultClient
+		wrappingService, err = wrapping.New(wrappingConfig)
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+	}
+
+	newUnwrapResponse, err := wrappingService.UnwrapWithContext(ctx, wrappingToken)
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	if newUnwrapResponse.Token != "" {
+		if newUnwrapFlags.OutFilePath == "" {
+			fatal(microerror.Maskf(invalidConfigError, "--out-file must not be empty for a wrapped token"))
+		}
+		err = writeSecretFile(newUnwrapFlags.OutFilePath, []byte(newUnwrapResponse.Token))
+		if err != nil {
+			fatal(microerror.Mask(err))
+		}
+
+		fmt.Printf("Token written to '%s'.\n", newUnwrapFlags.OutFilePath)
+		return
+	}
+
+	if newUnwrapFlags.CrtFilePath == "" || newUnwrapFlags.KeyFilePath == "" || newUnwrapFlags.CAFilePath == "" {
+		fatal(microerror.Maskf(invalidConfigError, "--crt-file, --key-file and --ca-file must not be empty for a wrapped key pair"))
+	}
+	err = writeSecretFile(newUnwrapFlags.CrtFilePath, []byte(newUnwrapResponse.IssueResponse.Certificate))
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+	err = writeSecretFile(newUnwrapFlags.KeyFilePath, []byte(newUnwrapResponse.IssueResponse.PrivateKey))
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+	err = writeSecretFile(newUnwrapFlags.CAFilePath, []byte(newUnwrapResponse.IssueResponse.IssuingCA))
+	if err != nil {
+		fatal(microerror.Mask(err))
+	}
+
+	fmt.Printf("Unwrapped signed certificate with the following serial number.\n")
+	fmt.Printf("\n")
+	fmt.Printf("    %s\n", newUnwrapResponse.IssueResponse.SerialNumber)
+	fmt.Printf("\n")
+	fmt.Printf("Public key written to '%s'.\n", newUnwrapFlags.CrtFilePath)
+	fmt.Printf("Private key written to '%s'.\n", newUnwrapFlags.KeyFilePath)
+	fmt.Printf("Root CA written to '%s'.\n", newUnwrapFlags.CAFilePath)
+}
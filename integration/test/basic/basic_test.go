@@ -23,6 +23,7 @@ import (
 	"github.com/giantswarm/certctl/v2/service/spec"
 	"github.com/giantswarm/certctl/v2/service/token"
 	vaultfactory "github.com/giantswarm/certctl/v2/service/vault-factory"
+	"github.com/giantswarm/certctl/v2/service/wrapping"
 )
 
 func TestIssuance(t *testing.T) {
@@ -56,6 +57,67 @@ func TestIssuance(t *testing.T) {
 	}
 }
 
+func TestWrappedIssuance(t *testing.T) {
+	vaultAddr, err := getVaultAddr()
+	if err != nil {
+		t.Fatalf("could not create Vault address, %#v", err)
+	}
+
+	client, err := getVaultClient(vaultAddr)
+	if err != nil {
+		t.Fatalf("could not create Vault client, %#v", err)
+	}
+
+	err = waitForVault(client)
+	if err != nil {
+		t.Fatalf("timeout waiting for Vault, %#v", err)
+	}
+
+	wrappingToken, err := setUpWrapped(client)
+	if err != nil {
+		t.Fatalf("could not setup Vault PKI, %#v", err)
+	}
+
+	wrappingService, err := getWrappingService(client)
+	if err != nil {
+		t.Fatalf("could not create wrapping service, %#v", err)
+	}
+
+	unwrapResponse, err := wrappingService.UnwrapWithContext(context.TODO(), wrappingToken)
+	if err != nil {
+		t.Fatalf("could not unwrap token, %#v", err)
+	}
+	if unwrapResponse.Token == "" {
+		t.Fatalf("expected unwrapped token, got none")
+	}
+
+	// Wrapping tokens are single-use, so unwrapping again must fail.
+	_, err = wrappingService.UnwrapWithContext(context.TODO(), wrappingToken)
+	if err == nil {
+		t.Fatalf("expected second unwrap of the same wrapping token to fail")
+	}
+
+	c.Logger.Log("level", "debug", "message", "setup Vault PKI with wrapped token delivery successful")
+
+	client.SetToken(unwrapResponse.Token)
+
+	wrappedKeyPairToken, err := issueWrappedCerts(client)
+	if err != nil {
+		t.Fatalf("could not issue wrapped signed certificates, %#v", err)
+	}
+
+	unwrapResponse, err = wrappingService.UnwrapWithContext(context.TODO(), wrappedKeyPairToken)
+	if err != nil {
+		t.Fatalf("could not unwrap key pair, %#v", err)
+	}
+	if unwrapResponse.IssueResponse == nil {
+		t.Fatalf("expected unwrapped key pair, got none")
+	}
+	if unwrapResponse.IssueResponse.Certificate == "" || unwrapResponse.IssueResponse.PrivateKey == "" {
+		t.Fatalf("expected unwrapped key pair to contain certificate and private key")
+	}
+}
+
 func setUp(client *vaultclient.Client) (string, error) {
 	pkiService, err := getPKIService(client)
 	if err != nil {
@@ -79,6 +141,29 @@ func setUp(client *vaultclient.Client) (string, error) {
 	return token, nil
 }
 
+func setUpWrapped(client *vaultclient.Client) (string, error) {
+	pkiService, err := getPKIService(client)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	tokenService, err := getTokenService(client)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	err = createPKIBackend(pkiService)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	wrappingToken, err := createWrappedToken(tokenService)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+	return wrappingToken, nil
+}
+
 func issueCerts(client *vaultclient.Client) error {
 	certSigner, err := getCertSigner(client)
 	if err != nil {
@@ -91,15 +176,42 @@ func issueCerts(client *vaultclient.Client) error {
 		TTL:        defaultCertTTL,
 		RoleTTL:    defaultCertTokenTTL,
 	}
-	_, err = certSigner.Issue(newIssueConfig)
+	_, err = certSigner.IssueWithContext(context.TODO(), newIssueConfig)
 	if err != nil {
 		return microerror.Mask(err)
 	}
 	return nil
 }
 
+func issueWrappedCerts(client *vaultclient.Client) (string, error) {
+	certSigner, err := getCertSigner(client)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	newIssueConfig := spec.IssueConfig{
+		ClusterID:  defaultClusterID,
+		CommonName: defaultCertCommonName,
+		TTL:        defaultCertTTL,
+		RoleTTL:    defaultCertTokenTTL,
+		WrapTTL:    defaultWrapTTL,
+	}
+	newIssueResponse, err := certSigner.IssueWithContext(context.TODO(), newIssueConfig)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+	if newIssueResponse.WrappingToken == "" {
+		return "", microerror.Mask(fmt.Errorf("expected wrapping token, got none"))
+	}
+	if newIssueResponse.PrivateKey != "" {
+		return "", microerror.Mask(fmt.Errorf("expected private key not to be delivered unwrapped"))
+	}
+	return newIssueResponse.WrappingToken, nil
+}
+
 func getVaultClient(vaultAddr string) (*vaultclient.Client, error) {
 	newVaultFactoryConfig := vaultfactory.DefaultConfig()
+	newVaultFactoryConfig.Logger = c.Logger
 	newVaultFactoryConfig.Address = vaultAddr
 	newVaultFactoryConfig.AdminToken = env.VaultToken()
 	newVaultFactoryConfig.TLS = &vaultclient.TLSConfig{}
@@ -118,6 +230,7 @@ func getVaultClient(vaultAddr string) (*vaultclient.Client, error) {
 
 func getPKIService(client *vaultclient.Client) (pki.Service, error) {
 	pkiConfig := pki.DefaultServiceConfig()
+	pkiConfig.Logger = c.Logger
 	pkiConfig.VaultClient = client
 	pkiService, err := pki.NewService(pkiConfig)
 	if err != nil {
@@ -128,6 +241,7 @@ func getPKIService(client *vaultclient.Client) (pki.Service, error) {
 
 func getTokenService(client *vaultclient.Client) (token.Service, error) {
 	tokenConfig := token.DefaultServiceConfig()
+	tokenConfig.Logger = c.Logger
 	tokenConfig.VaultClient = client
 	tokenService, err := token.NewService(tokenConfig)
 	if err != nil {
@@ -138,6 +252,7 @@ func getTokenService(client *vaultclient.Client) (token.Service, error) {
 
 func getCertSigner(client *vaultclient.Client) (spec.CertSigner, error) {
 	newCertSignerConfig := certsigner.DefaultConfig()
+	newCertSignerConfig.Logger = c.Logger
 	newCertSignerConfig.VaultClient = client
 	newCertSigner, err := certsigner.New(newCertSignerConfig)
 	if err != nil {
@@ -146,6 +261,17 @@ func getCertSigner(client *vaultclient.Client) (spec.CertSigner, error) {
 	return newCertSigner, nil
 }
 
+func getWrappingService(client *vaultclient.Client) (wrapping.Service, error) {
+	wrappingConfig := wrapping.DefaultConfig()
+	wrappingConfig.Logger = c.Logger
+	wrappingConfig.VaultClient = client
+	wrappingService, err := wrapping.New(wrappingConfig)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	return wrappingService, nil
+}
+
 func createPKIBackend(svc pki.Service) error {
 	createConfig := pki.CreateConfig{
 		AllowedDomains: defaultCommonName,
@@ -153,7 +279,7 @@ func createPKIBackend(svc pki.Service) error {
 		CommonName:     defaultCommonName,
 		TTL:            defaultCATTL,
 	}
-	err := svc.Create(createConfig)
+	_, err := svc.CreateWithContext(context.TODO(), createConfig)
 	if err != nil {
 		microerror.Mask(err)
 	}
@@ -166,7 +292,21 @@ func createToken(svc token.Service) (string, error) {
 		Num:       1,
 		TTL:       defaultTokenTTL,
 	}
-	tokens, err := svc.Create(createConfig)
+	tokens, err := svc.CreateWithContext(context.TODO(), createConfig)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+	return tokens[0], nil
+}
+
+func createWrappedToken(svc token.Service) (string, error) {
+	createConfig := token.CreateConfig{
+		ClusterID: defaultClusterID,
+		Num:       1,
+		TTL:       defaultTokenTTL,
+		WrapTTL:   defaultWrapTTL,
+	}
+	tokens, err := svc.CreateWithContext(context.TODO(), createConfig)
 	if err != nil {
 		return "", microerror.Mask(err)
 	}
@@ -10,4 +10,5 @@ const (
 	defaultCertCommonName = "admin." + defaultCommonName
 	defaultCATTL          = "86400h"
 	defaultTokenTTL       = "720h"
+	defaultWrapTTL        = "5m"
 )
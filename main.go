@@ -1,15 +1,15 @@
 package main
 
 import (
-	"log"
-
-	"github.com/giantswarm/microerror"
+	"os"
 
 	"github.com/giantswarm/certctl/v2/cli"
+	"github.com/giantswarm/certctl/v2/service/exitcode"
 )
 
 func main() {
 	if err := cli.CLICmd.Execute(); err != nil {
-		log.Fatalf("%#v\n", microerror.Mask(err))
+		// Cobra already printed the error, e.g. about unknown flags.
+		os.Exit(exitcode.InvalidConfig)
 	}
 }
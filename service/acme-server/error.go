@@ -0,0 +1,131 @@
+package acmeserver
+
+import (
+	"github.com/giantswarm/microerror"
+)
+
+var invalidConfigError = &microerror.Error{
+	Kind: "invalidConfigError",
+}
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return microerror.Cause(err) == invalidConfigError
+}
+
+var malformedError = &microerror.Error{
+	Kind: "malformedError",
+}
+
+// IsMalformed asserts malformedError.
+func IsMalformed(err error) bool {
+	return microerror.Cause(err) == malformedError
+}
+
+var badNonceError = &microerror.Error{
+	Kind: "badNonceError",
+}
+
+// IsBadNonce asserts badNonceError.
+func IsBadNonce(err error) bool {
+	return microerror.Cause(err) == badNonceError
+}
+
+var badSignatureAlgorithmError = &microerror.Error{
+	Kind: "badSignatureAlgorithmError",
+}
+
+// IsBadSignatureAlgorithm asserts badSignatureAlgorithmError.
+func IsBadSignatureAlgorithm(err error) bool {
+	return microerror.Cause(err) == badSignatureAlgorithmError
+}
+
+var badCSRError = &microerror.Error{
+	Kind: "badCSRError",
+}
+
+// IsBadCSR asserts badCSRError.
+func IsBadCSR(err error) bool {
+	return microerror.Cause(err) == badCSRError
+}
+
+var unauthorizedError = &microerror.Error{
+	Kind: "unauthorizedError",
+}
+
+// IsUnauthorized asserts unauthorizedError.
+func IsUnauthorized(err error) bool {
+	return microerror.Cause(err) == unauthorizedError
+}
+
+var accountDoesNotExistError = &microerror.Error{
+	Kind: "accountDoesNotExistError",
+}
+
+// IsAccountDoesNotExist asserts accountDoesNotExistError.
+func IsAccountDoesNotExist(err error) bool {
+	return microerror.Cause(err) == accountDoesNotExistError
+}
+
+var externalAccountRequiredError = &microerror.Error{
+	Kind: "externalAccountRequiredError",
+}
+
+// IsExternalAccountRequired asserts externalAccountRequiredError.
+func IsExternalAccountRequired(err error) bool {
+	return microerror.Cause(err) == externalAccountRequiredError
+}
+
+var rejectedIdentifierError = &microerror.Error{
+	Kind: "rejectedIdentifierError",
+}
+
+// IsRejectedIdentifier asserts rejectedIdentifierError.
+func IsRejectedIdentifier(err error) bool {
+	return microerror.Cause(err) == rejectedIdentifierError
+}
+
+var unsupportedIdentifierError = &microerror.Error{
+	Kind: "unsupportedIdentifierError",
+}
+
+// IsUnsupportedIdentifier asserts unsupportedIdentifierError.
+func IsUnsupportedIdentifier(err error) bool {
+	return microerror.Cause(err) == unsupportedIdentifierError
+}
+
+var orderNotReadyError = &microerror.Error{
+	Kind: "orderNotReadyError",
+}
+
+// IsOrderNotReady asserts orderNotReadyError.
+func IsOrderNotReady(err error) bool {
+	return microerror.Cause(err) == orderNotReadyError
+}
+
+var incorrectResponseError = &microerror.Error{
+	Kind: "incorrectResponseError",
+}
+
+// IsIncorrectResponse asserts incorrectResponseError.
+func IsIncorrectResponse(err error) bool {
+	return microerror.Cause(err) == incorrectResponseError
+}
+
+var notFoundError = &microerror.Error{
+	Kind: "notFoundError",
+}
+
+// IsNotFound asserts notFoundError.
+func IsNotFound(err error) bool {
+	return microerror.Cause(err) == notFoundError
+}
+
+var methodNotAllowedError = &microerror.Error{
+	Kind: "methodNotAllowedError",
+}
+
+// IsMethodNotAllowed asserts methodNotAllowedError.
+func IsMethodNotAllowed(err error) bool {
+	return microerror.Cause(err) == methodNotAllowedError
+}
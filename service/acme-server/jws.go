@@ -0,0 +1,229 @@
+package acmeserver
+
+import (
+	"crypto"
+	"encoding/base64"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// signatureAlgorithms are the algorithms requests may be signed with.
+var signatureAlgorithms = map[string]bool{
+	string(jose.RS256): true,
+	string(jose.ES256): true,
+	string(jose.ES384): true,
+	string(jose.ES512): true,
+	string(jose.EdDSA): true,
+}
+
+// macAlgorithms are the algorithms external account bindings may be signed
+// with.
+var macAlgorithms = map[string]bool{
+	string(jose.HS256): true,
+	string(jose.HS384): true,
+	string(jose.HS512): true,
+}
+
+// signedRequest is a verified request, see RFC 8555 section 6.2.
+type signedRequest struct {
+	// Payload is empty for POST-as-GET requests.
+	Payload []byte
+
+	// Key is the key the request is signed with.
+	Key *jose.JSONWebKey
+
+	// Account is the account the request is signed by. It is nil for
+	// requests signed with a key given in the request, which are only
+	// accepted for new accounts.
+	Account *account
+}
+
+// verify reads and verifies the JWS in the body of the given request. The
+// request must be signed by an existing account, unless withKey is true, in
+// which case it must be signed with the key it contains.
+func (s *server) verify(r *http.Request, req *request, withKey bool) (signedRequest, error) {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType != "application/jose+json" {
+		return signedRequest{}, microerror.Maskf(malformedError, "content type must be application/jose+json")
+	}
+
+	b, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxBodySize))
+	if err != nil {
+		return signedRequest{}, microerror.Maskf(malformedError, "cannot read request body: %s", err)
+	}
+	jws, err := jose.ParseSigned(string(b))
+	if err != nil {
+		return signedRequest{}, microerror.Maskf(malformedError, "cannot parse JWS: %s", err)
+	}
+	if len(jws.Signatures) != 1 {
+		return signedRequest{}, microerror.Maskf(malformedError, "JWS must have exactly one signature")
+	}
+	header := jws.Signatures[0].Protected
+
+	if !signatureAlgorithms[header.Algorithm] {
+		return signedRequest{}, microerror.Maskf(badSignatureAlgorithmError, "signature algorithm '%s' is not supported", header.Algorithm)
+	}
+
+	url, _ := header.ExtraHeaders["url"].(string)
+	if url != s.url(r, r.URL.Path) {
+		return signedRequest{}, microerror.Maskf(unauthorizedError, "JWS URL '%s' does not match the request URL", url)
+	}
+
+	s.mutex.Lock()
+	ok := s.store.useNonce(header.Nonce, s.now())
+	s.mutex.Unlock()
+	if !ok {
+		return signedRequest{}, microerror.Maskf(badNonceError, "nonce '%s' is invalid", header.Nonce)
+	}
+
+	var key *jose.JSONWebKey
+	var acc *account
+	switch {
+	case withKey:
+		if header.JSONWebKey == nil || header.KeyID != "" {
+			return signedRequest{}, microerror.Maskf(malformedError, "JWS must contain the JWK and no key ID")
+		}
+		if !header.JSONWebKey.Valid() || !header.JSONWebKey.IsPublic() {
+			return signedRequest{}, microerror.Maskf(malformedError, "JWK must be a valid public key")
+		}
+		key = header.JSONWebKey
+
+	default:
+		if header.KeyID == "" || header.JSONWebKey != nil {
+			return signedRequest{}, microerror.Maskf(malformedError, "JWS must contain the key ID and no JWK")
+		}
+		prefix := s.url(r, pathPrefix+pathAccount+"/")
+		if !strings.HasPrefix(header.KeyID, prefix) {
+			return signedRequest{}, microerror.Maskf(accountDoesNotExistError, "account '%s' does not exist", header.KeyID)
+		}
+
+		s.mutex.Lock()
+		acc = s.store.accounts[strings.TrimPrefix(header.KeyID, prefix)]
+		s.mutex.Unlock()
+		if acc == nil {
+			return signedRequest{}, microerror.Maskf(accountDoesNotExistError, "account '%s' does not exist", header.KeyID)
+		}
+		key = acc.Key
+	}
+
+	payload, err := jws.Verify(key)
+	if err != nil {
+		return signedRequest{}, microerror.Maskf(malformedError, "cannot verify JWS: %s", err)
+	}
+
+	if acc != nil {
+		req.Account = acc.ID
+		req.ClusterID = acc.ClusterID
+
+		s.mutex.Lock()
+		status := acc.Status
+		s.mutex.Unlock()
+		if status != statusValid {
+			return signedRequest{}, microerror.Maskf(unauthorizedError, "account '%s' is %s", acc.ID, status)
+		}
+	}
+
+	newSignedRequest := signedRequest{
+		Payload: payload,
+		Key:     key,
+		Account: acc,
+	}
+
+	return newSignedRequest, nil
+}
+
+// verifyExternalAccountBinding verifies the given external account binding
+// of a new account request signed with the given key, see RFC 8555 section
+// 7.3.4, and returns the external account key it is signed with.
+func (s *server) verifyExternalAccountBinding(r *http.Request, binding []byte, key *jose.JSONWebKey) (ExternalAccount, error) {
+	jws, err := jose.ParseSigned(string(binding))
+	if err != nil {
+		return ExternalAccount{}, microerror.Maskf(malformedError, "cannot parse external account binding: %s", err)
+	}
+	if len(jws.Signatures) != 1 {
+		return ExternalAccount{}, microerror.Maskf(malformedError, "external account binding must have exactly one signature")
+	}
+	header := jws.Signatures[0].Protected
+
+	if !macAlgorithms[header.Algorithm] {
+		return ExternalAccount{}, microerror.Maskf(badSignatureAlgorithmError, "external account binding algorithm '%s' is not supported", header.Algorithm)
+	}
+	if header.Nonce != "" {
+		return ExternalAccount{}, microerror.Maskf(malformedError, "external account binding must not contain a nonce")
+	}
+	url, _ := header.ExtraHeaders["url"].(string)
+	if url != s.url(r, r.URL.Path) {
+		return ExternalAccount{}, microerror.Maskf(unauthorizedError, "external account binding URL '%s' does not match the request URL", url)
+	}
+
+	externalAccount, ok := s.externalAccounts[header.KeyID]
+	if !ok {
+		return ExternalAccount{}, microerror.Maskf(unauthorizedError, "external account key '%s' is unknown", header.KeyID)
+	}
+	hmacKey, err := decodeHMACKey(externalAccount.HMACKey)
+	if err != nil {
+		return ExternalAccount{}, microerror.Mask(err)
+	}
+
+	payload, err := jws.Verify(hmacKey)
+	if err != nil {
+		return ExternalAccount{}, microerror.Maskf(unauthorizedError, "cannot verify external account binding: %s", err)
+	}
+
+	// The binding is signed for the account key, so that it cannot be used
+	// for other keys.
+	var boundKey jose.JSONWebKey
+	err = boundKey.UnmarshalJSON(payload)
+	if err != nil {
+		return ExternalAccount{}, microerror.Maskf(malformedError, "cannot parse external account binding JWK: %s", err)
+	}
+	equal, err := sameKey(&boundKey, key)
+	if err != nil {
+		return ExternalAccount{}, microerror.Mask(err)
+	}
+	if !equal {
+		return ExternalAccount{}, microerror.Maskf(unauthorizedError, "external account binding is not signed for the account key")
+	}
+
+	return externalAccount, nil
+}
+
+// thumbprint returns the base64url encoded SHA-256 thumbprint of the given
+// key, see RFC 7638, which is part of key authorizations.
+func thumbprint(key *jose.JSONWebKey) (string, error) {
+	b, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", microerror.Maskf(malformedError, "cannot compute JWK thumbprint: %s", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func sameKey(a, b *jose.JSONWebKey) (bool, error) {
+	ta, err := thumbprint(a)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+	tb, err := thumbprint(b)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	return ta == tb, nil
+}
+
+// decodeHMACKey decodes the given base64url encoded MAC key, with or without
+// padding.
+func decodeHMACKey(key string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(key, "="))
+	if err != nil {
+		return nil, microerror.Maskf(invalidConfigError, "HMAC key must be base64url encoded: %s", err)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,1042 @@
+package acmeserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+	jose "gopkg.in/square/go-jose.v2"
+
+	apiserver "github.com/giantswarm/certctl/v2/service/api-server"
+	"github.com/giantswarm/certctl/v2/service/metrics"
+	"github.com/giantswarm/certctl/v2/service/spec"
+)
+
+const (
+	actionAccount       = "account"
+	actionAuthorization = "authz"
+	actionCertificate   = "cert"
+	actionChallenge     = "chall"
+	actionDirectory     = "directory"
+	actionFinalize      = "finalize"
+	actionNewAccount    = "new-account"
+	actionNewNonce      = "new-nonce"
+	actionNewOrder      = "new-order"
+	actionOrder         = "order"
+	actionOrders        = "orders"
+
+	// maxBodySize limits the size of request bodies, which only hold small
+	// JWS and CSRs.
+	maxBodySize = 1 << 20
+
+	// pathPrefix prefixes the paths of all ACME resources, which are
+	// <pathPrefix><action> for the directory and the new resources, and
+	// <pathPrefix><resource>/<id>[/<action>] for existing ones.
+	pathPrefix = "/acme/"
+
+	pathAccount       = "account"
+	pathAuthorization = "authz"
+	pathCertificate   = "cert"
+	pathChallenge     = "chall"
+	pathOrder         = "order"
+
+	problemPrefix = "urn:ietf:params:acme:error:"
+)
+
+// Config represents the configuration used to create a new ACME server.
+type Config struct {
+	// Dependencies.
+
+	// AuditLogger receives an entry for every request but the ones for the
+	// directory and nonces, including the account, the requested names and
+	// the outcome.
+	AuditLogger micrologger.Logger
+	CertSigner  spec.CertSigner
+	Logger      micrologger.Logger
+
+	// Validators validate the challenges offered for authorizations by their
+	// type, e.g. ChallengeHTTP01. Only the challenge types given are offered.
+	Validators map[string]Validator
+
+	// Settings.
+
+	// ExternalAccounts are the keys accounts must be bound to on
+	// registration. The key an account is bound to determines the cluster
+	// its certificates are signed for.
+	ExternalAccounts []ExternalAccount
+
+	// ExternalURL, if set, is the URL ACME clients reach the server with,
+	// e.g. in case it is served behind a proxy. It defaults to the scheme and
+	// host of each request.
+	ExternalURL string
+
+	// TTL configures the time to live of ordered certificates. This is a
+	// golang time string with the allowed units s, m and h.
+	TTL string
+
+	// AllowedDomains, AllowBareDomains, AllowedURISANs and RoleTTL configure
+	// the roles created in case no role exists for a cluster yet.
+	AllowedDomains   []string
+	AllowBareDomains bool
+	AllowedURISANs   []string
+	RoleTTL          string
+
+	// Timeout bounds the requests to Vault and the validation of challenges
+	// made for a single ACME request. Zero means no timeout.
+	Timeout time.Duration
+}
+
+// DefaultConfig provides a default configuration to create a new ACME server.
+func DefaultConfig() Config {
+	newLogger, err := micrologger.New(micrologger.Config{IOWriter: os.Stderr})
+	if err != nil {
+		panic(err)
+	}
+
+	newConfig := Config{
+		// Dependencies.
+		AuditLogger: newLogger,
+		Logger:      newLogger,
+		Validators: map[string]Validator{
+			ChallengeHTTP01: HTTP01Validator{},
+			ChallengeDNS01:  DNS01Validator{},
+		},
+
+		// Settings.
+		TTL:     "2160h", // 90 days
+		RoleTTL: "8640h", // 1 year
+	}
+
+	return newConfig
+}
+
+// New creates a new configured ACME server. It serves ACME (RFC 8555) with
+// the directory at /acme/directory, requiring external account binding for
+// all accounts. It is meant to be served with TLS, since ACME clients
+// require HTTPS.
+func New(config Config) (http.Handler, error) {
+	// Dependencies.
+	if config.AuditLogger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "audit logger must not be empty")
+	}
+	if config.CertSigner == nil {
+		return nil, microerror.Maskf(invalidConfigError, "cert signer must not be empty")
+	}
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "logger must not be empty")
+	}
+	if len(config.Validators) == 0 {
+		return nil, microerror.Maskf(invalidConfigError, "validators must not be empty")
+	}
+	for t := range config.Validators {
+		if t != ChallengeHTTP01 && t != ChallengeDNS01 {
+			return nil, microerror.Maskf(invalidConfigError, "challenge type '%s' is not supported", t)
+		}
+	}
+
+	// Settings.
+	if len(config.ExternalAccounts) == 0 {
+		return nil, microerror.Maskf(invalidConfigError, "external accounts must not be empty")
+	}
+	externalAccounts := map[string]ExternalAccount{}
+	for _, a := range config.ExternalAccounts {
+		if a.KeyID == "" {
+			return nil, microerror.Maskf(invalidConfigError, "external account key ID must not be empty")
+		}
+		if _, ok := externalAccounts[a.KeyID]; ok {
+			return nil, microerror.Maskf(invalidConfigError, "external account key '%s' must not be given more than once", a.KeyID)
+		}
+		if a.ClusterID == "" {
+			return nil, microerror.Maskf(invalidConfigError, "cluster ID of external account key '%s' must not be empty", a.KeyID)
+		}
+		hmacKey, err := decodeHMACKey(a.HMACKey)
+		if err != nil {
+			return nil, microerror.Maskf(invalidConfigError, "external account key '%s': %s", a.KeyID, err)
+		}
+		// HS256 requires keys of at least 256 bits, see RFC 7518 section 3.2.
+		if len(hmacKey) < 32 {
+			return nil, microerror.Maskf(invalidConfigError, "HMAC key of external account key '%s' must be at least 32 bytes", a.KeyID)
+		}
+		err = externalAccountClient(a).Validate()
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+		externalAccounts[a.KeyID] = a
+	}
+	config.ExternalURL = strings.TrimSuffix(config.ExternalURL, "/")
+
+	newServer := &server{
+		Config: config,
+
+		externalAccounts: externalAccounts,
+		now:              time.Now,
+		store:            newStore(),
+	}
+
+	return newServer, nil
+}
+
+type server struct {
+	Config
+
+	// externalAccounts holds the external account keys by key ID.
+	externalAccounts map[string]ExternalAccount
+
+	now func() time.Time
+
+	mutex sync.Mutex
+	store *store
+}
+
+// request describes an ACME request for the audit log.
+type request struct {
+	Action    string
+	Account   string
+	ClusterID string
+
+	// Details are the key value pairs describing the requested certificate
+	// or its outcome, e.g. the issued serial number.
+	Details []interface{}
+}
+
+// response is the response to a successful ACME request.
+type response struct {
+	Status int
+
+	// Location is the URL of the resource created or returned.
+	Location string
+
+	// Up is the URL of the parent of the returned resource, e.g. the
+	// authorization of a challenge.
+	Up string
+
+	// Body is encoded as JSON, unless it is a certificate chain.
+	Body interface{}
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	req := &request{}
+
+	resp, err := s.handle(r, req)
+
+	s.mutex.Lock()
+	nonce := s.store.newNonce(s.now())
+	s.mutex.Unlock()
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Replay-Nonce", nonce)
+	w.Header().Add("Link", `<`+s.url(r, pathPrefix+actionDirectory)+`>;rel="index"`)
+
+	var contentType string
+	var body []byte
+	if err != nil {
+		p := problemFrom(err)
+		if p.Status >= http.StatusInternalServerError {
+			s.Logger.LogCtx(r.Context(), "level", "error", "message", "cannot handle ACME request", "action", req.Action, "cluster_id", req.ClusterID, "error", microerror.Pretty(err, false))
+			p.Detail = http.StatusText(p.Status)
+		}
+		resp = response{Status: p.Status}
+		contentType = "application/problem+json"
+		body, _ = json.Marshal(p)
+	} else if chain, ok := resp.Body.(string); ok {
+		contentType = "application/pem-certificate-chain"
+		body = []byte(chain)
+	} else if resp.Body != nil {
+		contentType = "application/json"
+		body, _ = json.Marshal(resp.Body)
+	}
+
+	if resp.Location != "" {
+		w.Header().Set("Location", resp.Location)
+	}
+	if resp.Up != "" {
+		w.Header().Add("Link", `<`+resp.Up+`>;rel="up"`)
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.WriteHeader(resp.Status)
+	if _, err := w.Write(body); err != nil {
+		s.Logger.LogCtx(r.Context(), "level", "warning", "message", "cannot write ACME response", "error", microerror.Pretty(err, false))
+	}
+
+	metrics.ServerRequests.WithLabelValues("acme", req.Action, strconv.Itoa(resp.Status)).Inc()
+
+	// Clients fetch the directory and nonces all the time, which tells
+	// nothing about what they do.
+	if req.Action == actionDirectory || req.Action == actionNewNonce {
+		return
+	}
+	entry := []interface{}{
+		"level", "info",
+		"message", "ACME request",
+		"action", req.Action,
+		"account", req.Account,
+		"cluster_id", req.ClusterID,
+		"duration", time.Since(start).String(),
+		"method", r.Method,
+		"path", r.URL.Path,
+		"remote_addr", r.RemoteAddr,
+		"status", resp.Status,
+	}
+	entry = append(entry, req.Details...)
+	if err != nil {
+		entry = append(entry, "error", microerror.Pretty(err, false))
+	}
+	s.AuditLogger.LogCtx(r.Context(), entry...)
+}
+
+// handle routes and executes the given ACME request. The request is
+// described for the audit log as far as it got.
+func (s *server) handle(r *http.Request, req *request) (response, error) {
+	if !strings.HasPrefix(r.URL.Path, pathPrefix) {
+		return response{}, microerror.Maskf(notFoundError, "path '%s' not found", r.URL.Path)
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, pathPrefix), "/")
+
+	var id string
+	switch {
+	case len(parts) == 1:
+		req.Action = parts[0]
+	case len(parts) == 2 && parts[1] != "":
+		req.Action = parts[0]
+		id = parts[1]
+	case len(parts) == 3 && parts[1] != "" && parts[0] == pathAccount && parts[2] == actionOrders:
+		req.Action = actionOrders
+		id = parts[1]
+	case len(parts) == 3 && parts[1] != "" && parts[0] == pathOrder && parts[2] == actionFinalize:
+		req.Action = actionFinalize
+		id = parts[1]
+	default:
+		return response{}, microerror.Maskf(notFoundError, "path '%s' not found", r.URL.Path)
+	}
+
+	// The directory and nonces are fetched without being signed, while all
+	// other requests are signed POST requests.
+	switch req.Action {
+	case actionDirectory:
+		if id != "" {
+			break
+		}
+		if r.Method != http.MethodGet {
+			return response{}, microerror.Maskf(methodNotAllowedError, "method %s not allowed for '%s', use GET", r.Method, r.URL.Path)
+		}
+		return s.directory(r), nil
+	case actionNewNonce:
+		if id != "" {
+			break
+		}
+		switch r.Method {
+		case http.MethodHead:
+			return response{Status: http.StatusOK}, nil
+		case http.MethodGet:
+			return response{Status: http.StatusNoContent}, nil
+		}
+		return response{}, microerror.Maskf(methodNotAllowedError, "method %s not allowed for '%s', use HEAD or GET", r.Method, r.URL.Path)
+	}
+
+	handlers := map[string]func(context.Context, *http.Request, *request, string) (response, error){
+		actionNewAccount:    s.newAccount,
+		actionNewOrder:      s.newOrder,
+		actionAccount:       s.account,
+		actionOrders:        s.orders,
+		actionOrder:         s.order,
+		actionFinalize:      s.finalize,
+		actionAuthorization: s.authorization,
+		actionChallenge:     s.challenge,
+		actionCertificate:   s.certificate,
+	}
+	handler, ok := handlers[req.Action]
+	newResource := req.Action == actionNewAccount || req.Action == actionNewOrder
+	if !ok || newResource != (id == "") {
+		return response{}, microerror.Maskf(notFoundError, "path '%s' not found", r.URL.Path)
+	}
+	if r.Method != http.MethodPost {
+		return response{}, microerror.Maskf(methodNotAllowedError, "method %s not allowed for '%s', use POST", r.Method, r.URL.Path)
+	}
+
+	ctx, cancel := s.withTimeout(r.Context())
+	defer cancel()
+
+	return handler(ctx, r, req, id)
+}
+
+func (s *server) directory(r *http.Request) response {
+	newDirectory := directory{
+		NewNonce:   s.url(r, pathPrefix+actionNewNonce),
+		NewAccount: s.url(r, pathPrefix+actionNewAccount),
+		NewOrder:   s.url(r, pathPrefix+actionNewOrder),
+		Meta: directoryMeta{
+			ExternalAccountRequired: true,
+		},
+	}
+
+	return response{Status: http.StatusOK, Body: newDirectory}
+}
+
+func (s *server) newAccount(ctx context.Context, r *http.Request, req *request, _ string) (response, error) {
+	signed, err := s.verify(r, req, true)
+	if err != nil {
+		return response{}, microerror.Mask(err)
+	}
+	var payload newAccountRequest
+	err = decode(signed.Payload, &payload)
+	if err != nil {
+		return response{}, microerror.Mask(err)
+	}
+	t, err := thumbprint(signed.Key)
+	if err != nil {
+		return response{}, microerror.Mask(err)
+	}
+
+	// Registering an existing key returns the existing account, see RFC 8555
+	// section 7.3.1.
+	s.mutex.Lock()
+	existing := s.store.accountByThumbprint(t)
+	s.mutex.Unlock()
+	if existing != nil {
+		req.Account = existing.ID
+		req.ClusterID = existing.ClusterID
+		return s.accountResponse(r, existing, http.StatusOK), nil
+	}
+	if payload.OnlyReturnExisting {
+		return response{}, microerror.Maskf(accountDoesNotExistError, "no account exists for the key")
+	}
+
+	if len(payload.ExternalAccountBinding) == 0 {
+		return response{}, microerror.Maskf(externalAccountRequiredError, "external account binding is required")
+	}
+	externalAccount, err := s.verifyExternalAccountBinding(r, payload.ExternalAccountBinding, signed.Key)
+	if err != nil {
+		return response{}, microerror.Mask(err)
+	}
+
+	newAccount := &account{
+		ID:         newID(),
+		Key:        signed.Key,
+		Thumbprint: t,
+		Status:     statusValid,
+		Contact:    payload.Contact,
+		KeyID:      externalAccount.KeyID,
+		ClusterID:  externalAccount.ClusterID,
+		client:     externalAccountClient(externalAccount),
+	}
+	req.Account = newAccount.ID
+	req.ClusterID = newAccount.ClusterID
+	req.Details = append(req.Details, "key_id", newAccount.KeyID)
+
+	s.mutex.Lock()
+	// The key may have been registered concurrently.
+	existing = s.store.accountByThumbprint(t)
+	if existing == nil {
+		s.store.accounts[newAccount.ID] = newAccount
+	}
+	s.mutex.Unlock()
+	if existing != nil {
+		return s.accountResponse(r, existing, http.StatusOK), nil
+	}
+
+	return s.accountResponse(r, newAccount, http.StatusCreated), nil
+}
+
+func (s *server) account(ctx context.Context, r *http.Request, req *request, id string) (response, error) {
+	signed, err := s.verify(r, req, false)
+	if err != nil {
+		return response{}, microerror.Mask(err)
+	}
+	if signed.Account.ID != id {
+		return response{}, microerror.Maskf(unauthorizedError, "account '%s' is not the account signing the request", id)
+	}
+
+	if len(signed.Payload) != 0 {
+		var payload accountRequest
+		err = decode(signed.Payload, &payload)
+		if err != nil {
+			return response{}, microerror.Mask(err)
+		}
+		if payload.Status != "" && payload.Status != statusDeactivated {
+			return response{}, microerror.Maskf(malformedError, "account status can only be changed to %s", statusDeactivated)
+		}
+
+		s.mutex.Lock()
+		if payload.Contact != nil {
+			signed.Account.Contact = payload.Contact
+		}
+		if payload.Status == statusDeactivated {
+			signed.Account.Status = statusDeactivated
+		}
+		s.mutex.Unlock()
+		req.Details = append(req.Details, "account_status", payload.Status)
+	}
+
+	return s.accountResponse(r, signed.Account, http.StatusOK), nil
+}
+
+func (s *server) orders(ctx context.Context, r *http.Request, req *request, id string) (response, error) {
+	signed, err := s.verify(r, req, false)
+	if err != nil {
+		return response{}, microerror.Mask(err)
+	}
+	if signed.Account.ID != id {
+		return response{}, microerror.Maskf(unauthorizedError, "account '%s' is not the account signing the request", id)
+	}
+
+	newOrders := ordersResource{Orders: []string{}}
+	s.mutex.Lock()
+	for _, orderID := range signed.Account.OrderIDs {
+		newOrders.Orders = append(newOrders.Orders, s.url(r, pathPrefix+pathOrder+"/"+orderID))
+	}
+	s.mutex.Unlock()
+
+	return response{Status: http.StatusOK, Body: newOrders}, nil
+}
+
+func (s *server) newOrder(ctx context.Context, r *http.Request, req *request, _ string) (response, error) {
+	signed, err := s.verify(r, req, false)
+	if err != nil {
+		return response{}, microerror.Mask(err)
+	}
+	var payload newOrderRequest
+	err = decode(signed.Payload, &payload)
+	if err != nil {
+		return response{}, microerror.Mask(err)
+	}
+	if payload.NotBefore != "" || payload.NotAfter != "" {
+		return response{}, microerror.Maskf(malformedError, "notBefore and notAfter are not supported, certificates are valid for %s", s.TTL)
+	}
+	if len(payload.Identifiers) == 0 {
+		return response{}, microerror.Maskf(malformedError, "identifiers must not be empty")
+	}
+
+	var identifiers []identifier
+	var domains []string
+	seen := map[string]bool{}
+	for _, id := range payload.Identifiers {
+		if id.Type != "dns" {
+			return response{}, microerror.Maskf(unsupportedIdentifierError, "identifier type '%s' is not supported", id.Type)
+		}
+		domain := strings.ToLower(strings.TrimSuffix(id.Value, "."))
+		if domain == "" || strings.Contains(strings.TrimPrefix(domain, "*."), "*") {
+			return response{}, microerror.Maskf(rejectedIdentifierError, "identifier '%s' is invalid", id.Value)
+		}
+		if seen[domain] {
+			continue
+		}
+		if _, ok := s.Validators[ChallengeDNS01]; !ok && strings.HasPrefix(domain, "*.") {
+			return response{}, microerror.Maskf(rejectedIdentifierError, "wildcard identifier '%s' requires dns-01 challenges, which are not offered", id.Value)
+		}
+		seen[domain] = true
+		identifiers = append(identifiers, identifier{Type: "dns", Value: domain})
+		domains = append(domains, domain)
+	}
+	req.Details = append(req.Details, "identifiers", strings.Join(domains, ","))
+
+	err = signed.Account.client.AuthorizeNames(apiserver.Names{AltNames: domains})
+	if err != nil {
+		return response{}, microerror.Maskf(rejectedIdentifierError, "%s", microerror.Pretty(err, false))
+	}
+
+	now := s.now()
+	newOrder := &order{
+		ID:          newID(),
+		AccountID:   signed.Account.ID,
+		Expires:     now.Add(orderLifetime),
+		Identifiers: identifiers,
+	}
+	req.Details = append(req.Details, "order", newOrder.ID)
+
+	s.mutex.Lock()
+	s.store.prune(now)
+	for _, id := range identifiers {
+		wildcard := strings.HasPrefix(id.Value, "*.")
+		id.Value = strings.TrimPrefix(id.Value, "*.")
+
+		a := s.store.validAuthorization(signed.Account.ID, id, wildcard, now)
+		if a == nil {
+			a = s.newAuthorization(signed.Account.ID, id, wildcard, now)
+		}
+		newOrder.AuthorizationIDs = append(newOrder.AuthorizationIDs, a.ID)
+	}
+	s.store.orders[newOrder.ID] = newOrder
+	signed.Account.OrderIDs = append(signed.Account.OrderIDs, newOrder.ID)
+	resp := s.orderResponse(r, newOrder, http.StatusCreated)
+	s.mutex.Unlock()
+
+	return resp, nil
+}
+
+// newAuthorization creates a pending authorization of the given account for
+// the given identifier together with its challenges. It must be called with
+// the mutex locked.
+func (s *server) newAuthorization(accountID string, id identifier, wildcard bool, now time.Time) *authorization {
+	a := &authorization{
+		ID:         newID(),
+		AccountID:  accountID,
+		Status:     statusPending,
+		Expires:    now.Add(authorizationLifetime),
+		Identifier: id,
+		Wildcard:   wildcard,
+	}
+
+	// Wildcards can only be validated using DNS, see RFC 8555 section 7.1.3.
+	for _, t := range []string{ChallengeHTTP01, ChallengeDNS01} {
+		if _, ok := s.Validators[t]; !ok || (wildcard && t != ChallengeDNS01) {
+			continue
+		}
+		c := &challenge{
+			ID:              newID(),
+			AuthorizationID: a.ID,
+			Type:            t,
+			Status:          statusPending,
+			Token:           newID(),
+		}
+		s.store.challenges[c.ID] = c
+		a.ChallengeIDs = append(a.ChallengeIDs, c.ID)
+	}
+	s.store.authorizations[a.ID] = a
+
+	return a
+}
+
+func (s *server) order(ctx context.Context, r *http.Request, req *request, id string) (response, error) {
+	signed, err := s.verify(r, req, false)
+	if err != nil {
+		return response{}, microerror.Mask(err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	o, ok := s.store.orders[id]
+	if !ok || o.AccountID != signed.Account.ID {
+		return response{}, microerror.Maskf(notFoundError, "order '%s' not found", id)
+	}
+
+	return s.orderResponse(r, o, http.StatusOK), nil
+}
+
+func (s *server) finalize(ctx context.Context, r *http.Request, req *request, id string) (response, error) {
+	signed, err := s.verify(r, req, false)
+	if err != nil {
+		return response{}, microerror.Mask(err)
+	}
+	var payload finalizeRequest
+	err = decode(signed.Payload, &payload)
+	if err != nil {
+		return response{}, microerror.Mask(err)
+	}
+	req.Details = append(req.Details, "order", id)
+
+	s.mutex.Lock()
+	o, ok := s.store.orders[id]
+	if !ok || o.AccountID != signed.Account.ID {
+		s.mutex.Unlock()
+		return response{}, microerror.Maskf(notFoundError, "order '%s' not found", id)
+	}
+	status := s.store.orderStatus(o, s.now())
+	identifiers := o.Identifiers
+	s.mutex.Unlock()
+	if status != statusReady {
+		return response{}, microerror.Maskf(orderNotReadyError, "order '%s' is %s", id, status)
+	}
+
+	csr, err := parseCSR(payload.CSR, identifiers, signed.Key)
+	if err != nil {
+		return response{}, microerror.Mask(err)
+	}
+
+	// The order is processed once, so that concurrent requests do not sign
+	// multiple certificates.
+	s.mutex.Lock()
+	if s.store.orderStatus(o, s.now()) != statusReady {
+		s.mutex.Unlock()
+		return response{}, microerror.Maskf(orderNotReadyError, "order '%s' is already being processed", id)
+	}
+	o.Status = statusProcessing
+	s.mutex.Unlock()
+
+	newSignConfig := spec.SignConfig{
+		ClusterID: signed.Account.ClusterID,
+		CSR:       string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr.Raw})),
+		TTL:       s.TTL,
+
+		AllowedDomains:   s.AllowedDomains,
+		AllowBareDomains: s.AllowBareDomains,
+		AllowedURISANs:   s.AllowedURISANs,
+		RoleTTL:          s.RoleTTL,
+	}
+	newSignResponse, err := s.CertSigner.SignWithContext(ctx, newSignConfig)
+	if err != nil {
+		// The order can be finalized again, e.g. in case Vault was
+		// unavailable.
+		s.mutex.Lock()
+		o.Status = ""
+		s.mutex.Unlock()
+
+		if apiserver.HTTPStatus(err) < http.StatusInternalServerError {
+			return response{}, microerror.Maskf(badCSRError, "%s", microerror.Pretty(err, false))
+		}
+		return response{}, microerror.Mask(err)
+	}
+	req.Details = append(req.Details, "serial_number", newSignResponse.SerialNumber)
+
+	newCertificate := &certificate{
+		ID:        newID(),
+		AccountID: signed.Account.ID,
+		OrderID:   o.ID,
+		Chain:     strings.TrimSpace(newSignResponse.Certificate) + "\n" + strings.TrimSpace(newSignResponse.IssuingCA) + "\n",
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.store.certificates[newCertificate.ID] = newCertificate
+	o.CertificateID = newCertificate.ID
+	o.Status = statusValid
+
+	return s.orderResponse(r, o, http.StatusOK), nil
+}
+
+func (s *server) authorization(ctx context.Context, r *http.Request, req *request, id string) (response, error) {
+	signed, err := s.verify(r, req, false)
+	if err != nil {
+		return response{}, microerror.Mask(err)
+	}
+
+	var payload authorizationRequest
+	if len(signed.Payload) != 0 {
+		err = decode(signed.Payload, &payload)
+		if err != nil {
+			return response{}, microerror.Mask(err)
+		}
+		if payload.Status != statusDeactivated {
+			return response{}, microerror.Maskf(malformedError, "authorization status can only be changed to %s", statusDeactivated)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	a, ok := s.store.authorizations[id]
+	if !ok || a.AccountID != signed.Account.ID {
+		return response{}, microerror.Maskf(notFoundError, "authorization '%s' not found", id)
+	}
+	if payload.Status == statusDeactivated {
+		a.Status = statusDeactivated
+		req.Details = append(req.Details, "identifier", a.Identifier.Value, "authorization_status", statusDeactivated)
+	}
+
+	return response{Status: http.StatusOK, Body: s.authorizationResource(r, a)}, nil
+}
+
+func (s *server) challenge(ctx context.Context, r *http.Request, req *request, id string) (response, error) {
+	signed, err := s.verify(r, req, false)
+	if err != nil {
+		return response{}, microerror.Mask(err)
+	}
+
+	s.mutex.Lock()
+	c, ok := s.store.challenges[id]
+	var a *authorization
+	if ok {
+		a = s.store.authorizations[c.AuthorizationID]
+	}
+	if !ok || a.AccountID != signed.Account.ID {
+		s.mutex.Unlock()
+		return response{}, microerror.Maskf(notFoundError, "challenge '%s' not found", id)
+	}
+	up := s.url(r, pathPrefix+pathAuthorization+"/"+a.ID)
+
+	// Challenges are validated when the client responds to them with an
+	// empty object, while POST-as-GET requests return their state, see RFC
+	// 8555 section 7.5.1. Validation is only started once.
+	if len(signed.Payload) == 0 || c.Status != statusPending || s.store.authorizationStatus(a, s.now()) != statusPending {
+		resp := response{Status: http.StatusOK, Up: up, Body: s.challengeResource(r, c)}
+		s.mutex.Unlock()
+		return resp, nil
+	}
+	c.Status = statusProcessing
+	domain := a.Identifier.Value
+	challengeType := c.Type
+	token := c.Token
+	s.mutex.Unlock()
+
+	req.Details = append(req.Details, "identifier", domain, "challenge_type", challengeType)
+
+	err = s.Validators[challengeType].Validate(ctx, domain, token, token+"."+signed.Account.Thumbprint)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err != nil {
+		// Failed challenges invalidate the authorization, see RFC 8555
+		// section 7.1.6.
+		p := problemFrom(err)
+		if p.Status >= http.StatusInternalServerError {
+			p = problem{Type: problemPrefix + "incorrectResponse", Detail: microerror.Pretty(err, false), Status: http.StatusForbidden}
+		}
+		c.Status = statusInvalid
+		c.Error = &p
+		a.Status = statusInvalid
+		req.Details = append(req.Details, "challenge_status", statusInvalid, "challenge_error", p.Detail)
+	} else {
+		c.Status = statusValid
+		c.Validated = s.now()
+		a.Status = statusValid
+		req.Details = append(req.Details, "challenge_status", statusValid)
+	}
+
+	return response{Status: http.StatusOK, Up: up, Body: s.challengeResource(r, c)}, nil
+}
+
+func (s *server) certificate(ctx context.Context, r *http.Request, req *request, id string) (response, error) {
+	signed, err := s.verify(r, req, false)
+	if err != nil {
+		return response{}, microerror.Mask(err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	c, ok := s.store.certificates[id]
+	if !ok || c.AccountID != signed.Account.ID {
+		return response{}, microerror.Maskf(notFoundError, "certificate '%s' not found", id)
+	}
+
+	return response{Status: http.StatusOK, Body: c.Chain}, nil
+}
+
+func (s *server) accountResponse(r *http.Request, a *account, status int) response {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	location := s.url(r, pathPrefix+pathAccount+"/"+a.ID)
+	newAccount := accountResource{
+		Status:  a.Status,
+		Contact: a.Contact,
+		Orders:  location + "/" + actionOrders,
+	}
+
+	return response{Status: status, Location: location, Body: newAccount}
+}
+
+// orderResponse must be called with the mutex locked.
+func (s *server) orderResponse(r *http.Request, o *order, status int) response {
+	newOrder := orderResource{
+		Status:      s.store.orderStatus(o, s.now()),
+		Expires:     o.Expires,
+		Identifiers: o.Identifiers,
+		Finalize:    s.url(r, pathPrefix+pathOrder+"/"+o.ID+"/"+actionFinalize),
+		Error:       o.Error,
+	}
+	for _, id := range o.AuthorizationIDs {
+		newOrder.Authorizations = append(newOrder.Authorizations, s.url(r, pathPrefix+pathAuthorization+"/"+id))
+	}
+	if o.CertificateID != "" {
+		newOrder.Certificate = s.url(r, pathPrefix+pathCertificate+"/"+o.CertificateID)
+	}
+
+	return response{Status: status, Location: s.url(r, pathPrefix+pathOrder+"/"+o.ID), Body: newOrder}
+}
+
+// authorizationResource must be called with the mutex locked.
+func (s *server) authorizationResource(r *http.Request, a *authorization) authorizationResource {
+	newAuthorization := authorizationResource{
+		Status:     s.store.authorizationStatus(a, s.now()),
+		Expires:    a.Expires,
+		Identifier: a.Identifier,
+		Challenges: []challengeResource{},
+		Wildcard:   a.Wildcard,
+	}
+	for _, id := range a.ChallengeIDs {
+		newAuthorization.Challenges = append(newAuthorization.Challenges, s.challengeResource(r, s.store.challenges[id]))
+	}
+
+	return newAuthorization
+}
+
+// challengeResource must be called with the mutex locked.
+func (s *server) challengeResource(r *http.Request, c *challenge) challengeResource {
+	newChallenge := challengeResource{
+		Type:   c.Type,
+		URL:    s.url(r, pathPrefix+pathChallenge+"/"+c.ID),
+		Status: c.Status,
+		Token:  c.Token,
+		Error:  c.Error,
+	}
+	if !c.Validated.IsZero() {
+		validated := c.Validated
+		newChallenge.Validated = &validated
+	}
+
+	return newChallenge
+}
+
+// url returns the absolute URL of the given path, using the external URL if
+// configured, or else the scheme and host of the given request.
+func (s *server) url(r *http.Request, path string) string {
+	if s.ExternalURL != "" {
+		return s.ExternalURL + path
+	}
+
+	scheme := "https"
+	if r.TLS == nil {
+		scheme = "http"
+	}
+
+	return scheme + "://" + r.Host + path
+}
+
+func (s *server) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.Timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, s.Timeout)
+}
+
+// externalAccountClient returns the rules accounts bound to the given
+// external account key are authorized with.
+func externalAccountClient(a ExternalAccount) apiserver.Client {
+	return apiserver.Client{
+		Name:       a.KeyID,
+		ClusterIDs: []string{a.ClusterID},
+		Domains:    a.Domains,
+	}
+}
+
+// decode decodes the given JSON payload into v. Unknown fields are ignored,
+// since ACME allows clients to send fields servers do not know.
+func decode(payload []byte, v interface{}) error {
+	err := json.Unmarshal(payload, v)
+	if err != nil {
+		return microerror.Maskf(malformedError, "cannot decode payload: %s", err)
+	}
+
+	return nil
+}
+
+// parseCSR decodes and checks the given base64url encoded CSR of a finalize
+// request. It must request exactly the identifiers of the order and must not
+// use the account key, see RFC 8555 section 7.4.
+func parseCSR(data string, identifiers []identifier, accountKey *jose.JSONWebKey) (*x509.CertificateRequest, error) {
+	der, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(data, "="))
+	if err != nil {
+		return nil, microerror.Maskf(badCSRError, "CSR must be base64url encoded: %s", err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, microerror.Maskf(badCSRError, "cannot parse CSR: %s", err)
+	}
+	err = csr.CheckSignature()
+	if err != nil {
+		return nil, microerror.Maskf(badCSRError, "CSR signature is invalid: %s", err)
+	}
+
+	if len(csr.IPAddresses) != 0 || len(csr.EmailAddresses) != 0 || len(csr.URIs) != 0 || len(csr.Subject.Organization) != 0 {
+		return nil, microerror.Maskf(badCSRError, "CSR must only request DNS names")
+	}
+	requested := map[string]bool{}
+	for _, d := range csr.DNSNames {
+		requested[strings.ToLower(d)] = true
+	}
+	if csr.Subject.CommonName != "" {
+		requested[strings.ToLower(csr.Subject.CommonName)] = true
+	}
+	ordered := map[string]bool{}
+	for _, id := range identifiers {
+		ordered[id.Value] = true
+	}
+	if !equalSets(requested, ordered) {
+		return nil, microerror.Maskf(badCSRError, "CSR must request exactly the identifiers of the order, %s", strings.Join(keys(ordered), ", "))
+	}
+
+	accountDER, err := x509.MarshalPKIXPublicKey(accountKey.Key)
+	if err == nil {
+		csrDER, err := x509.MarshalPKIXPublicKey(csr.PublicKey)
+		if err == nil && bytes.Equal(accountDER, csrDER) {
+			return nil, microerror.Maskf(badCSRError, "CSR must not use the account key")
+		}
+	}
+
+	return csr, nil
+}
+
+func equalSets(a, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if !b[k] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func keys(m map[string]bool) []string {
+	var k []string
+	for s := range m {
+		k = append(k, s)
+	}
+	sort.Strings(k)
+
+	return k
+}
+
+// problemFrom maps the given error to the problem document of the response.
+// Errors of Vault and the services are mapped to HTTP status codes the same
+// way as by the API server.
+func problemFrom(err error) problem {
+	problems := []struct {
+		is     func(error) bool
+		typ    string
+		status int
+	}{
+		{IsMalformed, "malformed", http.StatusBadRequest},
+		{IsBadNonce, "badNonce", http.StatusBadRequest},
+		{IsBadSignatureAlgorithm, "badSignatureAlgorithm", http.StatusBadRequest},
+		{IsBadCSR, "badCSR", http.StatusBadRequest},
+		{IsUnauthorized, "unauthorized", http.StatusForbidden},
+		{IsAccountDoesNotExist, "accountDoesNotExist", http.StatusBadRequest},
+		{IsExternalAccountRequired, "externalAccountRequired", http.StatusBadRequest},
+		{IsRejectedIdentifier, "rejectedIdentifier", http.StatusBadRequest},
+		{IsUnsupportedIdentifier, "unsupportedIdentifier", http.StatusBadRequest},
+		{IsOrderNotReady, "orderNotReady", http.StatusForbidden},
+		{IsIncorrectResponse, "incorrectResponse", http.StatusForbidden},
+		{IsNotFound, "malformed", http.StatusNotFound},
+		{IsMethodNotAllowed, "malformed", http.StatusMethodNotAllowed},
+	}
+
+	detail := microerror.Pretty(err, false)
+	for _, p := range problems {
+		if p.is(err) {
+			return problem{Type: problemPrefix + p.typ, Detail: detail, Status: p.status}
+		}
+	}
+
+	status := apiserver.HTTPStatus(err)
+	if errors.Is(err, context.Canceled) {
+		// The client went away, nobody receives the response.
+		status = http.StatusServiceUnavailable
+	}
+	if status >= http.StatusInternalServerError {
+		return problem{Type: problemPrefix + "serverInternal", Detail: detail, Status: status}
+	}
+
+	return problem{Type: problemPrefix + "malformed", Detail: detail, Status: status}
+}
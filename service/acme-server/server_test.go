@@ -0,0 +1,498 @@
+package acmeserver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger/microloggertest"
+	"golang.org/x/crypto/acme"
+
+	"github.com/giantswarm/certctl/v2/service/internal/testca"
+)
+
+var (
+	testHMACKey      = []byte("0123456789abcdef0123456789abcdef")
+	testOtherHMACKey = []byte("fedcba9876543210fedcba9876543210")
+)
+
+func newTestCA(t *testing.T, commonName string) *testca.CA {
+	ca, err := testca.New(commonName)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return ca
+}
+
+// testResponder holds the key authorizations provisioned by ACME clients,
+// like a web server answering http-01 and a DNS server answering dns-01
+// challenges.
+type testResponder struct {
+	mutex              sync.Mutex
+	keyAuthorizations  map[string]string
+	dnsRecords         map[string][]string
+	validatedChallenge int
+}
+
+func (r *testResponder) provisionHTTP01(token, keyAuthorization string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.keyAuthorizations[token] = keyAuthorization
+}
+
+func (r *testResponder) provisionDNS01(domain, record string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.dnsRecords["_acme-challenge."+domain] = append(r.dnsRecords["_acme-challenge."+domain], record)
+}
+
+// ServeHTTP serves the provisioned http-01 key authorizations for all
+// domains.
+func (r *testResponder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	keyAuthorization, ok := r.keyAuthorizations[req.URL.Path[len("/.well-known/acme-challenge/"):]]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	r.validatedChallenge++
+	w.Write([]byte(keyAuthorization))
+}
+
+func (r *testResponder) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	records, ok := r.dnsRecords[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	r.validatedChallenge++
+
+	return records, nil
+}
+
+// newTestServer starts an ACME server signing certificates with the CAs of
+// the clusters 'web' and 'internal'. The external account key 'web' binds
+// accounts to the cluster 'web' and allows domains of web.example.com, the
+// key 'internal' to the cluster 'internal' allowing all domains. Challenges
+// are validated with the default validators against the returned responder.
+func newTestServer(t *testing.T) (*httptest.Server, map[string]*testca.CA, *testResponder) {
+	cas := map[string]*testca.CA{
+		"web":      newTestCA(t, "web CA"),
+		"internal": newTestCA(t, "internal CA"),
+	}
+
+	responder := &testResponder{
+		keyAuthorizations: map[string]string{},
+		dnsRecords:        map[string][]string{},
+	}
+	responderServer := httptest.NewServer(responder)
+	t.Cleanup(responderServer.Close)
+
+	// The http-01 validator connects to the responder for all domains.
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, responderServer.Listener.Addr().String())
+			},
+		},
+	}
+
+	config := DefaultConfig()
+	config.AuditLogger = microloggertest.New()
+	config.Logger = microloggertest.New()
+	config.CertSigner = &testca.CertSigner{CAs: cas}
+	config.Validators = map[string]Validator{
+		ChallengeHTTP01: HTTP01Validator{Client: httpClient},
+		ChallengeDNS01:  DNS01Validator{Resolver: responder},
+	}
+	config.ExternalAccounts = []ExternalAccount{
+		{
+			KeyID:     "web",
+			HMACKey:   base64.RawURLEncoding.EncodeToString(testHMACKey),
+			ClusterID: "web",
+			Domains:   []string{"*.web.example.com"},
+		},
+		{
+			KeyID:     "internal",
+			HMACKey:   base64.RawURLEncoding.EncodeToString(testOtherHMACKey),
+			ClusterID: "internal",
+			Domains:   []string{"*"},
+		},
+	}
+
+	handler, err := New(config)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	s := httptest.NewTLSServer(handler)
+	t.Cleanup(s.Close)
+
+	return s, cas, responder
+}
+
+// newClient returns an ACME client registered with the given external
+// account key.
+func newClient(t *testing.T, s *httptest.Server, keyID string, hmacKey []byte) *acme.Client {
+	c := &acme.Client{
+		Key:          newKey(t),
+		DirectoryURL: s.URL + "/acme/directory",
+		HTTPClient:   s.Client(),
+	}
+
+	_, err := c.Register(context.Background(), &acme.Account{ExternalAccountBinding: &acme.ExternalAccountBinding{KID: keyID, Key: hmacKey}}, acme.AcceptTOS)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return c
+}
+
+// authorize responds to a challenge of the given type of every pending
+// authorization of the given order, provisioning the key authorization in
+// the responder if provision is true.
+func authorize(t *testing.T, c *acme.Client, o *acme.Order, challengeType string, responder *testResponder, provision bool) error {
+	ctx := context.Background()
+
+	for _, u := range o.AuthzURLs {
+		z, err := c.GetAuthorization(ctx, u)
+		if err != nil {
+			t.Fatalf("expected no error, got %#v", err)
+		}
+		if z.Status != acme.StatusPending {
+			continue
+		}
+
+		var chal *acme.Challenge
+		for _, ch := range z.Challenges {
+			if ch.Type == challengeType {
+				chal = ch
+			}
+		}
+		if chal == nil {
+			t.Fatalf("expected %s challenge for %s, got none", challengeType, z.Identifier.Value)
+		}
+
+		if provision {
+			switch challengeType {
+			case ChallengeHTTP01:
+				keyAuthorization, err := c.HTTP01ChallengeResponse(chal.Token)
+				if err != nil {
+					t.Fatalf("expected no error, got %#v", err)
+				}
+				responder.provisionHTTP01(chal.Token, keyAuthorization)
+			case ChallengeDNS01:
+				record, err := c.DNS01ChallengeRecord(chal.Token)
+				if err != nil {
+					t.Fatalf("expected no error, got %#v", err)
+				}
+				responder.provisionDNS01(z.Identifier.Value, record)
+			}
+		}
+
+		_, err = c.Accept(ctx, chal)
+		if err != nil {
+			t.Fatalf("expected no error, got %#v", err)
+		}
+		_, err = c.WaitAuthorization(ctx, z.URI)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := testca.NewKey()
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return key
+}
+
+func newCSR(t *testing.T, dnsNames ...string) []byte {
+	der, err := testca.NewCSR(newKey(t), "", dnsNames...)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return der
+}
+
+func problemType(err error) string {
+	var acmeErr *acme.Error
+	if errors.As(err, &acmeErr) {
+		return acmeErr.ProblemType
+	}
+
+	return ""
+}
+
+func Test_ACME_Order(t *testing.T) {
+	testCases := []struct {
+		name          string
+		keyID         string
+		hmacKey       []byte
+		domains       []string
+		challengeType string
+		expectedCA    string
+	}{
+		{
+			name:          "http-01",
+			keyID:         "web",
+			hmacKey:       testHMACKey,
+			domains:       []string{"a.web.example.com", "b.web.example.com"},
+			challengeType: ChallengeHTTP01,
+			expectedCA:    "web",
+		},
+		{
+			name:          "dns-01",
+			keyID:         "internal",
+			hmacKey:       testOtherHMACKey,
+			domains:       []string{"db.internal.example.com"},
+			challengeType: ChallengeDNS01,
+			expectedCA:    "internal",
+		},
+		{
+			name:          "wildcard",
+			keyID:         "web",
+			hmacKey:       testHMACKey,
+			domains:       []string{"*.shop.web.example.com"},
+			challengeType: ChallengeDNS01,
+			expectedCA:    "web",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, cas, responder := newTestServer(t)
+			c := newClient(t, s, tc.keyID, tc.hmacKey)
+
+			o, err := c.AuthorizeOrder(ctx, acme.DomainIDs(tc.domains...))
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			if o.Status != acme.StatusPending {
+				t.Fatalf("expected order %s, got %s", acme.StatusPending, o.Status)
+			}
+
+			err = authorize(t, c, o, tc.challengeType, responder, true)
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			if responder.validatedChallenge != len(tc.domains) {
+				t.Fatalf("expected %d validated challenges, got %d", len(tc.domains), responder.validatedChallenge)
+			}
+			o, err = c.WaitOrder(ctx, o.URI)
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			if o.Status != acme.StatusReady {
+				t.Fatalf("expected order %s, got %s", acme.StatusReady, o.Status)
+			}
+
+			// CSRs of ACME clients usually do not have a common name.
+			chain, _, err := c.CreateOrderCert(ctx, o.FinalizeURL, newCSR(t, tc.domains...), true)
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			if len(chain) != 2 {
+				t.Fatalf("expected certificate and issuing CA, got %d certificates", len(chain))
+			}
+			cert, err := x509.ParseCertificate(chain[0])
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			err = cert.CheckSignatureFrom(cas[tc.expectedCA].Cert)
+			if err != nil {
+				t.Fatalf("expected certificate signed by CA of cluster %q, got %#v", tc.expectedCA, err)
+			}
+
+			// Valid authorizations are reused for new orders.
+			o, err = c.AuthorizeOrder(ctx, acme.DomainIDs(tc.domains...))
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			if o.Status != acme.StatusReady {
+				t.Fatalf("expected order %s, got %s", acme.StatusReady, o.Status)
+			}
+		})
+	}
+}
+
+func Test_ACME_Register(t *testing.T) {
+	ctx := context.Background()
+	s, _, _ := newTestServer(t)
+
+	testCases := []struct {
+		name                string
+		binding             *acme.ExternalAccountBinding
+		expectedProblemType string
+	}{
+		{
+			name:                "without binding",
+			expectedProblemType: problemPrefix + "externalAccountRequired",
+		},
+		{
+			name:                "unknown key",
+			binding:             &acme.ExternalAccountBinding{KID: "unknown", Key: testHMACKey},
+			expectedProblemType: problemPrefix + "unauthorized",
+		},
+		{
+			name:                "wrong HMAC key",
+			binding:             &acme.ExternalAccountBinding{KID: "web", Key: testOtherHMACKey},
+			expectedProblemType: problemPrefix + "unauthorized",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &acme.Client{
+				Key:          newKey(t),
+				DirectoryURL: s.URL + "/acme/directory",
+				HTTPClient:   s.Client(),
+			}
+
+			_, err := c.Register(ctx, &acme.Account{ExternalAccountBinding: tc.binding}, acme.AcceptTOS)
+			if problemType(err) != tc.expectedProblemType {
+				t.Fatalf("expected problem %q, got %#v", tc.expectedProblemType, err)
+			}
+		})
+	}
+
+	t.Run("existing account", func(t *testing.T) {
+		c := newClient(t, s, "web", testHMACKey)
+
+		_, err := c.Register(ctx, &acme.Account{}, acme.AcceptTOS)
+		if err != acme.ErrAccountAlreadyExists {
+			t.Fatalf("expected %#v, got %#v", acme.ErrAccountAlreadyExists, err)
+		}
+		_, err = c.GetReg(ctx, "")
+		if err != nil {
+			t.Fatalf("expected no error, got %#v", err)
+		}
+	})
+}
+
+func Test_ACME_Rejected(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("domain not allowed", func(t *testing.T) {
+		s, _, _ := newTestServer(t)
+		c := newClient(t, s, "web", testHMACKey)
+
+		_, err := c.AuthorizeOrder(ctx, acme.DomainIDs("a.internal.example.com"))
+		if problemType(err) != problemPrefix+"rejectedIdentifier" {
+			t.Fatalf("expected rejected identifier, got %#v", err)
+		}
+	})
+
+	t.Run("IP identifier", func(t *testing.T) {
+		s, _, _ := newTestServer(t)
+		c := newClient(t, s, "internal", testOtherHMACKey)
+
+		_, err := c.AuthorizeOrder(ctx, acme.IPIDs("10.0.0.1"))
+		if problemType(err) != problemPrefix+"unsupportedIdentifier" {
+			t.Fatalf("expected unsupported identifier, got %#v", err)
+		}
+	})
+
+	t.Run("challenge not provisioned", func(t *testing.T) {
+		s, _, responder := newTestServer(t)
+		c := newClient(t, s, "web", testHMACKey)
+
+		o, err := c.AuthorizeOrder(ctx, acme.DomainIDs("a.web.example.com"))
+		if err != nil {
+			t.Fatalf("expected no error, got %#v", err)
+		}
+		err = authorize(t, c, o, ChallengeHTTP01, responder, false)
+		var authzErr *acme.AuthorizationError
+		if !errors.As(err, &authzErr) {
+			t.Fatalf("expected authorization error, got %#v", err)
+		}
+		o, err = c.GetOrder(ctx, o.URI)
+		if err != nil {
+			t.Fatalf("expected no error, got %#v", err)
+		}
+		if o.Status != acme.StatusInvalid {
+			t.Fatalf("expected order %s, got %s", acme.StatusInvalid, o.Status)
+		}
+	})
+
+	t.Run("finalize before authorization", func(t *testing.T) {
+		s, _, _ := newTestServer(t)
+		c := newClient(t, s, "web", testHMACKey)
+
+		o, err := c.AuthorizeOrder(ctx, acme.DomainIDs("a.web.example.com"))
+		if err != nil {
+			t.Fatalf("expected no error, got %#v", err)
+		}
+		_, _, err = c.CreateOrderCert(ctx, o.FinalizeURL, newCSR(t, "a.web.example.com"), true)
+		if problemType(err) != problemPrefix+"orderNotReady" {
+			t.Fatalf("expected order not ready, got %#v", err)
+		}
+	})
+
+	t.Run("CSR with other names", func(t *testing.T) {
+		s, _, responder := newTestServer(t)
+		c := newClient(t, s, "web", testHMACKey)
+
+		o, err := c.AuthorizeOrder(ctx, acme.DomainIDs("a.web.example.com"))
+		if err != nil {
+			t.Fatalf("expected no error, got %#v", err)
+		}
+		err = authorize(t, c, o, ChallengeHTTP01, responder, true)
+		if err != nil {
+			t.Fatalf("expected no error, got %#v", err)
+		}
+		_, _, err = c.CreateOrderCert(ctx, o.FinalizeURL, newCSR(t, "a.web.example.com", "b.web.example.com"), true)
+		if problemType(err) != problemPrefix+"badCSR" {
+			t.Fatalf("expected bad CSR, got %#v", err)
+		}
+	})
+
+	t.Run("other account", func(t *testing.T) {
+		s, _, _ := newTestServer(t)
+		c := newClient(t, s, "web", testHMACKey)
+		other := newClient(t, s, "web", testHMACKey)
+
+		o, err := c.AuthorizeOrder(ctx, acme.DomainIDs("a.web.example.com"))
+		if err != nil {
+			t.Fatalf("expected no error, got %#v", err)
+		}
+		_, err = other.GetOrder(ctx, o.URI)
+		if problemType(err) != problemPrefix+"malformed" {
+			t.Fatalf("expected order not found, got %#v", err)
+		}
+	})
+}
+
+func Test_problemFrom(t *testing.T) {
+	p := problemFrom(microerror.Maskf(badNonceError, "nonce 'x' is invalid"))
+	if p.Type != problemPrefix+"badNonce" || p.Status != http.StatusBadRequest {
+		t.Fatalf("expected bad nonce with status %d, got %#v", http.StatusBadRequest, p)
+	}
+
+	p = problemFrom(errors.New("unexpected"))
+	if p.Type != problemPrefix+"serverInternal" || p.Status != http.StatusInternalServerError {
+		t.Fatalf("expected server internal with status %d, got %#v", http.StatusInternalServerError, p)
+	}
+}
@@ -0,0 +1,151 @@
+package acmeserver
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const (
+	// ChallengeHTTP01 is the type of challenges validated by fetching the key
+	// authorization from the domain via HTTP, see RFC 8555 section 8.3.
+	ChallengeHTTP01 = "http-01"
+
+	// ChallengeDNS01 is the type of challenges validated by looking up the
+	// digest of the key authorization in a DNS TXT record of the domain, see
+	// RFC 8555 section 8.4.
+	ChallengeDNS01 = "dns-01"
+)
+
+// ExternalAccount is a key ACME accounts are bound to on registration using
+// external account binding, see RFC 8555 section 7.3.4. Binding an account
+// to a key binds it to the key's cluster ID, so that all certificates the
+// account orders are signed by the cluster's PKI backend.
+type ExternalAccount struct {
+	// KeyID identifies the key. It is given to ACME clients together with
+	// HMACKey, e.g. as keyID of cert-manager's externalAccountBinding.
+	KeyID string `json:"keyID"`
+
+	// HMACKey is the base64url encoded MAC key accounts are bound with.
+	HMACKey string `json:"hmacKey"`
+
+	// ClusterID represents the cluster ID whose PKI backend signs the
+	// certificates of accounts bound to the key.
+	ClusterID string `json:"clusterID"`
+
+	// Domains are the patterns all identifiers of orders of accounts bound to
+	// the key must match, in addition to proving control over them. Patterns
+	// are matched using path.Match, so that '*' matches any sequence of
+	// characters except '/', e.g. '*.example.com' matches 'a.b.example.com'.
+	Domains []string `json:"domains"`
+}
+
+// Validator validates challenges of a single type, proving control over
+// domains.
+type Validator interface {
+	// Validate checks whether the given key authorization of the challenge
+	// with the given token is provisioned for the given domain. An error
+	// asserted by IsIncorrectResponse is returned in case the domain
+	// provisions something else.
+	Validate(ctx context.Context, domain, token, keyAuthorization string) error
+}
+
+// ValidatorFunc is a function implementing Validator, e.g. to accept
+// challenges without validating them in tests.
+type ValidatorFunc func(ctx context.Context, domain, token, keyAuthorization string) error
+
+// Validate calls f.
+func (f ValidatorFunc) Validate(ctx context.Context, domain, token, keyAuthorization string) error {
+	return f(ctx, domain, token, keyAuthorization)
+}
+
+// The following types are the ACME resources as represented in responses,
+// see RFC 8555 section 7.1.
+
+type directory struct {
+	NewNonce   string        `json:"newNonce"`
+	NewAccount string        `json:"newAccount"`
+	NewOrder   string        `json:"newOrder"`
+	Meta       directoryMeta `json:"meta"`
+}
+
+type directoryMeta struct {
+	ExternalAccountRequired bool `json:"externalAccountRequired"`
+}
+
+type identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type accountResource struct {
+	Status  string   `json:"status"`
+	Contact []string `json:"contact,omitempty"`
+	Orders  string   `json:"orders"`
+}
+
+type ordersResource struct {
+	Orders []string `json:"orders"`
+}
+
+type orderResource struct {
+	Status         string       `json:"status"`
+	Expires        time.Time    `json:"expires"`
+	Identifiers    []identifier `json:"identifiers"`
+	Authorizations []string     `json:"authorizations"`
+	Finalize       string       `json:"finalize"`
+	Certificate    string       `json:"certificate,omitempty"`
+	Error          *problem     `json:"error,omitempty"`
+}
+
+type authorizationResource struct {
+	Status     string              `json:"status"`
+	Expires    time.Time           `json:"expires"`
+	Identifier identifier          `json:"identifier"`
+	Challenges []challengeResource `json:"challenges"`
+	Wildcard   bool                `json:"wildcard,omitempty"`
+}
+
+type challengeResource struct {
+	Type      string     `json:"type"`
+	URL       string     `json:"url"`
+	Status    string     `json:"status"`
+	Token     string     `json:"token"`
+	Validated *time.Time `json:"validated,omitempty"`
+	Error     *problem   `json:"error,omitempty"`
+}
+
+// problem is an error response, see RFC 8555 section 6.7.
+type problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status,omitempty"`
+}
+
+// The following types are the payloads of requests.
+
+type newAccountRequest struct {
+	Contact                []string        `json:"contact"`
+	TermsOfServiceAgreed   bool            `json:"termsOfServiceAgreed"`
+	OnlyReturnExisting     bool            `json:"onlyReturnExisting"`
+	ExternalAccountBinding json.RawMessage `json:"externalAccountBinding"`
+}
+
+type accountRequest struct {
+	Contact []string `json:"contact"`
+	Status  string   `json:"status"`
+}
+
+type newOrderRequest struct {
+	Identifiers []identifier `json:"identifiers"`
+	NotBefore   string       `json:"notBefore"`
+	NotAfter    string       `json:"notAfter"`
+}
+
+type authorizationRequest struct {
+	Status string `json:"status"`
+}
+
+type finalizeRequest struct {
+	CSR string `json:"csr"`
+}
@@ -0,0 +1,262 @@
+package acmeserver
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+
+	jose "gopkg.in/square/go-jose.v2"
+
+	apiserver "github.com/giantswarm/certctl/v2/service/api-server"
+)
+
+const (
+	statusDeactivated = "deactivated"
+	statusExpired     = "expired"
+	statusInvalid     = "invalid"
+	statusPending     = "pending"
+	statusProcessing  = "processing"
+	statusReady       = "ready"
+	statusValid       = "valid"
+
+	// authorizationLifetime is the time authorizations can be validated in
+	// and valid authorizations are reused for new orders of the same
+	// account.
+	authorizationLifetime = 24 * time.Hour
+
+	// orderLifetime is the time orders can be finalized in and their
+	// certificates can be downloaded.
+	orderLifetime = 24 * time.Hour
+
+	// nonceLifetime is the time nonces can be used in, and maxNonces the
+	// number of unused nonces kept at most.
+	nonceLifetime = time.Hour
+	maxNonces     = 10000
+)
+
+// The following types hold the state of the ACME resources. All of it is
+// kept in memory and protected by server.mutex.
+
+type account struct {
+	ID         string
+	Key        *jose.JSONWebKey
+	Thumbprint string
+	Status     string
+	Contact    []string
+
+	// KeyID is the ID of the external account key the account is bound to.
+	KeyID     string
+	ClusterID string
+
+	// client authorizes the identifiers of orders by the domains of the
+	// external account key.
+	client apiserver.Client
+
+	OrderIDs []string
+}
+
+type order struct {
+	ID        string
+	AccountID string
+
+	// Status is only set once the order is processing, valid or invalid.
+	// Otherwise it is derived from its authorizations.
+	Status      string
+	Expires     time.Time
+	Identifiers []identifier
+
+	AuthorizationIDs []string
+	CertificateID    string
+	Error            *problem
+}
+
+type authorization struct {
+	ID         string
+	AccountID  string
+	Status     string
+	Expires    time.Time
+	Identifier identifier
+	Wildcard   bool
+
+	ChallengeIDs []string
+}
+
+type challenge struct {
+	ID              string
+	AuthorizationID string
+	Type            string
+	Status          string
+	Token           string
+	Validated       time.Time
+	Error           *problem
+}
+
+type certificate struct {
+	ID        string
+	AccountID string
+	OrderID   string
+
+	// Chain is the PEM encoded certificate followed by its issuing CA.
+	Chain string
+}
+
+type store struct {
+	accounts       map[string]*account
+	authorizations map[string]*authorization
+	certificates   map[string]*certificate
+	challenges     map[string]*challenge
+	nonces         map[string]time.Time
+	orders         map[string]*order
+}
+
+func newStore() *store {
+	return &store{
+		accounts:       map[string]*account{},
+		authorizations: map[string]*authorization{},
+		certificates:   map[string]*certificate{},
+		challenges:     map[string]*challenge{},
+		nonces:         map[string]time.Time{},
+		orders:         map[string]*order{},
+	}
+}
+
+func (s *store) accountByThumbprint(thumbprint string) *account {
+	for _, a := range s.accounts {
+		if a.Thumbprint == thumbprint {
+			return a
+		}
+	}
+
+	return nil
+}
+
+// newNonce returns a new nonce, dropping expired nonces in case too many are
+// unused.
+func (s *store) newNonce(now time.Time) string {
+	if len(s.nonces) >= maxNonces {
+		for n, created := range s.nonces {
+			if now.Sub(created) > nonceLifetime {
+				delete(s.nonces, n)
+			}
+		}
+		for n := range s.nonces {
+			if len(s.nonces) < maxNonces {
+				break
+			}
+			delete(s.nonces, n)
+		}
+	}
+
+	n := newID()
+	s.nonces[n] = now
+
+	return n
+}
+
+// useNonce returns whether the given nonce was issued and is not expired.
+// Every nonce can only be used once.
+func (s *store) useNonce(n string, now time.Time) bool {
+	created, ok := s.nonces[n]
+	if !ok {
+		return false
+	}
+	delete(s.nonces, n)
+
+	return now.Sub(created) <= nonceLifetime
+}
+
+// authorizationStatus returns the status of the given authorization, which
+// expires unless it is invalid or deactivated.
+func (s *store) authorizationStatus(a *authorization, now time.Time) string {
+	if (a.Status == statusPending || a.Status == statusValid) && now.After(a.Expires) {
+		return statusExpired
+	}
+
+	return a.Status
+}
+
+// orderStatus returns the status of the given order, see RFC 8555 section
+// 7.1.6.
+func (s *store) orderStatus(o *order, now time.Time) string {
+	if o.Status != "" {
+		return o.Status
+	}
+	if now.After(o.Expires) {
+		return statusInvalid
+	}
+
+	status := statusReady
+	for _, id := range o.AuthorizationIDs {
+		switch s.authorizationStatus(s.authorizations[id], now) {
+		case statusValid:
+		case statusPending:
+			status = statusPending
+		default:
+			return statusInvalid
+		}
+	}
+
+	return status
+}
+
+// validAuthorization returns a valid authorization of the given account for
+// the given identifier to be reused, if any.
+func (s *store) validAuthorization(accountID string, id identifier, wildcard bool, now time.Time) *authorization {
+	for _, a := range s.authorizations {
+		if a.AccountID == accountID && a.Identifier == id && a.Wildcard == wildcard && s.authorizationStatus(a, now) == statusValid {
+			return a
+		}
+	}
+
+	return nil
+}
+
+// prune deletes expired orders together with their certificates, and
+// expired authorizations not referenced by any order anymore, together with
+// their challenges.
+func (s *store) prune(now time.Time) {
+	for id, o := range s.orders {
+		if now.After(o.Expires) {
+			delete(s.certificates, o.CertificateID)
+			delete(s.orders, id)
+		}
+	}
+
+	referenced := map[string]bool{}
+	for _, o := range s.orders {
+		for _, id := range o.AuthorizationIDs {
+			referenced[id] = true
+		}
+	}
+	for id, a := range s.authorizations {
+		if now.After(a.Expires) && !referenced[id] {
+			for _, c := range a.ChallengeIDs {
+				delete(s.challenges, c)
+			}
+			delete(s.authorizations, id)
+		}
+	}
+
+	for _, a := range s.accounts {
+		var orderIDs []string
+		for _, id := range a.OrderIDs {
+			if _, ok := s.orders[id]; ok {
+				orderIDs = append(orderIDs, id)
+			}
+		}
+		a.OrderIDs = orderIDs
+	}
+}
+
+// newID returns a random ID used for resources, nonces and challenge
+// tokens.
+func newID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		// Reading random bytes does not fail on supported platforms.
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,106 @@
+package acmeserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/microerror"
+)
+
+// HTTP01Validator validates http-01 challenges by fetching
+// http://<domain>/.well-known/acme-challenge/<token>, which must return the
+// key authorization.
+type HTTP01Validator struct {
+	// Client is used to fetch the key authorization. It may be replaced to
+	// validate against a test server. Defaults to a client following
+	// redirects without using proxies.
+	Client *http.Client
+}
+
+// Validate implements Validator.
+func (v HTTP01Validator) Validate(ctx context.Context, domain, token, keyAuthorization string) error {
+	client := v.Client
+	if client == nil {
+		client = &http.Client{
+			Transport: &http.Transport{
+				DialContext: (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+			},
+			Timeout: 30 * time.Second,
+		}
+	}
+
+	url := "http://" + domain + "/.well-known/acme-challenge/" + token
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return microerror.Maskf(incorrectResponseError, "cannot fetch '%s': %s", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return microerror.Maskf(incorrectResponseError, "fetching '%s' returned status %d", url, resp.StatusCode)
+	}
+	// The key authorization is short, anything longer is wrong anyway.
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	if err != nil {
+		return microerror.Maskf(incorrectResponseError, "cannot read '%s': %s", url, err)
+	}
+	if strings.TrimSpace(string(b)) != keyAuthorization {
+		return microerror.Maskf(incorrectResponseError, "'%s' does not return the key authorization", url)
+	}
+
+	return nil
+}
+
+// TXTResolver looks up DNS TXT records. It is implemented by *net.Resolver.
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// DNS01Validator validates dns-01 challenges by looking up the TXT records of
+// _acme-challenge.<domain>, of which one must be the base64url encoded
+// SHA-256 digest of the key authorization.
+type DNS01Validator struct {
+	// Resolver is used to look up the TXT records. It may be replaced to
+	// validate against test records. Defaults to net.DefaultResolver.
+	Resolver TXTResolver
+}
+
+// Validate implements Validator.
+func (v DNS01Validator) Validate(ctx context.Context, domain, token, keyAuthorization string) error {
+	var resolver TXTResolver = net.DefaultResolver
+	if v.Resolver != nil {
+		resolver = v.Resolver
+	}
+
+	name := "_acme-challenge." + domain
+	records, err := resolver.LookupTXT(ctx, name)
+	if err != nil {
+		return microerror.Maskf(incorrectResponseError, "cannot look up TXT records of '%s': %s", name, err)
+	}
+
+	expected := DNS01Record(keyAuthorization)
+	for _, r := range records {
+		if r == expected {
+			return nil
+		}
+	}
+
+	return microerror.Maskf(incorrectResponseError, "TXT records of '%s' do not contain the key authorization digest", name)
+}
+
+// DNS01Record returns the TXT record value proving the given key
+// authorization for dns-01 challenges.
+func DNS01Record(keyAuthorization string) string {
+	sum := sha256.Sum256([]byte(keyAuthorization))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
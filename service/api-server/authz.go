@@ -0,0 +1,122 @@
+package apiserver
+
+import (
+	"crypto/x509"
+	"net"
+	"path"
+
+	"github.com/giantswarm/microerror"
+)
+
+// Names describes the names a certificate is requested with.
+type Names struct {
+	CommonName    string
+	AltNames      []string
+	IPSANs        []net.IP
+	URISANs       []string
+	Organizations []string
+}
+
+// CSRNames returns the names requested by the given certificate signing
+// request.
+func CSRNames(csr *x509.CertificateRequest) Names {
+	n := Names{
+		CommonName:    csr.Subject.CommonName,
+		AltNames:      append(append([]string{}, csr.DNSNames...), csr.EmailAddresses...),
+		IPSANs:        csr.IPAddresses,
+		Organizations: csr.Subject.Organization,
+	}
+	for _, u := range csr.URIs {
+		n.URISANs = append(n.URISANs, u.String())
+	}
+
+	return n
+}
+
+// AuthorizeCluster checks whether the client may operate on the PKI backend
+// of the given cluster.
+func (c Client) AuthorizeCluster(clusterID string) error {
+	if !matchAny(c.ClusterIDs, clusterID) {
+		return microerror.Maskf(notAuthorizedError, "client '%s' is not allowed to access cluster ID '%s'", c.Name, clusterID)
+	}
+
+	return nil
+}
+
+// AuthorizeNames checks whether the client may request a certificate with
+// the given names.
+func (c Client) AuthorizeNames(n Names) error {
+	var domains []string
+	if n.CommonName != "" {
+		domains = append(domains, n.CommonName)
+	}
+	domains = append(domains, n.AltNames...)
+	for _, d := range domains {
+		if !matchAny(c.Domains, d) {
+			return microerror.Maskf(notAuthorizedError, "client '%s' is not allowed to request domain '%s'", c.Name, d)
+		}
+	}
+
+	for _, o := range n.Organizations {
+		if !matchAny(c.Organizations, o) {
+			return microerror.Maskf(notAuthorizedError, "client '%s' is not allowed to request organization '%s'", c.Name, o)
+		}
+	}
+
+	for _, u := range n.URISANs {
+		if !matchAny(c.URISANs, u) {
+			return microerror.Maskf(notAuthorizedError, "client '%s' is not allowed to request URI SAN '%s'", c.Name, u)
+		}
+	}
+
+	if len(n.IPSANs) != 0 && !c.AllowIPSANs {
+		return microerror.Maskf(notAuthorizedError, "client '%s' is not allowed to request IP SANs", c.Name)
+	}
+
+	return nil
+}
+
+// AuthorizeRevoke checks whether the client may revoke certificates of the
+// given cluster.
+func (c Client) AuthorizeRevoke(clusterID string) error {
+	err := c.AuthorizeCluster(clusterID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if !c.AllowRevoke {
+		return microerror.Maskf(notAuthorizedError, "client '%s' is not allowed to revoke certificates", c.Name)
+	}
+
+	return nil
+}
+
+// Validate checks the patterns of the client, so that malformed rules are
+// rejected on startup instead of never matching.
+func (c Client) Validate() error {
+	if c.Name == "" {
+		return microerror.Maskf(invalidConfigError, "client name must not be empty")
+	}
+
+	for _, patterns := range [][]string{c.ClusterIDs, c.Domains, c.Organizations, c.URISANs} {
+		for _, p := range patterns {
+			_, err := path.Match(p, "")
+			if err != nil {
+				return microerror.Maskf(invalidConfigError, "pattern '%s' of client '%s' is invalid: %s", p, c.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		// Patterns are validated on startup.
+		ok, _ := path.Match(p, name)
+		if ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,224 @@
+package apiserver
+
+import (
+	"net"
+	"strconv"
+	"testing"
+)
+
+func Test_Client_AuthorizeCluster(t *testing.T) {
+	testCases := []struct {
+		clusterIDs   []string
+		clusterID    string
+		expectedAuth bool
+	}{
+		{clusterIDs: []string{"abc"}, clusterID: "abc", expectedAuth: true},
+		{clusterIDs: []string{"abc"}, clusterID: "abcd", expectedAuth: false},
+		{clusterIDs: []string{"ab*"}, clusterID: "abcd", expectedAuth: true},
+		{clusterIDs: []string{"*"}, clusterID: "xyz", expectedAuth: true},
+		{clusterIDs: []string{"abc", "def"}, clusterID: "def", expectedAuth: true},
+		{clusterIDs: nil, clusterID: "abc", expectedAuth: false},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			c := Client{Name: "test", ClusterIDs: tc.clusterIDs}
+			err := c.AuthorizeCluster(tc.clusterID)
+			if tc.expectedAuth && err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			if !tc.expectedAuth && !IsNotAuthorized(err) {
+				t.Fatalf("expected not authorized error, got %#v", err)
+			}
+		})
+	}
+}
+
+func Test_Client_AuthorizeNames(t *testing.T) {
+	client := Client{
+		Name:          "test",
+		Domains:       []string{"*.example.com", "example.com", "*@example.com"},
+		Organizations: []string{"team-*"},
+		URISANs:       []string{"spiffe://example.com/ns/billing/*"},
+	}
+
+	testCases := []struct {
+		name         string
+		client       Client
+		names        Names
+		expectedAuth bool
+	}{
+		{
+			name:         "common name matching glob",
+			client:       client,
+			names:        Names{CommonName: "api.example.com"},
+			expectedAuth: true,
+		},
+		{
+			name:         "bare domain",
+			client:       client,
+			names:        Names{CommonName: "example.com"},
+			expectedAuth: true,
+		},
+		{
+			name:         "glob matching nested subdomain",
+			client:       client,
+			names:        Names{CommonName: "a.b.example.com"},
+			expectedAuth: true,
+		},
+		{
+			name:         "common name not matching",
+			client:       client,
+			names:        Names{CommonName: "api.example.org"},
+			expectedAuth: false,
+		},
+		{
+			name:         "suffix without dot",
+			client:       client,
+			names:        Names{CommonName: "evilexample.com"},
+			expectedAuth: false,
+		},
+		{
+			name:         "alt name not matching",
+			client:       client,
+			names:        Names{CommonName: "api.example.com", AltNames: []string{"api.example.org"}},
+			expectedAuth: false,
+		},
+		{
+			name:         "email matched against domains",
+			client:       client,
+			names:        Names{AltNames: []string{"admin@example.com"}},
+			expectedAuth: true,
+		},
+		{
+			name:         "email not matching domains",
+			client:       client,
+			names:        Names{AltNames: []string{"admin@example.org"}},
+			expectedAuth: false,
+		},
+		{
+			name:         "email not allowed by domain glob",
+			client:       Client{Name: "test", Domains: []string{"*.example.com"}},
+			names:        Names{AltNames: []string{"admin@example.com"}},
+			expectedAuth: false,
+		},
+		{
+			name:         "organization matching",
+			client:       client,
+			names:        Names{CommonName: "api.example.com", Organizations: []string{"team-billing"}},
+			expectedAuth: true,
+		},
+		{
+			name:         "organization not matching",
+			client:       client,
+			names:        Names{CommonName: "api.example.com", Organizations: []string{"system:masters"}},
+			expectedAuth: false,
+		},
+		{
+			name:         "URI SAN matching",
+			client:       client,
+			names:        Names{URISANs: []string{"spiffe://example.com/ns/billing/api"}},
+			expectedAuth: true,
+		},
+		{
+			name:         "URI SAN not matching across segments",
+			client:       client,
+			names:        Names{URISANs: []string{"spiffe://example.com/ns/billing/sa/api"}},
+			expectedAuth: false,
+		},
+		{
+			name:         "IP SANs not allowed",
+			client:       client,
+			names:        Names{CommonName: "api.example.com", IPSANs: []net.IP{net.ParseIP("10.0.0.1")}},
+			expectedAuth: false,
+		},
+		{
+			name:         "IP SANs allowed",
+			client:       Client{Name: "test", Domains: []string{"*"}, AllowIPSANs: true},
+			names:        Names{CommonName: "api.example.com", IPSANs: []net.IP{net.ParseIP("10.0.0.1")}},
+			expectedAuth: true,
+		},
+		{
+			name:         "no names",
+			client:       Client{Name: "test"},
+			names:        Names{},
+			expectedAuth: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.client.AuthorizeNames(tc.names)
+			if tc.expectedAuth && err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			if !tc.expectedAuth && !IsNotAuthorized(err) {
+				t.Fatalf("expected not authorized error, got %#v", err)
+			}
+		})
+	}
+}
+
+func Test_Client_AuthorizeRevoke(t *testing.T) {
+	testCases := []struct {
+		name         string
+		client       Client
+		clusterID    string
+		expectedAuth bool
+	}{
+		{
+			name:         "revoke allowed",
+			client:       Client{Name: "test", ClusterIDs: []string{"ab*"}, AllowRevoke: true},
+			clusterID:    "abc",
+			expectedAuth: true,
+		},
+		{
+			name:         "revoke not allowed",
+			client:       Client{Name: "test", ClusterIDs: []string{"ab*"}},
+			clusterID:    "abc",
+			expectedAuth: false,
+		},
+		{
+			name:         "cluster not allowed",
+			client:       Client{Name: "test", ClusterIDs: []string{"ab*"}, AllowRevoke: true},
+			clusterID:    "xyz",
+			expectedAuth: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.client.AuthorizeRevoke(tc.clusterID)
+			if tc.expectedAuth && err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			if !tc.expectedAuth && !IsNotAuthorized(err) {
+				t.Fatalf("expected not authorized error, got %#v", err)
+			}
+		})
+	}
+}
+
+func Test_Client_Validate(t *testing.T) {
+	testCases := []struct {
+		name          string
+		client        Client
+		expectedValid bool
+	}{
+		{name: "valid", client: Client{Name: "test", Domains: []string{"*.example.com"}}, expectedValid: true},
+		{name: "empty name", client: Client{Domains: []string{"*.example.com"}}, expectedValid: false},
+		{name: "malformed pattern", client: Client{Name: "test", ClusterIDs: []string{"[abc"}}, expectedValid: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.client.Validate()
+			if tc.expectedValid && err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			if !tc.expectedValid && !IsInvalidConfig(err) {
+				t.Fatalf("expected invalid config error, got %#v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,468 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+
+	"github.com/giantswarm/certctl/v2/service/exitcode"
+	"github.com/giantswarm/certctl/v2/service/metrics"
+	"github.com/giantswarm/certctl/v2/service/pki"
+	"github.com/giantswarm/certctl/v2/service/spec"
+)
+
+const (
+	actionCA     = "ca"
+	actionIssue  = "issue"
+	actionRevoke = "revoke"
+	actionSign   = "sign"
+
+	// maxBodySize limits the size of request bodies, which only hold small
+	// JSON documents and CSRs.
+	maxBodySize = 1 << 20
+
+	// pathPrefix prefixes the paths of all cluster specific endpoints, which
+	// are <pathPrefix><clusterID>/<action>.
+	pathPrefix = "/v1/clusters/"
+)
+
+// methods holds the HTTP method of every action.
+var methods = map[string]string{
+	actionCA:     http.MethodGet,
+	actionIssue:  http.MethodPost,
+	actionRevoke: http.MethodPost,
+	actionSign:   http.MethodPost,
+}
+
+// Config represents the configuration used to create a new API server.
+type Config struct {
+	// Dependencies.
+
+	// AuditLogger receives an entry for every request, including the client,
+	// the requested names and the outcome.
+	AuditLogger micrologger.Logger
+	CertSigner  spec.CertSigner
+	Logger      micrologger.Logger
+	PKIService  pki.Service
+
+	// Settings.
+
+	// Clients holds the authorization rules of all clients. Requests of
+	// clients not listed are denied.
+	Clients []Client
+
+	// AllowedDomains, AllowBareDomains, AllowedURISANs and RoleTTL configure
+	// the roles created in case a certificate is requested with
+	// organizations no role exists for yet.
+	AllowedDomains   []string
+	AllowBareDomains bool
+	AllowedURISANs   []string
+	RoleTTL          string
+
+	// Timeout bounds the requests to Vault made for a single API request.
+	// Zero means no timeout.
+	Timeout time.Duration
+}
+
+// DefaultConfig provides a default configuration to create a new API server.
+func DefaultConfig() Config {
+	newLogger, err := micrologger.New(micrologger.Config{IOWriter: os.Stderr})
+	if err != nil {
+		panic(err)
+	}
+
+	newConfig := Config{
+		// Dependencies.
+		AuditLogger: newLogger,
+		Logger:      newLogger,
+
+		// Settings.
+		RoleTTL: "8640h",
+	}
+
+	return newConfig
+}
+
+// New creates a new configured API server. It serves the API under /v1/ and
+// is meant to be served with TLS requiring verified client certificates,
+// e.g. tls.RequireAndVerifyClientCert, since clients are identified by the
+// common name of their certificate.
+func New(config Config) (http.Handler, error) {
+	// Dependencies.
+	if config.AuditLogger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "audit logger must not be empty")
+	}
+	if config.CertSigner == nil {
+		return nil, microerror.Maskf(invalidConfigError, "cert signer must not be empty")
+	}
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "logger must not be empty")
+	}
+	if config.PKIService == nil {
+		return nil, microerror.Maskf(invalidConfigError, "PKI service must not be empty")
+	}
+
+	// Settings.
+	if len(config.Clients) == 0 {
+		return nil, microerror.Maskf(invalidConfigError, "clients must not be empty")
+	}
+	clients := map[string]Client{}
+	for _, c := range config.Clients {
+		err := c.Validate()
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+		if _, ok := clients[c.Name]; ok {
+			return nil, microerror.Maskf(invalidConfigError, "client '%s' must not be given more than once", c.Name)
+		}
+		clients[c.Name] = c
+	}
+
+	newServer := &server{
+		Config: config,
+
+		clients: clients,
+	}
+
+	return newServer, nil
+}
+
+type server struct {
+	Config
+
+	// clients holds the clients by name.
+	clients map[string]Client
+}
+
+// request describes an API request for the audit log.
+type request struct {
+	Action    string
+	ClusterID string
+	Client    string
+
+	// Details are the key value pairs describing the requested certificate
+	// or its outcome, e.g. the issued serial number.
+	Details []interface{}
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	req := &request{}
+
+	response, err := s.handle(r, req)
+
+	status := http.StatusOK
+	if err != nil {
+		status = HTTPStatus(err)
+		message := http.StatusText(status)
+		if status < http.StatusInternalServerError {
+			message = microerror.Pretty(err, false)
+		} else {
+			s.Logger.LogCtx(r.Context(), "level", "error", "message", "cannot handle API request", "action", req.Action, "cluster_id", req.ClusterID, "error", microerror.Pretty(err, false))
+		}
+		response = ErrorResponse{Error: message}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.Logger.LogCtx(r.Context(), "level", "warning", "message", "cannot write API response", "error", microerror.Pretty(err, false))
+	}
+
+	metrics.ServerRequests.WithLabelValues("api", req.Action, strconv.Itoa(status)).Inc()
+
+	entry := []interface{}{
+		"level", "info",
+		"message", "API request",
+		"action", req.Action,
+		"client", req.Client,
+		"cluster_id", req.ClusterID,
+		"duration", time.Since(start).String(),
+		"method", r.Method,
+		"path", r.URL.Path,
+		"remote_addr", r.RemoteAddr,
+		"status", status,
+	}
+	entry = append(entry, req.Details...)
+	if err != nil {
+		entry = append(entry, "error", microerror.Pretty(err, false))
+	}
+	s.AuditLogger.LogCtx(r.Context(), entry...)
+}
+
+// handle authenticates, routes and executes the given API request. The
+// request is described for the audit log as far as it got.
+func (s *server) handle(r *http.Request, req *request) (interface{}, error) {
+	client, err := s.authenticate(r, req)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	if !strings.HasPrefix(r.URL.Path, pathPrefix) {
+		return nil, microerror.Maskf(notFoundError, "path '%s' not found", r.URL.Path)
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, pathPrefix), "/")
+	if len(parts) != 2 || parts[0] == "" {
+		return nil, microerror.Maskf(notFoundError, "path '%s' not found", r.URL.Path)
+	}
+	method, ok := methods[parts[1]]
+	if !ok {
+		return nil, microerror.Maskf(notFoundError, "path '%s' not found", r.URL.Path)
+	}
+	req.ClusterID = parts[0]
+	req.Action = parts[1]
+
+	if r.Method != method {
+		return nil, microerror.Maskf(methodNotAllowedError, "method %s not allowed for '%s', use %s", r.Method, r.URL.Path, method)
+	}
+
+	ctx, cancel := s.withTimeout(r.Context())
+	defer cancel()
+
+	switch req.Action {
+	case actionCA:
+		return s.ca(ctx, client, req)
+	case actionIssue:
+		return s.issue(ctx, client, req, r)
+	case actionRevoke:
+		return s.revoke(ctx, client, req, r)
+	default:
+		return s.sign(ctx, client, req, r)
+	}
+}
+
+// authenticate returns the client identified by the verified client
+// certificate of the given request. The name is recorded for the audit log
+// even if the client is unknown.
+func (s *server) authenticate(r *http.Request, req *request) (Client, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return Client{}, microerror.Maskf(unauthenticatedError, "verified client certificate required")
+	}
+
+	name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	req.Client = name
+	client, ok := s.clients[name]
+	if !ok {
+		return Client{}, microerror.Maskf(notAuthorizedError, "client '%s' is unknown", name)
+	}
+
+	return client, nil
+}
+
+func (s *server) ca(ctx context.Context, client Client, req *request) (interface{}, error) {
+	err := client.AuthorizeCluster(req.ClusterID)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	ca, err := s.PKIService.CAWithContext(ctx, req.ClusterID)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return ca, nil
+}
+
+func (s *server) issue(ctx context.Context, client Client, req *request, r *http.Request) (interface{}, error) {
+	var body IssueRequest
+	err := decode(r, &body)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	req.Details = append(req.Details, "common_name", body.CommonName, "alt_names", strings.Join(body.AltNames, ","), "organizations", strings.Join(body.Organizations, ","), "ttl", body.TTL)
+
+	err = client.AuthorizeCluster(req.ClusterID)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	err = client.AuthorizeNames(issueNames(body))
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	if body.CommonName == "" {
+		return nil, microerror.Maskf(invalidRequestError, "common name must not be empty")
+	}
+
+	newIssueConfig := spec.IssueConfig{
+		ClusterID:     req.ClusterID,
+		CommonName:    body.CommonName,
+		Organizations: body.Organizations,
+		IPSANs:        body.IPSANs,
+		AltNames:      body.AltNames,
+		URISANs:       body.URISANs,
+		TTL:           body.TTL,
+
+		AllowedDomains:   s.AllowedDomains,
+		AllowBareDomains: s.AllowBareDomains,
+		AllowedURISANs:   s.AllowedURISANs,
+		RoleTTL:          s.RoleTTL,
+	}
+	newIssueResponse, err := s.CertSigner.IssueWithContext(ctx, newIssueConfig)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	req.Details = append(req.Details, "serial_number", newIssueResponse.SerialNumber)
+
+	return newIssueResponse, nil
+}
+
+func (s *server) sign(ctx context.Context, client Client, req *request, r *http.Request) (interface{}, error) {
+	var body SignRequest
+	err := decode(r, &body)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	// The CSR is parsed to authorize the names it requests. Its signature is
+	// checked by the cert signer.
+	block, _ := pem.Decode([]byte(body.CSR))
+	if block == nil {
+		return nil, microerror.Maskf(invalidRequestError, "CSR must be PEM encoded")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, microerror.Maskf(invalidRequestError, "cannot parse CSR: %s", err)
+	}
+
+	n := CSRNames(csr)
+	req.Details = append(req.Details, "common_name", n.CommonName, "alt_names", strings.Join(n.AltNames, ","), "organizations", strings.Join(n.Organizations, ","), "ttl", body.TTL)
+
+	err = client.AuthorizeCluster(req.ClusterID)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	err = client.AuthorizeNames(n)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	newSignConfig := spec.SignConfig{
+		ClusterID: req.ClusterID,
+		CSR:       body.CSR,
+		TTL:       body.TTL,
+
+		AllowedDomains:   s.AllowedDomains,
+		AllowBareDomains: s.AllowBareDomains,
+		AllowedURISANs:   s.AllowedURISANs,
+		RoleTTL:          s.RoleTTL,
+	}
+	newSignResponse, err := s.CertSigner.SignWithContext(ctx, newSignConfig)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	req.Details = append(req.Details, "serial_number", newSignResponse.SerialNumber)
+
+	return newSignResponse, nil
+}
+
+func (s *server) revoke(ctx context.Context, client Client, req *request, r *http.Request) (interface{}, error) {
+	var body RevokeRequest
+	err := decode(r, &body)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	req.Details = append(req.Details, "serial_number", body.SerialNumber)
+
+	err = client.AuthorizeRevoke(req.ClusterID)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	if body.SerialNumber == "" {
+		return nil, microerror.Maskf(invalidRequestError, "serial number must not be empty")
+	}
+
+	newRevokeConfig := spec.RevokeConfig{
+		ClusterID:    req.ClusterID,
+		SerialNumber: body.SerialNumber,
+	}
+	newRevokeResponse, err := s.CertSigner.RevokeWithContext(ctx, newRevokeConfig)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return newRevokeResponse, nil
+}
+
+func (s *server) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.Timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, s.Timeout)
+}
+
+// issueNames returns the names requested by the given issue request.
+func issueNames(body IssueRequest) Names {
+	return Names{
+		CommonName:    body.CommonName,
+		AltNames:      body.AltNames,
+		IPSANs:        body.IPSANs,
+		URISANs:       body.URISANs,
+		Organizations: body.Organizations,
+	}
+}
+
+// decode decodes the JSON body of the given request into v. Unknown fields
+// are rejected, so that clients notice typos instead of getting a
+// certificate without the names they wanted.
+func decode(r *http.Request, v interface{}) error {
+	d := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBodySize))
+	d.DisallowUnknownFields()
+
+	err := d.Decode(v)
+	if err != nil {
+		return microerror.Maskf(invalidRequestError, "cannot decode request body: %s", err)
+	}
+
+	return nil
+}
+
+// HTTPStatus maps the given error to the HTTP status code of the response.
+// Errors of Vault and the services are mapped via their exit code, so that
+// both tell failures apart the same way.
+func HTTPStatus(err error) int {
+	switch {
+	case IsInvalidRequest(err):
+		return http.StatusBadRequest
+	case IsUnauthenticated(err):
+		return http.StatusUnauthorized
+	case IsNotAuthorized(err):
+		return http.StatusForbidden
+	case IsNotFound(err):
+		return http.StatusNotFound
+	case IsMethodNotAllowed(err):
+		return http.StatusMethodNotAllowed
+	case errors.Is(err, context.Canceled):
+		// The client went away, nobody receives the response.
+		return http.StatusServiceUnavailable
+	}
+
+	switch exitcode.FromError(err) {
+	case exitcode.InvalidConfig, exitcode.InvalidData:
+		return http.StatusBadRequest
+	case exitcode.NotAllowed:
+		return http.StatusForbidden
+	case exitcode.NotFound:
+		return http.StatusNotFound
+	case exitcode.Conflict:
+		return http.StatusConflict
+	case exitcode.VaultUnavailable:
+		return http.StatusServiceUnavailable
+	case exitcode.Timeout:
+		return http.StatusGatewayTimeout
+	case exitcode.PermissionDenied, exitcode.VaultError:
+		return http.StatusBadGateway
+	}
+
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,304 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger/microloggertest"
+	vaultclient "github.com/hashicorp/vault/api"
+
+	"github.com/giantswarm/certctl/v2/service/pki"
+	"github.com/giantswarm/certctl/v2/service/spec"
+)
+
+// testCertSigner issues fake certificates and records the requests it got.
+type testCertSigner struct {
+	spec.CertSigner
+
+	issued []spec.IssueConfig
+}
+
+func (s *testCertSigner) IssueWithContext(ctx context.Context, config spec.IssueConfig) (spec.IssueResponse, error) {
+	s.issued = append(s.issued, config)
+
+	newIssueResponse := spec.IssueResponse{
+		Certificate:  "certificate",
+		SerialNumber: "01:02",
+	}
+
+	return newIssueResponse, nil
+}
+
+func (s *testCertSigner) RevokeWithContext(ctx context.Context, config spec.RevokeConfig) (spec.RevokeResponse, error) {
+	return spec.RevokeResponse{}, nil
+}
+
+// testPKIService returns a fake root CA for every cluster.
+type testPKIService struct {
+	pki.Service
+}
+
+func (s *testPKIService) CAWithContext(ctx context.Context, clusterID string) (pki.CA, error) {
+	return pki.CA{CommonName: clusterID + " CA"}, nil
+}
+
+func newTestServer(t *testing.T) (http.Handler, *testCertSigner) {
+	certSigner := &testCertSigner{}
+
+	config := DefaultConfig()
+	config.AuditLogger = microloggertest.New()
+	config.Logger = microloggertest.New()
+	config.CertSigner = certSigner
+	config.PKIService = &testPKIService{}
+	config.Clients = []Client{
+		{
+			Name:       "ingress",
+			ClusterIDs: []string{"abc"},
+			Domains:    []string{"*.example.com"},
+		},
+		{
+			Name:        "operator",
+			ClusterIDs:  []string{"*"},
+			Domains:     []string{"*"},
+			AllowRevoke: true,
+		},
+	}
+
+	handler, err := New(config)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return handler, certSigner
+}
+
+// newTestRequest returns a request as the TLS server passes it on after
+// verifying the client certificate with the given common name. No client
+// certificate is given if the common name is empty.
+func newTestRequest(method, path, body, commonName string) *http.Request {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.TLS = &tls.ConnectionState{}
+	if commonName != "" {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+		r.TLS.PeerCertificates = []*x509.Certificate{cert}
+		r.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	}
+
+	return r
+}
+
+func Test_Server_Handle(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		client         string
+		expectedStatus int
+	}{
+		{
+			name:           "ca",
+			method:         http.MethodGet,
+			path:           "/v1/clusters/abc/ca",
+			client:         "ingress",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "issue",
+			method:         http.MethodPost,
+			path:           "/v1/clusters/abc/issue",
+			body:           `{"common_name": "api.example.com", "alt_names": ["www.example.com"]}`,
+			client:         "ingress",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "no client certificate",
+			method:         http.MethodGet,
+			path:           "/v1/clusters/abc/ca",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "unknown client",
+			method:         http.MethodGet,
+			path:           "/v1/clusters/abc/ca",
+			client:         "stranger",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "cluster not allowed",
+			method:         http.MethodGet,
+			path:           "/v1/clusters/def/ca",
+			client:         "ingress",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "domain not allowed",
+			method:         http.MethodPost,
+			path:           "/v1/clusters/abc/issue",
+			body:           `{"common_name": "api.example.org"}`,
+			client:         "ingress",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "revoke not allowed",
+			method:         http.MethodPost,
+			path:           "/v1/clusters/abc/revoke",
+			body:           `{"serial_number": "01:02"}`,
+			client:         "ingress",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "revoke",
+			method:         http.MethodPost,
+			path:           "/v1/clusters/abc/revoke",
+			body:           `{"serial_number": "01:02"}`,
+			client:         "operator",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unknown field",
+			method:         http.MethodPost,
+			path:           "/v1/clusters/abc/issue",
+			body:           `{"common_name": "api.example.com", "alt_name": "www.example.com"}`,
+			client:         "ingress",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "empty common name",
+			method:         http.MethodPost,
+			path:           "/v1/clusters/abc/issue",
+			body:           `{}`,
+			client:         "ingress",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "wrong method",
+			method:         http.MethodGet,
+			path:           "/v1/clusters/abc/issue",
+			client:         "ingress",
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:           "unknown action",
+			method:         http.MethodPost,
+			path:           "/v1/clusters/abc/renew",
+			client:         "ingress",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "empty cluster ID",
+			method:         http.MethodGet,
+			path:           "/v1/clusters//ca",
+			client:         "ingress",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "nested path",
+			method:         http.MethodGet,
+			path:           "/v1/clusters/abc/ca/extra",
+			client:         "ingress",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "unknown prefix",
+			method:         http.MethodGet,
+			path:           "/v2/clusters/abc/ca",
+			client:         "ingress",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler, _ := newTestServer(t)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, newTestRequest(tc.method, tc.path, tc.body, tc.client))
+
+			if w.Code != tc.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code == http.StatusOK {
+				return
+			}
+			var response ErrorResponse
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			if response.Error == "" {
+				t.Fatalf("expected error message, got none")
+			}
+		})
+	}
+}
+
+func Test_Server_Issue(t *testing.T) {
+	handler, certSigner := newTestServer(t)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newTestRequest(http.MethodPost, "/v1/clusters/abc/issue", `{"common_name": "api.example.com", "ttl": "24h"}`, "ingress"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	if len(certSigner.issued) != 1 {
+		t.Fatalf("expected 1 certificate issued, got %d", len(certSigner.issued))
+	}
+	issued := certSigner.issued[0]
+	if issued.ClusterID != "abc" || issued.CommonName != "api.example.com" || issued.TTL != "24h" {
+		t.Fatalf("expected certificate for api.example.com in cluster abc, got %#v", issued)
+	}
+
+	var response spec.IssueResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	if response.SerialNumber != "01:02" {
+		t.Fatalf("expected serial number 01:02, got %q", response.SerialNumber)
+	}
+}
+
+func Test_HTTPStatus(t *testing.T) {
+	testCases := []struct {
+		name           string
+		err            error
+		expectedStatus int
+	}{
+		{name: "invalid request", err: microerror.Mask(invalidRequestError), expectedStatus: http.StatusBadRequest},
+		{name: "unauthenticated", err: microerror.Mask(unauthenticatedError), expectedStatus: http.StatusUnauthorized},
+		{name: "not authorized", err: microerror.Mask(notAuthorizedError), expectedStatus: http.StatusForbidden},
+		{name: "not found", err: microerror.Mask(notFoundError), expectedStatus: http.StatusNotFound},
+		{name: "method not allowed", err: microerror.Mask(methodNotAllowedError), expectedStatus: http.StatusMethodNotAllowed},
+		{name: "canceled", err: fmt.Errorf("request failed: %w", context.Canceled), expectedStatus: http.StatusServiceUnavailable},
+		{name: "deadline exceeded", err: fmt.Errorf("request failed: %w", context.DeadlineExceeded), expectedStatus: http.StatusGatewayTimeout},
+		{name: "invalid config", err: microerror.Mask(&microerror.Error{Kind: "invalidConfigError"}), expectedStatus: http.StatusBadRequest},
+		{name: "invalid CSR", err: microerror.Mask(&microerror.Error{Kind: "invalidCSRError"}), expectedStatus: http.StatusBadRequest},
+		{name: "role violation", err: microerror.Mask(&microerror.Error{Kind: "domainNotAllowedError"}), expectedStatus: http.StatusForbidden},
+		{name: "CA not found", err: microerror.Mask(&microerror.Error{Kind: "caNotFoundError"}), expectedStatus: http.StatusNotFound},
+		{name: "conflict", err: microerror.Mask(&microerror.Error{Kind: "alreadyMountedError"}), expectedStatus: http.StatusConflict},
+		{name: "Vault unavailable", err: microerror.Mask(&microerror.Error{Kind: "noHealthyVaultError"}), expectedStatus: http.StatusServiceUnavailable},
+		{name: "Vault permission denied", err: &vaultclient.ResponseError{StatusCode: http.StatusForbidden}, expectedStatus: http.StatusBadGateway},
+		{name: "Vault bad request", err: &vaultclient.ResponseError{StatusCode: http.StatusBadRequest}, expectedStatus: http.StatusBadGateway},
+		{name: "unknown", err: fmt.Errorf("unknown"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			status := HTTPStatus(tc.err)
+			if status != tc.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tc.expectedStatus, status)
+			}
+		})
+	}
+}
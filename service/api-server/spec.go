@@ -0,0 +1,65 @@
+package apiserver
+
+import (
+	"net"
+)
+
+// Client holds the authorization rules of a client of the API. Patterns are
+// matched using path.Match, so that '*' matches any sequence of characters
+// except '/', e.g. '*.example.com' matches 'a.b.example.com'.
+type Client struct {
+	// Name identifies the client by the common name of its client
+	// certificate.
+	Name string `json:"name"`
+
+	// ClusterIDs are the patterns of the cluster IDs the client may request
+	// certificates and root CAs of.
+	ClusterIDs []string `json:"clusterIDs"`
+
+	// Domains are the patterns the common name and all DNS and email alt
+	// names of requested certificates must match.
+	Domains []string `json:"domains"`
+
+	// Organizations are the patterns all organizations of requested
+	// certificates must match. Certificates without organizations are always
+	// allowed.
+	Organizations []string `json:"organizations"`
+
+	// URISANs are the patterns all URI SANs of requested certificates must
+	// match, e.g. 'spiffe://example.com/ns/billing/*'.
+	URISANs []string `json:"uriSANs"`
+
+	// AllowIPSANs allows the client to request certificates with IP SANs.
+	AllowIPSANs bool `json:"allowIPSANs"`
+
+	// AllowRevoke allows the client to revoke any certificate of the clusters
+	// it may request certificates of.
+	AllowRevoke bool `json:"allowRevoke"`
+}
+
+// IssueRequest is the body of requests to issue a certificate key pair.
+type IssueRequest struct {
+	CommonName    string   `json:"common_name"`
+	AltNames      []string `json:"alt_names"`
+	IPSANs        []net.IP `json:"ip_sans"`
+	URISANs       []string `json:"uri_sans"`
+	Organizations []string `json:"organizations"`
+	TTL           string   `json:"ttl"`
+}
+
+// SignRequest is the body of requests to sign a certificate signing request.
+// The names requested are taken from the CSR.
+type SignRequest struct {
+	CSR string `json:"csr"`
+	TTL string `json:"ttl"`
+}
+
+// RevokeRequest is the body of requests to revoke a certificate.
+type RevokeRequest struct {
+	SerialNumber string `json:"serial_number"`
+}
+
+// ErrorResponse is the body of responses to failed requests.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
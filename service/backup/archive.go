@@ -0,0 +1,186 @@
+package backup
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+
+	"github.com/giantswarm/microerror"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	kdfScrypt = "scrypt"
+
+	// Parameters of the scrypt key derivation as recommended for interactive
+	// logins in 2017, see https://pkg.go.dev/golang.org/x/crypto/scrypt.
+	scryptN      = 32768
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltLen      = 16
+)
+
+// file is the on-disk representation of an archive.
+type file struct {
+	Header Header `json:"header"`
+
+	KDF        kdf    `json:"kdf"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type kdf struct {
+	Name string `json:"name"`
+	Salt []byte `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+// WriteArchive encrypts the given archive using the given passphrase and
+// writes it to w. The payload is encrypted with AES-256-GCM using a key
+// derived from the passphrase with scrypt. The header is stored in plain
+// text, but is authenticated.
+func WriteArchive(w io.Writer, archive Archive, passphrase []byte) error {
+	if len(passphrase) == 0 {
+		return microerror.Maskf(invalidConfigError, "passphrase must not be empty")
+	}
+
+	f := file{
+		Header: archive.Header,
+		KDF: kdf{
+			Name: kdfScrypt,
+			Salt: make([]byte, saltLen),
+			N:    scryptN,
+			R:    scryptR,
+			P:    scryptP,
+		},
+	}
+	f.Header.Version = ArchiveVersion
+
+	_, err := io.ReadFull(rand.Reader, f.KDF.Salt)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	aead, err := newAEAD(passphrase, f.KDF)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	f.Nonce = make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, f.Nonce)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	plaintext, err := json.Marshal(archive.Payload)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	additionalData, err := json.Marshal(f.Header)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	f.Ciphertext = aead.Seal(nil, f.Nonce, plaintext, additionalData)
+
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	err = e.Encode(f)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// ReadArchive reads an archive from r and decrypts it using the given
+// passphrase. In case the passphrase is wrong or the archive was tampered
+// with, an error asserted by IsDecryptionFailed is returned.
+func ReadArchive(r io.Reader, passphrase []byte) (Archive, error) {
+	f, err := readFile(r)
+	if err != nil {
+		return Archive{}, microerror.Mask(err)
+	}
+
+	aead, err := newAEAD(passphrase, f.KDF)
+	if err != nil {
+		return Archive{}, microerror.Mask(err)
+	}
+	if len(f.Nonce) != aead.NonceSize() {
+		return Archive{}, microerror.Maskf(invalidArchiveError, "nonce must be %d bytes", aead.NonceSize())
+	}
+
+	additionalData, err := json.Marshal(f.Header)
+	if err != nil {
+		return Archive{}, microerror.Mask(err)
+	}
+	plaintext, err := aead.Open(nil, f.Nonce, f.Ciphertext, additionalData)
+	if err != nil {
+		return Archive{}, microerror.Maskf(decryptionFailedError, "wrong passphrase or modified archive")
+	}
+
+	var payload Payload
+	err = json.Unmarshal(plaintext, &payload)
+	if err != nil {
+		return Archive{}, microerror.Maskf(invalidArchiveError, "%s", err)
+	}
+
+	archive := Archive{
+		Header:  f.Header,
+		Payload: payload,
+	}
+
+	return archive, nil
+}
+
+// ReadHeader reads only the header of an archive from r. It does not require
+// the passphrase, and consequently cannot verify the header's authenticity.
+func ReadHeader(r io.Reader) (Header, error) {
+	f, err := readFile(r)
+	if err != nil {
+		return Header{}, microerror.Mask(err)
+	}
+
+	return f.Header, nil
+}
+
+func readFile(r io.Reader) (file, error) {
+	var f file
+	err := json.NewDecoder(r).Decode(&f)
+	if err != nil {
+		return file{}, microerror.Maskf(invalidArchiveError, "%s", err)
+	}
+	if f.Header.Version != ArchiveVersion {
+		return file{}, microerror.Maskf(invalidArchiveError, "unsupported archive version %d", f.Header.Version)
+	}
+	if f.KDF.Name != kdfScrypt {
+		return file{}, microerror.Maskf(invalidArchiveError, "unsupported key derivation function '%s'", f.KDF.Name)
+	}
+
+	return f, nil
+}
+
+func newAEAD(passphrase []byte, k kdf) (cipher.AEAD, error) {
+	if len(passphrase) == 0 {
+		return nil, microerror.Maskf(invalidConfigError, "passphrase must not be empty")
+	}
+
+	key, err := scrypt.Key(passphrase, k.Salt, k.N, k.R, k.P, scryptKeyLen)
+	if err != nil {
+		return nil, microerror.Maskf(invalidArchiveError, "%s", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return aead, nil
+}
@@ -0,0 +1,183 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestArchive() Archive {
+	return Archive{
+		Header: Header{
+			ClusterID: "abc",
+			MountPath: "pki-abc",
+			CreatedAt: time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC),
+		},
+		Payload: Payload{
+			CA: CABundle{
+				Certificate: "certificate",
+				PrivateKey:  "private key",
+			},
+			Mount: MountTuning{
+				Description:     "PKI backend for cluster ID 'abc'",
+				DefaultLeaseTTL: 3600,
+				MaxLeaseTTL:     7200,
+			},
+			Roles: map[string]map[string]interface{}{
+				"role-abc": {"allowed_domains": "example.com"},
+			},
+			Policies: map[string]string{
+				"abc-pki": `path "pki-abc/issue/role-abc" { capabilities = ["update"] }`,
+			},
+		},
+	}
+}
+
+func writeTestArchive(t *testing.T, archive Archive, passphrase string) []byte {
+	var buf bytes.Buffer
+	err := WriteArchive(&buf, archive, []byte(passphrase))
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func Test_Archive_RoundTrip(t *testing.T) {
+	archive := newTestArchive()
+	data := writeTestArchive(t, archive, "secret")
+
+	read, err := ReadArchive(bytes.NewReader(data), []byte("secret"))
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	if read.Header.Version != ArchiveVersion {
+		t.Fatalf("expected version %d, got %d", ArchiveVersion, read.Header.Version)
+	}
+	if read.Header.ClusterID != archive.Header.ClusterID || read.Header.MountPath != archive.Header.MountPath || !read.Header.CreatedAt.Equal(archive.Header.CreatedAt) {
+		t.Fatalf("expected header %#v, got %#v", archive.Header, read.Header)
+	}
+	if !reflect.DeepEqual(read.Payload, archive.Payload) {
+		t.Fatalf("expected payload %#v, got %#v", archive.Payload, read.Payload)
+	}
+
+	// The header is readable without the passphrase.
+	header, err := ReadHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	if header.ClusterID != archive.Header.ClusterID {
+		t.Fatalf("expected cluster ID %q, got %q", archive.Header.ClusterID, header.ClusterID)
+	}
+
+	// The payload is not readable without the passphrase.
+	if bytes.Contains(data, []byte("private key")) {
+		t.Fatalf("expected payload to be encrypted, got %s", data)
+	}
+}
+
+func Test_Archive_Passphrase(t *testing.T) {
+	data := writeTestArchive(t, newTestArchive(), "secret")
+
+	_, err := ReadArchive(bytes.NewReader(data), []byte("wrong"))
+	if !IsDecryptionFailed(err) {
+		t.Fatalf("expected decryption failed error, got %#v", err)
+	}
+
+	_, err = ReadArchive(bytes.NewReader(data), nil)
+	if !IsInvalidConfig(err) {
+		t.Fatalf("expected invalid config error, got %#v", err)
+	}
+
+	var buf bytes.Buffer
+	err = WriteArchive(&buf, newTestArchive(), nil)
+	if !IsInvalidConfig(err) {
+		t.Fatalf("expected invalid config error, got %#v", err)
+	}
+}
+
+func Test_Archive_Tampered(t *testing.T) {
+	testCases := []struct {
+		name         string
+		tamper       func(f *file)
+		errorMatcher func(error) bool
+	}{
+		{
+			name:         "cluster ID",
+			tamper:       func(f *file) { f.Header.ClusterID = "def" },
+			errorMatcher: IsDecryptionFailed,
+		},
+		{
+			name:         "creation time",
+			tamper:       func(f *file) { f.Header.CreatedAt = f.Header.CreatedAt.Add(time.Hour) },
+			errorMatcher: IsDecryptionFailed,
+		},
+		{
+			name:         "ciphertext",
+			tamper:       func(f *file) { f.Ciphertext[0] ^= 1 },
+			errorMatcher: IsDecryptionFailed,
+		},
+		{
+			name:         "salt",
+			tamper:       func(f *file) { f.KDF.Salt[0] ^= 1 },
+			errorMatcher: IsDecryptionFailed,
+		},
+		{
+			name:         "nonce",
+			tamper:       func(f *file) { f.Nonce[0] ^= 1 },
+			errorMatcher: IsDecryptionFailed,
+		},
+		{
+			name:         "nonce length",
+			tamper:       func(f *file) { f.Nonce = f.Nonce[1:] },
+			errorMatcher: IsInvalidArchive,
+		},
+		{
+			name:         "version",
+			tamper:       func(f *file) { f.Header.Version = ArchiveVersion + 1 },
+			errorMatcher: IsInvalidArchive,
+		},
+		{
+			name:         "key derivation function",
+			tamper:       func(f *file) { f.KDF.Name = "pbkdf2" },
+			errorMatcher: IsInvalidArchive,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var f file
+			err := json.Unmarshal(writeTestArchive(t, newTestArchive(), "secret"), &f)
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			tc.tamper(&f)
+			data, err := json.Marshal(f)
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+
+			_, err = ReadArchive(bytes.NewReader(data), []byte("secret"))
+			if !tc.errorMatcher(err) {
+				t.Fatalf("expected error to match, got %#v", err)
+			}
+		})
+	}
+}
+
+func Test_Archive_Invalid(t *testing.T) {
+	data := writeTestArchive(t, newTestArchive(), "secret")
+
+	_, err := ReadArchive(bytes.NewReader(data[:len(data)/2]), []byte("secret"))
+	if !IsInvalidArchive(err) {
+		t.Fatalf("expected invalid archive error, got %#v", err)
+	}
+
+	_, err = ReadHeader(bytes.NewReader([]byte("foo")))
+	if !IsInvalidArchive(err) {
+		t.Fatalf("expected invalid archive error, got %#v", err)
+	}
+}
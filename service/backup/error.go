@@ -0,0 +1,50 @@
+package backup
+
+import (
+	"github.com/giantswarm/microerror"
+)
+
+var invalidConfigError = &microerror.Error{
+	Kind: "invalidConfigError",
+}
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return microerror.Cause(err) == invalidConfigError
+}
+
+var invalidArchiveError = &microerror.Error{
+	Kind: "invalidArchiveError",
+}
+
+// IsInvalidArchive asserts invalidArchiveError.
+func IsInvalidArchive(err error) bool {
+	return microerror.Cause(err) == invalidArchiveError
+}
+
+var decryptionFailedError = &microerror.Error{
+	Kind: "decryptionFailedError",
+}
+
+// IsDecryptionFailed asserts decryptionFailedError.
+func IsDecryptionFailed(err error) bool {
+	return microerror.Cause(err) == decryptionFailedError
+}
+
+var caMismatchError = &microerror.Error{
+	Kind: "caMismatchError",
+}
+
+// IsCAMismatch asserts caMismatchError.
+func IsCAMismatch(err error) bool {
+	return microerror.Cause(err) == caMismatchError
+}
+
+var alreadyMountedError = &microerror.Error{
+	Kind: "alreadyMountedError",
+}
+
+// IsAlreadyMounted asserts alreadyMountedError.
+func IsAlreadyMounted(err error) bool {
+	return microerror.Cause(err) == alreadyMountedError
+}
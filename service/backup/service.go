@@ -0,0 +1,342 @@
+package backup
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+	vaultclient "github.com/hashicorp/vault/api"
+
+	"github.com/giantswarm/certctl/v2/service/pki"
+	"github.com/giantswarm/certctl/v2/service/token"
+)
+
+const (
+	// rollbackTimeout is the time rolling back a failed restore may take.
+	rollbackTimeout = 30 * time.Second
+)
+
+// Config represents the configuration used to create a new backup service.
+type Config struct {
+	// Dependencies.
+	Logger       micrologger.Logger
+	PKIService   pki.Service
+	TokenService token.Service
+	VaultClient  *vaultclient.Client
+}
+
+// DefaultConfig provides a default configuration to create a backup service.
+func DefaultConfig() Config {
+	newClientConfig := vaultclient.DefaultConfig()
+	newClientConfig.Address = "http://127.0.0.1:8200"
+	newVaultClient, err := vaultclient.NewClient(newClientConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	newLogger, err := micrologger.New(micrologger.Config{IOWriter: os.Stderr})
+	if err != nil {
+		panic(err)
+	}
+
+	pkiConfig := pki.DefaultServiceConfig()
+	pkiConfig.VaultClient = newVaultClient
+	newPKIService, err := pki.NewService(pkiConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	tokenConfig := token.DefaultServiceConfig()
+	tokenConfig.VaultClient = newVaultClient
+	newTokenService, err := token.NewService(tokenConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	newConfig := Config{
+		// Dependencies.
+		Logger:       newLogger,
+		PKIService:   newPKIService,
+		TokenService: newTokenService,
+		VaultClient:  newVaultClient,
+	}
+
+	return newConfig
+}
+
+// New creates a new configured backup service.
+func New(config Config) (Service, error) {
+	// Dependencies.
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "logger must not be empty")
+	}
+	if config.PKIService == nil {
+		return nil, microerror.Maskf(invalidConfigError, "PKI service must not be empty")
+	}
+	if config.TokenService == nil {
+		return nil, microerror.Maskf(invalidConfigError, "token service must not be empty")
+	}
+	if config.VaultClient == nil {
+		return nil, microerror.Maskf(invalidConfigError, "Vault client must not be empty")
+	}
+
+	newService := &service{
+		Config: config,
+	}
+
+	return newService, nil
+}
+
+type service struct {
+	Config
+}
+
+func (s *service) Backup(config BackupConfig) (Archive, error) {
+	return s.BackupWithContext(context.Background(), config)
+}
+
+func (s *service) BackupWithContext(ctx context.Context, config BackupConfig) (Archive, error) {
+	if config.ClusterID == "" {
+		return Archive{}, microerror.Maskf(invalidConfigError, "cluster ID must not be empty")
+	}
+	if config.CAPrivateKey == "" {
+		return Archive{}, microerror.Maskf(invalidConfigError, "CA private key must not be empty")
+	}
+
+	mount, err := s.PKIService.MountWithContext(ctx, config.ClusterID)
+	if err != nil {
+		return Archive{}, microerror.Mask(err)
+	}
+
+	// Vault does not return the private key of a root CA, so the given one is
+	// verified to belong to the current root CA. Otherwise the archive would
+	// silently restore a different root CA.
+	ca, err := s.PKIService.CAWithContext(ctx, config.ClusterID)
+	if err != nil {
+		return Archive{}, microerror.Mask(err)
+	}
+	_, err = tls.X509KeyPair([]byte(ca.Certificate), []byte(config.CAPrivateKey))
+	if err != nil {
+		return Archive{}, microerror.Maskf(caMismatchError, "CA private key does not match root CA of cluster ID '%s'", config.ClusterID)
+	}
+
+	// Capture all roles, not only the ones created by setup.
+	roles := map[string]map[string]interface{}{}
+	{
+		names, err := s.PKIService.ListRolesWithContext(ctx, config.ClusterID)
+		if err != nil {
+			return Archive{}, microerror.Mask(err)
+		}
+
+		logicalBackend := s.VaultClient.Logical()
+		for _, name := range names {
+			secret, err := logicalBackend.ReadWithContext(ctx, rolePath(mount.Path, name))
+			if err != nil {
+				return Archive{}, microerror.Mask(err)
+			}
+			if secret == nil {
+				continue
+			}
+			roles[name] = secret.Data
+		}
+	}
+
+	policies := map[string]string{}
+	{
+		rules, err := s.TokenService.PolicyWithContext(ctx, config.ClusterID)
+		if err != nil {
+			return Archive{}, microerror.Mask(err)
+		}
+		if rules != "" {
+			policies[s.TokenService.PolicyName(config.ClusterID)] = rules
+		}
+
+		rules, err = s.TokenService.OrgPolicyWithContext(ctx, config.ClusterID)
+		if err != nil {
+			return Archive{}, microerror.Mask(err)
+		}
+		if rules != "" {
+			policies[s.TokenService.OrgPolicyName(config.ClusterID)] = rules
+		}
+	}
+
+	newArchive := Archive{
+		Header: Header{
+			Version:   ArchiveVersion,
+			ClusterID: config.ClusterID,
+			MountPath: mount.Path,
+			CreatedAt: time.Now().UTC(),
+		},
+		Payload: Payload{
+			CA: CABundle{
+				Certificate: ca.Certificate,
+				PrivateKey:  config.CAPrivateKey,
+			},
+			Mount: MountTuning{
+				Description:     mount.Description,
+				DefaultLeaseTTL: mount.DefaultLeaseTTL,
+				MaxLeaseTTL:     mount.MaxLeaseTTL,
+			},
+			Roles:    roles,
+			Policies: policies,
+		},
+	}
+
+	s.Logger.LogCtx(ctx, "level", "debug", "message", "backed up PKI backend", "cluster_id", config.ClusterID, "roles", len(roles), "policies", len(policies))
+
+	return newArchive, nil
+}
+
+func (s *service) Restore(archive Archive) error {
+	return s.RestoreWithContext(context.Background(), archive)
+}
+
+func (s *service) RestoreWithContext(ctx context.Context, archive Archive) error {
+	clusterID := archive.Header.ClusterID
+	if clusterID == "" {
+		return microerror.Maskf(invalidArchiveError, "cluster ID must not be empty")
+	}
+	if archive.Payload.CA.Certificate == "" || archive.Payload.CA.PrivateKey == "" {
+		return microerror.Maskf(invalidArchiveError, "root CA must not be empty")
+	}
+
+	// Restoring on top of an existing PKI backend would mix two root CAs, so
+	// the PKI backend has to be cleaned up first.
+	mounted, err := s.PKIService.IsMountedWithContext(ctx, clusterID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if mounted {
+		return microerror.Maskf(alreadyMountedError, "PKI backend for cluster ID '%s' is already mounted", clusterID)
+	}
+
+	// The PKI backend is mounted according to the current mount path scheme,
+	// which may differ from the one used when the backup was taken.
+	mountPath := s.PKIService.MountPKIPath(clusterID)
+
+	sysBackend := s.VaultClient.Sys()
+	{
+		newMountConfig := &vaultclient.MountInput{
+			Type:        "pki",
+			Description: archive.Payload.Mount.Description,
+			Config: vaultclient.MountConfigInput{
+				DefaultLeaseTTL: formatTTL(archive.Payload.Mount.DefaultLeaseTTL),
+				MaxLeaseTTL:     formatTTL(archive.Payload.Mount.MaxLeaseTTL),
+			},
+		}
+		err = sysBackend.MountWithContext(ctx, mountPath, newMountConfig)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	// A PKI backend restored halfway would be refused by the next attempt as
+	// already mounted, so everything restored so far is removed again in case
+	// of failure.
+	previousPolicies := map[string]string{}
+	err = s.restore(ctx, archive, mountPath, previousPolicies)
+	if err != nil {
+		s.rollback(ctx, clusterID, mountPath, previousPolicies)
+		return microerror.Mask(err)
+	}
+
+	s.Logger.LogCtx(ctx, "level", "debug", "message", "restored PKI backend", "cluster_id", clusterID)
+
+	return nil
+}
+
+// restore writes the root CA, the roles and the policies of the given archive
+// to the PKI backend mounted under mountPath. The previous rules of the
+// policies written are recorded in previousPolicies, empty for policies which
+// did not exist.
+func (s *service) restore(ctx context.Context, archive Archive, mountPath string, previousPolicies map[string]string) error {
+	logicalBackend := s.VaultClient.Logical()
+	{
+		data := map[string]interface{}{
+			"pem_bundle": strings.TrimSpace(archive.Payload.CA.PrivateKey) + "\n" + strings.TrimSpace(archive.Payload.CA.Certificate) + "\n",
+		}
+		_, err := logicalBackend.WriteWithContext(ctx, fmt.Sprintf("%s/config/ca", mountPath), data)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	for name, data := range archive.Payload.Roles {
+		_, err := logicalBackend.WriteWithContext(ctx, rolePath(mountPath, name), data)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	// Policies grant access to paths below the mount path, so they are moved
+	// along with the PKI backend in case the mount path changed.
+	sysBackend := s.VaultClient.Sys()
+	for name, rules := range archive.Payload.Policies {
+		if archive.Header.MountPath != "" && archive.Header.MountPath != mountPath {
+			rules = strings.Replace(rules, archive.Header.MountPath+"/", mountPath+"/", -1)
+		}
+
+		previous, err := sysBackend.GetPolicyWithContext(ctx, name)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+		previousPolicies[name] = previous
+
+		err = sysBackend.PutPolicyWithContext(ctx, name, rules)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	return nil
+}
+
+// rollback unmounts the PKI backend mounted under mountPath and resets the
+// given policies to their previous rules, deleting the ones which did not
+// exist. It is best effort, failures are only logged. The given context may
+// already be done, e.g. in case restoring timed out, so rolling back gets its
+// own deadline.
+func (s *service) rollback(ctx context.Context, clusterID, mountPath string, previousPolicies map[string]string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	sysBackend := s.VaultClient.Sys()
+	for name, rules := range previousPolicies {
+		var err error
+		if rules == "" {
+			err = sysBackend.DeletePolicyWithContext(ctx, name)
+		} else {
+			err = sysBackend.PutPolicyWithContext(ctx, name, rules)
+		}
+		if err != nil {
+			s.Logger.LogCtx(ctx, "level", "warning", "message", "failed to roll back policy", "cluster_id", clusterID, "policy", name, "error", microerror.Pretty(err, false))
+		}
+	}
+
+	err := sysBackend.UnmountWithContext(ctx, mountPath)
+	if err != nil {
+		s.Logger.LogCtx(ctx, "level", "warning", "message", "failed to roll back PKI backend", "cluster_id", clusterID, "error", microerror.Pretty(err, false))
+		return
+	}
+
+	s.Logger.LogCtx(ctx, "level", "debug", "message", "rolled back PKI backend", "cluster_id", clusterID)
+}
+
+// formatTTL formats the given number of seconds as TTL understood by Vault.
+// Zero results in an empty string, so that the system default applies.
+func formatTTL(seconds int) string {
+	if seconds == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%ds", seconds)
+}
+
+func rolePath(mountPath, name string) string {
+	return fmt.Sprintf("%s/roles/%s", mountPath, name)
+}
@@ -0,0 +1,199 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	vaultclient "github.com/hashicorp/vault/api"
+
+	"github.com/giantswarm/certctl/v2/service/pki"
+)
+
+type testPKIService struct {
+	pki.Service
+}
+
+func (s *testPKIService) IsMountedWithContext(ctx context.Context, clusterID string) (bool, error) {
+	return false, nil
+}
+
+func (s *testPKIService) MountPKIPath(clusterID string) string {
+	return "pki-" + clusterID
+}
+
+// testVault records the requests made to it and fails the ones whose method
+// and path are listed in fail. Policies are kept, so that their rules can be
+// checked.
+type testVault struct {
+	mutex    sync.Mutex
+	requests []string
+	fail     map[string]bool
+	policies map[string]string
+}
+
+func (v *testVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	request := r.Method + " " + r.URL.Path
+	v.requests = append(v.requests, request)
+
+	w.Header().Set("Content-Type", "application/json")
+	if v.fail[request] {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"errors": ["internal error"]}`))
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/v1/sys/policies/acl/") {
+		name := strings.TrimPrefix(r.URL.Path, "/v1/sys/policies/acl/")
+		switch r.Method {
+		case http.MethodGet:
+			rules, ok := v.policies[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"policy": rules}})
+			return
+		case http.MethodPut:
+			var body struct {
+				Policy string `json:"policy"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			v.policies[name] = body.Policy
+		case http.MethodDelete:
+			delete(v.policies, name)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (v *testVault) requested(request string) bool {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	for _, r := range v.requests {
+		if r == request {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newTestService(t *testing.T, vault *testVault) Service {
+	s := httptest.NewServer(vault)
+	t.Cleanup(s.Close)
+
+	clientConfig := vaultclient.DefaultConfig()
+	clientConfig.Address = s.URL
+	vaultClient, err := vaultclient.NewClient(clientConfig)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	vaultClient.SetMaxRetries(0)
+	vaultClient.SetToken("token")
+
+	config := DefaultConfig()
+	config.Logger = microloggertest.New()
+	config.PKIService = &testPKIService{}
+	config.VaultClient = vaultClient
+	service, err := New(config)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return service
+}
+
+func Test_Service_Restore(t *testing.T) {
+	testCases := []struct {
+		name             string
+		fail             string
+		policies         map[string]string
+		expectedErr      bool
+		expectedPolicies map[string]string
+	}{
+		{
+			name:             "restored",
+			policies:         map[string]string{"existing": "old"},
+			expectedPolicies: map[string]string{"existing": "new", "abc-pki": "new"},
+		},
+		{
+			name:             "writing root CA fails",
+			fail:             "PUT /v1/pki-abc/config/ca",
+			policies:         map[string]string{"existing": "old"},
+			expectedErr:      true,
+			expectedPolicies: map[string]string{"existing": "old"},
+		},
+		{
+			name:             "writing role fails",
+			fail:             "PUT /v1/pki-abc/roles/role-abc",
+			policies:         map[string]string{"existing": "old"},
+			expectedErr:      true,
+			expectedPolicies: map[string]string{"existing": "old"},
+		},
+		{
+			name:             "writing existing policy fails",
+			fail:             "PUT /v1/sys/policies/acl/existing",
+			policies:         map[string]string{"existing": "old"},
+			expectedErr:      true,
+			expectedPolicies: map[string]string{"existing": "old"},
+		},
+		{
+			name:             "writing new policy fails",
+			fail:             "PUT /v1/sys/policies/acl/abc-pki",
+			policies:         map[string]string{"existing": "old"},
+			expectedErr:      true,
+			expectedPolicies: map[string]string{"existing": "old"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			vault := &testVault{
+				fail:     map[string]bool{tc.fail: true},
+				policies: tc.policies,
+			}
+			s := newTestService(t, vault)
+
+			archive := newTestArchive()
+			archive.Payload.Policies = map[string]string{
+				"abc-pki":  "new",
+				"existing": "new",
+			}
+
+			err := s.RestoreWithContext(context.Background(), archive)
+			if tc.expectedErr && err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+			if !tc.expectedErr && err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+
+			if !vault.requested("POST /v1/sys/mounts/pki-abc") {
+				t.Fatalf("expected PKI backend to be mounted, got %v", vault.requests)
+			}
+			unmounted := vault.requested("DELETE /v1/sys/mounts/pki-abc")
+			if unmounted != tc.expectedErr {
+				t.Fatalf("expected PKI backend unmounted to be %t, got %v", tc.expectedErr, vault.requests)
+			}
+			if len(vault.policies) != len(tc.expectedPolicies) {
+				t.Fatalf("expected policies %v, got %v", tc.expectedPolicies, vault.policies)
+			}
+			for name, rules := range tc.expectedPolicies {
+				if vault.policies[name] != rules {
+					t.Fatalf("expected policies %v, got %v", tc.expectedPolicies, vault.policies)
+				}
+			}
+		})
+	}
+}
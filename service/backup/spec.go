@@ -0,0 +1,100 @@
+package backup
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// ArchiveVersion is the version of the archive format written by this
+	// package.
+	ArchiveVersion = 1
+)
+
+// Header describes an archive. It is stored unencrypted, so that e.g. the age
+// of a backup can be checked without knowing the passphrase. It is still
+// authenticated as part of the encryption, so that it cannot be changed
+// without the passphrase.
+type Header struct {
+	// Version is the version of the archive format.
+	Version int `json:"version"`
+
+	// ClusterID is the cluster ID the backed up PKI backend belongs to.
+	ClusterID string `json:"cluster_id"`
+
+	// MountPath is the path the backed up PKI backend was mounted under.
+	MountPath string `json:"mount_path"`
+
+	// CreatedAt is the time the backup was taken.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CABundle is the root CA of a PKI backend including its private key.
+type CABundle struct {
+	// Certificate is the PEM encoded root CA certificate.
+	Certificate string `json:"certificate"`
+
+	// PrivateKey is the PEM encoded private key of the root CA.
+	PrivateKey string `json:"private_key"`
+}
+
+// MountTuning holds the settings of a PKI backend mount.
+type MountTuning struct {
+	Description     string `json:"description"`
+	DefaultLeaseTTL int    `json:"default_lease_ttl"`
+	MaxLeaseTTL     int    `json:"max_lease_ttl"`
+}
+
+// Payload is the encrypted content of an archive.
+type Payload struct {
+	// CA is the root CA of the PKI backend.
+	CA CABundle `json:"ca"`
+
+	// Mount holds the settings of the PKI backend mount.
+	Mount MountTuning `json:"mount"`
+
+	// Roles maps role names to the role definitions as read from Vault.
+	Roles map[string]map[string]interface{} `json:"roles"`
+
+	// Policies maps policy names to their HCL rules.
+	Policies map[string]string `json:"policies"`
+}
+
+// Archive is the full backup of a cluster's PKI backend.
+type Archive struct {
+	Header  Header
+	Payload Payload
+}
+
+// BackupConfig is used to configure the backup of a PKI backend.
+type BackupConfig struct {
+	// ClusterID is the cluster ID of the PKI backend to back up.
+	ClusterID string
+
+	// CAPrivateKey is the PEM encoded private key of the cluster's root CA.
+	// Vault never returns the private key once the root CA is generated, so
+	// it has to be provided from a previous archive, e.g. the one written on
+	// setup using an exported root CA.
+	CAPrivateKey string
+}
+
+// Service backs up and restores the PKI backends of clusters.
+type Service interface {
+	// Backup captures the root CA, the roles, the policies and the mount
+	// settings of the PKI backend associated with the given cluster ID.
+	Backup(config BackupConfig) (Archive, error)
+
+	// BackupWithContext is the context aware variant of Backup.
+	BackupWithContext(ctx context.Context, config BackupConfig) (Archive, error)
+
+	// Restore recreates the PKI backend captured in the given archive,
+	// including the identical root CA. In case a PKI backend is already
+	// mounted for the archive's cluster ID, an error asserted by
+	// IsAlreadyMounted is returned. In case restoring fails after mounting
+	// the PKI backend, it is unmounted again and the restored policies are
+	// reset.
+	Restore(archive Archive) error
+
+	// RestoreWithContext is the context aware variant of Restore.
+	RestoreWithContext(ctx context.Context, archive Archive) error
+}
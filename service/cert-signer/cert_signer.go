@@ -1,21 +1,34 @@
 package certsigner
 
 import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
+	"net"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/giantswarm/microerror"
-	vaultrolekey "github.com/giantswarm/vaultrole/key"
+	"github.com/giantswarm/micrologger"
 	vaultclient "github.com/hashicorp/vault/api"
 
+	"github.com/giantswarm/certctl/v2/service/metrics"
+	mountpath "github.com/giantswarm/certctl/v2/service/mount-path"
+	"github.com/giantswarm/certctl/v2/service/retry"
 	"github.com/giantswarm/certctl/v2/service/role"
 	"github.com/giantswarm/certctl/v2/service/spec"
+	"github.com/giantswarm/certctl/v2/service/wrapping"
 )
 
 // Config represents the configuration used to create a new certificate signer.
 type Config struct {
 	// Dependencies.
-	VaultClient *vaultclient.Client
+	Logger          micrologger.Logger
+	MountPathScheme mountpath.Scheme
+	RetryPolicy     retry.Policy
+	VaultClient     *vaultclient.Client
 }
 
 // DefaultConfig provides a default configuration to create a certificate
@@ -28,9 +41,27 @@ func DefaultConfig() Config {
 		panic(err)
 	}
 
+	newLogger, err := micrologger.New(micrologger.Config{IOWriter: os.Stderr})
+	if err != nil {
+		panic(err)
+	}
+
+	newMountPathScheme, err := mountpath.New(mountpath.DefaultConfig())
+	if err != nil {
+		panic(err)
+	}
+
+	newRetryPolicy, err := retry.New(retry.DefaultConfig())
+	if err != nil {
+		panic(err)
+	}
+
 	newConfig := Config{
 		// Dependencies.
-		VaultClient: newVaultClient,
+		Logger:          newLogger,
+		MountPathScheme: newMountPathScheme,
+		RetryPolicy:     newRetryPolicy,
+		VaultClient:     newVaultClient,
 	}
 
 	return newConfig
@@ -43,6 +74,15 @@ func New(config Config) (spec.CertSigner, error) {
 	}
 
 	// Dependencies.
+	if newCertSigner.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "logger must not be empty")
+	}
+	if newCertSigner.MountPathScheme == nil {
+		return nil, microerror.Maskf(invalidConfigError, "mount path scheme must not be empty")
+	}
+	if newCertSigner.RetryPolicy == nil {
+		return nil, microerror.Maskf(invalidConfigError, "retry policy must not be empty")
+	}
 	if newCertSigner.VaultClient == nil {
 		return nil, microerror.Maskf(invalidConfigError, "Vault client must not be empty")
 	}
@@ -55,63 +95,101 @@ type certSigner struct {
 }
 
 func (cs *certSigner) Issue(config spec.IssueConfig) (spec.IssueResponse, error) {
-	var roleService role.Service
-	var err error
-	{
-		roleServiceConfig := role.DefaultConfig()
-		roleServiceConfig.VaultClient = cs.VaultClient
-		roleServiceConfig.PKIMountpoint = fmt.Sprintf("pki-%s", config.ClusterID)
-		roleService, err = role.New(roleServiceConfig)
-		if err != nil {
-			return spec.IssueResponse{}, microerror.Mask(err)
-		}
-	}
+	return cs.IssueWithContext(context.Background(), config)
+}
 
-	var organizations []string
-	if config.Organizations != "" {
-		organizations = strings.Split(config.Organizations, ",")
+func (cs *certSigner) IssueWithContext(ctx context.Context, config spec.IssueConfig) (spec.IssueResponse, error) {
+	metrics.IssueAttempts.WithLabelValues(config.ClusterID).Inc()
+
+	newIssueResponse, err := cs.issue(ctx, config)
+	if err != nil {
+		metrics.IssueFailures.WithLabelValues(config.ClusterID, errorKind(err)).Inc()
+		return spec.IssueResponse{}, microerror.Mask(err)
 	}
 
-	// Ensure a role exists exists that can issue a cert with the desired Organizations
-	// before trying to issue a cert.
-	// Sort organizations alphabetically
-	isRoleCreated, err := roleService.IsRoleCreated(vaultrolekey.RoleName(config.ClusterID, organizations))
+	cs.Logger.LogCtx(ctx, "level", "debug", "message", "issued certificate", "cluster_id", config.ClusterID, "common_name", config.CommonName, "serial_number", newIssueResponse.SerialNumber)
+
+	return newIssueResponse, nil
+}
+
+func (cs *certSigner) issue(ctx context.Context, config spec.IssueConfig) (spec.IssueResponse, error) {
+	err := mountpath.ValidateClusterID(config.ClusterID)
 	if err != nil {
 		return spec.IssueResponse{}, microerror.Mask(err)
 	}
 
-	if !isRoleCreated {
-		createRoleParams := role.CreateParams{
-			AllowBareDomains: config.AllowBareDomains,
-			AllowedDomains:   config.AllowedDomains,
-			AllowSubdomains:  true,
-			TTL:              config.RoleTTL,
-			Name:             vaultrolekey.RoleName(config.ClusterID, strings.Split(config.Organizations, ",")),
-			Organizations:    config.Organizations,
-		}
+	// Wrapped certificates are not visible here, so their URI SANs could not
+	// be verified.
+	if config.WrapTTL != "" && len(config.URISANs) != 0 {
+		return spec.IssueResponse{}, microerror.Maskf(notSupportedError, "URI SANs are not supported with response wrapping")
+	}
 
-		err = roleService.Create(createRoleParams)
-		if err != nil {
-			return spec.IssueResponse{}, microerror.Mask(err)
-		}
+	err = validateURISANs(config.URISANs)
+	if err != nil {
+		return spec.IssueResponse{}, microerror.Mask(err)
 	}
 
-	// Create a client for issuing a new signed certificate.
-	logicalStore := cs.VaultClient.Logical()
+	roleName, err := cs.ensureValidRole(ctx, config)
+	if err != nil {
+		return spec.IssueResponse{}, microerror.Mask(err)
+	}
+
+	// Create a client for issuing a new signed certificate. In case response
+	// wrapping is requested, only the issue request is wrapped.
+	newVaultClient, err := wrapping.NewClient(cs.VaultClient, config.WrapTTL)
+	if err != nil {
+		return spec.IssueResponse{}, microerror.Mask(err)
+	}
+	logicalStore := newVaultClient.Logical()
 
 	// Generate a certificate for the PKI backend signed by the certificate
 	// authority associated with the configured cluster ID.
 	data := map[string]interface{}{
 		"ttl":         config.TTL,
 		"common_name": config.CommonName,
-		"ip_sans":     config.IPSANs,
-		"alt_names":   config.AltNames,
+		"ip_sans":     joinIPs(config.IPSANs),
+		"alt_names":   strings.Join(config.AltNames, ","),
+	}
+	if len(config.URISANs) != 0 {
+		data["uri_sans"] = strings.Join(config.URISANs, ",")
 	}
+	if len(config.OtherSANs) != 0 {
+		data["other_sans"] = strings.Join(config.OtherSANs, ",")
+	}
+
+	// Issuing is not idempotent, so it is only retried in case the request
+	// never reached Vault. An attempt whose response failed may have issued a
+	// certificate nobody receives.
+	var secret *vaultclient.Secret
+	o := func() error {
+		secret, err = logicalStore.WriteWithContext(ctx, cs.issuePath(config.ClusterID, roleName), data)
+		if err != nil {
+			return microerror.Mask(err)
+		}
 
-	secret, err := logicalStore.Write(cs.SignedPath(config.ClusterID, organizations), data)
+		return nil
+	}
+	err = cs.RetryPolicy.DoNonIdempotent(ctx, o)
 	if err != nil {
 		return spec.IssueResponse{}, microerror.Mask(err)
 	}
+	if secret == nil {
+		return spec.IssueResponse{}, microerror.Maskf(keyPairNotFoundError, "response missing")
+	}
+
+	// In case the response is wrapped, the certificate data is not accessible
+	// here.
+	if config.WrapTTL != "" {
+		if secret.WrapInfo == nil {
+			return spec.IssueResponse{}, microerror.Maskf(keyPairNotFoundError, "wrapping token missing")
+		}
+
+		newIssueResponse := spec.IssueResponse{
+			WrappingToken: secret.WrapInfo.Token,
+		}
+
+		return newIssueResponse, nil
+	}
 
 	// Collect the certificate data from the secret response.
 	vCrt, ok := secret.Data["certificate"]
@@ -135,6 +213,14 @@ func (cs *certSigner) Issue(config spec.IssueConfig) (spec.IssueResponse, error)
 	}
 	serial := vSerial.(string)
 
+	// Vault silently drops URI SANs in some setups, e.g. older versions
+	// ignoring uri_sans. Workloads relying on their identity must not get a
+	// certificate without it, so the issued certificate is checked.
+	err = verifyURISANs(crt, config.URISANs)
+	if err != nil {
+		return spec.IssueResponse{}, microerror.Mask(err)
+	}
+
 	newIssueResponse := spec.IssueResponse{
 		Certificate:  crt,
 		PrivateKey:   key,
@@ -145,6 +231,352 @@ func (cs *certSigner) Issue(config spec.IssueConfig) (spec.IssueResponse, error)
 	return newIssueResponse, nil
 }
 
+func (cs *certSigner) Sign(config spec.SignConfig) (spec.SignResponse, error) {
+	return cs.SignWithContext(context.Background(), config)
+}
+
+func (cs *certSigner) SignWithContext(ctx context.Context, config spec.SignConfig) (spec.SignResponse, error) {
+	metrics.IssueAttempts.WithLabelValues(config.ClusterID).Inc()
+
+	newSignResponse, err := cs.sign(ctx, config)
+	if err != nil {
+		metrics.IssueFailures.WithLabelValues(config.ClusterID, errorKind(err)).Inc()
+		return spec.SignResponse{}, microerror.Mask(err)
+	}
+
+	cs.Logger.LogCtx(ctx, "level", "debug", "message", "signed certificate", "cluster_id", config.ClusterID, "serial_number", newSignResponse.SerialNumber)
+
+	return newSignResponse, nil
+}
+
+func (cs *certSigner) sign(ctx context.Context, config spec.SignConfig) (spec.SignResponse, error) {
+	err := mountpath.ValidateClusterID(config.ClusterID)
+	if err != nil {
+		return spec.SignResponse{}, microerror.Mask(err)
+	}
+
+	csr, err := parseCSR(config.CSR)
+	if err != nil {
+		return spec.SignResponse{}, microerror.Mask(err)
+	}
+
+	// The request is described by the CSR, so that the role is selected and
+	// the request validated the same way as for issuing.
+	newIssueConfig := issueConfigFromCSR(config, csr)
+	commonName := newIssueConfig.CommonName
+
+	err = validateURISANs(newIssueConfig.URISANs)
+	if err != nil {
+		return spec.SignResponse{}, microerror.Mask(err)
+	}
+
+	roleName, err := cs.ensureValidRole(ctx, newIssueConfig)
+	if err != nil {
+		return spec.SignResponse{}, microerror.Mask(err)
+	}
+
+	// Roles use the SANs of the CSR by default, so only the common name has
+	// to be given explicitly.
+	data := map[string]interface{}{
+		"csr":         config.CSR,
+		"common_name": commonName,
+		"ttl":         config.TTL,
+	}
+
+	// Signing is retried the same as issuing.
+	var secret *vaultclient.Secret
+	o := func() error {
+		secret, err = cs.VaultClient.Logical().WriteWithContext(ctx, cs.signPath(config.ClusterID, roleName), data)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		return nil
+	}
+	err = cs.RetryPolicy.DoNonIdempotent(ctx, o)
+	if err != nil {
+		return spec.SignResponse{}, microerror.Mask(err)
+	}
+	if secret == nil {
+		return spec.SignResponse{}, microerror.Maskf(keyPairNotFoundError, "response missing")
+	}
+
+	crt, ok := secret.Data["certificate"].(string)
+	if !ok {
+		return spec.SignResponse{}, microerror.Maskf(keyPairNotFoundError, "public key missing")
+	}
+	ca, ok := secret.Data["issuing_ca"].(string)
+	if !ok {
+		return spec.SignResponse{}, microerror.Maskf(keyPairNotFoundError, "root CA missing")
+	}
+	serial, ok := secret.Data["serial_number"].(string)
+	if !ok {
+		return spec.SignResponse{}, microerror.Maskf(keyPairNotFoundError, "serial number missing")
+	}
+
+	err = verifyURISANs(crt, newIssueConfig.URISANs)
+	if err != nil {
+		return spec.SignResponse{}, microerror.Mask(err)
+	}
+
+	newSignResponse := spec.SignResponse{
+		Certificate:  crt,
+		IssuingCA:    ca,
+		SerialNumber: serial,
+	}
+
+	return newSignResponse, nil
+}
+
+func (cs *certSigner) Revoke(config spec.RevokeConfig) (spec.RevokeResponse, error) {
+	return cs.RevokeWithContext(context.Background(), config)
+}
+
+func (cs *certSigner) RevokeWithContext(ctx context.Context, config spec.RevokeConfig) (spec.RevokeResponse, error) {
+	// Revoking an already revoked certificate succeeds, so revoking is
+	// retried as a whole.
+	var newRevokeResponse spec.RevokeResponse
+	o := func() error {
+		var err error
+		newRevokeResponse, err = cs.revoke(ctx, config)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		return nil
+	}
+	err := cs.RetryPolicy.Do(ctx, o)
+	if err != nil {
+		return spec.RevokeResponse{}, microerror.Mask(err)
+	}
+
+	cs.Logger.LogCtx(ctx, "level", "debug", "message", "revoked certificate", "cluster_id", config.ClusterID, "serial_number", config.SerialNumber)
+
+	return newRevokeResponse, nil
+}
+
+func (cs *certSigner) revoke(ctx context.Context, config spec.RevokeConfig) (spec.RevokeResponse, error) {
+	err := mountpath.ValidateClusterID(config.ClusterID)
+	if err != nil {
+		return spec.RevokeResponse{}, microerror.Mask(err)
+	}
+	if config.SerialNumber == "" {
+		return spec.RevokeResponse{}, microerror.Maskf(invalidConfigError, "serial number must not be empty")
+	}
+
+	logicalStore := cs.VaultClient.Logical()
+
+	data := map[string]interface{}{
+		"serial_number": strings.ToLower(config.SerialNumber),
+	}
+
+	secret, err := logicalStore.WriteWithContext(ctx, cs.RevokePath(config.ClusterID), data)
+	if isVaultCertificateNotFound(err) {
+		return spec.RevokeResponse{}, microerror.Maskf(certificateNotFoundError, "certificate with serial number '%s' not issued for cluster ID '%s'", config.SerialNumber, config.ClusterID)
+	} else if err != nil {
+		return spec.RevokeResponse{}, microerror.Mask(err)
+	}
+
+	var newRevokeResponse spec.RevokeResponse
+	if secret != nil {
+		if v, ok := secret.Data["revocation_time"].(json.Number); ok {
+			seconds, err := v.Int64()
+			if err != nil {
+				return spec.RevokeResponse{}, microerror.Mask(err)
+			}
+			newRevokeResponse.RevocationTime = time.Unix(seconds, 0).UTC()
+		}
+	}
+
+	return newRevokeResponse, nil
+}
+
+// ensureValidRole ensures the role for the given configuration exists and
+// validates the configuration against it, returning the name of the role.
+// Both only read the role and the mount settings, or create a missing role
+// with the same parameters, so they are retried as a whole.
+func (cs *certSigner) ensureValidRole(ctx context.Context, config spec.IssueConfig) (string, error) {
+	var roleName string
+	o := func() error {
+		roleService, name, err := cs.ensureRole(ctx, config)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		err = cs.validate(ctx, roleService, name, config)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		roleName = name
+
+		return nil
+	}
+	err := cs.RetryPolicy.Do(ctx, o)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return roleName, nil
+}
+
+// ensureRole returns the role service of the cluster's PKI backend and the
+// name of the role able to issue certificates with the organizations of the
+// given configuration. The role is created in case it does not exist yet.
+func (cs *certSigner) ensureRole(ctx context.Context, config spec.IssueConfig) (role.Service, string, error) {
+	var err error
+	var roleService role.Service
+	{
+		roleServiceConfig := role.DefaultConfig()
+		roleServiceConfig.Logger = cs.Logger
+		roleServiceConfig.VaultClient = cs.VaultClient
+		roleServiceConfig.PKIMountpoint = cs.MountPathScheme.MountPath(config.ClusterID)
+		roleService, err = role.New(roleServiceConfig)
+		if err != nil {
+			return nil, "", microerror.Mask(err)
+		}
+	}
+
+	// Ensure a role exists that can issue a cert with the desired
+	// organizations before trying to issue a cert. Organizations are
+	// normalized, so that the same role is used regardless of their order.
+	organizations := role.NormalizeOrganizations(config.Organizations)
+	roleName := role.Name(config.ClusterID, organizations)
+	isRoleCreated, err := roleService.IsRoleCreatedWithContext(ctx, roleName)
+	if err != nil {
+		return nil, "", microerror.Mask(err)
+	}
+
+	// Older versions did not normalize organizations and may have created the
+	// role under a different name. It is used as long as it exists.
+	if !isRoleCreated {
+		legacyName := role.LegacyName(config.ClusterID, config.Organizations)
+		if legacyName != roleName {
+			isRoleCreated, err = roleService.IsRoleCreatedWithContext(ctx, legacyName)
+			if err != nil {
+				return nil, "", microerror.Mask(err)
+			}
+			if isRoleCreated {
+				roleName = legacyName
+			}
+		}
+	}
+
+	if !isRoleCreated {
+		createRoleParams := role.CreateParams{
+			AllowBareDomains: config.AllowBareDomains,
+			AllowedDomains:   config.AllowedDomains,
+			AllowedOtherSANs: config.AllowedOtherSANs,
+			AllowedURISANs:   config.AllowedURISANs,
+			AllowSubdomains:  true,
+			TTL:              config.RoleTTL,
+			Name:             roleName,
+			Organizations:    organizations,
+		}
+
+		err = roleService.CreateWithContext(ctx, createRoleParams)
+		if err != nil {
+			return nil, "", microerror.Mask(err)
+		}
+		metrics.RoleCreations.WithLabelValues(config.ClusterID).Inc()
+	}
+
+	return roleService, roleName, nil
+}
+
+// validate checks the request against the role before issuing, so that users
+// get a specific error instead of Vault's generic bad request. Tokens created
+// before the policies granted reading the role or the mount settings cannot
+// look them up, in which case Vault is left to decide.
+func (cs *certSigner) validate(ctx context.Context, roleService role.Service, roleName string, config spec.IssueConfig) error {
+	r, err := roleService.RoleWithContext(ctx, roleName)
+	if role.IsPermissionDenied(err) {
+		return nil
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	maxLeaseTTL, err := cs.maxLeaseTTL(ctx, config.ClusterID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = validateIssueConfig(config, r, maxLeaseTTL)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// maxLeaseTTL returns the maximum lease TTL of the cluster's PKI backend
+// mount. Zero is returned in case the Vault token is not allowed to look it
+// up.
+func (cs *certSigner) maxLeaseTTL(ctx context.Context, clusterID string) (time.Duration, error) {
+	mountConfig, err := cs.VaultClient.Sys().MountConfigWithContext(ctx, cs.MountPathScheme.MountPath(clusterID))
+	if role.IsPermissionDenied(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, microerror.Mask(err)
+	}
+
+	return time.Duration(mountConfig.MaxLeaseTTL) * time.Second, nil
+}
+
+// RevokePath returns the path used to revoke certificates of a cluster's PKI
+// backend.
+func (cs *certSigner) RevokePath(clusterID string) string {
+	return fmt.Sprintf("%s/revoke", cs.MountPathScheme.MountPath(clusterID))
+}
+
 func (cs *certSigner) SignedPath(clusterID string, organizations []string) string {
-	return fmt.Sprintf("pki-%s/issue/%s", clusterID, vaultrolekey.RoleName(clusterID, organizations))
+	return cs.issuePath(clusterID, role.Name(clusterID, organizations))
+}
+
+func (cs *certSigner) issuePath(clusterID, roleName string) string {
+	return fmt.Sprintf("%s/issue/%s", cs.MountPathScheme.MountPath(clusterID), roleName)
+}
+
+func (cs *certSigner) signPath(clusterID, roleName string) string {
+	return fmt.Sprintf("%s/sign/%s", cs.MountPathScheme.MountPath(clusterID), roleName)
+}
+
+// issueConfigFromCSR describes the request to sign the given CSR as issue
+// configuration.
+func issueConfigFromCSR(config spec.SignConfig, csr *x509.CertificateRequest) spec.IssueConfig {
+	// Vault requires a common name, which CSRs of e.g. ACME clients do not
+	// necessarily contain. Then the first DNS name is used, which Vault takes
+	// in case the CSR has no common name.
+	commonName := csr.Subject.CommonName
+	if commonName == "" && len(csr.DNSNames) != 0 {
+		commonName = csr.DNSNames[0]
+	}
+
+	newIssueConfig := spec.IssueConfig{
+		ClusterID:     config.ClusterID,
+		CommonName:    commonName,
+		Organizations: csr.Subject.Organization,
+		IPSANs:        csr.IPAddresses,
+		AltNames:      append(append([]string{}, csr.DNSNames...), csr.EmailAddresses...),
+		TTL:           config.TTL,
+
+		AllowedDomains:   config.AllowedDomains,
+		AllowBareDomains: config.AllowBareDomains,
+		AllowedURISANs:   config.AllowedURISANs,
+		RoleTTL:          config.RoleTTL,
+	}
+	for _, u := range csr.URIs {
+		newIssueConfig.URISANs = append(newIssueConfig.URISANs, u.String())
+	}
+
+	return newIssueConfig
+}
+
+func joinIPs(ips []net.IP) string {
+	var list []string
+	for _, ip := range ips {
+		list = append(list, ip.String())
+	}
+
+	return strings.Join(list, ",")
 }
@@ -0,0 +1,158 @@
+package certsigner
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	vaultclient "github.com/hashicorp/vault/api"
+
+	mountpath "github.com/giantswarm/certctl/v2/service/mount-path"
+	"github.com/giantswarm/certctl/v2/service/retry"
+	"github.com/giantswarm/certctl/v2/service/spec"
+)
+
+// Test_CertSigner_Issue_WrappedURISANs verifies that URI SANs are rejected
+// together with response wrapping before Vault is requested, since wrapped
+// certificates cannot be verified to contain them.
+func Test_CertSigner_Issue_WrappedURISANs(t *testing.T) {
+	issueConfig := spec.IssueConfig{
+		ClusterID:  "abc",
+		CommonName: "api.example.com",
+		URISANs:    []string{"spiffe://example.org/cluster/abc/api"},
+		WrapTTL:    "5m",
+	}
+
+	// The Vault client is not set, so that any request to Vault would panic.
+	cs := &certSigner{}
+	_, err := cs.issue(context.Background(), issueConfig)
+	if !IsNotSupported(err) {
+		t.Fatalf("expected not supported error, got %#v", err)
+	}
+}
+
+// Test_CertSigner_InvalidClusterID verifies that cluster IDs which would
+// address another mount are rejected before Vault is requested.
+func Test_CertSigner_InvalidClusterID(t *testing.T) {
+	clusterID := "abc/../pki-def"
+
+	// The Vault client is not set, so that any request to Vault would panic.
+	cs := &certSigner{}
+
+	_, err := cs.issue(context.Background(), spec.IssueConfig{ClusterID: clusterID, CommonName: "api.example.com"})
+	if !mountpath.IsInvalidClusterID(err) {
+		t.Fatalf("expected invalid cluster ID error, got %#v", err)
+	}
+	_, err = cs.sign(context.Background(), spec.SignConfig{ClusterID: clusterID})
+	if !mountpath.IsInvalidClusterID(err) {
+		t.Fatalf("expected invalid cluster ID error, got %#v", err)
+	}
+	_, err = cs.revoke(context.Background(), spec.RevokeConfig{ClusterID: clusterID, SerialNumber: "01"})
+	if !mountpath.IsInvalidClusterID(err) {
+		t.Fatalf("expected invalid cluster ID error, got %#v", err)
+	}
+
+	kind := errorKind(err)
+	if kind != "invalid_config" {
+		t.Fatalf("expected error kind %q, got %q", "invalid_config", kind)
+	}
+}
+
+// Test_CertSigner_Issue_Retry verifies that looking up the role is retried,
+// but issuing is not once the request reached Vault, since Vault may have
+// issued a certificate even though the response failed.
+func Test_CertSigner_Issue_Retry(t *testing.T) {
+	testCases := []struct {
+		name  string
+		issue func(w http.ResponseWriter)
+	}{
+		{
+			name: "server error",
+			issue: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+		},
+		{
+			name: "connection closed",
+			issue: func(w http.ResponseWriter) {
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err != nil {
+					panic(err)
+				}
+				conn.Close()
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var listAttempts, issueAttempts int
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v1/pki-abc/roles":
+					listAttempts++
+					if listAttempts == 1 {
+						w.WriteHeader(http.StatusServiceUnavailable)
+						return
+					}
+					_, _ = w.Write([]byte(`{"data":{"keys":["role-abc"]}}`))
+				case "/v1/pki-abc/issue/role-abc":
+					issueAttempts++
+					tc.issue(w)
+				default:
+					// Reading the role and the mount settings is denied, so
+					// that validation is left to Vault.
+					w.WriteHeader(http.StatusForbidden)
+				}
+			}))
+			defer s.Close()
+
+			cs := newTestCertSigner(t, s.URL)
+
+			_, err := cs.IssueWithContext(context.Background(), spec.IssueConfig{ClusterID: "abc", CommonName: "api.example.com"})
+			if err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+
+			if listAttempts != 2 {
+				t.Fatalf("expected 2 attempts listing roles, got %d", listAttempts)
+			}
+			if issueAttempts != 1 {
+				t.Fatalf("expected 1 attempt issuing, got %d", issueAttempts)
+			}
+		})
+	}
+}
+
+func newTestCertSigner(t *testing.T, address string) spec.CertSigner {
+	clientConfig := vaultclient.DefaultConfig()
+	clientConfig.Address = address
+	vaultClient, err := vaultclient.NewClient(clientConfig)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	vaultClient.SetMaxRetries(0)
+	vaultClient.SetToken("token")
+
+	retryConfig := retry.DefaultConfig()
+	retryConfig.Logger = microloggertest.New()
+	retryConfig.MaxInterval = 10 * time.Millisecond
+	retryPolicy, err := retry.New(retryConfig)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	config := DefaultConfig()
+	config.Logger = microloggertest.New()
+	config.RetryPolicy = retryPolicy
+	config.VaultClient = vaultClient
+	cs, err := New(config)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return cs
+}
@@ -1,11 +1,19 @@
 package certsigner
 
 import (
+	"context"
+	"errors"
+	"net/http"
 	"strings"
 
 	"github.com/giantswarm/microerror"
+	vaultclient "github.com/hashicorp/vault/api"
 
 	"github.com/juju/errgo"
+
+	"github.com/giantswarm/certctl/v2/service/metrics"
+	mountpath "github.com/giantswarm/certctl/v2/service/mount-path"
+	"github.com/giantswarm/certctl/v2/service/retry"
 )
 
 var invalidConfigError = &microerror.Error{
@@ -17,6 +25,15 @@ func IsInvalidConfig(err error) bool {
 	return microerror.Cause(err) == invalidConfigError
 }
 
+var invalidCSRError = &microerror.Error{
+	Kind: "invalidCSRError",
+}
+
+// IsInvalidCSR asserts invalidCSRError.
+func IsInvalidCSR(err error) bool {
+	return microerror.Cause(err) == invalidCSRError
+}
+
 var keyPairNotFoundError = &microerror.Error{
 	Kind: "keyPairNotFoundError",
 }
@@ -26,6 +43,78 @@ func IsKeyPairNotFound(err error) bool {
 	return microerror.Cause(err) == keyPairNotFoundError
 }
 
+var notMountedError = &microerror.Error{
+	Kind: "notMountedError",
+}
+
+// IsNotMounted asserts notMountedError.
+func IsNotMounted(err error) bool {
+	return microerror.Cause(err) == notMountedError
+}
+
+var notSupportedError = &microerror.Error{
+	Kind: "notSupportedError",
+}
+
+// IsNotSupported asserts notSupportedError.
+func IsNotSupported(err error) bool {
+	return microerror.Cause(err) == notSupportedError
+}
+
+var certificateNotFoundError = &microerror.Error{
+	Kind: "certificateNotFoundError",
+}
+
+// IsCertificateNotFound asserts certificateNotFoundError.
+func IsCertificateNotFound(err error) bool {
+	return microerror.Cause(err) == certificateNotFoundError
+}
+
+var domainNotAllowedError = &microerror.Error{
+	Kind: "domainNotAllowedError",
+}
+
+// IsDomainNotAllowed asserts domainNotAllowedError.
+func IsDomainNotAllowed(err error) bool {
+	return microerror.Cause(err) == domainNotAllowedError
+}
+
+var ipSANNotAllowedError = &microerror.Error{
+	Kind: "ipSANNotAllowedError",
+}
+
+// IsIPSANNotAllowed asserts ipSANNotAllowedError.
+func IsIPSANNotAllowed(err error) bool {
+	return microerror.Cause(err) == ipSANNotAllowedError
+}
+
+var uriSANNotAllowedError = &microerror.Error{
+	Kind: "uriSANNotAllowedError",
+}
+
+// IsURISANNotAllowed asserts uriSANNotAllowedError.
+func IsURISANNotAllowed(err error) bool {
+	return microerror.Cause(err) == uriSANNotAllowedError
+}
+
+var uriSANMismatchError = &microerror.Error{
+	Kind: "uriSANMismatchError",
+}
+
+// IsURISANMismatch asserts uriSANMismatchError.
+func IsURISANMismatch(err error) bool {
+	return microerror.Cause(err) == uriSANMismatchError
+}
+
+var ttlExceededError = &microerror.Error{
+	Kind: "ttlExceededError",
+}
+
+// IsTTLExceeded asserts ttlExceededError.
+func IsTTLExceeded(err error) bool {
+	return microerror.Cause(err) == ttlExceededError
+}
+
 // IsNoVaultHandlerDefined asserts a dirty string matching against the error
 // message provided by err. This is necessary due to the poor error handling
 // design of the Vault library we are using.
@@ -38,3 +127,57 @@ func IsNoVaultHandlerDefined(err error) bool {
 
 	return false
 }
+
+// isVaultCertificateNotFound asserts a dirty string matching against the error
+// message Vault returns when revoking an unknown serial number.
+func isVaultCertificateNotFound(err error) bool {
+	cause := errgo.Cause(err)
+
+	if cause != nil && strings.Contains(cause.Error(), "certificate with serial") && strings.Contains(cause.Error(), "not found") {
+		return true
+	}
+
+	return false
+}
+
+// errorKind classifies the given issuance error for metrics.
+func errorKind(err error) string {
+	var responseError *vaultclient.ResponseError
+
+	switch {
+	case IsDomainNotAllowed(err):
+		return "domain_not_allowed"
+	case IsIPSANNotAllowed(err):
+		return "ip_san_not_allowed"
+	case IsURISANNotAllowed(err):
+		return "uri_san_not_allowed"
+	case IsURISANMismatch(err):
+		return "uri_san_mismatch"
+	case IsTTLExceeded(err):
+		return "ttl_exceeded"
+	case IsInvalidConfig(err), mountpath.IsInvalidClusterID(err):
+		return "invalid_config"
+	case IsInvalidCSR(err):
+		return "invalid_csr"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case IsNotMounted(err), IsNoVaultHandlerDefined(err):
+		return "not_mounted"
+	case IsNotSupported(err):
+		return "not_supported"
+	case IsKeyPairNotFound(err):
+		return "key_pair_not_found"
+	case IsCertificateNotFound(err):
+		return "certificate_not_found"
+	case retry.IsRetryable(err):
+		return "unavailable"
+	case errors.As(err, &responseError) && responseError.StatusCode == http.StatusForbidden:
+		return "permission_denied"
+	case errors.As(err, &responseError):
+		return "vault_error"
+	}
+
+	return metrics.ErrorKindUnknown
+}
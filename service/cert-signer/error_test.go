@@ -0,0 +1,133 @@
+package certsigner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"syscall"
+	"testing"
+
+	"github.com/giantswarm/microerror"
+	vaultclient "github.com/hashicorp/vault/api"
+
+	"github.com/giantswarm/certctl/v2/service/metrics"
+)
+
+func Test_errorKind(t *testing.T) {
+	testCases := []struct {
+		name         string
+		err          error
+		expectedKind string
+	}{
+		{
+			name:         "invalid config",
+			err:          microerror.Maskf(invalidConfigError, "foo"),
+			expectedKind: "invalid_config",
+		},
+		{
+			name:         "invalid CSR",
+			err:          microerror.Maskf(invalidCSRError, "foo"),
+			expectedKind: "invalid_csr",
+		},
+		{
+			name:         "key pair not found",
+			err:          microerror.Maskf(keyPairNotFoundError, "foo"),
+			expectedKind: "key_pair_not_found",
+		},
+		{
+			name:         "not mounted",
+			err:          microerror.Maskf(notMountedError, "foo"),
+			expectedKind: "not_mounted",
+		},
+		{
+			name:         "not supported",
+			err:          microerror.Maskf(notSupportedError, "foo"),
+			expectedKind: "not_supported",
+		},
+		{
+			name:         "certificate not found",
+			err:          microerror.Maskf(certificateNotFoundError, "foo"),
+			expectedKind: "certificate_not_found",
+		},
+		{
+			name:         "domain not allowed",
+			err:          microerror.Maskf(domainNotAllowedError, "foo"),
+			expectedKind: "domain_not_allowed",
+		},
+		{
+			name:         "IP SAN not allowed",
+			err:          microerror.Maskf(ipSANNotAllowedError, "foo"),
+			expectedKind: "ip_san_not_allowed",
+		},
+		{
+			name:         "URI SAN not allowed",
+			err:          microerror.Maskf(uriSANNotAllowedError, "foo"),
+			expectedKind: "uri_san_not_allowed",
+		},
+		{
+			name:         "URI SAN mismatch",
+			err:          microerror.Maskf(uriSANMismatchError, "foo"),
+			expectedKind: "uri_san_mismatch",
+		},
+		{
+			name:         "TTL exceeded",
+			err:          microerror.Maskf(ttlExceededError, "foo"),
+			expectedKind: "ttl_exceeded",
+		},
+		{
+			name:         "masked twice",
+			err:          microerror.Mask(microerror.Maskf(ttlExceededError, "foo")),
+			expectedKind: "ttl_exceeded",
+		},
+		{
+			name:         "deadline exceeded",
+			err:          fmt.Errorf("issuing: %w", context.DeadlineExceeded),
+			expectedKind: "timeout",
+		},
+		{
+			name:         "canceled",
+			err:          microerror.Mask(context.Canceled),
+			expectedKind: "canceled",
+		},
+		{
+			name:         "no Vault handler",
+			err:          microerror.Mask(errors.New("Error making API request. Code: 404. Errors: * no handler for route 'pki-abc/issue/role-abc'")),
+			expectedKind: "not_mounted",
+		},
+		{
+			name:         "connection refused",
+			err:          microerror.Mask(fmt.Errorf("dial: %w", syscall.ECONNREFUSED)),
+			expectedKind: "unavailable",
+		},
+		{
+			name:         "Vault unavailable",
+			err:          microerror.Mask(&vaultclient.ResponseError{StatusCode: http.StatusServiceUnavailable}),
+			expectedKind: "unavailable",
+		},
+		{
+			name:         "Vault forbidden",
+			err:          microerror.Mask(&vaultclient.ResponseError{StatusCode: http.StatusForbidden}),
+			expectedKind: "permission_denied",
+		},
+		{
+			name:         "Vault bad request",
+			err:          microerror.Mask(&vaultclient.ResponseError{StatusCode: http.StatusBadRequest}),
+			expectedKind: "vault_error",
+		},
+		{
+			name:         "unknown",
+			err:          errors.New("foo"),
+			expectedKind: metrics.ErrorKindUnknown,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			kind := errorKind(tc.err)
+			if kind != tc.expectedKind {
+				t.Fatalf("expected error kind %q, got %q", tc.expectedKind, kind)
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package certsigner
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+
+	localca "github.com/giantswarm/certctl/v2/service/local-ca"
+	"github.com/giantswarm/certctl/v2/service/metrics"
+	"github.com/giantswarm/certctl/v2/service/pki"
+	"github.com/giantswarm/certctl/v2/service/role"
+	"github.com/giantswarm/certctl/v2/service/spec"
+)
+
+// LocalConfig represents the configuration used to create a new certificate
+// signer backed by local CAs.
+type LocalConfig struct {
+	// Dependencies.
+	Logger micrologger.Logger
+	Store  localca.Store
+}
+
+// DefaultLocalConfig provides a default configuration to create a certificate
+// signer backed by local CAs.
+func DefaultLocalConfig() LocalConfig {
+	newLogger, err := micrologger.New(micrologger.Config{IOWriter: os.Stderr})
+	if err != nil {
+		panic(err)
+	}
+
+	newConfig := LocalConfig{
+		// Dependencies.
+		Logger: newLogger,
+		Store:  nil,
+	}
+
+	return newConfig
+}
+
+// NewLocal creates a new configured certificate signer issuing certificates
+// with the local CAs of the given store instead of Vault. Roles put the same
+// constraints on issued certificates as Vault roles do.
+func NewLocal(config LocalConfig) (spec.CertSigner, error) {
+	newCertSigner := &localCertSigner{
+		LocalConfig: config,
+	}
+
+	// Dependencies.
+	if newCertSigner.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "logger must not be empty")
+	}
+	if newCertSigner.Store == nil {
+		return nil, microerror.Maskf(invalidConfigError, "store must not be empty")
+	}
+
+	return newCertSigner, nil
+}
+
+type localCertSigner struct {
+	LocalConfig
+}
+
+func (cs *localCertSigner) Issue(config spec.IssueConfig) (spec.IssueResponse, error) {
+	return cs.IssueWithContext(context.Background(), config)
+}
+
+func (cs *localCertSigner) IssueWithContext(ctx context.Context, config spec.IssueConfig) (spec.IssueResponse, error) {
+	metrics.IssueAttempts.WithLabelValues(config.ClusterID).Inc()
+
+	newIssueResponse, err := cs.issue(ctx, config)
+	if err != nil {
+		metrics.IssueFailures.WithLabelValues(config.ClusterID, errorKind(err)).Inc()
+		return spec.IssueResponse{}, microerror.Mask(err)
+	}
+
+	cs.Logger.LogCtx(ctx, "level", "debug", "message", "issued certificate", "cluster_id", config.ClusterID, "common_name", config.CommonName, "serial_number", newIssueResponse.SerialNumber)
+
+	return newIssueResponse, nil
+}
+
+func (cs *localCertSigner) issue(ctx context.Context, config spec.IssueConfig) (spec.IssueResponse, error) {
+	// Response wrapping and other SANs are features of Vault, which local CAs
+	// do not provide.
+	if config.WrapTTL != "" {
+		return spec.IssueResponse{}, microerror.Maskf(notSupportedError, "response wrapping is not supported by local CAs")
+	}
+	if len(config.OtherSANs) != 0 {
+		return spec.IssueResponse{}, microerror.Maskf(notSupportedError, "other SANs are not supported by local CAs")
+	}
+
+	err := validateURISANs(config.URISANs)
+	if err != nil {
+		return spec.IssueResponse{}, microerror.Mask(err)
+	}
+
+	key, err := localca.GenerateKey()
+	if err != nil {
+		return spec.IssueResponse{}, microerror.Mask(err)
+	}
+
+	crt, ca, serial, err := cs.issueCertificate(ctx, config, &key.PublicKey)
+	if err != nil {
+		return spec.IssueResponse{}, microerror.Mask(err)
+	}
+
+	newIssueResponse := spec.IssueResponse{
+		Certificate:  crt,
+		PrivateKey:   localca.EncodePrivateKey(key),
+		IssuingCA:    ca,
+		SerialNumber: serial,
+	}
+
+	return newIssueResponse, nil
+}
+
+func (cs *localCertSigner) Sign(config spec.SignConfig) (spec.SignResponse, error) {
+	return cs.SignWithContext(context.Background(), config)
+}
+
+func (cs *localCertSigner) SignWithContext(ctx context.Context, config spec.SignConfig) (spec.SignResponse, error) {
+	metrics.IssueAttempts.WithLabelValues(config.ClusterID).Inc()
+
+	newSignResponse, err := cs.sign(ctx, config)
+	if err != nil {
+		metrics.IssueFailures.WithLabelValues(config.ClusterID, errorKind(err)).Inc()
+		return spec.SignResponse{}, microerror.Mask(err)
+	}
+
+	cs.Logger.LogCtx(ctx, "level", "debug", "message", "signed certificate", "cluster_id", config.ClusterID, "serial_number", newSignResponse.SerialNumber)
+
+	return newSignResponse, nil
+}
+
+func (cs *localCertSigner) sign(ctx context.Context, config spec.SignConfig) (spec.SignResponse, error) {
+	csr, err := parseCSR(config.CSR)
+	if err != nil {
+		return spec.SignResponse{}, microerror.Mask(err)
+	}
+
+	// Vault roles only accept RSA keys of at least 2048 bits by default.
+	publicKey, ok := csr.PublicKey.(*rsa.PublicKey)
+	if !ok || publicKey.N.BitLen() < localca.KeyBits {
+		return spec.SignResponse{}, microerror.Maskf(invalidCSRError, "CSR must contain an RSA public key of at least %d bits", localca.KeyBits)
+	}
+
+	newIssueConfig := issueConfigFromCSR(config, csr)
+
+	err = validateURISANs(newIssueConfig.URISANs)
+	if err != nil {
+		return spec.SignResponse{}, microerror.Mask(err)
+	}
+
+	crt, ca, serial, err := cs.issueCertificate(ctx, newIssueConfig, publicKey)
+	if err != nil {
+		return spec.SignResponse{}, microerror.Mask(err)
+	}
+
+	newSignResponse := spec.SignResponse{
+		Certificate:  crt,
+		IssuingCA:    ca,
+		SerialNumber: serial,
+	}
+
+	return newSignResponse, nil
+}
+
+func (cs *localCertSigner) Revoke(config spec.RevokeConfig) (spec.RevokeResponse, error) {
+	return cs.RevokeWithContext(context.Background(), config)
+}
+
+func (cs *localCertSigner) RevokeWithContext(ctx context.Context, config spec.RevokeConfig) (spec.RevokeResponse, error) {
+	if config.ClusterID == "" {
+		return spec.RevokeResponse{}, microerror.Maskf(invalidConfigError, "cluster ID must not be empty")
+	}
+	if config.SerialNumber == "" {
+		return spec.RevokeResponse{}, microerror.Maskf(invalidConfigError, "serial number must not be empty")
+	}
+
+	serial := strings.ToLower(strings.Replace(config.SerialNumber, "-", ":", -1))
+
+	var newRevokeResponse spec.RevokeResponse
+	update := func(cluster *localca.Cluster) error {
+		crt, ok := cluster.Certificates[serial]
+		if !ok {
+			return microerror.Maskf(certificateNotFoundError, "certificate with serial number '%s' not issued for cluster ID '%s'", config.SerialNumber, config.ClusterID)
+		}
+
+		// Revoking an already revoked certificate returns the original
+		// revocation time, the same as Vault does.
+		if crt.RevocationTime == nil {
+			revocationTime := time.Now().UTC().Truncate(time.Second)
+			crt.RevocationTime = &revocationTime
+			cluster.Certificates[serial] = crt
+		}
+		newRevokeResponse.RevocationTime = *crt.RevocationTime
+
+		return nil
+	}
+	err := cs.Store.Update(ctx, config.ClusterID, update)
+	if localca.IsClusterNotFound(err) {
+		return spec.RevokeResponse{}, microerror.Maskf(certificateNotFoundError, "certificate with serial number '%s' not issued for cluster ID '%s'", config.SerialNumber, config.ClusterID)
+	} else if err != nil {
+		return spec.RevokeResponse{}, microerror.Mask(err)
+	}
+
+	cs.Logger.LogCtx(ctx, "level", "debug", "message", "revoked certificate", "cluster_id", config.ClusterID, "serial_number", config.SerialNumber)
+
+	return newRevokeResponse, nil
+}
+
+// SignedPath returns the path of the file the local CA of the given cluster is
+// stored in, because local CAs do not provide paths per role.
+func (cs *localCertSigner) SignedPath(clusterID string, organizations []string) string {
+	return cs.Store.Path(clusterID)
+}
+
+// issueCertificate issues a certificate for the given public key as described
+// by the given configuration with the cluster's local CA. The role able to
+// issue certificates with the organizations of the given configuration is
+// created in case it does not exist yet, and the request is validated against
+// it the same way as for Vault. The PEM encoded certificate, the PEM encoded
+// root CA and the serial number are returned.
+func (cs *localCertSigner) issueCertificate(ctx context.Context, config spec.IssueConfig, publicKey crypto.PublicKey) (string, string, string, error) {
+	var crt, ca, serial string
+	var roleCreated bool
+	update := func(cluster *localca.Cluster) error {
+		if cluster.CA == nil {
+			return microerror.Maskf(keyPairNotFoundError, "root CA for cluster ID '%s' is not generated", config.ClusterID)
+		}
+		caCrt, _, err := cluster.CA.KeyPair()
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		organizations := role.NormalizeOrganizations(config.Organizations)
+		roleName := role.Name(config.ClusterID, organizations)
+		r, ok := cluster.Roles[roleName]
+		if !ok {
+			ttl, err := roleTTL(config.RoleTTL)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			// The role is created with the settings Vault applies to roles
+			// created while issuing.
+			r = localca.Role{
+				Role: role.Role{
+					Name:             roleName,
+					AllowBareDomains: config.AllowBareDomains,
+					AllowIPSANs:      true,
+					AllowLocalhost:   true,
+					AllowSubdomains:  true,
+					AllowedDomains:   config.AllowedDomains,
+					AllowedURISANs:   config.AllowedURISANs,
+					TTL:              ttl,
+				},
+				Organizations: organizations,
+			}
+			cluster.Roles[roleName] = r
+			roleCreated = true
+		}
+
+		err = validateIssueConfig(config, r.Role, cluster.MaxLeaseTTL)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		// The TTL defaults to the role's TTL and then to the maximum lease
+		// TTL, which also caps the role's TTL.
+		ttl := r.TTL
+		if config.TTL != "" {
+			ttl, err = parseTTL(config.TTL)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+		}
+		if ttl == 0 || ttl > cluster.MaxLeaseTTL {
+			ttl = cluster.MaxLeaseTTL
+		}
+
+		// Requested TTLs exceeding the validity of the root CA fail the same
+		// way they do with Vault, while defaulted ones are capped by it.
+		now := time.Now()
+		notAfter := now.Add(ttl)
+		if notAfter.After(caCrt.NotAfter) && config.TTL == "" {
+			notAfter = caCrt.NotAfter
+		} else if notAfter.After(caCrt.NotAfter) {
+			return microerror.Maskf(ttlExceededError, "TTL %s exceeds the validity of the root CA for cluster ID '%s' ending at %s", ttl, config.ClusterID, caCrt.NotAfter.UTC().Format(time.RFC3339))
+		}
+
+		serialNumber, err := localca.NewSerialNumber()
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		template := &x509.Certificate{
+			SerialNumber: serialNumber,
+			Subject: pkix.Name{
+				CommonName:   config.CommonName,
+				Organization: r.Organizations,
+			},
+			NotBefore:   now.Add(-localca.NotBeforeSkew),
+			NotAfter:    notAfter,
+			KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageKeyAgreement,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			IPAddresses: config.IPSANs,
+		}
+
+		// The common name is added to the SANs, the same as Vault does.
+		seen := map[string]bool{}
+		for _, name := range append([]string{config.CommonName}, config.AltNames...) {
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			if strings.Contains(name, "@") {
+				template.EmailAddresses = append(template.EmailAddresses, name)
+			} else {
+				template.DNSNames = append(template.DNSNames, name)
+			}
+		}
+		for _, uri := range config.URISANs {
+			u, err := url.Parse(uri)
+			if err != nil {
+				return microerror.Maskf(invalidConfigError, "URI SAN '%s' is not a valid URI: %s", uri, err)
+			}
+			template.URIs = append(template.URIs, u)
+		}
+
+		crt, err = cluster.CA.Issue(template, publicKey)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+		ca = cluster.CA.Certificate
+		serial = pki.FormatSerialNumber(serialNumber.Bytes())
+
+		cluster.Certificates[serial] = localca.Certificate{
+			Certificate: crt,
+		}
+
+		return nil
+	}
+	err := cs.Store.Update(ctx, config.ClusterID, update)
+	if localca.IsClusterNotFound(err) {
+		return "", "", "", microerror.Maskf(notMountedError, "local CA for cluster ID '%s' does not exist", config.ClusterID)
+	} else if err != nil {
+		return "", "", "", microerror.Mask(err)
+	}
+	if roleCreated {
+		metrics.RoleCreations.WithLabelValues(config.ClusterID).Inc()
+	}
+
+	return crt, ca, serial, nil
+}
+
+// roleTTL parses the TTL of a role to be created. Empty means the maximum
+// lease TTL applies.
+func roleTTL(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	ttl, err := parseTTL(s)
+	if err != nil {
+		return 0, microerror.Mask(err)
+	}
+
+	return ttl, nil
+}
@@ -0,0 +1,213 @@
+package certsigner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+
+	localca "github.com/giantswarm/certctl/v2/service/local-ca"
+	"github.com/giantswarm/certctl/v2/service/pki"
+	"github.com/giantswarm/certctl/v2/service/spec"
+)
+
+// newLocalTestSetup returns a local certificate signer and PKI service
+// sharing a store in a temporary directory, with the cluster 'abc' set up for
+// the domain example.com.
+func newLocalTestSetup(t *testing.T) (spec.CertSigner, pki.Service) {
+	storeConfig := localca.DefaultConfig()
+	storeConfig.Logger = microloggertest.New()
+	storeConfig.Directory = t.TempDir()
+	storeConfig.Passphrase = []byte("secret")
+	store, err := localca.New(storeConfig)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	pkiConfig := pki.DefaultLocalServiceConfig()
+	pkiConfig.Logger = microloggertest.New()
+	pkiConfig.Store = store
+	pkiService, err := pki.NewLocalService(pkiConfig)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	certSignerConfig := DefaultLocalConfig()
+	certSignerConfig.Logger = microloggertest.New()
+	certSignerConfig.Store = store
+	certSigner, err := NewLocal(certSignerConfig)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	createConfig := pki.CreateConfig{
+		AllowedDomains: "example.com",
+		ClusterID:      "abc",
+		CommonName:     "ca.example.com",
+		TTL:            "720h",
+	}
+	_, err = pkiService.CreateWithContext(context.Background(), createConfig)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return certSigner, pkiService
+}
+
+func parseTestCertificate(t *testing.T, data string) *x509.Certificate {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		t.Fatalf("expected PEM encoded certificate, got %q", data)
+	}
+	crt, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return crt
+}
+
+func Test_Local_IssueRevoke(t *testing.T) {
+	ctx := context.Background()
+	certSigner, pkiService := newLocalTestSetup(t)
+
+	issueConfig := spec.IssueConfig{
+		ClusterID:      "abc",
+		CommonName:     "api.example.com",
+		Organizations:  []string{"system:masters"},
+		AltNames:       []string{"www.example.com"},
+		TTL:            "24h",
+		AllowedDomains: []string{"example.com"},
+	}
+	issueResponse, err := certSigner.IssueWithContext(ctx, issueConfig)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	crt := parseTestCertificate(t, issueResponse.Certificate)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM([]byte(issueResponse.IssuingCA))
+	_, err = crt.Verify(x509.VerifyOptions{DNSName: "www.example.com", Roots: roots})
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	if len(crt.Subject.Organization) != 1 || crt.Subject.Organization[0] != "system:masters" {
+		t.Fatalf("expected organization 'system:masters', got %v", crt.Subject.Organization)
+	}
+	if pki.FormatSerialNumber(crt.SerialNumber.Bytes()) != issueResponse.SerialNumber {
+		t.Fatalf("expected serial number %s, got %s", pki.FormatSerialNumber(crt.SerialNumber.Bytes()), issueResponse.SerialNumber)
+	}
+
+	// Names outside of the allowed domains are rejected the same way Vault
+	// rejects them.
+	issueConfig.CommonName = "api.example.org"
+	_, err = certSigner.IssueWithContext(ctx, issueConfig)
+	if !IsDomainNotAllowed(err) {
+		t.Fatalf("expected domain not allowed error, got %#v", err)
+	}
+
+	// The TTL is capped by the TTL the cluster was set up with.
+	issueConfig.CommonName = "api.example.com"
+	issueConfig.TTL = "1000h"
+	_, err = certSigner.IssueWithContext(ctx, issueConfig)
+	if !IsTTLExceeded(err) {
+		t.Fatalf("expected TTL exceeded error, got %#v", err)
+	}
+
+	// Response wrapping is a feature of Vault.
+	issueConfig.TTL = ""
+	issueConfig.WrapTTL = "5m"
+	_, err = certSigner.IssueWithContext(ctx, issueConfig)
+	if !IsNotSupported(err) {
+		t.Fatalf("expected not supported error, got %#v", err)
+	}
+
+	revokeConfig := spec.RevokeConfig{
+		ClusterID:    "abc",
+		SerialNumber: issueResponse.SerialNumber,
+	}
+	revokeResponse, err := certSigner.RevokeWithContext(ctx, revokeConfig)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	// Revoking again returns the original revocation time.
+	again, err := certSigner.RevokeWithContext(ctx, revokeConfig)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	if !again.RevocationTime.Equal(revokeResponse.RevocationTime) {
+		t.Fatalf("expected revocation time %s, got %s", revokeResponse.RevocationTime, again.RevocationTime)
+	}
+
+	crl, err := pkiService.CRLWithContext(ctx, "abc")
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	if len(crl.RevokedSerialNumbers) != 1 || crl.RevokedSerialNumbers[0] != issueResponse.SerialNumber {
+		t.Fatalf("expected CRL to list serial number %s, got %v", issueResponse.SerialNumber, crl.RevokedSerialNumbers)
+	}
+
+	revokeConfig.SerialNumber = "01:02:03"
+	_, err = certSigner.RevokeWithContext(ctx, revokeConfig)
+	if !IsCertificateNotFound(err) {
+		t.Fatalf("expected certificate not found error, got %#v", err)
+	}
+}
+
+func Test_Local_Sign(t *testing.T) {
+	ctx := context.Background()
+	certSigner, _ := newLocalTestSetup(t)
+
+	key, err := localca.GenerateKey()
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	template := &x509.CertificateRequest{
+		DNSNames: []string{"web.example.com"},
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	signConfig := spec.SignConfig{
+		ClusterID: "abc",
+		CSR:       string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})),
+	}
+	signResponse, err := certSigner.SignWithContext(ctx, signConfig)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	// CSRs without a common name get the first DNS name as common name.
+	crt := parseTestCertificate(t, signResponse.Certificate)
+	if crt.Subject.CommonName != "web.example.com" {
+		t.Fatalf("expected common name 'web.example.com', got %q", crt.Subject.CommonName)
+	}
+
+	// Keys other than RSA keys of at least 2048 bits are rejected the same
+	// way Vault rejects them by default.
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	template = &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "web.example.com"},
+	}
+	der, err = x509.CreateCertificateRequest(rand.Reader, template, ecKey)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	signConfig.CSR = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+	_, err = certSigner.SignWithContext(ctx, signConfig)
+	if !IsInvalidCSR(err) {
+		t.Fatalf("expected invalid CSR error, got %#v", err)
+	}
+}
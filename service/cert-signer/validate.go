@@ -0,0 +1,254 @@
+package certsigner
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/microerror"
+
+	"github.com/giantswarm/certctl/v2/service/role"
+	"github.com/giantswarm/certctl/v2/service/spec"
+	"github.com/giantswarm/certctl/v2/service/spiffe"
+)
+
+// validateIssueConfig checks the given issue configuration against the
+// constraints of the role used to issue the certificate, so that violations
+// are reported with a specific error instead of Vault's generic bad request.
+// A zero maxLeaseTTL means the mount's maximum lease TTL is unknown.
+func validateIssueConfig(config spec.IssueConfig, r role.Role, maxLeaseTTL time.Duration) error {
+	var names []string
+	if config.CommonName != "" {
+		names = append(names, config.CommonName)
+	}
+	names = append(names, config.AltNames...)
+	for _, name := range names {
+		if !isNameAllowed(r, name) {
+			return microerror.Maskf(domainNotAllowedError, "'%s' is not allowed by role '%s' with allowed domains '%s'", name, r.Name, strings.Join(r.AllowedDomains, ","))
+		}
+	}
+
+	for _, ip := range config.IPSANs {
+		if ip == nil {
+			return microerror.Maskf(invalidConfigError, "IP SANs must not contain invalid IP addresses")
+		}
+	}
+	if len(config.IPSANs) != 0 && !r.AllowIPSANs {
+		return microerror.Maskf(ipSANNotAllowedError, "IP SANs are not allowed by role '%s'", r.Name)
+	}
+
+	for _, uri := range config.URISANs {
+		if !isURISANAllowed(r, uri) {
+			return microerror.Maskf(uriSANNotAllowedError, "URI SAN '%s' is not allowed by role '%s' with allowed URI SANs '%s'", uri, r.Name, strings.Join(r.AllowedURISANs, ","))
+		}
+	}
+
+	if config.TTL != "" {
+		ttl, err := parseTTL(config.TTL)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		// The role's maximum TTL is capped by the mount's maximum lease TTL.
+		maxTTL := r.MaxTTL
+		if maxTTL == 0 || (maxLeaseTTL != 0 && maxLeaseTTL < maxTTL) {
+			maxTTL = maxLeaseTTL
+		}
+		if maxTTL != 0 && ttl > maxTTL {
+			return microerror.Maskf(ttlExceededError, "TTL %s exceeds the maximum TTL %s of role '%s'", ttl, maxTTL, r.Name)
+		}
+	}
+
+	return nil
+}
+
+// isNameAllowed mirrors the host name checks Vault applies when issuing
+// certificates for the given role. Names Vault cannot reason about on the
+// client side, like templated allowed domains, are always allowed, so that
+// Vault has the final say.
+func isNameAllowed(r role.Role, name string) bool {
+	if r.AllowAnyName {
+		return true
+	}
+	if r.AllowLocalhost && name == "localhost" {
+		return true
+	}
+
+	// Email addresses are checked against their domain.
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.ToLower(name)
+
+	isWildcard := strings.HasPrefix(name, "*.")
+	base := strings.TrimPrefix(name, "*.")
+
+	for _, d := range r.AllowedDomains {
+		d = strings.ToLower(d)
+
+		if strings.Contains(d, "{{") {
+			return true
+		}
+		if r.AllowGlobDomains && strings.Contains(d, "*") && matchGlob(d, name) {
+			return true
+		}
+		if base == d {
+			// A wildcard for an allowed domain covers its subdomains only.
+			if isWildcard && r.AllowSubdomains {
+				return true
+			}
+			if !isWildcard && r.AllowBareDomains {
+				return true
+			}
+			continue
+		}
+		if r.AllowSubdomains && strings.HasSuffix(base, "."+d) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isURISANAllowed mirrors the URI SAN checks Vault applies when issuing
+// certificates for the given role. Templated allowed URI SANs are always
+// allowed, so that Vault has the final say.
+func isURISANAllowed(r role.Role, uri string) bool {
+	for _, allowed := range r.AllowedURISANs {
+		if strings.Contains(allowed, "{{") {
+			return true
+		}
+		if matchGlob(allowed, uri) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateURISANs checks that the given URI SANs are absolute URIs, and that
+// SPIFFE IDs among them follow the SPIFFE ID specification.
+func validateURISANs(uris []string) error {
+	for _, uri := range uris {
+		if spiffe.IsID(uri) {
+			err := spiffe.ValidateID(uri)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+			continue
+		}
+
+		u, err := url.Parse(uri)
+		if err != nil {
+			return microerror.Maskf(invalidConfigError, "URI SAN '%s' is not a valid URI: %s", uri, err)
+		}
+		if !u.IsAbs() {
+			return microerror.Maskf(invalidConfigError, "URI SAN '%s' must be an absolute URI", uri)
+		}
+	}
+
+	return nil
+}
+
+// parseCSR parses the given PEM encoded certificate signing request and
+// checks its signature, so that only requests made by the holder of the
+// private key are signed.
+func parseCSR(data string) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, microerror.Maskf(invalidCSRError, "CSR must be a PEM encoded certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, microerror.Maskf(invalidCSRError, "%s", err)
+	}
+	err = csr.CheckSignature()
+	if err != nil {
+		return nil, microerror.Maskf(invalidCSRError, "%s", err)
+	}
+
+	return csr, nil
+}
+
+// verifyURISANs checks that the given PEM encoded certificate contains
+// exactly the given URI SANs, regardless of their order.
+func verifyURISANs(crt string, uris []string) error {
+	block, _ := pem.Decode([]byte(crt))
+	if block == nil {
+		return microerror.Maskf(keyPairNotFoundError, "public key is not PEM encoded")
+	}
+	c, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	var issued []string
+	for _, u := range c.URIs {
+		issued = append(issued, u.String())
+	}
+
+	// Requested URIs are compared in the form Go encodes them, the same as
+	// the issued ones.
+	var want []string
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+		want = append(want, u.String())
+	}
+
+	sort.Strings(want)
+	sort.Strings(issued)
+	mismatch := len(want) != len(issued)
+	for i := 0; !mismatch && i < len(want); i++ {
+		mismatch = want[i] != issued[i]
+	}
+	if mismatch {
+		return microerror.Maskf(uriSANMismatchError, "issued certificate contains URI SANs '%s' instead of requested '%s'", strings.Join(issued, ","), strings.Join(want, ","))
+	}
+
+	return nil
+}
+
+// matchGlob matches name against pattern, in which '*' matches any sequence
+// of characters including dots, the way Vault matches glob domains.
+func matchGlob(pattern, name string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == name
+	}
+
+	if !strings.HasPrefix(name, parts[0]) {
+		return false
+	}
+	name = name[len(parts[0]):]
+	for _, p := range parts[1 : len(parts)-1] {
+		i := strings.Index(name, p)
+		if i < 0 {
+			return false
+		}
+		name = name[i+len(p):]
+	}
+
+	return strings.HasSuffix(name, parts[len(parts)-1])
+}
+
+// parseTTL parses a TTL the way Vault does, either as golang time string or
+// as number of seconds.
+func parseTTL(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err == nil {
+		return d, nil
+	}
+	seconds, err := strconv.ParseInt(s, 10, 64)
+	if err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	return 0, microerror.Maskf(invalidConfigError, "TTL '%s' is not a valid duration", s)
+}
@@ -0,0 +1,211 @@
+package certsigner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/giantswarm/certctl/v2/service/role"
+)
+
+func Test_isNameAllowed(t *testing.T) {
+	testCases := []struct {
+		name     string
+		role     role.Role
+		host     string
+		expected bool
+	}{
+		{
+			name:     "any name",
+			role:     role.Role{AllowAnyName: true},
+			host:     "foo.example.org",
+			expected: true,
+		},
+		{
+			name:     "localhost allowed",
+			role:     role.Role{AllowLocalhost: true},
+			host:     "localhost",
+			expected: true,
+		},
+		{
+			name:     "localhost not allowed",
+			role:     role.Role{AllowedDomains: []string{"example.com"}, AllowSubdomains: true},
+			host:     "localhost",
+			expected: false,
+		},
+		{
+			name:     "subdomain",
+			role:     role.Role{AllowedDomains: []string{"example.com"}, AllowSubdomains: true},
+			host:     "api.example.com",
+			expected: true,
+		},
+		{
+			name:     "nested subdomain",
+			role:     role.Role{AllowedDomains: []string{"example.com"}, AllowSubdomains: true},
+			host:     "a.b.example.com",
+			expected: true,
+		},
+		{
+			name:     "subdomain not allowed",
+			role:     role.Role{AllowedDomains: []string{"example.com"}, AllowBareDomains: true},
+			host:     "api.example.com",
+			expected: false,
+		},
+		{
+			name:     "case insensitive",
+			role:     role.Role{AllowedDomains: []string{"Example.com"}, AllowSubdomains: true},
+			host:     "API.example.COM",
+			expected: true,
+		},
+		{
+			name:     "suffix without dot",
+			role:     role.Role{AllowedDomains: []string{"example.com"}, AllowSubdomains: true},
+			host:     "badexample.com",
+			expected: false,
+		},
+		{
+			name:     "bare domain",
+			role:     role.Role{AllowedDomains: []string{"example.com"}, AllowBareDomains: true},
+			host:     "example.com",
+			expected: true,
+		},
+		{
+			name:     "bare domain not allowed",
+			role:     role.Role{AllowedDomains: []string{"example.com"}, AllowSubdomains: true},
+			host:     "example.com",
+			expected: false,
+		},
+		{
+			name:     "wildcard",
+			role:     role.Role{AllowedDomains: []string{"example.com"}, AllowSubdomains: true},
+			host:     "*.example.com",
+			expected: true,
+		},
+		{
+			name:     "wildcard without subdomains",
+			role:     role.Role{AllowedDomains: []string{"example.com"}, AllowBareDomains: true},
+			host:     "*.example.com",
+			expected: false,
+		},
+		{
+			name:     "email",
+			role:     role.Role{AllowedDomains: []string{"example.com"}, AllowBareDomains: true},
+			host:     "admin@example.com",
+			expected: true,
+		},
+		{
+			name:     "email of other domain",
+			role:     role.Role{AllowedDomains: []string{"example.com"}, AllowBareDomains: true},
+			host:     "admin@example.org",
+			expected: false,
+		},
+		{
+			name:     "glob domain",
+			role:     role.Role{AllowedDomains: []string{"*.svc.example.com"}, AllowGlobDomains: true},
+			host:     "api.ns.svc.example.com",
+			expected: true,
+		},
+		{
+			name:     "glob domain not matching",
+			role:     role.Role{AllowedDomains: []string{"*.svc.example.com"}, AllowGlobDomains: true},
+			host:     "api.example.com",
+			expected: false,
+		},
+		{
+			name:     "glob domain without glob domains allowed",
+			role:     role.Role{AllowedDomains: []string{"*.svc.example.com"}},
+			host:     "api.svc.example.com",
+			expected: false,
+		},
+		{
+			name:     "templated domain",
+			role:     role.Role{AllowedDomains: []string{"{{identity.entity.name}}.example.com"}},
+			host:     "anything.example.org",
+			expected: true,
+		},
+		{
+			name:     "no allowed domains",
+			role:     role.Role{AllowSubdomains: true, AllowBareDomains: true},
+			host:     "example.com",
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := isNameAllowed(tc.role, tc.host)
+			if result != tc.expected {
+				t.Fatalf("expected %t, got %t", tc.expected, result)
+			}
+		})
+	}
+}
+
+func Test_matchGlob(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{pattern: "example.com", name: "example.com", expected: true},
+		{pattern: "example.com", name: "api.example.com", expected: false},
+		{pattern: "*", name: "anything", expected: true},
+		{pattern: "*", name: "", expected: true},
+		{pattern: "*.example.com", name: "api.example.com", expected: true},
+		{pattern: "*.example.com", name: "a.b.example.com", expected: true},
+		{pattern: "*.example.com", name: "example.com", expected: false},
+		{pattern: "api.*", name: "api.example.com", expected: true},
+		{pattern: "api.*", name: "web.example.com", expected: false},
+		{pattern: "spiffe://example.org/cluster/123/*", name: "spiffe://example.org/cluster/123/ns/default", expected: true},
+		{pattern: "spiffe://example.org/cluster/123/*", name: "spiffe://example.org/cluster/1234/ns/default", expected: false},
+		{pattern: "a*b*c", name: "abc", expected: true},
+		{pattern: "a*b*c", name: "axxbyyc", expected: true},
+		{pattern: "a*b*c", name: "axxcyyb", expected: false},
+		{pattern: "a*a", name: "a", expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.pattern+" "+tc.name, func(t *testing.T) {
+			result := matchGlob(tc.pattern, tc.name)
+			if result != tc.expected {
+				t.Fatalf("expected %t, got %t", tc.expected, result)
+			}
+		})
+	}
+}
+
+func Test_parseTTL(t *testing.T) {
+	testCases := []struct {
+		ttl          string
+		expected     time.Duration
+		errorMatcher func(error) bool
+	}{
+		{ttl: "1h", expected: time.Hour},
+		{ttl: "90m", expected: 90 * time.Minute},
+		{ttl: "1h30m", expected: 90 * time.Minute},
+		{ttl: "3600", expected: time.Hour},
+		{ttl: "0", expected: 0},
+		{ttl: "", errorMatcher: IsInvalidConfig},
+		{ttl: "1d", errorMatcher: IsInvalidConfig},
+		{ttl: "foo", errorMatcher: IsInvalidConfig},
+		{ttl: "1.5", errorMatcher: IsInvalidConfig},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.ttl, func(t *testing.T) {
+			result, err := parseTTL(tc.ttl)
+			if tc.errorMatcher != nil {
+				if !tc.errorMatcher(err) {
+					t.Fatalf("expected error to match, got %#v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+
+			if result != tc.expected {
+				t.Fatalf("expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package estserver
+
+import (
+	"github.com/giantswarm/microerror"
+)
+
+var invalidConfigError = &microerror.Error{
+	Kind: "invalidConfigError",
+}
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return microerror.Cause(err) == invalidConfigError
+}
+
+var invalidRequestError = &microerror.Error{
+	Kind: "invalidRequestError",
+}
+
+// IsInvalidRequest asserts invalidRequestError.
+func IsInvalidRequest(err error) bool {
+	return microerror.Cause(err) == invalidRequestError
+}
+
+var notFoundError = &microerror.Error{
+	Kind: "notFoundError",
+}
+
+// IsNotFound asserts notFoundError.
+func IsNotFound(err error) bool {
+	return microerror.Cause(err) == notFoundError
+}
+
+var notAuthorizedError = &microerror.Error{
+	Kind: "notAuthorizedError",
+}
+
+// IsNotAuthorized asserts notAuthorizedError.
+func IsNotAuthorized(err error) bool {
+	return microerror.Cause(err) == notAuthorizedError
+}
+
+var unauthenticatedError = &microerror.Error{
+	Kind: "unauthenticatedError",
+}
+
+// IsUnauthenticated asserts unauthenticatedError.
+func IsUnauthenticated(err error) bool {
+	return microerror.Cause(err) == unauthenticatedError
+}
+
+var methodNotAllowedError = &microerror.Error{
+	Kind: "methodNotAllowedError",
+}
+
+// IsMethodNotAllowed asserts methodNotAllowedError.
+func IsMethodNotAllowed(err error) bool {
+	return microerror.Cause(err) == methodNotAllowedError
+}
@@ -0,0 +1,114 @@
+package estserver
+
+import (
+	"encoding/asn1"
+	"encoding/base64"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+)
+
+var (
+	oidData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+// contentInfo is the PKCS#7 content info, see RFC 5652 section 3.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+// signedData is the PKCS#7 signed data, see RFC 5652 section 5.1. EST uses
+// it without signers to transport certificates, which is called certs-only.
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo encapContentInfo
+	Certificates     asn1.RawValue
+	SignerInfos      asn1.RawValue
+}
+
+type encapContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+}
+
+// encodeCertsOnly returns the DER encoded PKCS#7 certs-only structure holding
+// the given DER encoded certificates, see RFC 7030 section 4.1.3.
+func encodeCertsOnly(certs [][]byte) ([]byte, error) {
+	emptySet := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true}
+
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: emptySet,
+		EncapContentInfo: encapContentInfo{
+			ContentType: oidData,
+		},
+		Certificates: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      concat(certs),
+		},
+		SignerInfos: emptySet,
+	}
+	b, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	ci := contentInfo{
+		ContentType: oidSignedData,
+		Content: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      b,
+		},
+	}
+	b, err = asn1.Marshal(ci)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return b, nil
+}
+
+// encodeBase64 encodes the given data the way EST transfers bodies, using
+// base64 with lines of at most 76 characters, see RFC 2045 section 6.8.
+func encodeBase64(data []byte) []byte {
+	s := base64.StdEncoding.EncodeToString(data)
+
+	var b strings.Builder
+	for len(s) > 76 {
+		b.WriteString(s[:76])
+		b.WriteString("\r\n")
+		s = s[76:]
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+
+	return []byte(b.String())
+}
+
+// decodeBase64 decodes the given base64 encoded body, ignoring line breaks
+// and other whitespace.
+func decodeBase64(data []byte) ([]byte, error) {
+	s := strings.Join(strings.Fields(string(data)), "")
+
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, microerror.Maskf(invalidRequestError, "cannot decode base64 body: %s", err)
+	}
+
+	return b, nil
+}
+
+func concat(bs [][]byte) []byte {
+	var c []byte
+	for _, b := range bs {
+		c = append(c, b...)
+	}
+
+	return c
+}
@@ -0,0 +1,631 @@
+package estserver
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+	"golang.org/x/crypto/bcrypt"
+
+	apiserver "github.com/giantswarm/certctl/v2/service/api-server"
+	"github.com/giantswarm/certctl/v2/service/metrics"
+	"github.com/giantswarm/certctl/v2/service/pki"
+	"github.com/giantswarm/certctl/v2/service/spec"
+)
+
+const (
+	operationCACerts        = "cacerts"
+	operationSimpleEnroll   = "simpleenroll"
+	operationSimpleReenroll = "simplereenroll"
+
+	// maxBodySize limits the size of request bodies, which only hold CSRs.
+	maxBodySize = 1 << 20
+
+	// pathPrefix prefixes the paths of all EST operations, which are
+	// <pathPrefix>[<label>/]<operation>, see RFC 7030 section 3.2.2.
+	pathPrefix = "/.well-known/est/"
+
+	// realm is the realm clients are asked to authenticate for with HTTP
+	// basic auth.
+	realm = "certctl EST"
+)
+
+// methods holds the HTTP method of every operation.
+var methods = map[string]string{
+	operationCACerts:        http.MethodGet,
+	operationSimpleEnroll:   http.MethodPost,
+	operationSimpleReenroll: http.MethodPost,
+}
+
+// Config represents the configuration used to create a new EST server.
+type Config struct {
+	// Dependencies.
+
+	// AuditLogger receives an entry for every request, including the client,
+	// the requested names and the outcome.
+	AuditLogger micrologger.Logger
+	CertSigner  spec.CertSigner
+	Logger      micrologger.Logger
+	PKIService  pki.Service
+
+	// Settings.
+
+	// Clients holds the credentials and authorization rules of all clients
+	// enrolling certificates. Requests of clients not listed are denied.
+	// Reenrolling certificates requires the client named by the common name
+	// of the certificate presented to be listed as well.
+	Clients []Client
+
+	// ClientCAs verifies the client certificates clients enrolling
+	// certificates authenticate with. Client certificates are not accepted
+	// for enrolling if empty. Certificates presented for reenrolling are
+	// verified with the root CA of the requested cluster instead.
+	ClientCAs *x509.CertPool
+
+	// Labels maps the EST labels requests are made for to the cluster IDs
+	// whose PKI backends serve them. Requests for labels not listed are
+	// rejected.
+	Labels map[string]string
+
+	// DefaultClusterID, if set, is the cluster ID whose PKI backend serves
+	// requests made without a label.
+	DefaultClusterID string
+
+	// TTL configures the time to live of enrolled certificates. This is a
+	// golang time string with the allowed units s, m and h.
+	TTL string
+
+	// AllowedDomains, AllowBareDomains, AllowedURISANs and RoleTTL configure
+	// the roles created in case a certificate is requested with
+	// organizations no role exists for yet.
+	AllowedDomains   []string
+	AllowBareDomains bool
+	AllowedURISANs   []string
+	RoleTTL          string
+
+	// Timeout bounds the requests to Vault made for a single EST request.
+	// Zero means no timeout.
+	Timeout time.Duration
+}
+
+// DefaultConfig provides a default configuration to create a new EST server.
+func DefaultConfig() Config {
+	newLogger, err := micrologger.New(micrologger.Config{IOWriter: os.Stderr})
+	if err != nil {
+		panic(err)
+	}
+
+	newConfig := Config{
+		// Dependencies.
+		AuditLogger: newLogger,
+		Logger:      newLogger,
+
+		// Settings.
+		TTL:     "8640h",
+		RoleTTL: "8640h",
+	}
+
+	return newConfig
+}
+
+// New creates a new configured EST server. It serves the EST operations
+// cacerts, simpleenroll and simplereenroll under /.well-known/est/ and is
+// meant to be served with TLS. Client certificates are requested by the TLS
+// server using tls.RequestClientCert without verifying them, since the server
+// verifies them depending on the operation, and clients can authenticate with
+// HTTP basic auth instead.
+func New(config Config) (http.Handler, error) {
+	// Dependencies.
+	if config.AuditLogger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "audit logger must not be empty")
+	}
+	if config.CertSigner == nil {
+		return nil, microerror.Maskf(invalidConfigError, "cert signer must not be empty")
+	}
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "logger must not be empty")
+	}
+	if config.PKIService == nil {
+		return nil, microerror.Maskf(invalidConfigError, "PKI service must not be empty")
+	}
+
+	// Settings.
+	if len(config.Labels) == 0 && config.DefaultClusterID == "" {
+		return nil, microerror.Maskf(invalidConfigError, "labels or default cluster ID must not be empty")
+	}
+	for label, clusterID := range config.Labels {
+		if label == "" || strings.Contains(label, "/") {
+			return nil, microerror.Maskf(invalidConfigError, "label '%s' must not be empty or contain '/'", label)
+		}
+		if clusterID == "" {
+			return nil, microerror.Maskf(invalidConfigError, "cluster ID of label '%s' must not be empty", label)
+		}
+	}
+	clients := map[string]Client{}
+	for _, c := range config.Clients {
+		err := c.Validate()
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+		if c.PasswordHash != "" {
+			_, err := bcrypt.Cost([]byte(c.PasswordHash))
+			if err != nil {
+				return nil, microerror.Maskf(invalidConfigError, "password hash of client '%s' is not a bcrypt hash: %s", c.Name, err)
+			}
+		}
+		if _, ok := clients[c.Name]; ok {
+			return nil, microerror.Maskf(invalidConfigError, "client '%s' must not be given more than once", c.Name)
+		}
+		clients[c.Name] = c
+	}
+
+	newServer := &server{
+		Config: config,
+
+		clients: clients,
+	}
+
+	return newServer, nil
+}
+
+type server struct {
+	Config
+
+	// clients holds the clients by name.
+	clients map[string]Client
+}
+
+// request describes an EST request for the audit log.
+type request struct {
+	Operation string
+	Label     string
+	ClusterID string
+	Client    string
+
+	// Details are the key value pairs describing the requested certificate
+	// or its outcome, e.g. the issued serial number.
+	Details []interface{}
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	req := &request{}
+
+	body, err := s.handle(r, req)
+
+	status := http.StatusOK
+	if err != nil {
+		status = httpStatus(err)
+		message := http.StatusText(status)
+		if status < http.StatusInternalServerError {
+			message = microerror.Pretty(err, false)
+		} else {
+			s.Logger.LogCtx(r.Context(), "level", "error", "message", "cannot handle EST request", "operation", req.Operation, "cluster_id", req.ClusterID, "error", microerror.Pretty(err, false))
+		}
+		if status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`"`)
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		body = []byte(message + "\n")
+	} else {
+		w.Header().Set("Content-Type", "application/pkcs7-mime; smime-type=certs-only")
+		w.Header().Set("Content-Transfer-Encoding", "base64")
+	}
+
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		s.Logger.LogCtx(r.Context(), "level", "warning", "message", "cannot write EST response", "error", microerror.Pretty(err, false))
+	}
+
+	metrics.ServerRequests.WithLabelValues("est", req.Operation, strconv.Itoa(status)).Inc()
+
+	entry := []interface{}{
+		"level", "info",
+		"message", "EST request",
+		"operation", req.Operation,
+		"client", req.Client,
+		"label", req.Label,
+		"cluster_id", req.ClusterID,
+		"duration", time.Since(start).String(),
+		"method", r.Method,
+		"path", r.URL.Path,
+		"remote_addr", r.RemoteAddr,
+		"status", status,
+	}
+	entry = append(entry, req.Details...)
+	if err != nil {
+		entry = append(entry, "error", microerror.Pretty(err, false))
+	}
+	s.AuditLogger.LogCtx(r.Context(), entry...)
+}
+
+// handle routes and executes the given EST request and returns the base64
+// encoded response body. The request is described for the audit log as far
+// as it got.
+func (s *server) handle(r *http.Request, req *request) ([]byte, error) {
+	if !strings.HasPrefix(r.URL.Path, pathPrefix) {
+		return nil, microerror.Maskf(notFoundError, "path '%s' not found", r.URL.Path)
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, pathPrefix), "/")
+	var label string
+	switch len(parts) {
+	case 1:
+	case 2:
+		label = parts[0]
+		if label == "" {
+			return nil, microerror.Maskf(notFoundError, "path '%s' not found", r.URL.Path)
+		}
+	default:
+		return nil, microerror.Maskf(notFoundError, "path '%s' not found", r.URL.Path)
+	}
+	operation := parts[len(parts)-1]
+	method, ok := methods[operation]
+	if !ok {
+		return nil, microerror.Maskf(notFoundError, "operation '%s' is not supported", operation)
+	}
+	req.Operation = operation
+	req.Label = label
+
+	clusterID, err := s.clusterID(label)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	req.ClusterID = clusterID
+
+	if r.Method != method {
+		return nil, microerror.Maskf(methodNotAllowedError, "method %s not allowed for '%s', use %s", r.Method, r.URL.Path, method)
+	}
+
+	ctx, cancel := s.withTimeout(r.Context())
+	defer cancel()
+
+	switch req.Operation {
+	case operationCACerts:
+		return s.caCerts(ctx, req)
+	case operationSimpleEnroll:
+		return s.simpleEnroll(ctx, req, r)
+	default:
+		return s.simpleReenroll(ctx, req, r)
+	}
+}
+
+// clusterID returns the cluster ID the given label is mapped to, or the
+// default cluster ID in case no label is given.
+func (s *server) clusterID(label string) (string, error) {
+	if label == "" {
+		if s.DefaultClusterID == "" {
+			return "", microerror.Maskf(notFoundError, "label must not be empty")
+		}
+		return s.DefaultClusterID, nil
+	}
+
+	clusterID, ok := s.Labels[label]
+	if !ok {
+		return "", microerror.Maskf(notFoundError, "label '%s' not found", label)
+	}
+
+	return clusterID, nil
+}
+
+// authenticate returns the client identified by the HTTP basic auth
+// credentials of the given request, or else by its verified client
+// certificate. The name is recorded for the audit log even if the client is
+// unknown.
+func (s *server) authenticate(r *http.Request, req *request) (Client, error) {
+	name, password, ok := r.BasicAuth()
+	if ok {
+		req.Client = name
+		client, ok := s.clients[name]
+		if !ok || client.PasswordHash == "" {
+			return Client{}, microerror.Maskf(unauthenticatedError, "invalid credentials of client '%s'", name)
+		}
+		err := bcrypt.CompareHashAndPassword([]byte(client.PasswordHash), []byte(password))
+		if err != nil {
+			return Client{}, microerror.Maskf(unauthenticatedError, "invalid credentials of client '%s'", name)
+		}
+
+		return client, nil
+	}
+
+	// Only the dedicated client CAs identify clients by certificate. Root
+	// CAs of clusters must not, since any certificate they issue could
+	// otherwise claim the name of a client.
+	if s.ClientCAs == nil {
+		return Client{}, microerror.Maskf(unauthenticatedError, "basic auth credentials required")
+	}
+	cert, err := clientCertificate(r, s.ClientCAs)
+	if err != nil {
+		return Client{}, microerror.Mask(err)
+	}
+
+	return s.client(cert, req)
+}
+
+// client returns the client named by the common name of the given verified
+// client certificate.
+func (s *server) client(cert *x509.Certificate, req *request) (Client, error) {
+	name := cert.Subject.CommonName
+	req.Client = name
+	client, ok := s.clients[name]
+	if !ok {
+		return Client{}, microerror.Maskf(notAuthorizedError, "client '%s' is unknown", name)
+	}
+
+	return client, nil
+}
+
+func (s *server) caCerts(ctx context.Context, req *request) ([]byte, error) {
+	// The CA certificates are public, so that they are returned without
+	// authentication, see RFC 7030 section 4.1.1.
+	ca, err := s.PKIService.CAWithContext(ctx, req.ClusterID)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	req.Details = append(req.Details, "serial_number", ca.SerialNumber)
+
+	caCert, err := parseCertificate(ca.Certificate)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	b, err := encodeCertsOnly([][]byte{caCert.Raw})
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return encodeBase64(b), nil
+}
+
+func (s *server) simpleEnroll(ctx context.Context, req *request, r *http.Request) ([]byte, error) {
+	client, err := s.authenticate(r, req)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	csr, err := decodeCSR(r)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	n := apiserver.CSRNames(csr)
+	req.Details = append(req.Details, "common_name", n.CommonName, "alt_names", strings.Join(n.AltNames, ","), "organizations", strings.Join(n.Organizations, ","))
+
+	err = client.AuthorizeCluster(req.ClusterID)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	err = client.AuthorizeNames(n)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return s.sign(ctx, req, csr)
+}
+
+func (s *server) simpleReenroll(ctx context.Context, req *request, r *http.Request) ([]byte, error) {
+	// Reenrolling renews the certificate the client authenticates with, see
+	// RFC 7030 section 4.2.2. It must be issued by the CA of the requested
+	// cluster and not be revoked, and the client it names must still be
+	// authorized for the cluster and the names of the certificate.
+	ca, err := s.PKIService.CAWithContext(ctx, req.ClusterID)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	caCert, err := parseCertificate(ca.Certificate)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	cert, err := clientCertificate(r, roots)
+	if IsNotAuthorized(err) {
+		return nil, microerror.Maskf(notAuthorizedError, "client certificate is not issued by the CA of cluster ID '%s'", req.ClusterID)
+	} else if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	req.Client = cert.Subject.CommonName
+
+	csr, err := decodeCSR(r)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	n := apiserver.CSRNames(csr)
+	req.Details = append(req.Details, "common_name", n.CommonName, "alt_names", strings.Join(n.AltNames, ","), "organizations", strings.Join(n.Organizations, ","))
+
+	crl, err := s.PKIService.CRLWithContext(ctx, req.ClusterID)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	serialNumber := pki.FormatSerialNumber(cert.SerialNumber.Bytes())
+	for _, revoked := range crl.RevokedSerialNumbers {
+		if revoked == serialNumber {
+			return nil, microerror.Maskf(notAuthorizedError, "client certificate with serial number %s is revoked", serialNumber)
+		}
+	}
+
+	client, err := s.client(cert, req)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	err = client.AuthorizeCluster(req.ClusterID)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	err = client.AuthorizeNames(n)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	if csr.Subject.String() != cert.Subject.String() || !equal(altNames(csr.DNSNames, csr.EmailAddresses, csr.IPAddresses, csr.URIs), altNames(cert.DNSNames, cert.EmailAddresses, cert.IPAddresses, cert.URIs)) {
+		return nil, microerror.Maskf(notAuthorizedError, "subject and alt names of the CSR must be the same as the ones of the client certificate")
+	}
+
+	return s.sign(ctx, req, csr)
+}
+
+// sign signs the given CSR for the cluster of the given request and returns
+// the issued certificate as base64 encoded certs-only response.
+func (s *server) sign(ctx context.Context, req *request, csr *x509.CertificateRequest) ([]byte, error) {
+	newSignConfig := spec.SignConfig{
+		ClusterID: req.ClusterID,
+		CSR:       string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr.Raw})),
+		TTL:       s.TTL,
+
+		AllowedDomains:   s.AllowedDomains,
+		AllowBareDomains: s.AllowBareDomains,
+		AllowedURISANs:   s.AllowedURISANs,
+		RoleTTL:          s.RoleTTL,
+	}
+	newSignResponse, err := s.CertSigner.SignWithContext(ctx, newSignConfig)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	req.Details = append(req.Details, "serial_number", newSignResponse.SerialNumber)
+
+	cert, err := parseCertificate(newSignResponse.Certificate)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	b, err := encodeCertsOnly([][]byte{cert.Raw})
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return encodeBase64(b), nil
+}
+
+func (s *server) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.Timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, s.Timeout)
+}
+
+// clientCertificate returns the client certificate of the given request
+// after verifying it with the given root CAs.
+func clientCertificate(r *http.Request, roots *x509.CertPool) (*x509.Certificate, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil, microerror.Maskf(unauthenticatedError, "client certificate or basic auth credentials required")
+	}
+
+	cert := r.TLS.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, c := range r.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(c)
+	}
+	verifyOptions := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	_, err := cert.Verify(verifyOptions)
+	if err != nil {
+		return nil, microerror.Maskf(notAuthorizedError, "client certificate of '%s' cannot be verified: %s", cert.Subject.CommonName, err)
+	}
+
+	return cert, nil
+}
+
+// decodeCSR decodes the base64 encoded DER CSR in the body of the given
+// request, see RFC 7030 section 4.2.1.
+func decodeCSR(r *http.Request) (*x509.CertificateRequest, error) {
+	data, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxBodySize))
+	if err != nil {
+		return nil, microerror.Maskf(invalidRequestError, "cannot read request body: %s", err)
+	}
+
+	der, err := decodeBase64(data)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, microerror.Maskf(invalidRequestError, "cannot parse CSR: %s", err)
+	}
+
+	return csr, nil
+}
+
+func parseCertificate(certificate string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certificate))
+	if block == nil {
+		return nil, microerror.Maskf(invalidConfigError, "certificate must be PEM encoded")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return cert, nil
+}
+
+// altNames returns the given subject alternative names as sorted strings, so
+// that the ones of a CSR and a certificate can be compared.
+func altNames(dnsNames, emailAddresses []string, ipAddresses []net.IP, uris []*url.URL) []string {
+	var names []string
+	for _, d := range dnsNames {
+		names = append(names, "dns:"+d)
+	}
+	for _, e := range emailAddresses {
+		names = append(names, "email:"+e)
+	}
+	for _, ip := range ipAddresses {
+		names = append(names, "ip:"+ip.String())
+	}
+	for _, u := range uris {
+		names = append(names, "uri:"+u.String())
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// httpStatus maps the given error to the HTTP status code of the response,
+// falling back to the mapping of the API server.
+func httpStatus(err error) int {
+	switch {
+	case IsInvalidRequest(err):
+		return http.StatusBadRequest
+	case IsUnauthenticated(err):
+		return http.StatusUnauthorized
+	case IsNotAuthorized(err):
+		return http.StatusForbidden
+	case IsNotFound(err):
+		return http.StatusNotFound
+	case IsMethodNotAllowed(err):
+		return http.StatusMethodNotAllowed
+	case errors.Is(err, context.Canceled):
+		// The client went away, nobody receives the response.
+		return http.StatusServiceUnavailable
+	}
+
+	return apiserver.HTTPStatus(err)
+}
@@ -0,0 +1,564 @@
+package estserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	"golang.org/x/crypto/bcrypt"
+
+	apiserver "github.com/giantswarm/certctl/v2/service/api-server"
+	"github.com/giantswarm/certctl/v2/service/internal/testca"
+	"github.com/giantswarm/certctl/v2/service/pki"
+)
+
+func newTestCA(t *testing.T, commonName string) *testca.CA {
+	ca, err := testca.New(commonName)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return ca
+}
+
+// mustSign signs the given CSR with the given CA, failing the test on errors.
+func mustSign(t *testing.T, ca *testca.CA, csr *x509.CertificateRequest, serialNumber int64) *x509.Certificate {
+	cert, err := ca.Sign(csr, serialNumber)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return cert
+}
+
+// testPKIService returns the root CAs of the test clusters.
+type testPKIService struct {
+	pki.Service
+
+	cas map[string]*testca.CA
+}
+
+func (s *testPKIService) CAWithContext(ctx context.Context, clusterID string) (pki.CA, error) {
+	ca := s.cas[clusterID]
+
+	newCA := pki.CA{
+		Certificate:  ca.PEM(),
+		CommonName:   ca.Cert.Subject.CommonName,
+		SerialNumber: pki.FormatSerialNumber(ca.Cert.SerialNumber.Bytes()),
+	}
+
+	return newCA, nil
+}
+
+func (s *testPKIService) CRLWithContext(ctx context.Context, clusterID string) (pki.CRL, error) {
+	newCRL := pki.CRL{
+		RevokedSerialNumbers: s.cas[clusterID].Revoked(),
+	}
+
+	return newCRL, nil
+}
+
+// estClient is a minimal EST client as used by devices enrolling
+// certificates, see RFC 7030 section 4.
+type estClient struct {
+	t      *testing.T
+	url    string
+	client *http.Client
+
+	// username and password, if set, are sent using HTTP basic auth.
+	username string
+	password string
+}
+
+// withCertificate returns a copy of the client authenticating with the given
+// client certificate.
+func (c estClient) withCertificate(cert *x509.Certificate, key *ecdsa.PrivateKey) estClient {
+	transport := c.client.Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.Certificates = []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key, Leaf: cert}}
+	c.client = &http.Client{Transport: transport}
+
+	return c
+}
+
+func (c estClient) withBasicAuth(username, password string) estClient {
+	c.username = username
+	c.password = password
+
+	return c
+}
+
+func (c estClient) cacerts(label string) ([]*x509.Certificate, int) {
+	return c.do(http.MethodGet, label, operationCACerts, nil)
+}
+
+func (c estClient) simpleEnroll(label string, csr []byte) ([]*x509.Certificate, int) {
+	return c.do(http.MethodPost, label, operationSimpleEnroll, csr)
+}
+
+func (c estClient) simpleReenroll(label string, csr []byte) ([]*x509.Certificate, int) {
+	return c.do(http.MethodPost, label, operationSimpleReenroll, csr)
+}
+
+// do requests the given EST operation and returns the certificates of a
+// successful response together with the status code.
+func (c estClient) do(method, label, operation string, csr []byte) ([]*x509.Certificate, int) {
+	url := c.url + pathPrefix + operation
+	if label != "" {
+		url = c.url + pathPrefix + label + "/" + operation
+	}
+
+	var body io.Reader
+	if csr != nil {
+		body = bytes.NewReader(encodeBase64(csr))
+	}
+	r, err := http.NewRequest(method, url, body)
+	if err != nil {
+		c.t.Fatalf("expected no error, got %#v", err)
+	}
+	if csr != nil {
+		r.Header.Set("Content-Type", "application/pkcs10")
+		r.Header.Set("Content-Transfer-Encoding", "base64")
+	}
+	if c.username != "" {
+		r.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		c.t.Fatalf("expected no error, got %#v", err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatalf("expected no error, got %#v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode
+	}
+
+	if resp.Header.Get("Content-Type") != "application/pkcs7-mime; smime-type=certs-only" {
+		c.t.Fatalf("expected certs-only content type, got %q", resp.Header.Get("Content-Type"))
+	}
+	der, err := decodeBase64(b)
+	if err != nil {
+		c.t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return decodeCertsOnly(c.t, der), resp.StatusCode
+}
+
+// decodeCertsOnly returns the certificates of the given DER encoded PKCS#7
+// certs-only structure.
+func decodeCertsOnly(t *testing.T, der []byte) []*x509.Certificate {
+	var ci contentInfo
+	_, err := asn1.Unmarshal(der, &ci)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		t.Fatalf("expected signed data, got %s", ci.ContentType)
+	}
+
+	var sd signedData
+	_, err = asn1.Unmarshal(ci.Content.Bytes, &sd)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return certs
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := testca.NewKey()
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return key
+}
+
+func newCSR(t *testing.T, key *ecdsa.PrivateKey, commonName string, dnsNames ...string) []byte {
+	der, err := testca.NewCSR(key, commonName, dnsNames...)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return der
+}
+
+func mustParseCSR(t *testing.T, der []byte) *x509.CertificateRequest {
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return csr
+}
+
+// newTestServer starts an EST server with TLS for the clusters 'routers',
+// mapped to the label 'routers' and used by default, and 'switches', mapped
+// to the label 'switches'. It returns an EST client without credentials and
+// the CAs of the clusters and client certificates.
+func newTestServer(t *testing.T) (estClient, map[string]*testca.CA, *testca.CA) {
+	cas := map[string]*testca.CA{
+		"routers":  newTestCA(t, "routers CA"),
+		"switches": newTestCA(t, "switches CA"),
+	}
+	clientCA := newTestCA(t, "client CA")
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	config := DefaultConfig()
+	config.AuditLogger = microloggertest.New()
+	config.Logger = microloggertest.New()
+	config.CertSigner = &testca.CertSigner{CAs: cas}
+	config.PKIService = &testPKIService{cas: cas}
+	config.Clients = []Client{
+		{
+			Client: apiserver.Client{
+				Name:       "provisioner",
+				ClusterIDs: []string{"routers"},
+				Domains:    []string{"*.routers.example.com"},
+			},
+			PasswordHash: string(passwordHash),
+		},
+		{
+			Client: apiserver.Client{
+				Name:       "operator",
+				ClusterIDs: []string{"*"},
+				Domains:    []string{"*"},
+			},
+		},
+		{
+			Client: apiserver.Client{
+				Name:       "r1.routers.example.com",
+				ClusterIDs: []string{"routers"},
+				Domains:    []string{"r1.routers.example.com"},
+			},
+		},
+	}
+	config.Labels = map[string]string{
+		"routers":  "routers",
+		"switches": "switches",
+	}
+	config.DefaultClusterID = "routers"
+	config.ClientCAs = x509.NewCertPool()
+	config.ClientCAs.AddCert(clientCA.Cert)
+
+	handler, err := New(config)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	// Client certificates are verified by the EST server, since devices
+	// reenroll with certificates issued by the cluster CAs.
+	s := httptest.NewUnstartedServer(handler)
+	s.TLS = &tls.Config{
+		ClientAuth: tls.RequestClientCert,
+	}
+	s.StartTLS()
+	t.Cleanup(s.Close)
+
+	c := estClient{
+		t:      t,
+		url:    s.URL,
+		client: s.Client(),
+	}
+
+	return c, cas, clientCA
+}
+
+func Test_EST_CACerts(t *testing.T) {
+	c, cas, _ := newTestServer(t)
+
+	testCases := []struct {
+		name           string
+		label          string
+		expectedStatus int
+		expectedCA     *testca.CA
+	}{
+		{name: "default label", label: "", expectedStatus: http.StatusOK, expectedCA: cas["routers"]},
+		{name: "label", label: "switches", expectedStatus: http.StatusOK, expectedCA: cas["switches"]},
+		{name: "unknown label", label: "firewalls", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			certs, status := c.cacerts(tc.label)
+			if status != tc.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tc.expectedStatus, status)
+			}
+			if tc.expectedCA == nil {
+				return
+			}
+			if len(certs) != 1 || !certs[0].Equal(tc.expectedCA.Cert) {
+				t.Fatalf("expected CA %q, got %d certificates", tc.expectedCA.Cert.Subject.CommonName, len(certs))
+			}
+		})
+	}
+}
+
+func Test_EST_SimpleEnroll(t *testing.T) {
+	c, cas, clientCA := newTestServer(t)
+
+	operatorKey := newKey(t)
+	operatorCert := mustSign(t, clientCA, mustParseCSR(t, newCSR(t, operatorKey, "operator")), 2)
+	strangerKey := newKey(t)
+	strangerCert := mustSign(t, clientCA, mustParseCSR(t, newCSR(t, strangerKey, "stranger")), 3)
+	// Certificates issued by cluster CAs must not identify clients, even
+	// though they are accepted for reenrolling.
+	impostorKey := newKey(t)
+	impostorCert := mustSign(t, cas["routers"], mustParseCSR(t, newCSR(t, impostorKey, "operator")), 4)
+
+	testCases := []struct {
+		name           string
+		client         estClient
+		label          string
+		commonName     string
+		expectedStatus int
+		expectedCA     *testca.CA
+	}{
+		{
+			name:           "basic auth",
+			client:         c.withBasicAuth("provisioner", "secret"),
+			commonName:     "r1.routers.example.com",
+			expectedStatus: http.StatusOK,
+			expectedCA:     cas["routers"],
+		},
+		{
+			name:           "basic auth with label",
+			client:         c.withBasicAuth("provisioner", "secret"),
+			label:          "routers",
+			commonName:     "r2.routers.example.com",
+			expectedStatus: http.StatusOK,
+			expectedCA:     cas["routers"],
+		},
+		{
+			name:           "client certificate",
+			client:         c.withCertificate(operatorCert, operatorKey),
+			label:          "switches",
+			commonName:     "s1.switches.example.com",
+			expectedStatus: http.StatusOK,
+			expectedCA:     cas["switches"],
+		},
+		{
+			name:           "no credentials",
+			client:         c,
+			commonName:     "r1.routers.example.com",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "wrong password",
+			client:         c.withBasicAuth("provisioner", "guess"),
+			commonName:     "r1.routers.example.com",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "basic auth disabled",
+			client:         c.withBasicAuth("operator", ""),
+			commonName:     "r1.routers.example.com",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "unknown client certificate",
+			client:         c.withCertificate(strangerCert, strangerKey),
+			commonName:     "r1.routers.example.com",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "client certificate issued by cluster CA",
+			client:         c.withCertificate(impostorCert, impostorKey),
+			label:          "switches",
+			commonName:     "s1.switches.example.com",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "cluster not allowed",
+			client:         c.withBasicAuth("provisioner", "secret"),
+			label:          "switches",
+			commonName:     "s1.switches.example.com",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "domain not allowed",
+			client:         c.withBasicAuth("provisioner", "secret"),
+			commonName:     "r1.switches.example.com",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "unknown label",
+			client:         c.withBasicAuth("provisioner", "secret"),
+			label:          "firewalls",
+			commonName:     "r1.routers.example.com",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			csr := newCSR(t, newKey(t), tc.commonName, tc.commonName)
+
+			certs, status := tc.client.simpleEnroll(tc.label, csr)
+			if status != tc.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tc.expectedStatus, status)
+			}
+			if tc.expectedCA == nil {
+				return
+			}
+			if len(certs) != 1 {
+				t.Fatalf("expected 1 certificate, got %d", len(certs))
+			}
+			if certs[0].Subject.CommonName != tc.commonName {
+				t.Fatalf("expected common name %q, got %q", tc.commonName, certs[0].Subject.CommonName)
+			}
+			err := certs[0].CheckSignatureFrom(tc.expectedCA.Cert)
+			if err != nil {
+				t.Fatalf("expected certificate issued by %q, got %#v", tc.expectedCA.Cert.Subject.CommonName, err)
+			}
+		})
+	}
+}
+
+func Test_EST_SimpleReenroll(t *testing.T) {
+	c, cas, clientCA := newTestServer(t)
+
+	// Enroll a device certificate to be reenrolled.
+	deviceKey := newKey(t)
+	certs, status := c.withBasicAuth("provisioner", "secret").simpleEnroll("routers", newCSR(t, deviceKey, "r1.routers.example.com", "r1.routers.example.com"))
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+	}
+	deviceCert := certs[0]
+
+	operatorKey := newKey(t)
+	operatorCert := mustSign(t, clientCA, mustParseCSR(t, newCSR(t, operatorKey, "operator")), 2)
+
+	revokedKey := newKey(t)
+	revokedCert := mustSign(t, cas["routers"], mustParseCSR(t, newCSR(t, revokedKey, "r1.routers.example.com", "r1.routers.example.com")), 3)
+	cas["routers"].Revoke(revokedCert)
+
+	strangerKey := newKey(t)
+	strangerCert := mustSign(t, cas["routers"], mustParseCSR(t, newCSR(t, strangerKey, "r2.routers.example.com", "r2.routers.example.com")), 4)
+
+	testCases := []struct {
+		name           string
+		client         estClient
+		label          string
+		commonName     string
+		dnsNames       []string
+		expectedStatus int
+	}{
+		{
+			name:           "same names",
+			client:         c.withCertificate(deviceCert, deviceKey),
+			label:          "routers",
+			commonName:     "r1.routers.example.com",
+			dnsNames:       []string{"r1.routers.example.com"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "different common name",
+			client:         c.withCertificate(deviceCert, deviceKey),
+			label:          "routers",
+			commonName:     "r2.routers.example.com",
+			dnsNames:       []string{"r1.routers.example.com"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "additional alt name",
+			client:         c.withCertificate(deviceCert, deviceKey),
+			label:          "routers",
+			commonName:     "r1.routers.example.com",
+			dnsNames:       []string{"r1.routers.example.com", "r2.routers.example.com"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "other cluster",
+			client:         c.withCertificate(deviceCert, deviceKey),
+			label:          "switches",
+			commonName:     "r1.routers.example.com",
+			dnsNames:       []string{"r1.routers.example.com"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "revoked certificate",
+			client:         c.withCertificate(revokedCert, revokedKey),
+			label:          "routers",
+			commonName:     "r1.routers.example.com",
+			dnsNames:       []string{"r1.routers.example.com"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "unknown client",
+			client:         c.withCertificate(strangerCert, strangerKey),
+			label:          "routers",
+			commonName:     "r2.routers.example.com",
+			dnsNames:       []string{"r2.routers.example.com"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "certificate not issued by cluster CA",
+			client:         c.withCertificate(operatorCert, operatorKey),
+			label:          "routers",
+			commonName:     "operator",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "basic auth",
+			client:         c.withBasicAuth("provisioner", "secret"),
+			label:          "routers",
+			commonName:     "r1.routers.example.com",
+			dnsNames:       []string{"r1.routers.example.com"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			csr := newCSR(t, newKey(t), tc.commonName, tc.dnsNames...)
+
+			certs, status := tc.client.simpleReenroll(tc.label, csr)
+			if status != tc.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tc.expectedStatus, status)
+			}
+			if status != http.StatusOK {
+				return
+			}
+			if len(certs) != 1 {
+				t.Fatalf("expected 1 certificate, got %d", len(certs))
+			}
+			if certs[0].SerialNumber.Cmp(deviceCert.SerialNumber) == 0 {
+				t.Fatalf("expected new certificate, got serial number %s again", certs[0].SerialNumber)
+			}
+			err := certs[0].CheckSignatureFrom(cas["routers"].Cert)
+			if err != nil {
+				t.Fatalf("expected certificate issued by routers CA, got %#v", err)
+			}
+		})
+	}
+}
+
+func Test_EST_MethodNotAllowed(t *testing.T) {
+	c, _, _ := newTestServer(t)
+
+	_, status := c.withBasicAuth("provisioner", "secret").do(http.MethodGet, "", operationSimpleEnroll, nil)
+	if status != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status %d, got %d", http.StatusMethodNotAllowed, status)
+	}
+}
@@ -0,0 +1,20 @@
+package estserver
+
+import (
+	apiserver "github.com/giantswarm/certctl/v2/service/api-server"
+)
+
+// Client holds the credentials and authorization rules of a client enrolling
+// certificates. Clients authenticate either with a client certificate whose
+// common name is the client's name, or with HTTP basic auth using the
+// client's name and password. The authorization rules are the same as the
+// ones of API clients, while AllowRevoke has no effect since EST does not
+// revoke certificates.
+type Client struct {
+	apiserver.Client
+
+	// PasswordHash is the bcrypt hash of the password the client
+	// authenticates with using HTTP basic auth, as created by e.g.
+	// 'htpasswd -nB'. Basic auth is disabled for the client if empty.
+	PasswordHash string `json:"passwordHash"`
+}
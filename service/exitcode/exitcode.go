@@ -0,0 +1,173 @@
+package exitcode
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+	vaultclient "github.com/hashicorp/vault/api"
+
+	"github.com/giantswarm/certctl/v2/service/retry"
+)
+
+// Exit codes of certctl. They are part of the CLI's interface and must not
+// change once released.
+const (
+	// OK means the command succeeded.
+	OK = 0
+
+	// Unknown is used for all errors not classified any further.
+	Unknown = 1
+
+	// InvalidConfig means flags, env vars or arguments are invalid.
+	InvalidConfig = 2
+
+	// NotConfirmed means a destructive operation was not confirmed.
+	NotConfirmed = 3
+
+	// NotFound means something does not exist in Vault, e.g. a PKI backend,
+	// root CA, role, certificate or wrapped secret.
+	NotFound = 4
+
+	// Conflict means something already exists or does not match the existing
+	// state, e.g. a mounted PKI backend on restore or an already generated
+	// root CA which cannot be exported anymore.
+	Conflict = 5
+
+	// NotAllowed means a certificate request violates the constraints of the
+	// cluster's PKI role, e.g. a domain, IP SAN, URI SAN or TTL.
+	NotAllowed = 6
+
+	// PermissionDenied means Vault or a certctl server denied the request,
+	// e.g. due to a missing, expired or insufficiently privileged token or
+	// client certificate.
+	PermissionDenied = 7
+
+	// VaultUnavailable means Vault cannot be reached or is temporarily unable
+	// to serve requests, e.g. sealed, refusing connections or without active
+	// node.
+	VaultUnavailable = 8
+
+	// Timeout means the command did not finish within --timeout.
+	Timeout = 9
+
+	// InvalidData means data read from files or Vault is invalid, e.g. a
+	// corrupted backup archive, a wrong passphrase or a malformed
+	// certificate.
+	InvalidData = 10
+
+	// VaultError means Vault rejected the request for any other reason, e.g.
+	// a bad request.
+	VaultError = 11
+
+	// CheckFailed means the command ran, but found problems it was asked to
+	// report, e.g. inspect --check or tidy.
+	CheckFailed = 12
+)
+
+// kinds maps the kinds of the microerror errors of all certctl packages to
+// exit codes. Kinds are shared among packages, e.g. invalidConfigError. Every
+// kind must be listed, which is verified by the tests.
+var kinds = map[string]int{
+	"invalidClusterIDError": InvalidConfig,
+	"invalidConfigError":    InvalidConfig,
+	"invalidIDError":        InvalidConfig,
+	"notSupportedError":     InvalidConfig,
+
+	"notConfirmedError": NotConfirmed,
+
+	"accountDoesNotExistError":   NotFound,
+	"caNotFoundError":            NotFound,
+	"certificateNotFoundError":   NotFound,
+	"clusterNotFoundError":       NotFound,
+	"keyPairNotFoundError":       NotFound,
+	"notFoundError":              NotFound,
+	"notMountedError":            NotFound,
+	"roleNotFoundError":          NotFound,
+	"wrappedSecretNotFoundError": NotFound,
+
+	"alreadyMountedError":       Conflict,
+	"caMismatchError":           Conflict,
+	"caNotExportableError":      Conflict,
+	"clusterAlreadyExistsError": Conflict,
+	"orderNotReadyError":        Conflict,
+	"policyAlreadyExistsError":  Conflict,
+
+	"domainNotAllowedError":      NotAllowed,
+	"ipSANNotAllowedError":       NotAllowed,
+	"rejectedIdentifierError":    NotAllowed,
+	"ttlExceededError":           NotAllowed,
+	"unsupportedIdentifierError": NotAllowed,
+	"uriSANNotAllowedError":      NotAllowed,
+
+	"externalAccountRequiredError": PermissionDenied,
+	"notAuthorizedError":           PermissionDenied,
+	"unauthenticatedError":         PermissionDenied,
+	"unauthorizedError":            PermissionDenied,
+
+	"noHealthyVaultError": VaultUnavailable,
+
+	"badCSRError":                InvalidData,
+	"badNonceError":              InvalidData,
+	"badSignatureAlgorithmError": InvalidData,
+	"decryptionFailedError":      InvalidData,
+	"incorrectResponseError":     InvalidData,
+	"invalidArchiveError":        InvalidData,
+	"invalidCertificateError":    InvalidData,
+	"invalidCSRError":            InvalidData,
+	"invalidRequestError":        InvalidData,
+	"invalidStoreError":          InvalidData,
+	"malformedError":             InvalidData,
+	"methodNotAllowedError":      InvalidData,
+	"scanFailedError":            InvalidData,
+	"uriSANMismatchError":        InvalidData,
+
+	"wrappingNotSupportedError": VaultError,
+}
+
+// FromError returns the exit code certctl exits with for the given error. It
+// is OK for nil errors and Unknown for errors not classified any further.
+func FromError(err error) int {
+	if err == nil {
+		return OK
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Timeout
+	}
+
+	var microError *microerror.Error
+	if errors.As(err, &microError) {
+		code, ok := kinds[microError.Kind]
+		if ok {
+			return code
+		}
+	}
+
+	var responseError *vaultclient.ResponseError
+	if errors.As(err, &responseError) {
+		switch responseError.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return PermissionDenied
+		case http.StatusNotFound:
+			return NotFound
+		}
+	}
+
+	if retry.IsRetryable(err) {
+		return VaultUnavailable
+	}
+
+	if responseError != nil {
+		return VaultError
+	}
+
+	// Vault responds to requests for unmounted paths this way.
+	if strings.Contains(err.Error(), "no handler for route") {
+		return NotFound
+	}
+
+	return Unknown
+}
@@ -0,0 +1,220 @@
+package exitcode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/giantswarm/microerror"
+	vaultclient "github.com/hashicorp/vault/api"
+)
+
+// Test_kinds verifies that the kind of every microerror error defined by the
+// certctl packages is mapped to an exit code. The integration tests are not
+// part of certctl and thus skipped.
+func Test_kinds(t *testing.T) {
+	root := filepath.Join("..", "..")
+	fileSet := token.NewFileSet()
+
+	var found int
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(d.Name(), ".") || d.Name() == "integration" || d.Name() == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".go" || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+
+		file, err := parser.ParseFile(fileSet, path, nil, 0)
+		if err != nil {
+			return err
+		}
+
+		ast.Inspect(file, func(n ast.Node) bool {
+			kind, ok := errorKind(n)
+			if !ok {
+				return true
+			}
+			found++
+
+			if _, ok := kinds[kind]; !ok {
+				t.Errorf("expected kind %s of %s to be mapped to an exit code", kind, fileSet.Position(n.Pos()))
+			}
+			return true
+		})
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	if found == 0 {
+		t.Fatalf("expected error kinds to be found")
+	}
+}
+
+// errorKind returns the kind of the given node in case it is a
+// microerror.Error composite literal.
+func errorKind(n ast.Node) (string, bool) {
+	lit, ok := n.(*ast.CompositeLit)
+	if !ok {
+		return "", false
+	}
+	sel, ok := lit.Type.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Error" {
+		return "", false
+	}
+	if x, ok := sel.X.(*ast.Ident); !ok || x.Name != "microerror" {
+		return "", false
+	}
+
+	for _, e := range lit.Elts {
+		kv, ok := e.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		if key, ok := kv.Key.(*ast.Ident); !ok || key.Name != "Kind" {
+			continue
+		}
+		value, ok := kv.Value.(*ast.BasicLit)
+		if !ok || value.Kind != token.STRING {
+			continue
+		}
+		kind, err := strconv.Unquote(value.Value)
+		if err != nil {
+			continue
+		}
+		return kind, true
+	}
+
+	return "", false
+}
+
+func Test_FromError(t *testing.T) {
+	testCases := []struct {
+		name         string
+		err          error
+		expectedCode int
+	}{
+		{
+			name:         "nil",
+			err:          nil,
+			expectedCode: OK,
+		},
+		{
+			name:         "unknown error",
+			err:          errors.New("foo"),
+			expectedCode: Unknown,
+		},
+		{
+			name:         "unknown kind",
+			err:          microerror.Mask(&microerror.Error{Kind: "fooError"}),
+			expectedCode: Unknown,
+		},
+		{
+			name:         "deadline exceeded",
+			err:          fmt.Errorf("issuing: %w", context.DeadlineExceeded),
+			expectedCode: Timeout,
+		},
+		{
+			name:         "invalid config",
+			err:          microerror.Maskf(&microerror.Error{Kind: "invalidConfigError"}, "foo"),
+			expectedCode: InvalidConfig,
+		},
+		{
+			name:         "not confirmed",
+			err:          microerror.Mask(&microerror.Error{Kind: "notConfirmedError"}),
+			expectedCode: NotConfirmed,
+		},
+		{
+			name:         "cluster not found",
+			err:          microerror.Mask(&microerror.Error{Kind: "clusterNotFoundError"}),
+			expectedCode: NotFound,
+		},
+		{
+			name:         "already mounted",
+			err:          microerror.Mask(&microerror.Error{Kind: "alreadyMountedError"}),
+			expectedCode: Conflict,
+		},
+		{
+			name:         "domain not allowed",
+			err:          microerror.Mask(&microerror.Error{Kind: "domainNotAllowedError"}),
+			expectedCode: NotAllowed,
+		},
+		{
+			name:         "not authorized",
+			err:          microerror.Mask(&microerror.Error{Kind: "notAuthorizedError"}),
+			expectedCode: PermissionDenied,
+		},
+		{
+			name:         "no healthy vault",
+			err:          microerror.Mask(&microerror.Error{Kind: "noHealthyVaultError"}),
+			expectedCode: VaultUnavailable,
+		},
+		{
+			name:         "decryption failed",
+			err:          microerror.Mask(&microerror.Error{Kind: "decryptionFailedError"}),
+			expectedCode: InvalidData,
+		},
+		{
+			name:         "wrapping not supported",
+			err:          microerror.Mask(&microerror.Error{Kind: "wrappingNotSupportedError"}),
+			expectedCode: VaultError,
+		},
+		{
+			name:         "vault forbidden",
+			err:          microerror.Mask(&vaultclient.ResponseError{StatusCode: http.StatusForbidden}),
+			expectedCode: PermissionDenied,
+		},
+		{
+			name:         "vault unauthorized",
+			err:          &vaultclient.ResponseError{StatusCode: http.StatusUnauthorized},
+			expectedCode: PermissionDenied,
+		},
+		{
+			name:         "vault not found",
+			err:          &vaultclient.ResponseError{StatusCode: http.StatusNotFound},
+			expectedCode: NotFound,
+		},
+		{
+			name:         "vault unavailable",
+			err:          &vaultclient.ResponseError{StatusCode: http.StatusServiceUnavailable},
+			expectedCode: VaultUnavailable,
+		},
+		{
+			name:         "vault bad request",
+			err:          &vaultclient.ResponseError{StatusCode: http.StatusBadRequest},
+			expectedCode: VaultError,
+		},
+		{
+			name:         "unmounted path",
+			err:          errors.New("Error making API request. Code: 400. Errors: * no handler for route 'pki-foo/cert/ca'"),
+			expectedCode: NotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code := FromError(tc.err)
+			if code != tc.expectedCode {
+				t.Fatalf("expected exit code %d, got %d", tc.expectedCode, code)
+			}
+		})
+	}
+}
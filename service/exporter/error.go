@@ -0,0 +1,32 @@
+package exporter
+
+import (
+	"github.com/giantswarm/microerror"
+)
+
+var invalidConfigError = &microerror.Error{
+	Kind: "invalidConfigError",
+}
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return microerror.Cause(err) == invalidConfigError
+}
+
+var invalidCertificateError = &microerror.Error{
+	Kind: "invalidCertificateError",
+}
+
+// IsInvalidCertificate asserts invalidCertificateError.
+func IsInvalidCertificate(err error) bool {
+	return microerror.Cause(err) == invalidCertificateError
+}
+
+var scanFailedError = &microerror.Error{
+	Kind: "scanFailedError",
+}
+
+// IsScanFailed asserts scanFailedError.
+func IsScanFailed(err error) bool {
+	return microerror.Cause(err) == scanFailedError
+}
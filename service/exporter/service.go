@@ -0,0 +1,315 @@
+package exporter
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/giantswarm/certctl/v2/service/metrics"
+	"github.com/giantswarm/certctl/v2/service/pki"
+)
+
+const (
+	sourceFile  = "file"
+	sourceVault = "vault"
+)
+
+// Config represents the configuration used to create a new exporter service.
+type Config struct {
+	// Dependencies.
+
+	Logger micrologger.Logger
+
+	// PKIService is used to scan the root CAs of all clusters set up in
+	// Vault. In case it is nil, only files are scanned.
+	PKIService pki.Service
+
+	// Settings.
+
+	// ClusterID is the cluster ID certificates read from files are labelled
+	// with. It may be empty.
+	ClusterID string
+
+	// Files are the paths of PEM encoded certificate files to scan. Glob
+	// patterns like /etc/kubernetes/ssl/*.pem are expanded on every scan. All
+	// certificates of a file are scanned, e.g. of a CA bundle.
+	Files []string
+}
+
+// DefaultConfig provides a default configuration to create a new exporter
+// service.
+func DefaultConfig() Config {
+	newLogger, err := micrologger.New(micrologger.Config{IOWriter: os.Stderr})
+	if err != nil {
+		panic(err)
+	}
+
+	newConfig := Config{
+		// Dependencies.
+		Logger: newLogger,
+	}
+
+	return newConfig
+}
+
+// New creates a new configured exporter service.
+func New(config Config) (Service, error) {
+	// Dependencies.
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "logger must not be empty")
+	}
+
+	// Settings.
+	if config.PKIService == nil && len(config.Files) == 0 {
+		return nil, microerror.Maskf(invalidConfigError, "files or PKI service must not be empty")
+	}
+	for _, f := range config.Files {
+		_, err := filepath.Match(f, "")
+		if err != nil {
+			return nil, microerror.Maskf(invalidConfigError, "file pattern '%s' is invalid: %s", f, err)
+		}
+	}
+
+	newService := &service{
+		Config: config,
+
+		exported: map[string]gauge{},
+	}
+
+	return newService, nil
+}
+
+type service struct {
+	Config
+
+	// exported holds the gauges set by the previous scan, keyed by their
+	// joined label values.
+	exported map[string]gauge
+}
+
+// certificate is a scanned certificate along with where it was read from.
+type certificate struct {
+	Source    string
+	Path      string
+	ClusterID string
+	Cert      *x509.Certificate
+}
+
+// gauge is an exported metrics.CertificateExpiry gauge along with the source
+// its certificate was read from.
+type gauge struct {
+	Source string
+	Labels prometheus.Labels
+}
+
+// failed records the sources a scan failed to read, so that the gauges of
+// their certificates are kept.
+type failed struct {
+	// Patterns are the file patterns not matching any file.
+	Patterns []string
+	// Paths are the file paths and Vault mount paths which could not be read.
+	Paths map[string]bool
+	// Vault is true in case the PKI backends could not be listed.
+	Vault bool
+}
+
+// Keeps returns whether the given gauge has to be kept, since the source of
+// its certificate could not be read.
+func (f failed) Keeps(g gauge) bool {
+	path := g.Labels["path"]
+
+	switch g.Source {
+	case sourceFile:
+		for _, pattern := range f.Patterns {
+			// Patterns are validated in New, so errors cannot occur here.
+			if ok, _ := filepath.Match(pattern, path); ok {
+				return true
+			}
+		}
+	case sourceVault:
+		if f.Vault {
+			return true
+		}
+	}
+
+	return f.Paths[path]
+}
+
+func (s *service) Scan(ctx context.Context) error {
+	var certificates []certificate
+	var failures []string
+	scanErrors := map[string]int{}
+	f := failed{Paths: map[string]bool{}}
+
+	for _, pattern := range s.Files {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+		if len(paths) == 0 {
+			scanErrors[sourceFile]++
+			f.Patterns = append(f.Patterns, pattern)
+			failures = append(failures, pattern+": no such file")
+			continue
+		}
+
+		for _, path := range paths {
+			certs, err := readCertificates(path)
+			if err != nil {
+				scanErrors[sourceFile]++
+				f.Paths[path] = true
+				failures = append(failures, path+": "+err.Error())
+				continue
+			}
+
+			for _, c := range certs {
+				certificates = append(certificates, certificate{Source: sourceFile, Path: path, ClusterID: s.ClusterID, Cert: c})
+			}
+		}
+	}
+
+	if s.PKIService != nil {
+		mounts, err := s.PKIService.ListWithContext(ctx)
+		if err != nil {
+			scanErrors[sourceVault]++
+			f.Vault = true
+			failures = append(failures, "listing PKI backends: "+err.Error())
+		}
+
+		for _, m := range mounts {
+			ca, err := s.PKIService.CAWithContext(ctx, m.ClusterID)
+			if pki.IsCANotFound(err) {
+				// The PKI backend is mounted, but its root CA is not
+				// generated yet, so there is nothing to expire.
+				continue
+			} else if err != nil {
+				scanErrors[sourceVault]++
+				f.Paths[m.Path] = true
+				failures = append(failures, m.Path+": "+err.Error())
+				continue
+			}
+
+			certs, err := parseCertificates([]byte(ca.Certificate))
+			if err != nil {
+				scanErrors[sourceVault]++
+				f.Paths[m.Path] = true
+				failures = append(failures, m.Path+": "+err.Error())
+				continue
+			}
+
+			for _, c := range certs {
+				certificates = append(certificates, certificate{Source: sourceVault, Path: m.Path, ClusterID: m.ClusterID, Cert: c})
+			}
+		}
+	}
+
+	s.export(certificates, f)
+
+	if len(s.Files) != 0 {
+		metrics.ExporterScanErrors.WithLabelValues(sourceFile).Add(float64(scanErrors[sourceFile]))
+		metrics.ExporterLastScanErrors.WithLabelValues(sourceFile).Set(float64(scanErrors[sourceFile]))
+	}
+	if s.PKIService != nil {
+		metrics.ExporterScanErrors.WithLabelValues(sourceVault).Add(float64(scanErrors[sourceVault]))
+		metrics.ExporterLastScanErrors.WithLabelValues(sourceVault).Set(float64(scanErrors[sourceVault]))
+	}
+
+	s.Logger.LogCtx(ctx, "level", "debug", "message", "scanned certificates", "certificates", len(certificates), "failures", len(failures))
+
+	if len(failures) != 0 {
+		return microerror.Maskf(scanFailedError, "%d certificate(s) could not be read: %s", len(failures), strings.Join(failures, "; "))
+	}
+
+	return nil
+}
+
+// export sets the gauges of the given certificates and removes the ones of
+// certificates not given anymore, unless their source failed to be read. In
+// case certificates share the same labels, the earliest expiry is exported.
+func (s *service) export(certificates []certificate, f failed) {
+	expiries := map[string]float64{}
+	current := map[string]gauge{}
+	for _, c := range certificates {
+		labels := prometheus.Labels{
+			"path":        c.Path,
+			"common_name": c.Cert.Subject.CommonName,
+			"issuer":      c.Cert.Issuer.CommonName,
+			"cluster_id":  c.ClusterID,
+		}
+		key := strings.Join([]string{labels["path"], labels["common_name"], labels["issuer"], labels["cluster_id"]}, "\x00")
+
+		expiry := float64(c.Cert.NotAfter.Unix())
+		if e, ok := expiries[key]; !ok || expiry < e {
+			expiries[key] = expiry
+		}
+		current[key] = gauge{Source: c.Source, Labels: labels}
+	}
+
+	for key, g := range current {
+		metrics.CertificateExpiry.With(g.Labels).Set(expiries[key])
+	}
+	for key, g := range s.exported {
+		if _, ok := current[key]; ok {
+			continue
+		}
+		if f.Keeps(g) {
+			current[key] = g
+			continue
+		}
+		metrics.CertificateExpiry.Delete(g.Labels)
+	}
+
+	s.exported = current
+}
+
+func readCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return certs, nil
+}
+
+// parseCertificates returns all certificates of the given PEM data. Other PEM
+// blocks, like private keys, are ignored, so that glob patterns may match
+// private key files as well.
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	var found bool
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		found = true
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+		certs = append(certs, c)
+	}
+
+	if !found {
+		return nil, microerror.Maskf(invalidCertificateError, "no PEM encoded data found")
+	}
+
+	return certs, nil
+}
@@ -0,0 +1,317 @@
+package exporter
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/giantswarm/certctl/v2/service/metrics"
+	"github.com/giantswarm/certctl/v2/service/pki"
+)
+
+// newCertificate returns a PEM encoded self-signed certificate with the given
+// common name expiring at the given time.
+func newCertificate(t *testing.T, commonName string, notAfter time.Time) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    notAfter.Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// expiries returns the exported certificate expiries of the given path by
+// common name.
+func expiries(t *testing.T, path string) map[string]float64 {
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	result := map[string]float64{}
+	for _, f := range families {
+		if f.GetName() != "certctl_certificate_expiry_timestamp_seconds" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["path"] == path {
+				result[labels["common_name"]] = m.GetGauge().GetValue()
+			}
+		}
+	}
+
+	return result
+}
+
+func writeFile(t *testing.T, path, data string) {
+	err := os.WriteFile(path, []byte(data), 0600)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+}
+
+type testPKIService struct {
+	pki.Service
+
+	listErr error
+	caErrs  map[string]error
+	mounts  []pki.Mount
+	cas     map[string]string
+}
+
+func (s *testPKIService) ListWithContext(ctx context.Context) ([]pki.Mount, error) {
+	if s.listErr != nil {
+		return nil, s.listErr
+	}
+	return s.mounts, nil
+}
+
+func (s *testPKIService) CAWithContext(ctx context.Context, clusterID string) (pki.CA, error) {
+	if err := s.caErrs[clusterID]; err != nil {
+		return pki.CA{}, err
+	}
+	return pki.CA{Certificate: s.cas[clusterID]}, nil
+}
+
+func Test_parseCertificates(t *testing.T) {
+	expiry := time.Now().Add(24 * time.Hour)
+	a := newCertificate(t, "a", expiry)
+	b := newCertificate(t, "b", expiry)
+	key := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte("key")}))
+
+	testCases := []struct {
+		name         string
+		data         string
+		expectedCNs  []string
+		errorMatcher func(error) bool
+	}{
+		{
+			name:        "single certificate",
+			data:        a,
+			expectedCNs: []string{"a"},
+		},
+		{
+			name:        "bundle",
+			data:        a + b,
+			expectedCNs: []string{"a", "b"},
+		},
+		{
+			name:        "private key is ignored",
+			data:        key + a,
+			expectedCNs: []string{"a"},
+		},
+		{
+			name:        "private key only",
+			data:        key,
+			expectedCNs: nil,
+		},
+		{
+			name:         "no PEM data",
+			data:         "foo",
+			errorMatcher: IsInvalidCertificate,
+		},
+		{
+			name:         "empty",
+			data:         "",
+			errorMatcher: IsInvalidCertificate,
+		},
+		{
+			name:         "invalid certificate",
+			data:         string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("foo")})),
+			errorMatcher: func(err error) bool { return err != nil },
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			certs, err := parseCertificates([]byte(tc.data))
+			if tc.errorMatcher != nil {
+				if !tc.errorMatcher(err) {
+					t.Fatalf("expected error to match, got %#v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+
+			if len(certs) != len(tc.expectedCNs) {
+				t.Fatalf("expected %d certificates, got %d", len(tc.expectedCNs), len(certs))
+			}
+			for i, c := range certs {
+				if c.Subject.CommonName != tc.expectedCNs[i] {
+					t.Fatalf("expected common name %q, got %q", tc.expectedCNs[i], c.Subject.CommonName)
+				}
+			}
+		})
+	}
+}
+
+func Test_Service_Scan_Files(t *testing.T) {
+	dir := t.TempDir()
+	expiry := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+
+	a := filepath.Join(dir, "a.pem")
+	b := filepath.Join(dir, "b.pem")
+	c := filepath.Join(dir, "c.crt")
+	writeFile(t, a, newCertificate(t, "a", expiry))
+	writeFile(t, b, newCertificate(t, "b", expiry))
+	writeFile(t, c, newCertificate(t, "c", expiry))
+
+	config := DefaultConfig()
+	config.Logger = microloggertest.New()
+	config.Files = []string{filepath.Join(dir, "*.pem"), c}
+	s, err := New(config)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	err = s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	for _, path := range []string{a, b, c} {
+		if len(expiries(t, path)) != 1 {
+			t.Fatalf("expected gauge of %s, got %v", path, expiries(t, path))
+		}
+	}
+	if v := expiries(t, a)["a"]; v != float64(expiry.Unix()) {
+		t.Fatalf("expected expiry %d, got %f", expiry.Unix(), v)
+	}
+
+	// Unreadable files and patterns matching no file keep their gauges.
+	writeFile(t, a, "foo")
+	err = os.Remove(c)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	err = s.Scan(context.Background())
+	if !IsScanFailed(err) {
+		t.Fatalf("expected scan failed error, got %#v", err)
+	}
+	for _, path := range []string{a, b, c} {
+		if len(expiries(t, path)) != 1 {
+			t.Fatalf("expected gauge of %s to be kept, got %v", path, expiries(t, path))
+		}
+	}
+
+	// Files no longer matching a pattern, which still matches other files,
+	// lose their gauges.
+	err = os.Remove(a)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	writeFile(t, c, newCertificate(t, "c", expiry))
+	err = s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	if len(expiries(t, a)) != 0 {
+		t.Fatalf("expected gauge of %s to be removed, got %v", a, expiries(t, a))
+	}
+	for _, path := range []string{b, c} {
+		if len(expiries(t, path)) != 1 {
+			t.Fatalf("expected gauge of %s, got %v", path, expiries(t, path))
+		}
+	}
+}
+
+func Test_Service_Scan_Vault(t *testing.T) {
+	expiry := time.Now().Add(24 * time.Hour)
+
+	pkiService := &testPKIService{
+		mounts: []pki.Mount{
+			{ClusterID: "exporter1", Path: "pki-exporter1"},
+			{ClusterID: "exporter2", Path: "pki-exporter2"},
+		},
+		cas: map[string]string{
+			"exporter1": newCertificate(t, "exporter1", expiry),
+			"exporter2": newCertificate(t, "exporter2", expiry),
+		},
+	}
+
+	config := DefaultConfig()
+	config.Logger = microloggertest.New()
+	config.PKIService = pkiService
+	s, err := New(config)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	err = s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	for _, path := range []string{"pki-exporter1", "pki-exporter2"} {
+		if len(expiries(t, path)) != 1 {
+			t.Fatalf("expected gauge of %s, got %v", path, expiries(t, path))
+		}
+	}
+
+	// A failing listing keeps all gauges.
+	pkiService.listErr = errors.New("unavailable")
+	err = s.Scan(context.Background())
+	if !IsScanFailed(err) {
+		t.Fatalf("expected scan failed error, got %#v", err)
+	}
+	for _, path := range []string{"pki-exporter1", "pki-exporter2"} {
+		if len(expiries(t, path)) != 1 {
+			t.Fatalf("expected gauge of %s to be kept, got %v", path, expiries(t, path))
+		}
+	}
+
+	// A failing CA read keeps the gauge of its mount only.
+	pkiService.listErr = nil
+	pkiService.mounts = pkiService.mounts[:1]
+	pkiService.caErrs = map[string]error{"exporter1": errors.New("unavailable")}
+	err = s.Scan(context.Background())
+	if !IsScanFailed(err) {
+		t.Fatalf("expected scan failed error, got %#v", err)
+	}
+	if len(expiries(t, "pki-exporter1")) != 1 {
+		t.Fatalf("expected gauge of pki-exporter1 to be kept, got %v", expiries(t, "pki-exporter1"))
+	}
+	if len(expiries(t, "pki-exporter2")) != 0 {
+		t.Fatalf("expected gauge of pki-exporter2 to be removed, got %v", expiries(t, "pki-exporter2"))
+	}
+	if v := testutil.ToFloat64(metrics.ExporterLastScanErrors.WithLabelValues(sourceVault)); v != 1 {
+		t.Fatalf("expected 1 last scan error, got %f", v)
+	}
+
+	pkiService.caErrs = nil
+	err = s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	if v := testutil.ToFloat64(metrics.ExporterLastScanErrors.WithLabelValues(sourceVault)); v != 0 {
+		t.Fatalf("expected 0 last scan errors, got %f", v)
+	}
+}
@@ -0,0 +1,17 @@
+package exporter
+
+import (
+	"context"
+)
+
+// Service exports the expiry of certificates as Prometheus metrics.
+type Service interface {
+	// Scan reads all watched certificates and updates the
+	// metrics.CertificateExpiry gauges accordingly. Gauges of certificates no
+	// longer found are removed. Certificates which cannot be read are skipped
+	// and counted by metrics.ExporterScanErrors and
+	// metrics.ExporterLastScanErrors, in which case their gauges are kept and
+	// an error asserted by IsScanFailed is returned after all other
+	// certificates have been scanned.
+	Scan(ctx context.Context) error
+}
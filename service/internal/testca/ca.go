@@ -0,0 +1,131 @@
+package testca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/giantswarm/microerror"
+
+	"github.com/giantswarm/certctl/v2/service/pki"
+)
+
+// CA is a CA issuing certificates in memory, used by the tests of the
+// servers. All functions return errors instead of failing tests, since they
+// are called by test server handlers as well.
+type CA struct {
+	Cert *x509.Certificate
+	Key  *ecdsa.PrivateKey
+
+	mutex   sync.Mutex
+	revoked []string
+}
+
+// New creates a self-signed CA with the given common name valid for an hour.
+func New(commonName string) (*CA, error) {
+	key, err := NewKey()
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return &CA{Cert: cert, Key: key}, nil
+}
+
+// Sign issues a client and server certificate with the subject and SANs of
+// the given CSR.
+func (c *CA) Sign(csr *x509.CertificateRequest, serialNumber int64) (*x509.Certificate, error) {
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(serialNumber),
+		Subject:        csr.Subject,
+		DNSNames:       csr.DNSNames,
+		EmailAddresses: csr.EmailAddresses,
+		IPAddresses:    csr.IPAddresses,
+		URIs:           csr.URIs,
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, c.Cert, csr.PublicKey, c.Key)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return cert, nil
+}
+
+// Revoke adds the serial number of the given certificate to the revoked
+// serial numbers.
+func (c *CA) Revoke(cert *x509.Certificate) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.revoked = append(c.revoked, pki.FormatSerialNumber(cert.SerialNumber.Bytes()))
+}
+
+// Revoked returns the serial numbers of the revoked certificates as
+// formatted by pki.FormatSerialNumber.
+func (c *CA) Revoked() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([]string(nil), c.revoked...)
+}
+
+// PEM returns the PEM encoded CA certificate.
+func (c *CA) PEM() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Cert.Raw}))
+}
+
+// NewKey generates a P-256 ECDSA key.
+func NewKey() (*ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return key, nil
+}
+
+// NewCSR returns a DER encoded CSR signed by the given key with the given
+// common name and DNS names.
+func NewCSR(key *ecdsa.PrivateKey, commonName string, dnsNames ...string) ([]byte, error) {
+	template := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: commonName},
+		DNSNames: dnsNames,
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return der, nil
+}
@@ -0,0 +1,59 @@
+package testca
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sync"
+
+	"github.com/giantswarm/microerror"
+
+	"github.com/giantswarm/certctl/v2/service/pki"
+	"github.com/giantswarm/certctl/v2/service/spec"
+)
+
+// CertSigner signs CSRs with the CA of the cluster they are signed for. Only
+// SignWithContext is implemented. Serial numbers start at 101.
+type CertSigner struct {
+	spec.CertSigner
+
+	CAs map[string]*CA
+
+	mutex  sync.Mutex
+	signed int64
+}
+
+func (s *CertSigner) SignWithContext(ctx context.Context, config spec.SignConfig) (spec.SignResponse, error) {
+	ca, ok := s.CAs[config.ClusterID]
+	if !ok {
+		return spec.SignResponse{}, microerror.Mask(fmt.Errorf("cluster %q not found", config.ClusterID))
+	}
+
+	block, _ := pem.Decode([]byte(config.CSR))
+	if block == nil {
+		return spec.SignResponse{}, microerror.Mask(fmt.Errorf("CSR is not PEM encoded"))
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return spec.SignResponse{}, microerror.Mask(err)
+	}
+
+	s.mutex.Lock()
+	s.signed++
+	serialNumber := 100 + s.signed
+	s.mutex.Unlock()
+
+	cert, err := ca.Sign(csr, serialNumber)
+	if err != nil {
+		return spec.SignResponse{}, microerror.Mask(err)
+	}
+
+	newSignResponse := spec.SignResponse{
+		Certificate:  string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})),
+		IssuingCA:    ca.PEM(),
+		SerialNumber: pki.FormatSerialNumber(cert.SerialNumber.Bytes()),
+	}
+
+	return newSignResponse, nil
+}
@@ -0,0 +1,47 @@
+package vaultdata
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ToBool converts a value of a Vault response into a boolean. Depending on
+// the Vault version booleans are either returned as JSON booleans or as
+// strings. def is returned for missing or unparsable values.
+func ToBool(v interface{}, def bool) bool {
+	switch t := v.(type) {
+	case bool:
+		return t
+	case string:
+		b, err := strconv.ParseBool(t)
+		if err == nil {
+			return b
+		}
+	}
+
+	return def
+}
+
+// ToStrings converts a value of a Vault response into a list of strings.
+// Depending on the Vault version lists are either returned as JSON arrays or
+// as comma separated strings. Empty items are dropped.
+func ToStrings(v interface{}) []string {
+	var list []string
+
+	switch t := v.(type) {
+	case []interface{}:
+		for _, i := range t {
+			if str, ok := i.(string); ok && str != "" {
+				list = append(list, str)
+			}
+		}
+	case string:
+		for _, str := range strings.Split(t, ",") {
+			if str != "" {
+				list = append(list, str)
+			}
+		}
+	}
+
+	return list
+}
@@ -0,0 +1,61 @@
+package vaultdata
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_ToBool(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    interface{}
+		def      bool
+		expected bool
+	}{
+		{name: "true", value: true, def: false, expected: true},
+		{name: "false", value: false, def: true, expected: false},
+		{name: "string true", value: "true", def: false, expected: true},
+		{name: "string false", value: "false", def: true, expected: false},
+		{name: "string 1", value: "1", def: false, expected: true},
+		{name: "invalid string", value: "foo", def: true, expected: true},
+		{name: "empty string", value: "", def: false, expected: false},
+		{name: "missing", value: nil, def: true, expected: true},
+		{name: "number", value: float64(1), def: false, expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := ToBool(tc.value, tc.def)
+			if result != tc.expected {
+				t.Fatalf("expected %t, got %t", tc.expected, result)
+			}
+		})
+	}
+}
+
+func Test_ToStrings(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    interface{}
+		expected []string
+	}{
+		{name: "array", value: []interface{}{"a", "b"}, expected: []string{"a", "b"}},
+		{name: "array with empty items and non-strings", value: []interface{}{"a", "", 1, "b"}, expected: []string{"a", "b"}},
+		{name: "empty array", value: []interface{}{}, expected: nil},
+		{name: "comma separated", value: "a,b", expected: []string{"a", "b"}},
+		{name: "comma separated with empty items", value: ",a,,b,", expected: []string{"a", "b"}},
+		{name: "single", value: "a", expected: []string{"a"}},
+		{name: "empty string", value: "", expected: nil},
+		{name: "missing", value: nil, expected: nil},
+		{name: "number", value: float64(1), expected: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := ToStrings(tc.value)
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Fatalf("expected %#v, got %#v", tc.expected, result)
+			}
+		})
+	}
+}
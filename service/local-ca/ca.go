@@ -0,0 +1,155 @@
+package localca
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	"github.com/giantswarm/microerror"
+)
+
+const (
+	// KeyBits is the size of the RSA keys generated for root CAs and issued
+	// certificates, which is the default of Vault's PKI backend.
+	KeyBits = 2048
+
+	// NotBeforeSkew is the time issued certificates are backdated by to
+	// tolerate clock skew, which is the default of Vault's PKI backend.
+	NotBeforeSkew = 30 * time.Second
+
+	// CRLTTL is the time generated CRLs are valid for, which is the default of
+	// Vault's PKI backend.
+	CRLTTL = 72 * time.Hour
+)
+
+// NewCA generates a self-signed root CA with the given common name valid for
+// the given TTL.
+func NewCA(commonName string, ttl time.Duration) (CA, error) {
+	key, err := rsa.GenerateKey(rand.Reader, KeyBits)
+	if err != nil {
+		return CA{}, microerror.Mask(err)
+	}
+	serialNumber, err := NewSerialNumber()
+	if err != nil {
+		return CA{}, microerror.Mask(err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-NotBeforeSkew),
+		NotAfter:              now.Add(ttl),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return CA{}, microerror.Mask(err)
+	}
+
+	newCA := CA{
+		Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		PrivateKey:  EncodePrivateKey(key),
+	}
+
+	return newCA, nil
+}
+
+// KeyPair parses the root CA certificate and private key.
+func (ca CA) KeyPair() (*x509.Certificate, crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(ca.Certificate))
+	if block == nil {
+		return nil, nil, microerror.Maskf(invalidStoreError, "root CA certificate is not PEM encoded")
+	}
+	crt, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, microerror.Maskf(invalidStoreError, "%s", err)
+	}
+
+	block, _ = pem.Decode([]byte(ca.PrivateKey))
+	if block == nil {
+		return nil, nil, microerror.Maskf(invalidStoreError, "root CA private key is not PEM encoded")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, microerror.Maskf(invalidStoreError, "%s", err)
+	}
+
+	return crt, key, nil
+}
+
+// Issue signs a certificate for the given public key described by the given
+// template with the root CA, and returns it PEM encoded. The serial number
+// and validity of the template must be set.
+func (ca CA) Issue(template *x509.Certificate, publicKey crypto.PublicKey) (string, error) {
+	caCrt, caKey, err := ca.KeyPair()
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCrt, publicKey, caKey)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), nil
+}
+
+// CRL generates a PEM encoded CRL listing the given revoked certificates,
+// signed by the root CA.
+func (ca CA) CRL(revoked []x509.RevocationListEntry) (string, error) {
+	caCrt, caKey, err := ca.KeyPair()
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	// The CRL is generated on every request, so that its number only has to
+	// increase over time.
+	now := time.Now()
+	template := &x509.RevocationList{
+		RevokedCertificateEntries: revoked,
+		Number:                    big.NewInt(now.UnixNano()),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(CRLTTL),
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, caCrt, caKey)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})), nil
+}
+
+// GenerateKey generates the private key of a certificate to be issued.
+func GenerateKey() (*rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, KeyBits)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return key, nil
+}
+
+// EncodePrivateKey PEM encodes the given private key the way Vault returns
+// RSA private keys.
+func EncodePrivateKey(key *rsa.PrivateKey) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+// NewSerialNumber returns a random positive serial number of at most 20
+// bytes, as required by RFC 5280.
+func NewSerialNumber() (*big.Int, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 159))
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return serialNumber, nil
+}
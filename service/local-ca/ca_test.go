@@ -0,0 +1,101 @@
+package localca
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func Test_CA_IssueCRL(t *testing.T) {
+	ca, err := NewCA("ca.example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	caCrt, _, err := ca.KeyPair()
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	if !caCrt.IsCA || caCrt.Subject.CommonName != "ca.example.com" {
+		t.Fatalf("expected root CA 'ca.example.com', got %#v", caCrt.Subject)
+	}
+
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	serialNumber, err := NewSerialNumber()
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: "api.example.com"},
+		DNSNames:     []string{"api.example.com"},
+		NotBefore:    time.Now().Add(-NotBeforeSkew),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	certificate, err := ca.Issue(template, &key.PublicKey)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	block, _ := pem.Decode([]byte(certificate))
+	if block == nil {
+		t.Fatalf("expected PEM encoded certificate, got %q", certificate)
+	}
+	crt, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(caCrt)
+	_, err = crt.Verify(x509.VerifyOptions{DNSName: "api.example.com", Roots: roots})
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	revoked := []x509.RevocationListEntry{{SerialNumber: serialNumber, RevocationTime: time.Now()}}
+	crl, err := ca.CRL(revoked)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	block, _ = pem.Decode([]byte(crl))
+	if block == nil {
+		t.Fatalf("expected PEM encoded CRL, got %q", crl)
+	}
+	list, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	err = list.CheckSignatureFrom(caCrt)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	if len(list.RevokedCertificateEntries) != 1 || list.RevokedCertificateEntries[0].SerialNumber.Cmp(serialNumber) != 0 {
+		t.Fatalf("expected CRL to list serial number %s, got %v", serialNumber, list.RevokedCertificateEntries)
+	}
+}
+
+func Test_NewSerialNumber(t *testing.T) {
+	limit := new(big.Int).Lsh(big.NewInt(1), 159)
+	for i := 0; i < 100; i++ {
+		serialNumber, err := NewSerialNumber()
+		if err != nil {
+			t.Fatalf("expected no error, got %#v", err)
+		}
+		if serialNumber.Sign() < 0 || serialNumber.Cmp(limit) >= 0 {
+			t.Fatalf("expected serial number of at most 159 bits, got %s", serialNumber)
+		}
+	}
+}
+
+func Test_CA_KeyPair_Invalid(t *testing.T) {
+	_, _, err := CA{Certificate: "certificate", PrivateKey: "key"}.KeyPair()
+	if !IsInvalidStore(err) {
+		t.Fatalf("expected invalid store error, got %#v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package localca
+
+import (
+	"github.com/giantswarm/microerror"
+)
+
+var invalidConfigError = &microerror.Error{
+	Kind: "invalidConfigError",
+}
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return microerror.Cause(err) == invalidConfigError
+}
+
+var clusterNotFoundError = &microerror.Error{
+	Kind: "clusterNotFoundError",
+}
+
+// IsClusterNotFound asserts clusterNotFoundError.
+func IsClusterNotFound(err error) bool {
+	return microerror.Cause(err) == clusterNotFoundError
+}
+
+var clusterAlreadyExistsError = &microerror.Error{
+	Kind: "clusterAlreadyExistsError",
+}
+
+// IsClusterAlreadyExists asserts clusterAlreadyExistsError.
+func IsClusterAlreadyExists(err error) bool {
+	return microerror.Cause(err) == clusterAlreadyExistsError
+}
+
+var decryptionFailedError = &microerror.Error{
+	Kind: "decryptionFailedError",
+}
+
+// IsDecryptionFailed asserts decryptionFailedError.
+func IsDecryptionFailed(err error) bool {
+	return microerror.Cause(err) == decryptionFailedError
+}
+
+var invalidStoreError = &microerror.Error{
+	Kind: "invalidStoreError",
+}
+
+// IsInvalidStore asserts invalidStoreError.
+func IsInvalidStore(err error) bool {
+	return microerror.Cause(err) == invalidStoreError
+}
@@ -0,0 +1,58 @@
+package localca
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_lockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), lockFileName)
+
+	open := func() *os.File {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, os.FileMode(0600))
+		if err != nil {
+			t.Fatalf("expected no error, got %#v", err)
+		}
+		t.Cleanup(func() { f.Close() })
+		return f
+	}
+	first := open()
+	second := open()
+
+	err := lockFile(first)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	locked := make(chan error, 1)
+	go func() {
+		locked <- lockFile(second)
+	}()
+
+	select {
+	case err := <-locked:
+		t.Fatalf("expected second lock to wait for the first, got %#v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	err = unlockFile(first)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	select {
+	case err := <-locked:
+		if err != nil {
+			t.Fatalf("expected no error, got %#v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected second lock after unlocking the first")
+	}
+
+	err = unlockFile(second)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package localca
+
+import (
+	"context"
+	"time"
+
+	"github.com/giantswarm/certctl/v2/service/role"
+)
+
+// Cluster is the state of a cluster's local CA, which takes the place of a
+// cluster's Vault PKI backend.
+type Cluster struct {
+	// ClusterID is the cluster ID the local CA belongs to.
+	ClusterID string `json:"cluster_id"`
+
+	// Description describes the local CA as set on setup.
+	Description string `json:"description"`
+
+	// MaxLeaseTTL caps the TTL of issued certificates the same way the max
+	// lease TTL of a PKI backend mount does.
+	MaxLeaseTTL time.Duration `json:"max_lease_ttl"`
+
+	// CA is the root CA. It is nil until the root CA is generated.
+	CA *CA `json:"ca,omitempty"`
+
+	// Roles maps role names to the roles registered for the cluster.
+	Roles map[string]Role `json:"roles"`
+
+	// Certificates maps serial numbers, in the colon separated hex format
+	// used by Vault, to the certificates issued for the cluster, including
+	// the root CA.
+	Certificates map[string]Certificate `json:"certificates"`
+
+	// LastTidy is the result of the last tidy operation, if any.
+	LastTidy *TidyResult `json:"last_tidy,omitempty"`
+}
+
+// CA is the root CA of a local CA including its private key.
+type CA struct {
+	// Certificate is the PEM encoded root CA certificate.
+	Certificate string `json:"certificate"`
+
+	// PrivateKey is the PEM encoded private key of the root CA.
+	PrivateKey string `json:"private_key"`
+}
+
+// Role is a role registered for a cluster. It puts the same constraints on
+// issued certificates as a role of a Vault PKI backend.
+type Role struct {
+	role.Role
+
+	// Organizations is the list of organizations set in the subject of
+	// issued certificates.
+	Organizations []string `json:"organizations"`
+}
+
+// Certificate is a certificate issued by a local CA.
+type Certificate struct {
+	// Certificate is the PEM encoded certificate.
+	Certificate string `json:"certificate"`
+
+	// RevocationTime is the time the certificate was revoked. It is nil in
+	// case the certificate is not revoked.
+	RevocationTime *time.Time `json:"revocation_time,omitempty"`
+}
+
+// TidyResult describes a tidy operation of a local CA.
+type TidyResult struct {
+	// CertStoreDeletedCount is the number of expired certificates removed.
+	CertStoreDeletedCount int `json:"cert_store_deleted_count"`
+
+	// RevokedCertDeletedCount is the number of expired revoked certificates
+	// removed, which are also dropped from the CRL.
+	RevokedCertDeletedCount int `json:"revoked_cert_deleted_count"`
+
+	// Time is the time the tidy operation ran.
+	Time time.Time `json:"time"`
+}
+
+// Store persists the state of local CAs in a directory. The state of each
+// cluster, including the private key of its root CA, is encrypted with a key
+// derived from a passphrase.
+type Store interface {
+	// Cluster returns the state of the local CA associated with the given
+	// cluster ID. In case it does not exist an error asserted by
+	// IsClusterNotFound is returned.
+	Cluster(ctx context.Context, clusterID string) (Cluster, error)
+
+	// Create creates the local CA described by the given state. In case it
+	// already exists an error asserted by IsClusterAlreadyExists is returned.
+	Create(ctx context.Context, cluster Cluster) error
+
+	// Delete removes the local CA associated with the given cluster ID, if it
+	// exists.
+	Delete(ctx context.Context, clusterID string) error
+
+	// List returns the cluster IDs of all local CAs, sorted.
+	List(ctx context.Context) ([]string, error)
+
+	// Update applies the given function to the state of the local CA
+	// associated with the given cluster ID and writes the result, unless the
+	// function returns an error. Updates are serialized across all processes
+	// sharing the directory.
+	// In case the local CA does not exist an error asserted by
+	// IsClusterNotFound is returned.
+	Update(ctx context.Context, clusterID string, update func(cluster *Cluster) error) error
+
+	// Path returns the path of the file the state of the local CA associated
+	// with the given cluster ID is stored in.
+	Path(clusterID string) string
+}
@@ -0,0 +1,559 @@
+package localca
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// StoreVersion is the version of the directory layout written by this
+	// package.
+	StoreVersion = 1
+
+	kdfScrypt = "scrypt"
+
+	// Parameters of the scrypt key derivation. The key is derived once per
+	// process, so the parameters recommended for interactive logins apply.
+	scryptN      = 32768
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltLen      = 16
+
+	// storeFileName is the name of the file holding the key derivation
+	// parameters of the store.
+	storeFileName = "store.json"
+
+	// clustersDirName is the name of the directory holding one file per
+	// cluster.
+	clustersDirName = "clusters"
+
+	// lockFileName is the name of the file locked while the store is
+	// modified.
+	lockFileName = ".lock"
+
+	// checkPlaintext is encrypted into the store file, so that a wrong
+	// passphrase is detected before any cluster is read or written.
+	checkPlaintext = "certctl"
+)
+
+// storeFile is the on-disk representation of the store's metadata.
+type storeFile struct {
+	Version int        `json:"version"`
+	KDF     kdf        `json:"kdf"`
+	Check   sealedData `json:"check"`
+}
+
+type kdf struct {
+	Name string `json:"name"`
+	Salt []byte `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+// sealedData is data encrypted with AES-256-GCM, which is how the state of
+// each cluster is written.
+type sealedData struct {
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Config represents the configuration used to create a new store.
+type Config struct {
+	// Dependencies.
+	Logger micrologger.Logger
+
+	// Settings.
+
+	// Directory is the directory the store is kept in. It is created with
+	// permissions only granting access to the current user in case it does
+	// not exist.
+	Directory string
+
+	// Passphrase is the passphrase the key encrypting the state of all
+	// clusters is derived from. It is chosen when the store is created and
+	// must be given the same afterwards.
+	Passphrase []byte
+}
+
+// DefaultConfig provides a default configuration to create a new store.
+func DefaultConfig() Config {
+	newLogger, err := micrologger.New(micrologger.Config{IOWriter: os.Stderr})
+	if err != nil {
+		panic(err)
+	}
+
+	newConfig := Config{
+		// Dependencies.
+		Logger: newLogger,
+	}
+
+	return newConfig
+}
+
+// New opens the store in the configured directory, creating it in case it
+// does not exist. In case the passphrase does not match the one the store was
+// created with, an error asserted by IsDecryptionFailed is returned.
+func New(config Config) (Store, error) {
+	// Dependencies.
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "logger must not be empty")
+	}
+
+	// Settings.
+	if config.Directory == "" {
+		return nil, microerror.Maskf(invalidConfigError, "directory must not be empty")
+	}
+	if len(config.Passphrase) == 0 {
+		return nil, microerror.Maskf(invalidConfigError, "passphrase must not be empty")
+	}
+
+	newStore := &store{
+		Config: config,
+	}
+
+	err := newStore.load()
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return newStore, nil
+}
+
+type store struct {
+	Config
+
+	aead cipher.AEAD
+
+	// mutex serializes all access to the cluster files within the process,
+	// so that concurrent updates, e.g. of a server, are not lost. Other
+	// processes are excluded by lock.
+	mutex sync.Mutex
+}
+
+func (s *store) Cluster(ctx context.Context, clusterID string) (Cluster, error) {
+	err := checkClusterID(ctx, clusterID)
+	if err != nil {
+		return Cluster{}, microerror.Mask(err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	cluster, err := s.read(clusterID)
+	if err != nil {
+		return Cluster{}, microerror.Mask(err)
+	}
+
+	return cluster, nil
+}
+
+func (s *store) Create(ctx context.Context, cluster Cluster) error {
+	err := checkClusterID(ctx, cluster.ClusterID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	unlock, err := s.lock()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	defer unlock()
+
+	_, err = os.Stat(s.Path(cluster.ClusterID))
+	if err == nil {
+		return microerror.Maskf(clusterAlreadyExistsError, "local CA for cluster ID '%s' already exists", cluster.ClusterID)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return microerror.Mask(err)
+	}
+
+	err = s.write(cluster)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	s.Logger.LogCtx(ctx, "level", "debug", "message", "created local CA", "cluster_id", cluster.ClusterID, "path", s.Path(cluster.ClusterID))
+
+	return nil
+}
+
+func (s *store) Delete(ctx context.Context, clusterID string) error {
+	err := checkClusterID(ctx, clusterID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	unlock, err := s.lock()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	defer unlock()
+
+	err = os.Remove(s.Path(clusterID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	s.Logger.LogCtx(ctx, "level", "debug", "message", "deleted local CA", "cluster_id", clusterID, "path", s.Path(clusterID))
+
+	return nil
+}
+
+func (s *store) List(ctx context.Context) ([]string, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entries, err := os.ReadDir(filepath.Join(s.Directory, clustersDirName))
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	var clusterIDs []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		clusterIDs = append(clusterIDs, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	sort.Strings(clusterIDs)
+
+	return clusterIDs, nil
+}
+
+func (s *store) Update(ctx context.Context, clusterID string, update func(cluster *Cluster) error) error {
+	err := checkClusterID(ctx, clusterID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	// The lock is held from reading to writing the state, so that updates of
+	// other processes sharing the directory, e.g. a server and the CLI
+	// revoking a certificate, are not lost.
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	unlock, err := s.lock()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	defer unlock()
+
+	cluster, err := s.read(clusterID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = update(&cluster)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = s.write(cluster)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *store) Path(clusterID string) string {
+	return filepath.Join(s.Directory, clustersDirName, clusterID+".json")
+}
+
+// load derives the key of the store, creating the store in case it does not
+// exist yet.
+func (s *store) load() error {
+	err := os.MkdirAll(filepath.Join(s.Directory, clustersDirName), os.FileMode(0700))
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	// Processes creating the store at the same time must agree on the salt.
+	unlock, err := s.lock()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	defer unlock()
+
+	path := filepath.Join(s.Directory, storeFileName)
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		err = s.init(path)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		return nil
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	var f storeFile
+	err = json.Unmarshal(b, &f)
+	if err != nil {
+		return microerror.Maskf(invalidStoreError, "cannot parse '%s': %s", path, err)
+	}
+	if f.Version != StoreVersion {
+		return microerror.Maskf(invalidStoreError, "unsupported store version %d", f.Version)
+	}
+	if f.KDF.Name != kdfScrypt {
+		return microerror.Maskf(invalidStoreError, "unsupported key derivation function '%s'", f.KDF.Name)
+	}
+
+	s.aead, err = newAEAD(s.Passphrase, f.KDF)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	_, err = s.open(f.Check, storeFileName)
+	if err != nil {
+		return microerror.Maskf(decryptionFailedError, "wrong passphrase for local CA store '%s'", s.Directory)
+	}
+
+	return nil
+}
+
+// init creates the store file at path with a new salt.
+func (s *store) init(path string) error {
+	f := storeFile{
+		Version: StoreVersion,
+		KDF: kdf{
+			Name: kdfScrypt,
+			Salt: make([]byte, saltLen),
+			N:    scryptN,
+			R:    scryptR,
+			P:    scryptP,
+		},
+	}
+
+	_, err := io.ReadFull(rand.Reader, f.KDF.Salt)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	s.aead, err = newAEAD(s.Passphrase, f.KDF)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	f.Check, err = s.seal([]byte(checkPlaintext), storeFileName)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	err = writeFile(path, b)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	s.Logger.Log("level", "debug", "message", "created local CA store", "directory", s.Directory)
+
+	return nil
+}
+
+// lock acquires an exclusive lock on the lock file of the store, waiting for
+// other processes holding it. Reading does not need the lock, since files are
+// replaced atomically. The returned function releases the lock.
+func (s *store) lock() (func(), error) {
+	f, err := os.OpenFile(filepath.Join(s.Directory, lockFileName), os.O_RDWR|os.O_CREATE, os.FileMode(0600))
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	err = lockFile(f)
+	if err != nil {
+		f.Close()
+		return nil, microerror.Mask(err)
+	}
+
+	unlock := func() {
+		// Closing the file releases the lock as well.
+		_ = unlockFile(f)
+		f.Close()
+	}
+
+	return unlock, nil
+}
+
+func (s *store) read(clusterID string) (Cluster, error) {
+	path := s.Path(clusterID)
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Cluster{}, microerror.Maskf(clusterNotFoundError, "local CA for cluster ID '%s' does not exist", clusterID)
+	} else if err != nil {
+		return Cluster{}, microerror.Mask(err)
+	}
+
+	var sealed sealedData
+	err = json.Unmarshal(b, &sealed)
+	if err != nil {
+		return Cluster{}, microerror.Maskf(invalidStoreError, "cannot parse '%s': %s", path, err)
+	}
+
+	// The cluster ID is authenticated along with the state, so that the
+	// state of one cluster cannot be passed off as another's by renaming
+	// files.
+	plaintext, err := s.open(sealed, clusterID)
+	if err != nil {
+		return Cluster{}, microerror.Maskf(decryptionFailedError, "cannot decrypt '%s', which was modified or moved", path)
+	}
+
+	var cluster Cluster
+	err = json.Unmarshal(plaintext, &cluster)
+	if err != nil {
+		return Cluster{}, microerror.Maskf(invalidStoreError, "cannot parse '%s': %s", path, err)
+	}
+	if cluster.Roles == nil {
+		cluster.Roles = map[string]Role{}
+	}
+	if cluster.Certificates == nil {
+		cluster.Certificates = map[string]Certificate{}
+	}
+
+	return cluster, nil
+}
+
+func (s *store) write(cluster Cluster) error {
+	plaintext, err := json.Marshal(cluster)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	sealed, err := s.seal(plaintext, cluster.ClusterID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	b, err := json.Marshal(sealed)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = writeFile(s.Path(cluster.ClusterID), b)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *store) seal(plaintext []byte, additionalData string) (sealedData, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return sealedData{}, microerror.Mask(err)
+	}
+
+	sealed := sealedData{
+		Nonce:      nonce,
+		Ciphertext: s.aead.Seal(nil, nonce, plaintext, []byte(additionalData)),
+	}
+
+	return sealed, nil
+}
+
+// open decrypts the given data, see seal.
+func (s *store) open(sealed sealedData, additionalData string) ([]byte, error) {
+	if len(sealed.Nonce) != s.aead.NonceSize() {
+		return nil, microerror.Maskf(invalidStoreError, "nonce must be %d bytes", s.aead.NonceSize())
+	}
+	plaintext, err := s.aead.Open(nil, sealed.Nonce, sealed.Ciphertext, []byte(additionalData))
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return plaintext, nil
+}
+
+// checkClusterID ensures the given cluster ID can be used as file name, so
+// that it cannot point outside of the store.
+func checkClusterID(ctx context.Context, clusterID string) error {
+	err := ctx.Err()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	if clusterID == "" {
+		return microerror.Maskf(invalidConfigError, "cluster ID must not be empty")
+	}
+	if clusterID == "." || clusterID == ".." || strings.ContainsAny(clusterID, `/\`+"\x00") {
+		return microerror.Maskf(invalidConfigError, "cluster ID '%s' must not contain path separators", clusterID)
+	}
+
+	return nil
+}
+
+func newAEAD(passphrase []byte, k kdf) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, k.Salt, k.N, k.R, k.P, scryptKeyLen)
+	if err != nil {
+		return nil, microerror.Maskf(invalidStoreError, "%s", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return aead, nil
+}
+
+// writeFile atomically replaces the file at path with the given data, only
+// readable and writable by the current user, so that readers never see a
+// partially written file.
+func writeFile(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return microerror.Mask(err)
+	}
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return microerror.Mask(err)
+	}
+	err = f.Close()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = os.Rename(f.Name(), path)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,227 @@
+package localca
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+)
+
+func newTestStore(t *testing.T, directory, passphrase string) (Store, error) {
+	config := DefaultConfig()
+	config.Logger = microloggertest.New()
+	config.Directory = directory
+	config.Passphrase = []byte(passphrase)
+
+	return New(config)
+}
+
+func mustNewTestStore(t *testing.T, directory, passphrase string) Store {
+	s, err := newTestStore(t, directory, passphrase)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return s
+}
+
+func Test_Store_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	directory := t.TempDir()
+	s := mustNewTestStore(t, directory, "secret")
+
+	cluster := Cluster{
+		ClusterID:   "abc",
+		Description: "test",
+		MaxLeaseTTL: time.Hour,
+	}
+	err := s.Create(ctx, cluster)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	err = s.Create(ctx, cluster)
+	if !IsClusterAlreadyExists(err) {
+		t.Fatalf("expected cluster already exists error, got %#v", err)
+	}
+
+	err = s.Update(ctx, "abc", func(c *Cluster) error {
+		c.Certificates["01:02"] = Certificate{Certificate: "certificate"}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	// The state is read back by another store opened with the same
+	// passphrase, e.g. of another process.
+	other := mustNewTestStore(t, directory, "secret")
+	got, err := other.Cluster(ctx, "abc")
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	if got.Description != "test" || got.MaxLeaseTTL != time.Hour {
+		t.Fatalf("expected cluster to be read back, got %#v", got)
+	}
+	if got.Certificates["01:02"].Certificate != "certificate" {
+		t.Fatalf("expected updated certificates, got %#v", got.Certificates)
+	}
+
+	clusterIDs, err := other.List(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	if len(clusterIDs) != 1 || clusterIDs[0] != "abc" {
+		t.Fatalf("expected cluster IDs [abc], got %v", clusterIDs)
+	}
+
+	err = other.Delete(ctx, "abc")
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	_, err = s.Cluster(ctx, "abc")
+	if !IsClusterNotFound(err) {
+		t.Fatalf("expected cluster not found error, got %#v", err)
+	}
+	err = s.Update(ctx, "abc", func(c *Cluster) error { return nil })
+	if !IsClusterNotFound(err) {
+		t.Fatalf("expected cluster not found error, got %#v", err)
+	}
+}
+
+func Test_Store_ConcurrentUpdates(t *testing.T) {
+	ctx := context.Background()
+	directory := t.TempDir()
+
+	// Two stores on the same directory stand in for two processes, since
+	// they do not share the mutex of a store.
+	stores := []Store{
+		mustNewTestStore(t, directory, "secret"),
+		mustNewTestStore(t, directory, "secret"),
+	}
+	err := stores[0].Create(ctx, Cluster{ClusterID: "abc"})
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- stores[i%2].Update(ctx, "abc", func(c *Cluster) error {
+				c.Certificates[strconv.Itoa(i)] = Certificate{}
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("expected no error, got %#v", err)
+		}
+	}
+
+	cluster, err := stores[0].Cluster(ctx, "abc")
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	if len(cluster.Certificates) != 20 {
+		t.Fatalf("expected 20 certificates, got %d", len(cluster.Certificates))
+	}
+}
+
+func Test_Store_WrongPassphrase(t *testing.T) {
+	directory := t.TempDir()
+	mustNewTestStore(t, directory, "secret")
+
+	_, err := newTestStore(t, directory, "guess")
+	if !IsDecryptionFailed(err) {
+		t.Fatalf("expected decryption failed error, got %#v", err)
+	}
+}
+
+func Test_Store_Tampered(t *testing.T) {
+	ctx := context.Background()
+	s := mustNewTestStore(t, t.TempDir(), "secret")
+
+	for _, clusterID := range []string{"abc", "def"} {
+		err := s.Create(ctx, Cluster{ClusterID: clusterID})
+		if err != nil {
+			t.Fatalf("expected no error, got %#v", err)
+		}
+	}
+
+	// Flipping a bit of the ciphertext is detected.
+	b, err := os.ReadFile(s.Path("abc"))
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	var sealed sealedData
+	err = json.Unmarshal(b, &sealed)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	sealed.Ciphertext[0] ^= 1
+	b, err = json.Marshal(sealed)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	err = os.WriteFile(s.Path("abc"), b, 0600)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	_, err = s.Cluster(ctx, "abc")
+	if !IsDecryptionFailed(err) {
+		t.Fatalf("expected decryption failed error, got %#v", err)
+	}
+
+	// The state of one cluster cannot be passed off as another's.
+	err = os.Rename(s.Path("def"), s.Path("ghi"))
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	_, err = s.Cluster(ctx, "ghi")
+	if !IsDecryptionFailed(err) {
+		t.Fatalf("expected decryption failed error, got %#v", err)
+	}
+}
+
+func Test_checkClusterID(t *testing.T) {
+	testCases := []struct {
+		clusterID     string
+		expectedValid bool
+	}{
+		{clusterID: "abc", expectedValid: true},
+		{clusterID: "abc.def", expectedValid: true},
+		{clusterID: "..abc", expectedValid: true},
+		{clusterID: "", expectedValid: false},
+		{clusterID: ".", expectedValid: false},
+		{clusterID: "..", expectedValid: false},
+		{clusterID: "../abc", expectedValid: false},
+		{clusterID: "abc/def", expectedValid: false},
+		{clusterID: "/abc", expectedValid: false},
+		{clusterID: `abc\def`, expectedValid: false},
+		{clusterID: "abc\x00", expectedValid: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(strconv.Quote(tc.clusterID), func(t *testing.T) {
+			err := checkClusterID(context.Background(), tc.clusterID)
+			if tc.expectedValid && err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			if !tc.expectedValid && !IsInvalidConfig(err) {
+				t.Fatalf("expected invalid config error, got %#v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/giantswarm/microerror"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Handler returns the HTTP handler exposing all certctl metrics along with Go
+// runtime and process metrics, to be served by long-running commands.
+func Handler() http.Handler {
+	runtimeRegistry := prometheus.NewRegistry()
+	runtimeRegistry.MustRegister(prometheus.NewGoCollector())
+	runtimeRegistry.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+
+	gatherers := prometheus.Gatherers{
+		Registry,
+		runtimeRegistry,
+	}
+
+	return promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{})
+}
+
+// WriteTextfile writes all certctl metrics to the file at path in the text
+// exposition format, to be collected by the node-exporter's textfile
+// collector after one-shot commands. The file is replaced atomically.
+func WriteTextfile(path string) error {
+	err := prometheus.WriteToTextfile(path, Registry)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
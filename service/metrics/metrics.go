@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	namespace = "certctl"
+)
+
+const (
+	// ErrorKindUnknown is the error kind of failures not classified any
+	// further.
+	ErrorKindUnknown = "unknown"
+
+	// CodeError is the code of Vault requests failed without a response, e.g.
+	// due to refused connections.
+	CodeError = "error"
+)
+
+var (
+	// IssueAttempts counts the calls to issue certificates per cluster ID.
+	// Retries of a single call are not counted separately.
+	IssueAttempts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "issue",
+			Name:      "attempts_total",
+			Help:      "Number of attempts to issue certificates.",
+		},
+		[]string{"cluster_id"},
+	)
+
+	// IssueFailures counts the failed calls to issue certificates per cluster
+	// ID and kind of error, e.g. domain_not_allowed.
+	IssueFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "issue",
+			Name:      "failures_total",
+			Help:      "Number of failed attempts to issue certificates.",
+		},
+		[]string{"cluster_id", "error_kind"},
+	)
+
+	// RoleCreations counts the PKI roles created per cluster ID.
+	RoleCreations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "role",
+			Name:      "creations_total",
+			Help:      "Number of created PKI roles.",
+		},
+		[]string{"cluster_id"},
+	)
+
+	// TokenCreations counts the Vault tokens created per cluster ID.
+	TokenCreations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "token",
+			Name:      "creations_total",
+			Help:      "Number of created Vault tokens.",
+		},
+		[]string{"cluster_id"},
+	)
+
+	// CertificateExpiry is the time certificates watched by the exporter
+	// expire, per path they were read from, subject common name, issuer
+	// common name and cluster ID.
+	CertificateExpiry = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "certificate",
+			Name:      "expiry_timestamp_seconds",
+			Help:      "Time certificates expire as Unix timestamp.",
+		},
+		[]string{"path", "common_name", "issuer", "cluster_id"},
+	)
+
+	// ExporterScanErrors counts the certificates the exporter failed to read
+	// per source, either file or vault.
+	ExporterScanErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "scan_errors_total",
+			Help:      "Number of errors reading certificates to export.",
+		},
+		[]string{"source"},
+	)
+
+	// ExporterLastScanErrors is the number of certificates the last scan of
+	// the exporter failed to read per source, either file or vault. Gauges of
+	// certificates which failed to be read keep their previous value.
+	ExporterLastScanErrors = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "last_scan_errors",
+			Help:      "Number of errors reading certificates to export in the last scan.",
+		},
+		[]string{"source"},
+	)
+
+	// ServerRequests counts the requests handled by the servers of certctl per
+	// server, e.g. api, action, e.g. issue, and HTTP response status code.
+	ServerRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "server",
+			Name:      "requests_total",
+			Help:      "Number of requests handled by servers.",
+		},
+		[]string{"server", "action", "code"},
+	)
+
+	// VaultRequestDuration observes the latency of requests to Vault per HTTP
+	// method and response status code, or CodeError in case no response was
+	// received.
+	VaultRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "vault",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of requests to Vault.",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{"method", "code"},
+	)
+)
+
+// Registry holds all certctl metrics. It does not include Go runtime and
+// process metrics, so that it can be written to files collected by the
+// node-exporter's textfile collector, which exposes these metrics itself.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(CertificateExpiry)
+	Registry.MustRegister(ExporterLastScanErrors)
+	Registry.MustRegister(ExporterScanErrors)
+	Registry.MustRegister(IssueAttempts)
+	Registry.MustRegister(IssueFailures)
+	Registry.MustRegister(RoleCreations)
+	Registry.MustRegister(ServerRequests)
+	Registry.MustRegister(TokenCreations)
+	Registry.MustRegister(VaultRequestDuration)
+}
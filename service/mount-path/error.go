@@ -0,0 +1,23 @@
+package mountpath
+
+import (
+	"github.com/giantswarm/microerror"
+)
+
+var invalidConfigError = &microerror.Error{
+	Kind: "invalidConfigError",
+}
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return microerror.Cause(err) == invalidConfigError
+}
+
+var invalidClusterIDError = &microerror.Error{
+	Kind: "invalidClusterIDError",
+}
+
+// IsInvalidClusterID asserts invalidClusterIDError.
+func IsInvalidClusterID(err error) bool {
+	return microerror.Cause(err) == invalidClusterIDError
+}
@@ -0,0 +1,137 @@
+package mountpath
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/giantswarm/microerror"
+)
+
+const (
+	// DefaultFormat is the mount path format certctl always used. Changing it
+	// for existing installations makes already set up clusters invisible to
+	// certctl.
+	DefaultFormat = "pki-{{.ClusterID}}"
+)
+
+const (
+	// placeholder is rendered in place of the cluster ID in order to find the
+	// static prefix and suffix of a format.
+	placeholder = "\x00"
+)
+
+// Config represents the configuration used to create a new mount path scheme.
+type Config struct {
+	// Settings.
+
+	// Format is a Go template rendered with the cluster ID available as
+	// {{.ClusterID}}, e.g. "clusters/{{.ClusterID}}/pki". The cluster ID must
+	// be used exactly once, so that mount paths can be mapped back to cluster
+	// IDs.
+	Format string
+}
+
+// DefaultConfig provides a default configuration to create a mount path
+// scheme.
+func DefaultConfig() Config {
+	newConfig := Config{
+		// Settings.
+		Format: DefaultFormat,
+	}
+
+	return newConfig
+}
+
+// New creates a new configured mount path scheme.
+func New(config Config) (Scheme, error) {
+	// Settings.
+	if config.Format == "" {
+		return nil, microerror.Maskf(invalidConfigError, "format must not be empty")
+	}
+
+	tmpl, err := template.New("mount-path").Option("missingkey=error").Parse(config.Format)
+	if err != nil {
+		return nil, microerror.Maskf(invalidConfigError, "format must be a valid Go template: %s", err)
+	}
+
+	newScheme := &scheme{
+		template: tmpl,
+	}
+
+	rendered, err := newScheme.render(placeholder)
+	if err != nil {
+		return nil, microerror.Maskf(invalidConfigError, "format cannot be rendered: %s", err)
+	}
+	if strings.Count(rendered, placeholder) != 1 {
+		return nil, microerror.Maskf(invalidConfigError, "format must contain {{.ClusterID}} exactly once")
+	}
+	if strings.HasPrefix(rendered, "/") || strings.HasSuffix(rendered, "/") {
+		return nil, microerror.Maskf(invalidConfigError, "format must not start or end with a slash")
+	}
+
+	i := strings.Index(rendered, placeholder)
+	newScheme.prefix = rendered[:i]
+	newScheme.suffix = rendered[i+len(placeholder):]
+
+	return newScheme, nil
+}
+
+// ValidateClusterID checks the given cluster ID can be used in mount paths.
+// Cluster IDs must not be empty and must not contain slashes, because these
+// would address another mount, e.g. "abc/../pki-def".
+func ValidateClusterID(clusterID string) error {
+	if clusterID == "" {
+		return microerror.Maskf(invalidClusterIDError, "cluster ID must not be empty")
+	}
+	if strings.Contains(clusterID, "/") {
+		return microerror.Maskf(invalidClusterIDError, "cluster ID '%s' must not contain slashes", clusterID)
+	}
+
+	return nil
+}
+
+type scheme struct {
+	template *template.Template
+
+	prefix string
+	suffix string
+}
+
+func (s *scheme) ClusterID(mountPath string) (string, bool) {
+	mountPath = strings.TrimSuffix(mountPath, "/")
+
+	if len(mountPath) <= len(s.prefix)+len(s.suffix) {
+		return "", false
+	}
+	if !strings.HasPrefix(mountPath, s.prefix) || !strings.HasSuffix(mountPath, s.suffix) {
+		return "", false
+	}
+
+	clusterID := mountPath[len(s.prefix) : len(mountPath)-len(s.suffix)]
+	if strings.Contains(clusterID, "/") {
+		return "", false
+	}
+
+	return clusterID, true
+}
+
+func (s *scheme) MountPath(clusterID string) string {
+	// Errors cannot occur here, because the template was already rendered
+	// successfully when creating the scheme and the cluster ID is only ever
+	// inserted as plain text.
+	rendered, _ := s.render(clusterID)
+
+	return rendered
+}
+
+func (s *scheme) render(clusterID string) (string, error) {
+	var result bytes.Buffer
+
+	err := s.template.Execute(&result, struct{ ClusterID string }{ClusterID: clusterID})
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return result.String(), nil
+}
@@ -0,0 +1,130 @@
+package mountpath
+
+import (
+	"testing"
+)
+
+func Test_New(t *testing.T) {
+	testCases := []struct {
+		name         string
+		format       string
+		errorMatcher func(error) bool
+	}{
+		{name: "default", format: DefaultFormat},
+		{name: "nested", format: "clusters/{{.ClusterID}}/pki"},
+		{name: "empty", format: "", errorMatcher: IsInvalidConfig},
+		{name: "invalid template", format: "pki-{{.ClusterID", errorMatcher: IsInvalidConfig},
+		{name: "unknown field", format: "pki-{{.Foo}}", errorMatcher: IsInvalidConfig},
+		{name: "cluster ID missing", format: "pki", errorMatcher: IsInvalidConfig},
+		{name: "cluster ID twice", format: "{{.ClusterID}}/{{.ClusterID}}", errorMatcher: IsInvalidConfig},
+		{name: "leading slash", format: "/pki-{{.ClusterID}}", errorMatcher: IsInvalidConfig},
+		{name: "trailing slash", format: "pki-{{.ClusterID}}/", errorMatcher: IsInvalidConfig},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(Config{Format: tc.format})
+			if tc.errorMatcher != nil {
+				if !tc.errorMatcher(err) {
+					t.Fatalf("expected error to match, got %#v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+		})
+	}
+}
+
+func Test_Scheme(t *testing.T) {
+	testCases := []struct {
+		name              string
+		format            string
+		clusterID         string
+		expectedMountPath string
+	}{
+		{name: "default", format: DefaultFormat, clusterID: "abc", expectedMountPath: "pki-abc"},
+		{name: "nested", format: "clusters/{{.ClusterID}}/pki", clusterID: "abc", expectedMountPath: "clusters/abc/pki"},
+		{name: "suffix", format: "{{.ClusterID}}-pki", clusterID: "a-b", expectedMountPath: "a-b-pki"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := New(Config{Format: tc.format})
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+
+			mountPath := s.MountPath(tc.clusterID)
+			if mountPath != tc.expectedMountPath {
+				t.Fatalf("expected mount path %q, got %q", tc.expectedMountPath, mountPath)
+			}
+
+			for _, p := range []string{mountPath, mountPath + "/"} {
+				clusterID, ok := s.ClusterID(p)
+				if !ok || clusterID != tc.clusterID {
+					t.Fatalf("expected cluster ID %q of %q, got %q", tc.clusterID, p, clusterID)
+				}
+			}
+		})
+	}
+}
+
+func Test_Scheme_ClusterID(t *testing.T) {
+	testCases := []struct {
+		name      string
+		mountPath string
+		expected  bool
+	}{
+		{name: "other mount", mountPath: "secret", expected: false},
+		{name: "prefix only", mountPath: "clusters//pki", expected: false},
+		{name: "other suffix", mountPath: "clusters/abc/kv", expected: false},
+		{name: "slash in cluster ID", mountPath: "clusters/a/b/pki", expected: false},
+		{name: "matching", mountPath: "clusters/abc/pki", expected: true},
+	}
+
+	s, err := New(Config{Format: "clusters/{{.ClusterID}}/pki"})
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, ok := s.ClusterID(tc.mountPath)
+			if ok != tc.expected {
+				t.Fatalf("expected %t, got %t", tc.expected, ok)
+			}
+		})
+	}
+}
+
+func Test_ValidateClusterID(t *testing.T) {
+	testCases := []struct {
+		name         string
+		clusterID    string
+		errorMatcher func(error) bool
+	}{
+		{name: "valid", clusterID: "abc"},
+		{name: "dots and dashes", clusterID: "a.b-c_d"},
+		{name: "empty", clusterID: "", errorMatcher: IsInvalidClusterID},
+		{name: "slash", clusterID: "a/b", errorMatcher: IsInvalidClusterID},
+		{name: "traversal", clusterID: "abc/../pki-def", errorMatcher: IsInvalidClusterID},
+		{name: "trailing slash", clusterID: "abc/", errorMatcher: IsInvalidClusterID},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateClusterID(tc.clusterID)
+			if tc.errorMatcher != nil {
+				if !tc.errorMatcher(err) {
+					t.Fatalf("expected error to match, got %#v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package mountpath
+
+// Scheme defines the naming of the Vault PKI backend mounts managed by
+// certctl. All services deriving paths from a cluster ID use the same scheme,
+// so that mounts, roles and policies stay consistent.
+type Scheme interface {
+	// ClusterID returns the cluster ID the given mount path belongs to. The
+	// returned boolean is false in case the mount path does not match the
+	// scheme. A trailing slash, as returned by Vault when listing mounts, is
+	// ignored.
+	ClusterID(mountPath string) (string, bool)
+
+	// MountPath returns the path under which the PKI backend of the given
+	// cluster ID is mounted. The cluster ID must be valid according to
+	// ValidateClusterID. Mount paths look e.g. like
+	//
+	//     pki-<clusterID>
+	//
+	MountPath(clusterID string) string
+}
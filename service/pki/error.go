@@ -15,6 +15,69 @@ func IsInvalidConfig(err error) bool {
 	return microerror.Cause(err) == invalidConfigError
 }
 
+var caNotFoundError = &microerror.Error{
+	Kind: "caNotFoundError",
+}
+
+// IsCANotFound asserts caNotFoundError.
+func IsCANotFound(err error) bool {
+	return microerror.Cause(err) == caNotFoundError
+}
+
+var invalidCertificateError = &microerror.Error{
+	Kind: "invalidCertificateError",
+}
+
+// IsInvalidCertificate asserts invalidCertificateError.
+func IsInvalidCertificate(err error) bool {
+	return microerror.Cause(err) == invalidCertificateError
+}
+
+var notMountedError = &microerror.Error{
+	Kind: "notMountedError",
+}
+
+// IsNotMounted asserts notMountedError.
+func IsNotMounted(err error) bool {
+	return microerror.Cause(err) == notMountedError
+}
+
+var roleNotFoundError = &microerror.Error{
+	Kind: "roleNotFoundError",
+}
+
+// IsRoleNotFound asserts roleNotFoundError.
+func IsRoleNotFound(err error) bool {
+	return microerror.Cause(err) == roleNotFoundError
+}
+
+var caNotExportableError = &microerror.Error{
+	Kind: "caNotExportableError",
+}
+
+// IsCANotExportable asserts caNotExportableError.
+func IsCANotExportable(err error) bool {
+	return microerror.Cause(err) == caNotExportableError
+}
+
+var notSupportedError = &microerror.Error{
+	Kind: "notSupportedError",
+}
+
+// IsNotSupported asserts notSupportedError.
+func IsNotSupported(err error) bool {
+	return microerror.Cause(err) == notSupportedError
+}
+
+var certificateNotFoundError = &microerror.Error{
+	Kind: "certificateNotFoundError",
+}
+
+// IsCertificateNotFound asserts certificateNotFoundError.
+func IsCertificateNotFound(err error) bool {
+	return microerror.Cause(err) == certificateNotFoundError
+}
+
 // IsNoVaultHandlerDefined asserts a dirty string matching against the error
 // message provided by err. This is necessary due to the poor error handling
 // design of the Vault library we are using.
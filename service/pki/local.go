@@ -0,0 +1,656 @@
+package pki
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+
+	localca "github.com/giantswarm/certctl/v2/service/local-ca"
+	"github.com/giantswarm/certctl/v2/service/metrics"
+	"github.com/giantswarm/certctl/v2/service/role"
+)
+
+// LocalServiceConfig represents the configuration used to create a new PKI
+// controller managing local CAs instead of Vault PKI backends.
+type LocalServiceConfig struct {
+	// Dependencies.
+	Logger micrologger.Logger
+	Store  localca.Store
+}
+
+// DefaultLocalServiceConfig provides a default configuration to create a PKI
+// controller managing local CAs.
+func DefaultLocalServiceConfig() LocalServiceConfig {
+	newLogger, err := micrologger.New(micrologger.Config{IOWriter: os.Stderr})
+	if err != nil {
+		panic(err)
+	}
+
+	newConfig := LocalServiceConfig{
+		// Dependencies.
+		Logger: newLogger,
+		Store:  nil,
+	}
+
+	return newConfig
+}
+
+// NewLocalService creates a new configured PKI controller managing local CAs.
+// A local CA takes the place of a cluster's PKI backend, so that mounting it
+// means creating it in the store. Features only Vault provides, i.e. auto-tidy
+// and the issuing certificate and CRL distribution point URLs, are not
+// supported and result in an error asserted by IsNotSupported. All paths
+// returned are the path of the file the cluster's local CA is stored in.
+func NewLocalService(config LocalServiceConfig) (Service, error) {
+	// Dependencies.
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "logger must not be empty")
+	}
+	if config.Store == nil {
+		return nil, microerror.Maskf(invalidConfigError, "store must not be empty")
+	}
+
+	newService := &localService{
+		LocalServiceConfig: config,
+	}
+
+	return newService, nil
+}
+
+type localService struct {
+	LocalServiceConfig
+}
+
+// PKI management.
+
+func (s *localService) CA(clusterID string) (CA, error) {
+	return s.CAWithContext(context.Background(), clusterID)
+}
+
+func (s *localService) CAWithContext(ctx context.Context, clusterID string) (CA, error) {
+	cluster, err := s.Store.Cluster(ctx, clusterID)
+	if localca.IsClusterNotFound(err) {
+		return CA{}, microerror.Maskf(caNotFoundError, "local CA for cluster ID '%s' does not exist", clusterID)
+	} else if err != nil {
+		return CA{}, microerror.Mask(err)
+	}
+	if cluster.CA == nil {
+		return CA{}, microerror.Maskf(caNotFoundError, "root CA for cluster ID '%s' is not generated", clusterID)
+	}
+
+	crt, err := parseCertificate(cluster.CA.Certificate)
+	if err != nil {
+		return CA{}, microerror.Mask(err)
+	}
+
+	newCA := CA{
+		Certificate:  cluster.CA.Certificate,
+		CommonName:   crt.Subject.CommonName,
+		Subject:      crt.Subject.String(),
+		SerialNumber: FormatSerialNumber(crt.SerialNumber.Bytes()),
+		NotBefore:    crt.NotBefore,
+		NotAfter:     crt.NotAfter,
+		KeyType:      keyType(crt),
+	}
+
+	return newCA, nil
+}
+
+func (s *localService) Certificate(clusterID, serialNumber string) (Certificate, error) {
+	return s.CertificateWithContext(context.Background(), clusterID, serialNumber)
+}
+
+func (s *localService) CertificateWithContext(ctx context.Context, clusterID, serialNumber string) (Certificate, error) {
+	cluster, err := s.cluster(ctx, clusterID)
+	if err != nil {
+		return Certificate{}, microerror.Mask(err)
+	}
+	c, ok := cluster.Certificates[normalizeSerialNumber(serialNumber)]
+	if !ok {
+		return Certificate{}, microerror.Maskf(certificateNotFoundError, "certificate with serial number '%s' not found", serialNumber)
+	}
+
+	crt, err := parseCertificate(c.Certificate)
+	if err != nil {
+		return Certificate{}, microerror.Mask(err)
+	}
+
+	newCertificate := Certificate{
+		SerialNumber:   FormatSerialNumber(crt.SerialNumber.Bytes()),
+		CommonName:     crt.Subject.CommonName,
+		DNSNames:       crt.DNSNames,
+		Organizations:  crt.Subject.Organization,
+		NotBefore:      crt.NotBefore,
+		NotAfter:       crt.NotAfter,
+		IsCA:           crt.IsCA,
+		RevocationTime: c.RevocationTime,
+	}
+	for _, ip := range crt.IPAddresses {
+		newCertificate.IPAddresses = append(newCertificate.IPAddresses, ip.String())
+	}
+	for _, u := range crt.URIs {
+		newCertificate.URIs = append(newCertificate.URIs, u.String())
+	}
+
+	return newCertificate, nil
+}
+
+func (s *localService) ConfigureAutoTidy(config AutoTidyConfig) error {
+	return s.ConfigureAutoTidyWithContext(context.Background(), config)
+}
+
+func (s *localService) ConfigureAutoTidyWithContext(ctx context.Context, config AutoTidyConfig) error {
+	return microerror.Maskf(notSupportedError, "auto-tidy is not supported by local CAs")
+}
+
+func (s *localService) ConfigureURLs(config URLsConfig) error {
+	return s.ConfigureURLsWithContext(context.Background(), config)
+}
+
+func (s *localService) ConfigureURLsWithContext(ctx context.Context, config URLsConfig) error {
+	return microerror.Maskf(notSupportedError, "issuing certificate and CRL distribution point URLs are not supported by local CAs")
+}
+
+func (s *localService) CRL(clusterID string) (CRL, error) {
+	return s.CRLWithContext(context.Background(), clusterID)
+}
+
+func (s *localService) CRLWithContext(ctx context.Context, clusterID string) (CRL, error) {
+	cluster, err := s.cluster(ctx, clusterID)
+	if err != nil {
+		return CRL{}, microerror.Mask(err)
+	}
+	if cluster.CA == nil {
+		return CRL{}, microerror.Maskf(caNotFoundError, "root CA for cluster ID '%s' is not generated", clusterID)
+	}
+
+	var revoked []x509.RevocationListEntry
+	for _, c := range cluster.Certificates {
+		if c.RevocationTime == nil {
+			continue
+		}
+		crt, err := parseCertificate(c.Certificate)
+		if err != nil {
+			return CRL{}, microerror.Mask(err)
+		}
+		revoked = append(revoked, x509.RevocationListEntry{
+			SerialNumber:   crt.SerialNumber,
+			RevocationTime: *c.RevocationTime,
+		})
+	}
+	sort.Slice(revoked, func(i, j int) bool {
+		return revoked[i].SerialNumber.Cmp(revoked[j].SerialNumber) < 0
+	})
+
+	crl, err := cluster.CA.CRL(revoked)
+	if err != nil {
+		return CRL{}, microerror.Mask(err)
+	}
+
+	// The CRL is parsed back, so that it is described the same way as the
+	// one served by Vault.
+	block, _ := pem.Decode([]byte(crl))
+	if block == nil {
+		return CRL{}, microerror.Maskf(invalidCertificateError, "CRL for cluster ID '%s' is not PEM encoded", clusterID)
+	}
+	list, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		return CRL{}, microerror.Maskf(invalidCertificateError, "%s", err)
+	}
+
+	newCRL := CRL{
+		PEM:        crl,
+		ThisUpdate: list.ThisUpdate,
+		NextUpdate: list.NextUpdate,
+	}
+	for _, e := range revoked {
+		newCRL.RevokedSerialNumbers = append(newCRL.RevokedSerialNumbers, FormatSerialNumber(e.SerialNumber.Bytes()))
+	}
+
+	return newCRL, nil
+}
+
+func (s *localService) Delete(clusterID string) error {
+	return s.DeleteWithContext(context.Background(), clusterID)
+}
+
+func (s *localService) DeleteWithContext(ctx context.Context, clusterID string) error {
+	err := s.Store.Delete(ctx, clusterID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *localService) IsCAGenerated(clusterID string) (bool, error) {
+	return s.IsCAGeneratedWithContext(context.Background(), clusterID)
+}
+
+func (s *localService) IsCAGeneratedWithContext(ctx context.Context, clusterID string) (bool, error) {
+	cluster, err := s.Store.Cluster(ctx, clusterID)
+	if localca.IsClusterNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	return cluster.CA != nil, nil
+}
+
+func (s *localService) IsMounted(clusterID string) (bool, error) {
+	return s.IsMountedWithContext(context.Background(), clusterID)
+}
+
+func (s *localService) IsMountedWithContext(ctx context.Context, clusterID string) (bool, error) {
+	_, err := s.Store.Cluster(ctx, clusterID)
+	if localca.IsClusterNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	return true, nil
+}
+
+func (s *localService) IsRoleCreated(clusterID string) (bool, error) {
+	return s.IsRoleCreatedWithContext(context.Background(), clusterID)
+}
+
+func (s *localService) IsRoleCreatedWithContext(ctx context.Context, clusterID string) (bool, error) {
+	cluster, err := s.Store.Cluster(ctx, clusterID)
+	if localca.IsClusterNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, microerror.Mask(err)
+	}
+	_, ok := cluster.Roles[s.RoleName(clusterID)]
+
+	return ok, nil
+}
+
+func (s *localService) List() ([]Mount, error) {
+	return s.ListWithContext(context.Background())
+}
+
+func (s *localService) ListWithContext(ctx context.Context) ([]Mount, error) {
+	clusterIDs, err := s.Store.List(ctx)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	var list []Mount
+	for _, clusterID := range clusterIDs {
+		m, err := s.MountWithContext(ctx, clusterID)
+		if IsNotMounted(err) {
+			// The local CA was deleted after listing.
+			continue
+		} else if err != nil {
+			return nil, microerror.Mask(err)
+		}
+		list = append(list, m)
+	}
+
+	return list, nil
+}
+
+func (s *localService) Mount(clusterID string) (Mount, error) {
+	return s.MountWithContext(context.Background(), clusterID)
+}
+
+func (s *localService) MountWithContext(ctx context.Context, clusterID string) (Mount, error) {
+	cluster, err := s.cluster(ctx, clusterID)
+	if err != nil {
+		return Mount{}, microerror.Mask(err)
+	}
+
+	newMount := Mount{
+		ClusterID:   clusterID,
+		Path:        s.MountPKIPath(clusterID),
+		Description: cluster.Description,
+		MaxLeaseTTL: int(cluster.MaxLeaseTTL / time.Second),
+	}
+
+	return newMount, nil
+}
+
+func (s *localService) ListCertificates(clusterID string) ([]string, error) {
+	return s.ListCertificatesWithContext(context.Background(), clusterID)
+}
+
+func (s *localService) ListCertificatesWithContext(ctx context.Context, clusterID string) ([]string, error) {
+	cluster, err := s.cluster(ctx, clusterID)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	var serialNumbers []string
+	for serialNumber := range cluster.Certificates {
+		serialNumbers = append(serialNumbers, serialNumber)
+	}
+	sort.Strings(serialNumbers)
+
+	return serialNumbers, nil
+}
+
+func (s *localService) ListRoles(clusterID string) ([]string, error) {
+	return s.ListRolesWithContext(context.Background(), clusterID)
+}
+
+func (s *localService) ListRolesWithContext(ctx context.Context, clusterID string) ([]string, error) {
+	cluster, err := s.Store.Cluster(ctx, clusterID)
+	if localca.IsClusterNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	var roles []string
+	for name := range cluster.Roles {
+		roles = append(roles, name)
+	}
+	sort.Strings(roles)
+
+	return roles, nil
+}
+
+func (s *localService) Role(clusterID string) (Role, error) {
+	return s.RoleWithContext(context.Background(), clusterID)
+}
+
+func (s *localService) RoleWithContext(ctx context.Context, clusterID string) (Role, error) {
+	cluster, err := s.Store.Cluster(ctx, clusterID)
+	if localca.IsClusterNotFound(err) {
+		return Role{}, microerror.Maskf(roleNotFoundError, "local CA for cluster ID '%s' does not exist", clusterID)
+	} else if err != nil {
+		return Role{}, microerror.Mask(err)
+	}
+	r, ok := cluster.Roles[s.RoleName(clusterID)]
+	if !ok {
+		return Role{}, microerror.Maskf(roleNotFoundError, "PKI role for cluster ID '%s' is not created", clusterID)
+	}
+
+	newRole := Role{
+		Name:             r.Name,
+		AllowedDomains:   r.AllowedDomains,
+		AllowBareDomains: r.AllowBareDomains,
+		AllowSubdomains:  r.AllowSubdomains,
+		AllowedURISANs:   r.AllowedURISANs,
+		Organizations:    r.Organizations,
+		TTL:              int(r.TTL / time.Second),
+		MaxTTL:           int(r.MaxTTL / time.Second),
+	}
+
+	return newRole, nil
+}
+
+func (s *localService) RotateCRL(clusterID string) error {
+	return s.RotateCRLWithContext(context.Background(), clusterID)
+}
+
+func (s *localService) RotateCRLWithContext(ctx context.Context, clusterID string) error {
+	// The CRL of a local CA is generated whenever it is fetched, so there is
+	// nothing to rotate besides checking the local CA exists.
+	_, err := s.cluster(ctx, clusterID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *localService) Tidy(config TidyConfig) error {
+	return s.TidyWithContext(context.Background(), config)
+}
+
+func (s *localService) TidyWithContext(ctx context.Context, config TidyConfig) error {
+	if config.SafetyBuffer == "" {
+		return microerror.Maskf(invalidConfigError, "safety buffer must not be empty")
+	}
+	safetyBuffer, err := time.ParseDuration(config.SafetyBuffer)
+	if err != nil {
+		return microerror.Maskf(invalidConfigError, "safety buffer '%s' is not a valid duration", config.SafetyBuffer)
+	}
+
+	// Unlike Vault, local CAs are tidied right away, so that the result can
+	// be looked up as soon as Tidy returns.
+	update := func(cluster *localca.Cluster) error {
+		result := localca.TidyResult{
+			Time: time.Now().UTC(),
+		}
+		for serialNumber, c := range cluster.Certificates {
+			crt, err := parseCertificate(c.Certificate)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+			if crt.IsCA || !crt.NotAfter.Add(safetyBuffer).Before(result.Time) {
+				continue
+			}
+
+			delete(cluster.Certificates, serialNumber)
+			result.CertStoreDeletedCount++
+			if c.RevocationTime != nil {
+				result.RevokedCertDeletedCount++
+			}
+		}
+		cluster.LastTidy = &result
+
+		return nil
+	}
+	err = s.Store.Update(ctx, config.ClusterID, update)
+	if localca.IsClusterNotFound(err) {
+		return microerror.Maskf(notMountedError, "local CA for cluster ID '%s' does not exist", config.ClusterID)
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *localService) TidyStatus(clusterID string) (TidyStatus, error) {
+	return s.TidyStatusWithContext(context.Background(), clusterID)
+}
+
+func (s *localService) TidyStatusWithContext(ctx context.Context, clusterID string) (TidyStatus, error) {
+	cluster, err := s.cluster(ctx, clusterID)
+	if err != nil {
+		return TidyStatus{}, microerror.Mask(err)
+	}
+	if cluster.LastTidy == nil {
+		return TidyStatus{State: "Inactive"}, nil
+	}
+
+	t := cluster.LastTidy.Time
+	newTidyStatus := TidyStatus{
+		State:                   "Finished",
+		CertStoreDeletedCount:   cluster.LastTidy.CertStoreDeletedCount,
+		RevokedCertDeletedCount: cluster.LastTidy.RevokedCertDeletedCount,
+		TimeStarted:             &t,
+		TimeFinished:            &t,
+	}
+
+	return newTidyStatus, nil
+}
+
+func (s *localService) URLs(clusterID string) (URLs, error) {
+	return s.URLsWithContext(context.Background(), clusterID)
+}
+
+func (s *localService) URLsWithContext(ctx context.Context, clusterID string) (URLs, error) {
+	_, err := s.cluster(ctx, clusterID)
+	if err != nil {
+		return URLs{}, microerror.Mask(err)
+	}
+
+	return URLs{}, nil
+}
+
+func (s *localService) RoleName(clusterID string) string {
+	return role.Name(clusterID, nil)
+}
+
+func (s *localService) Create(config CreateConfig) (CreateResponse, error) {
+	return s.CreateWithContext(context.Background(), config)
+}
+
+func (s *localService) CreateWithContext(ctx context.Context, config CreateConfig) (CreateResponse, error) {
+	if config.ClusterID == "" {
+		return CreateResponse{}, microerror.Maskf(invalidConfigError, "cluster ID must not be empty")
+	}
+	ttl, err := time.ParseDuration(config.TTL)
+	if err != nil {
+		return CreateResponse{}, microerror.Maskf(invalidConfigError, "TTL '%s' is not a valid duration", config.TTL)
+	}
+
+	// Nothing is changed in case any part of the setup is not supported.
+	if config.AutoTidyInterval != "" {
+		return CreateResponse{}, microerror.Maskf(notSupportedError, "auto-tidy is not supported by local CAs")
+	}
+	if config.PKIBaseURL != "" {
+		return CreateResponse{}, microerror.Maskf(notSupportedError, "issuing certificate and CRL distribution point URLs are not supported by local CAs")
+	}
+
+	mounted, err := s.IsMountedWithContext(ctx, config.ClusterID)
+	if err != nil {
+		return CreateResponse{}, microerror.Mask(err)
+	}
+	if !mounted {
+		newCluster := localca.Cluster{
+			ClusterID:   config.ClusterID,
+			Description: fmt.Sprintf("Local CA for cluster ID '%s'", config.ClusterID),
+			MaxLeaseTTL: ttl,
+		}
+		err = s.Store.Create(ctx, newCluster)
+		if err != nil {
+			return CreateResponse{}, microerror.Mask(err)
+		}
+	}
+
+	var newCreateResponse CreateResponse
+	var roleCreated bool
+	update := func(cluster *localca.Cluster) error {
+		if cluster.CA != nil && config.ExportCA {
+			return microerror.Maskf(caNotExportableError, "root CA for cluster ID '%s' is already generated", config.ClusterID)
+		}
+
+		if cluster.CA == nil {
+			if config.CommonName == "" {
+				return microerror.Maskf(invalidConfigError, "common name must not be empty")
+			}
+			ca, err := localca.NewCA(config.CommonName, ttl)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+			cluster.CA = &ca
+
+			crt, err := parseCertificate(ca.Certificate)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+			cluster.Certificates[FormatSerialNumber(crt.SerialNumber.Bytes())] = localca.Certificate{
+				Certificate: ca.Certificate,
+			}
+
+			if config.ExportCA {
+				newCreateResponse.CAPrivateKey = ca.PrivateKey
+			}
+
+			s.Logger.LogCtx(ctx, "level", "debug", "message", "generated root CA", "cluster_id", config.ClusterID, "exported", config.ExportCA)
+		}
+
+		// The role is created with the settings Vault applies to the role
+		// written on setup.
+		roleName := s.RoleName(config.ClusterID)
+		r, ok := cluster.Roles[roleName]
+		if !ok {
+			r = localca.Role{
+				Role: role.Role{
+					Name:             roleName,
+					AllowBareDomains: config.AllowBareDomains,
+					AllowIPSANs:      true,
+					AllowLocalhost:   true,
+					AllowSubdomains:  true,
+					AllowedDomains:   splitList(config.AllowedDomains),
+					TTL:              ttl,
+				},
+			}
+			roleCreated = true
+		}
+		if len(config.AllowedURISANs) != 0 {
+			r.AllowedURISANs = config.AllowedURISANs
+		}
+		cluster.Roles[roleName] = r
+
+		return nil
+	}
+	err = s.Store.Update(ctx, config.ClusterID, update)
+	if err != nil {
+		return CreateResponse{}, microerror.Mask(err)
+	}
+	if roleCreated {
+		metrics.RoleCreations.WithLabelValues(config.ClusterID).Inc()
+
+		s.Logger.LogCtx(ctx, "level", "debug", "message", "created PKI role", "cluster_id", config.ClusterID)
+	}
+
+	return newCreateResponse, nil
+}
+
+// Path management.
+
+func (s *localService) MountPKIPath(clusterID string) string {
+	return s.Store.Path(clusterID)
+}
+
+func (s *localService) WriteCAPath(clusterID string) string {
+	return s.Store.Path(clusterID)
+}
+
+func (s *localService) WriteExportedCAPath(clusterID string) string {
+	return s.Store.Path(clusterID)
+}
+
+func (s *localService) WriteRolePath(clusterID string) string {
+	return s.Store.Path(clusterID)
+}
+
+// cluster returns the state of the cluster's local CA. In case it does not
+// exist an error asserted by IsNotMounted is returned.
+func (s *localService) cluster(ctx context.Context, clusterID string) (localca.Cluster, error) {
+	cluster, err := s.Store.Cluster(ctx, clusterID)
+	if localca.IsClusterNotFound(err) {
+		return localca.Cluster{}, microerror.Maskf(notMountedError, "local CA for cluster ID '%s' does not exist", clusterID)
+	} else if err != nil {
+		return localca.Cluster{}, microerror.Mask(err)
+	}
+
+	return cluster, nil
+}
+
+// normalizeSerialNumber converts a serial number given in the colon or hyphen
+// separated hex format into the one local CAs are keyed by.
+func normalizeSerialNumber(serialNumber string) string {
+	return strings.ToLower(strings.Replace(serialNumber, "-", ":", -1))
+}
+
+// splitList splits a comma separated list, dropping surrounding whitespace
+// and empty items.
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
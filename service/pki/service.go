@@ -1,16 +1,46 @@
 package pki
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
 	vaultclient "github.com/hashicorp/vault/api"
+
+	"github.com/giantswarm/certctl/v2/service/internal/vaultdata"
+	"github.com/giantswarm/certctl/v2/service/metrics"
+	mountpath "github.com/giantswarm/certctl/v2/service/mount-path"
+	"github.com/giantswarm/certctl/v2/service/retry"
+)
+
+const (
+	// namespaceHeaderName is the header the Vault client uses to scope
+	// requests to a Vault Enterprise namespace.
+	namespaceHeaderName = "X-Vault-Namespace"
 )
 
 // ServiceConfig represents the configuration used to create a new PKI controller.
 type ServiceConfig struct {
 	// Dependencies.
-	VaultClient *vaultclient.Client
+	Logger          micrologger.Logger
+	MountPathScheme mountpath.Scheme
+	RetryPolicy     retry.Policy
+	VaultClient     *vaultclient.Client
 }
 
 // DefaultServiceConfig provides a default configuration to create a PKI controller.
@@ -22,9 +52,27 @@ func DefaultServiceConfig() ServiceConfig {
 		panic(err)
 	}
 
+	newLogger, err := micrologger.New(micrologger.Config{IOWriter: os.Stderr})
+	if err != nil {
+		panic(err)
+	}
+
+	newMountPathScheme, err := mountpath.New(mountpath.DefaultConfig())
+	if err != nil {
+		panic(err)
+	}
+
+	newRetryPolicy, err := retry.New(retry.DefaultConfig())
+	if err != nil {
+		panic(err)
+	}
+
 	newConfig := ServiceConfig{
 		// Dependencies.
-		VaultClient: newVaultClient,
+		Logger:          newLogger,
+		MountPathScheme: newMountPathScheme,
+		RetryPolicy:     newRetryPolicy,
+		VaultClient:     newVaultClient,
 	}
 
 	return newConfig
@@ -33,6 +81,15 @@ func DefaultServiceConfig() ServiceConfig {
 // NewService creates a new configured PKI controller.
 func NewService(config ServiceConfig) (Service, error) {
 	// Dependencies.
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "logger must not be empty")
+	}
+	if config.MountPathScheme == nil {
+		return nil, microerror.Maskf(invalidConfigError, "mount path scheme must not be empty")
+	}
+	if config.RetryPolicy == nil {
+		return nil, microerror.Maskf(invalidConfigError, "retry policy must not be empty")
+	}
 	if config.VaultClient == nil {
 		return nil, microerror.Maskf(invalidConfigError, "Vault client must not be empty")
 	}
@@ -50,18 +107,232 @@ type service struct {
 
 // PKI management.
 
+func (s *service) CA(clusterID string) (CA, error) {
+	return s.CAWithContext(context.Background(), clusterID)
+}
+
+func (s *service) CAWithContext(ctx context.Context, clusterID string) (CA, error) {
+	// Create a client for the logical backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.ReadWithContext(ctx, s.ReadCAPath(clusterID))
+	if IsNoVaultHandlerDefined(err) {
+		return CA{}, microerror.Maskf(caNotFoundError, "PKI backend for cluster ID '%s' is not mounted", clusterID)
+	} else if err != nil {
+		return CA{}, microerror.Mask(err)
+	}
+	if secret == nil {
+		return CA{}, microerror.Maskf(caNotFoundError, "root CA for cluster ID '%s' is not generated", clusterID)
+	}
+	certificate, ok := secret.Data["certificate"].(string)
+	if !ok || certificate == "" {
+		return CA{}, microerror.Maskf(caNotFoundError, "root CA for cluster ID '%s' is not generated", clusterID)
+	}
+
+	crt, err := parseCertificate(certificate)
+	if err != nil {
+		return CA{}, microerror.Mask(err)
+	}
+
+	newCA := CA{
+		Certificate:  certificate,
+		CommonName:   crt.Subject.CommonName,
+		Subject:      crt.Subject.String(),
+		SerialNumber: FormatSerialNumber(crt.SerialNumber.Bytes()),
+		NotBefore:    crt.NotBefore,
+		NotAfter:     crt.NotAfter,
+		KeyType:      keyType(crt),
+	}
+
+	return newCA, nil
+}
+
+func (s *service) Certificate(clusterID, serialNumber string) (Certificate, error) {
+	return s.CertificateWithContext(context.Background(), clusterID, serialNumber)
+}
+
+func (s *service) CertificateWithContext(ctx context.Context, clusterID, serialNumber string) (Certificate, error) {
+	// Create a client for the logical backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.ReadWithContext(ctx, s.ReadCertificatePath(clusterID, serialNumber))
+	if IsNoVaultHandlerDefined(err) {
+		return Certificate{}, microerror.Maskf(notMountedError, "PKI backend for cluster ID '%s' is not mounted", clusterID)
+	} else if err != nil {
+		return Certificate{}, microerror.Mask(err)
+	}
+	if secret == nil {
+		return Certificate{}, microerror.Maskf(certificateNotFoundError, "certificate with serial number '%s' not found", serialNumber)
+	}
+	certificate, ok := secret.Data["certificate"].(string)
+	if !ok || certificate == "" {
+		return Certificate{}, microerror.Maskf(certificateNotFoundError, "certificate with serial number '%s' not found", serialNumber)
+	}
+
+	crt, err := parseCertificate(certificate)
+	if err != nil {
+		return Certificate{}, microerror.Mask(err)
+	}
+
+	newCertificate := Certificate{
+		SerialNumber:  FormatSerialNumber(crt.SerialNumber.Bytes()),
+		CommonName:    crt.Subject.CommonName,
+		DNSNames:      crt.DNSNames,
+		Organizations: crt.Subject.Organization,
+		NotBefore:     crt.NotBefore,
+		NotAfter:      crt.NotAfter,
+		IsCA:          crt.IsCA,
+	}
+	for _, ip := range crt.IPAddresses {
+		newCertificate.IPAddresses = append(newCertificate.IPAddresses, ip.String())
+	}
+	for _, u := range crt.URIs {
+		newCertificate.URIs = append(newCertificate.URIs, u.String())
+	}
+
+	// Vault reports a revocation time of zero for certificates not revoked.
+	if seconds := toInt(secret.Data["revocation_time"]); seconds != 0 {
+		t := time.Unix(int64(seconds), 0).UTC()
+		newCertificate.RevocationTime = &t
+	}
+
+	return newCertificate, nil
+}
+
+func (s *service) ConfigureAutoTidy(config AutoTidyConfig) error {
+	return s.ConfigureAutoTidyWithContext(context.Background(), config)
+}
+
+func (s *service) ConfigureAutoTidyWithContext(ctx context.Context, config AutoTidyConfig) error {
+	if config.Interval == "" {
+		return microerror.Maskf(invalidConfigError, "interval must not be empty")
+	}
+	if config.SafetyBuffer == "" {
+		return microerror.Maskf(invalidConfigError, "safety buffer must not be empty")
+	}
+
+	// Create a client for the logical backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	logicalBackend := s.VaultClient.Logical()
+
+	data := map[string]interface{}{
+		"enabled":            true,
+		"interval_duration":  config.Interval,
+		"safety_buffer":      config.SafetyBuffer,
+		"tidy_cert_store":    true,
+		"tidy_revoked_certs": true,
+	}
+	_, err := logicalBackend.WriteWithContext(ctx, s.AutoTidyPath(config.ClusterID), data)
+	if IsNoVaultHandlerDefined(err) {
+		return microerror.Maskf(notMountedError, "PKI backend for cluster ID '%s' is not mounted or Vault does not support auto-tidy", config.ClusterID)
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *service) ConfigureURLs(config URLsConfig) error {
+	return s.ConfigureURLsWithContext(context.Background(), config)
+}
+
+func (s *service) ConfigureURLsWithContext(ctx context.Context, config URLsConfig) error {
+	if config.PKIBaseURL == "" {
+		return microerror.Maskf(invalidConfigError, "PKI base URL must not be empty")
+	}
+	u, err := url.Parse(config.PKIBaseURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return microerror.Maskf(invalidConfigError, "PKI base URL '%s' must be an absolute URL", config.PKIBaseURL)
+	}
+
+	// The URLs are fetched by arbitrary clients, so they have to include the
+	// namespace the PKI backend is mounted in, if any.
+	base := strings.TrimSuffix(config.PKIBaseURL, "/") + "/v1/"
+	if namespace := strings.Trim(s.VaultClient.Headers().Get(namespaceHeaderName), "/"); namespace != "" {
+		base += namespace + "/"
+	}
+	base += s.MountPKIPath(config.ClusterID)
+
+	// Create a client for the logical backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	logicalBackend := s.VaultClient.Logical()
+
+	data := map[string]interface{}{
+		"issuing_certificates":    base + "/ca",
+		"crl_distribution_points": base + "/crl",
+	}
+	_, err = logicalBackend.WriteWithContext(ctx, s.URLsPath(config.ClusterID), data)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *service) CRL(clusterID string) (CRL, error) {
+	return s.CRLWithContext(context.Background(), clusterID)
+}
+
+func (s *service) CRLWithContext(ctx context.Context, clusterID string) (CRL, error) {
+	// The CRL is not served as JSON, so it is fetched using a raw request.
+	resp, err := s.VaultClient.Logical().ReadRawWithContext(ctx, s.ReadCRLPath(clusterID))
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return CRL{}, microerror.Maskf(notMountedError, "PKI backend for cluster ID '%s' is not mounted", clusterID)
+	} else if err != nil {
+		return CRL{}, microerror.Mask(err)
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return CRL{}, microerror.Mask(err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return CRL{}, microerror.Maskf(invalidCertificateError, "CRL for cluster ID '%s' is not PEM encoded", clusterID)
+	}
+	list, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		return CRL{}, microerror.Maskf(invalidCertificateError, "%s", err)
+	}
+
+	newCRL := CRL{
+		PEM:        string(b),
+		ThisUpdate: list.ThisUpdate,
+		NextUpdate: list.NextUpdate,
+	}
+	for _, e := range list.RevokedCertificateEntries {
+		newCRL.RevokedSerialNumbers = append(newCRL.RevokedSerialNumbers, FormatSerialNumber(e.SerialNumber.Bytes()))
+	}
+
+	return newCRL, nil
+}
+
 func (s *service) Delete(clusterID string) error {
+	return s.DeleteWithContext(context.Background(), clusterID)
+}
+
+func (s *service) DeleteWithContext(ctx context.Context, clusterID string) error {
+	err := mountpath.ValidateClusterID(clusterID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
 	// Create a client for the system backend configured with the Vault token
 	// used for the current cluster's PKI backend.
 	sysBackend := s.VaultClient.Sys()
 
 	// Unmount the PKI backend, if it exists.
-	mounted, err := s.IsMounted(clusterID)
+	mounted, err := s.IsMountedWithContext(ctx, clusterID)
 	if err != nil {
 		return microerror.Mask(err)
 	}
 	if mounted {
-		err = sysBackend.Unmount(s.MountPKIPath(clusterID))
+		err = sysBackend.UnmountWithContext(ctx, s.MountPKIPath(clusterID))
 		if err != nil {
 			return microerror.Mask(err)
 		}
@@ -71,12 +342,16 @@ func (s *service) Delete(clusterID string) error {
 }
 
 func (s *service) IsCAGenerated(clusterID string) (bool, error) {
+	return s.IsCAGeneratedWithContext(context.Background(), clusterID)
+}
+
+func (s *service) IsCAGeneratedWithContext(ctx context.Context, clusterID string) (bool, error) {
 	// Create a client for the logical backend configured with the Vault token
 	// used for the current cluster's PKI backend.
 	logicalBackend := s.VaultClient.Logical()
 
 	// Check if a root CA for the given cluster ID exists.
-	secret, err := logicalBackend.Read(s.ReadCAPath(clusterID))
+	secret, err := logicalBackend.ReadWithContext(ctx, s.ReadCAPath(clusterID))
 	if IsNoVaultHandlerDefined(err) {
 		return false, nil
 	} else if err != nil {
@@ -99,12 +374,16 @@ func (s *service) IsCAGenerated(clusterID string) (bool, error) {
 }
 
 func (s *service) IsMounted(clusterID string) (bool, error) {
+	return s.IsMountedWithContext(context.Background(), clusterID)
+}
+
+func (s *service) IsMountedWithContext(ctx context.Context, clusterID string) (bool, error) {
 	// Create a client for the system backend configured with the Vault token
 	// used for the current cluster's PKI backend.
 	sysBackend := s.VaultClient.Sys()
 
 	// Check if a PKI for the given cluster ID exists.
-	mounts, err := sysBackend.ListMounts()
+	mounts, err := sysBackend.ListMountsWithContext(ctx)
 	if IsNoVaultHandlerDefined(err) {
 		return false, nil
 	} else if err != nil {
@@ -119,12 +398,16 @@ func (s *service) IsMounted(clusterID string) (bool, error) {
 }
 
 func (s *service) IsRoleCreated(clusterID string) (bool, error) {
+	return s.IsRoleCreatedWithContext(context.Background(), clusterID)
+}
+
+func (s *service) IsRoleCreatedWithContext(ctx context.Context, clusterID string) (bool, error) {
 	// Create a client for the logical backend configured with the Vault token
 	// used for the current cluster's PKI backend.
 	logicalBackend := s.VaultClient.Logical()
 
 	// Check if a PKI for the given cluster ID exists.
-	secret, err := logicalBackend.List(s.ListRolesPath(clusterID))
+	secret, err := logicalBackend.ListWithContext(ctx, s.ListRolesPath(clusterID))
 	if IsNoVaultHandlerDefined(err) {
 		return false, nil
 	} else if err != nil {
@@ -152,19 +435,343 @@ func (s *service) IsRoleCreated(clusterID string) (bool, error) {
 	return false, nil
 }
 
+func (s *service) List() ([]Mount, error) {
+	return s.ListWithContext(context.Background())
+}
+
+func (s *service) ListWithContext(ctx context.Context) ([]Mount, error) {
+	// Create a client for the system backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	sysBackend := s.VaultClient.Sys()
+
+	mounts, err := sysBackend.ListMountsWithContext(ctx)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	// Only PKI backends mounted according to the mount path scheme are
+	// considered to be managed by certctl.
+	var list []Mount
+	for path, mountOutput := range mounts {
+		if mountOutput.Type != "pki" {
+			continue
+		}
+		clusterID, ok := s.MountPathScheme.ClusterID(path)
+		if !ok {
+			continue
+		}
+
+		m := Mount{
+			ClusterID:       clusterID,
+			Path:            strings.TrimSuffix(path, "/"),
+			Description:     mountOutput.Description,
+			DefaultLeaseTTL: mountOutput.Config.DefaultLeaseTTL,
+			MaxLeaseTTL:     mountOutput.Config.MaxLeaseTTL,
+		}
+		list = append(list, m)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ClusterID < list[j].ClusterID
+	})
+
+	return list, nil
+}
+
+func (s *service) Mount(clusterID string) (Mount, error) {
+	return s.MountWithContext(context.Background(), clusterID)
+}
+
+func (s *service) MountWithContext(ctx context.Context, clusterID string) (Mount, error) {
+	// Create a client for the system backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	sysBackend := s.VaultClient.Sys()
+
+	mounts, err := sysBackend.ListMountsWithContext(ctx)
+	if err != nil {
+		return Mount{}, microerror.Mask(err)
+	}
+	mountOutput, ok := mounts[s.ListMountsPath(clusterID)+"/"]
+	if !ok || mountOutput.Type != "pki" {
+		return Mount{}, microerror.Maskf(notMountedError, "PKI backend for cluster ID '%s' is not mounted", clusterID)
+	}
+
+	newMount := Mount{
+		ClusterID:       clusterID,
+		Path:            s.MountPKIPath(clusterID),
+		Description:     mountOutput.Description,
+		DefaultLeaseTTL: mountOutput.Config.DefaultLeaseTTL,
+		MaxLeaseTTL:     mountOutput.Config.MaxLeaseTTL,
+	}
+
+	return newMount, nil
+}
+
+func (s *service) ListCertificates(clusterID string) ([]string, error) {
+	return s.ListCertificatesWithContext(context.Background(), clusterID)
+}
+
+func (s *service) ListCertificatesWithContext(ctx context.Context, clusterID string) ([]string, error) {
+	// Create a client for the logical backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.ListWithContext(ctx, s.ListCertificatesPath(clusterID))
+	if IsNoVaultHandlerDefined(err) {
+		return nil, microerror.Maskf(notMountedError, "PKI backend for cluster ID '%s' is not mounted", clusterID)
+	} else if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	// In case there is not a single certificate, secret is nil.
+	if secret == nil {
+		return nil, nil
+	}
+
+	// Vault lists serial numbers hyphen separated, but reports them colon
+	// separated everywhere else.
+	var serialNumbers []string
+	for _, k := range vaultdata.ToStrings(secret.Data["keys"]) {
+		serialNumbers = append(serialNumbers, strings.Replace(k, "-", ":", -1))
+	}
+
+	return serialNumbers, nil
+}
+
+func (s *service) ListRoles(clusterID string) ([]string, error) {
+	return s.ListRolesWithContext(context.Background(), clusterID)
+}
+
+func (s *service) ListRolesWithContext(ctx context.Context, clusterID string) ([]string, error) {
+	// Create a client for the logical backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.ListWithContext(ctx, s.ListRolesPath(clusterID))
+	if IsNoVaultHandlerDefined(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	// In case there is not a single role for this PKI backend, secret is nil.
+	if secret == nil {
+		return nil, nil
+	}
+
+	var roles []string
+	if keys, ok := secret.Data["keys"]; ok {
+		if list, ok := keys.([]interface{}); ok {
+			for _, k := range list {
+				if str, ok := k.(string); ok {
+					roles = append(roles, str)
+				}
+			}
+		}
+	}
+
+	return roles, nil
+}
+
+func (s *service) Role(clusterID string) (Role, error) {
+	return s.RoleWithContext(context.Background(), clusterID)
+}
+
+func (s *service) RoleWithContext(ctx context.Context, clusterID string) (Role, error) {
+	// Create a client for the logical backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.ReadWithContext(ctx, s.WriteRolePath(clusterID))
+	if IsNoVaultHandlerDefined(err) {
+		return Role{}, microerror.Maskf(roleNotFoundError, "PKI backend for cluster ID '%s' is not mounted", clusterID)
+	} else if err != nil {
+		return Role{}, microerror.Mask(err)
+	}
+	if secret == nil {
+		return Role{}, microerror.Maskf(roleNotFoundError, "PKI role for cluster ID '%s' is not created", clusterID)
+	}
+
+	newRole := Role{
+		Name:             s.RoleName(clusterID),
+		AllowedDomains:   vaultdata.ToStrings(secret.Data["allowed_domains"]),
+		AllowBareDomains: vaultdata.ToBool(secret.Data["allow_bare_domains"], false),
+		AllowSubdomains:  vaultdata.ToBool(secret.Data["allow_subdomains"], false),
+		AllowedURISANs:   vaultdata.ToStrings(secret.Data["allowed_uri_sans"]),
+		AllowedOtherSANs: vaultdata.ToStrings(secret.Data["allowed_other_sans"]),
+		Organizations:    vaultdata.ToStrings(secret.Data["organization"]),
+		TTL:              toInt(secret.Data["ttl"]),
+		MaxTTL:           toInt(secret.Data["max_ttl"]),
+	}
+
+	return newRole, nil
+}
+
+func (s *service) RotateCRL(clusterID string) error {
+	return s.RotateCRLWithContext(context.Background(), clusterID)
+}
+
+func (s *service) RotateCRLWithContext(ctx context.Context, clusterID string) error {
+	// Create a client for the logical backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	logicalBackend := s.VaultClient.Logical()
+
+	_, err := logicalBackend.ReadWithContext(ctx, s.RotateCRLPath(clusterID))
+	if IsNoVaultHandlerDefined(err) {
+		return microerror.Maskf(notMountedError, "PKI backend for cluster ID '%s' is not mounted", clusterID)
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *service) Tidy(config TidyConfig) error {
+	return s.TidyWithContext(context.Background(), config)
+}
+
+func (s *service) TidyWithContext(ctx context.Context, config TidyConfig) error {
+	if config.SafetyBuffer == "" {
+		return microerror.Maskf(invalidConfigError, "safety buffer must not be empty")
+	}
+
+	// Create a client for the logical backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	logicalBackend := s.VaultClient.Logical()
+
+	data := map[string]interface{}{
+		"safety_buffer":      config.SafetyBuffer,
+		"tidy_cert_store":    true,
+		"tidy_revoked_certs": true,
+	}
+	_, err := logicalBackend.WriteWithContext(ctx, s.TidyPath(config.ClusterID), data)
+	if IsNoVaultHandlerDefined(err) {
+		return microerror.Maskf(notMountedError, "PKI backend for cluster ID '%s' is not mounted", config.ClusterID)
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *service) TidyStatus(clusterID string) (TidyStatus, error) {
+	return s.TidyStatusWithContext(context.Background(), clusterID)
+}
+
+func (s *service) TidyStatusWithContext(ctx context.Context, clusterID string) (TidyStatus, error) {
+	// Create a client for the logical backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.ReadWithContext(ctx, s.TidyStatusPath(clusterID))
+	if IsNoVaultHandlerDefined(err) {
+		return TidyStatus{}, microerror.Maskf(notMountedError, "PKI backend for cluster ID '%s' is not mounted or Vault does not report the tidy status", clusterID)
+	} else if err != nil {
+		return TidyStatus{}, microerror.Mask(err)
+	}
+	if secret == nil {
+		return TidyStatus{State: "Inactive"}, nil
+	}
+
+	newTidyStatus := TidyStatus{
+		State:                   toString(secret.Data["state"]),
+		Error:                   toString(secret.Data["error"]),
+		CertStoreDeletedCount:   toInt(secret.Data["cert_store_deleted_count"]),
+		RevokedCertDeletedCount: toInt(secret.Data["revoked_cert_deleted_count"]),
+		TimeStarted:             toTime(secret.Data["time_started"]),
+		TimeFinished:            toTime(secret.Data["time_finished"]),
+	}
+
+	return newTidyStatus, nil
+}
+
+func (s *service) URLs(clusterID string) (URLs, error) {
+	return s.URLsWithContext(context.Background(), clusterID)
+}
+
+func (s *service) URLsWithContext(ctx context.Context, clusterID string) (URLs, error) {
+	// Create a client for the logical backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.ReadWithContext(ctx, s.URLsPath(clusterID))
+	if IsNoVaultHandlerDefined(err) {
+		return URLs{}, microerror.Maskf(notMountedError, "PKI backend for cluster ID '%s' is not mounted", clusterID)
+	} else if err != nil {
+		return URLs{}, microerror.Mask(err)
+	}
+	if secret == nil {
+		return URLs{}, nil
+	}
+
+	newURLs := URLs{
+		IssuingCertificates:   vaultdata.ToStrings(secret.Data["issuing_certificates"]),
+		CRLDistributionPoints: vaultdata.ToStrings(secret.Data["crl_distribution_points"]),
+	}
+
+	return newURLs, nil
+}
+
 func (s *service) RoleName(clusterID string) string {
 	return fmt.Sprintf("role-%s", clusterID)
 }
 
-func (s *service) Create(config CreateConfig) error {
+func (s *service) Create(config CreateConfig) (CreateResponse, error) {
+	return s.CreateWithContext(context.Background(), config)
+}
+
+func (s *service) CreateWithContext(ctx context.Context, config CreateConfig) (CreateResponse, error) {
+	// Each step of the setup is only taken in case it was not taken before,
+	// so the setup is retried as a whole. An exported root CA is the
+	// exception, because its private key is lost in case the root CA was
+	// generated by an attempt whose response did not arrive.
+	if config.ExportCA {
+		return s.create(ctx, config)
+	}
+
+	var newCreateResponse CreateResponse
+	o := func() error {
+		var err error
+		newCreateResponse, err = s.create(ctx, config)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		return nil
+	}
+	err := s.RetryPolicy.Do(ctx, o)
+	if err != nil {
+		return CreateResponse{}, microerror.Mask(err)
+	}
+
+	return newCreateResponse, nil
+}
+
+func (s *service) create(ctx context.Context, config CreateConfig) (CreateResponse, error) {
+	err := mountpath.ValidateClusterID(config.ClusterID)
+	if err != nil {
+		return CreateResponse{}, microerror.Mask(err)
+	}
+
 	// Create a client for the system backend configured with the Vault token
 	// used for the current cluster's PKI backend.
 	sysBackend := s.VaultClient.Sys()
 
+	// The private key of a root CA can only ever be exported on generation.
+	// So in case exporting is requested for an already generated root CA,
+	// nothing is done at all.
+	generated, err := s.IsCAGeneratedWithContext(ctx, config.ClusterID)
+	if err != nil {
+		return CreateResponse{}, microerror.Mask(err)
+	}
+	if generated && config.ExportCA {
+		return CreateResponse{}, microerror.Maskf(caNotExportableError, "root CA for cluster ID '%s' is already generated", config.ClusterID)
+	}
+
 	// Mount a new PKI backend for the cluster, if it does not already exist.
-	mounted, err := s.IsMounted(config.ClusterID)
+	mounted, err := s.IsMountedWithContext(ctx, config.ClusterID)
 	if err != nil {
-		return microerror.Mask(err)
+		return CreateResponse{}, microerror.Mask(err)
 	}
 	if !mounted {
 		newMountConfig := &vaultclient.MountInput{
@@ -174,10 +781,12 @@ func (s *service) Create(config CreateConfig) error {
 				MaxLeaseTTL: config.TTL,
 			},
 		}
-		err = sysBackend.Mount(s.MountPKIPath(config.ClusterID), newMountConfig)
+		err = sysBackend.MountWithContext(ctx, s.MountPKIPath(config.ClusterID), newMountConfig)
 		if err != nil {
-			return microerror.Mask(err)
+			return CreateResponse{}, microerror.Mask(err)
 		}
+
+		s.Logger.LogCtx(ctx, "level", "debug", "message", "mounted PKI backend", "cluster_id", config.ClusterID, "path", s.MountPKIPath(config.ClusterID))
 	}
 
 	// Create a client for the logical backend configured with the Vault token
@@ -186,25 +795,41 @@ func (s *service) Create(config CreateConfig) error {
 
 	// Generate a certificate authority for the PKI backend, if it does not
 	// already exist.
-	generated, err := s.IsCAGenerated(config.ClusterID)
-	if err != nil {
-		return microerror.Mask(err)
-	}
+	var newCreateResponse CreateResponse
 	if !generated {
 		data := map[string]interface{}{
 			"ttl":         config.TTL,
 			"common_name": config.CommonName,
 		}
-		_, err = logicalBackend.Write(s.WriteCAPath(config.ClusterID), data)
+
+		path := s.WriteCAPath(config.ClusterID)
+		if config.ExportCA {
+			path = s.WriteExportedCAPath(config.ClusterID)
+		}
+
+		secret, err := logicalBackend.WriteWithContext(ctx, path, data)
 		if err != nil {
-			return microerror.Mask(err)
+			return CreateResponse{}, microerror.Mask(err)
+		}
+
+		if config.ExportCA {
+			if secret == nil {
+				return CreateResponse{}, microerror.Maskf(caNotExportableError, "root CA private key missing")
+			}
+			key, ok := secret.Data["private_key"].(string)
+			if !ok || key == "" {
+				return CreateResponse{}, microerror.Maskf(caNotExportableError, "root CA private key missing")
+			}
+			newCreateResponse.CAPrivateKey = key
 		}
+
+		s.Logger.LogCtx(ctx, "level", "debug", "message", "generated root CA", "cluster_id", config.ClusterID, "exported", config.ExportCA)
 	}
 
 	// Create a role for the mounted PKI backend, if it does not already exist.
-	created, err := s.IsRoleCreated(config.ClusterID)
+	created, err := s.IsRoleCreatedWithContext(ctx, config.ClusterID)
 	if err != nil {
-		return microerror.Mask(err)
+		return CreateResponse{}, microerror.Mask(err)
 	}
 	if !created {
 		data := map[string]interface{}{
@@ -213,38 +838,240 @@ func (s *service) Create(config CreateConfig) error {
 			"ttl":                config.TTL,
 			"allow_bare_domains": config.AllowBareDomains,
 		}
+		if len(config.AllowedURISANs) != 0 {
+			data["allowed_uri_sans"] = strings.Join(config.AllowedURISANs, ",")
+		}
+		if len(config.AllowedOtherSANs) != 0 {
+			data["allowed_other_sans"] = strings.Join(config.AllowedOtherSANs, ",")
+		}
 
-		_, err = logicalBackend.Write(s.WriteRolePath(config.ClusterID), data)
+		_, err = logicalBackend.WriteWithContext(ctx, s.WriteRolePath(config.ClusterID), data)
 		if err != nil {
-			return microerror.Mask(err)
+			return CreateResponse{}, microerror.Mask(err)
+		}
+		metrics.RoleCreations.WithLabelValues(config.ClusterID).Inc()
+
+		s.Logger.LogCtx(ctx, "level", "debug", "message", "created PKI role", "cluster_id", config.ClusterID)
+	} else if len(config.AllowedURISANs) != 0 || len(config.AllowedOtherSANs) != 0 {
+		// The requested SANs are allowed in addition to the ones allowed
+		// already, e.g. by the operator. Only the allowed SANs are patched,
+		// since writing a role replaces all of its settings.
+		r, err := s.RoleWithContext(ctx, config.ClusterID)
+		if err != nil {
+			return CreateResponse{}, microerror.Mask(err)
+		}
+
+		data := map[string]interface{}{}
+		if sans, changed := mergeSANs(r.AllowedURISANs, config.AllowedURISANs); changed {
+			data["allowed_uri_sans"] = strings.Join(sans, ",")
+		}
+		if sans, changed := mergeSANs(r.AllowedOtherSANs, config.AllowedOtherSANs); changed {
+			data["allowed_other_sans"] = strings.Join(sans, ",")
+		}
+
+		if len(data) != 0 {
+			_, err = logicalBackend.JSONMergePatch(ctx, s.WriteRolePath(config.ClusterID), data)
+			if err != nil {
+				return CreateResponse{}, microerror.Mask(err)
+			}
+
+			s.Logger.LogCtx(ctx, "level", "debug", "message", "allowed SANs of PKI role", "cluster_id", config.ClusterID)
 		}
 	}
 
-	return nil
+	// Enable automatic tidying, if requested. It is configured on every call,
+	// so that a changed interval applies to existing clusters as well.
+	if config.AutoTidyInterval != "" {
+		autoTidyConfig := AutoTidyConfig{
+			ClusterID:    config.ClusterID,
+			Interval:     config.AutoTidyInterval,
+			SafetyBuffer: config.TidySafetyBuffer,
+		}
+		err = s.ConfigureAutoTidyWithContext(ctx, autoTidyConfig)
+		if err != nil {
+			return CreateResponse{}, microerror.Mask(err)
+		}
+	}
+
+	// Configure the URLs embedded into issued certificates, if requested.
+	// Writing them again is harmless, so this is not checked beforehand.
+	if config.PKIBaseURL != "" {
+		urlsConfig := URLsConfig{
+			ClusterID:  config.ClusterID,
+			PKIBaseURL: config.PKIBaseURL,
+		}
+		err = s.ConfigureURLsWithContext(ctx, urlsConfig)
+		if err != nil {
+			return CreateResponse{}, microerror.Mask(err)
+		}
+	}
+
+	return newCreateResponse, nil
 }
 
 // Path management.
 
 func (s *service) ReadCAPath(clusterID string) string {
-	return fmt.Sprintf("pki-%s/cert/ca", clusterID)
+	return fmt.Sprintf("%s/cert/ca", s.MountPKIPath(clusterID))
 }
 
 func (s *service) MountPKIPath(clusterID string) string {
-	return fmt.Sprintf("pki-%s", clusterID)
+	return s.MountPathScheme.MountPath(clusterID)
 }
 
 func (s *service) ListMountsPath(clusterID string) string {
-	return fmt.Sprintf("pki-%s", clusterID)
+	return s.MountPKIPath(clusterID)
+}
+
+func (s *service) AutoTidyPath(clusterID string) string {
+	return fmt.Sprintf("%s/config/auto-tidy", s.MountPKIPath(clusterID))
+}
+
+func (s *service) TidyPath(clusterID string) string {
+	return fmt.Sprintf("%s/tidy", s.MountPKIPath(clusterID))
+}
+
+func (s *service) TidyStatusPath(clusterID string) string {
+	return fmt.Sprintf("%s/tidy-status", s.MountPKIPath(clusterID))
+}
+
+func (s *service) ListCertificatesPath(clusterID string) string {
+	return fmt.Sprintf("%s/certs/", s.MountPKIPath(clusterID))
+}
+
+func (s *service) ReadCertificatePath(clusterID, serialNumber string) string {
+	return fmt.Sprintf("%s/cert/%s", s.MountPKIPath(clusterID), serialNumber)
+}
+
+func (s *service) ReadCRLPath(clusterID string) string {
+	return fmt.Sprintf("%s/crl/pem", s.MountPKIPath(clusterID))
+}
+
+func (s *service) RotateCRLPath(clusterID string) string {
+	return fmt.Sprintf("%s/crl/rotate", s.MountPKIPath(clusterID))
+}
+
+func (s *service) URLsPath(clusterID string) string {
+	return fmt.Sprintf("%s/config/urls", s.MountPKIPath(clusterID))
 }
 
 func (s *service) ListRolesPath(clusterID string) string {
-	return fmt.Sprintf("pki-%s/roles/", clusterID)
+	return fmt.Sprintf("%s/roles/", s.MountPKIPath(clusterID))
 }
 
 func (s *service) WriteCAPath(clusterID string) string {
-	return fmt.Sprintf("pki-%s/root/generate/internal", clusterID)
+	return fmt.Sprintf("%s/root/generate/internal", s.MountPKIPath(clusterID))
+}
+
+func (s *service) WriteExportedCAPath(clusterID string) string {
+	return fmt.Sprintf("%s/root/generate/exported", s.MountPKIPath(clusterID))
 }
 
 func (s *service) WriteRolePath(clusterID string) string {
-	return fmt.Sprintf("pki-%s/roles/%s", clusterID, s.RoleName(clusterID))
+	return fmt.Sprintf("%s/roles/%s", s.MountPKIPath(clusterID), s.RoleName(clusterID))
+}
+
+// parseCertificate decodes the first PEM block of the given string and parses
+// it as X.509 certificate.
+func parseCertificate(s string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, microerror.Maskf(invalidCertificateError, "PEM block missing")
+	}
+	crt, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, microerror.Maskf(invalidCertificateError, "%s", err)
+	}
+
+	return crt, nil
+}
+
+// FormatSerialNumber formats a serial number the way Vault does, as colon
+// separated hex bytes.
+func FormatSerialNumber(b []byte) string {
+	parts := make([]string, len(b))
+	for i, v := range b {
+		parts[i] = fmt.Sprintf("%02x", v)
+	}
+
+	return strings.Join(parts, ":")
+}
+
+// keyType describes the type and size of the given certificate's public key.
+func keyType(crt *x509.Certificate) string {
+	switch k := crt.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA %d", k.Params().BitSize)
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return crt.PublicKeyAlgorithm.String()
+	}
+}
+
+// toString converts a value of a Vault response into a string.
+func toString(v interface{}) string {
+	if str, ok := v.(string); ok {
+		return str
+	}
+
+	return ""
+}
+
+// toTime parses an RFC 3339 time as returned by Vault. Empty and invalid
+// values result in nil.
+func toTime(v interface{}) *time.Time {
+	str, ok := v.(string)
+	if !ok || str == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, str)
+	if err != nil {
+		return nil
+	}
+
+	return &t
+}
+
+// toInt converts a value of a Vault response into an integer. Durations are
+// returned by Vault in seconds.
+func toInt(v interface{}) int {
+	switch t := v.(type) {
+	case json.Number:
+		i, _ := t.Int64()
+		return int(i)
+	case float64:
+		return int(t)
+	case int:
+		return t
+	case string:
+		i, _ := strconv.Atoi(t)
+		return i
+	}
+
+	return 0
+}
+
+// mergeSANs returns the allowed SANs extended by the requested ones not
+// allowed yet, and whether any were added.
+func mergeSANs(allowed, requested []string) ([]string, bool) {
+	merged := append([]string(nil), allowed...)
+	seen := map[string]bool{}
+	for _, san := range allowed {
+		seen[san] = true
+	}
+
+	var changed bool
+	for _, san := range requested {
+		if seen[san] {
+			continue
+		}
+		seen[san] = true
+		merged = append(merged, san)
+		changed = true
+	}
+
+	return merged, changed
 }
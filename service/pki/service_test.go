@@ -0,0 +1,170 @@
+package pki
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	vaultclient "github.com/hashicorp/vault/api"
+)
+
+// Test_Service_Create_ExistingRole verifies that SANs requested for an
+// existing role are allowed in addition to the ones it allows already, and
+// that only the allowed SANs are patched.
+func Test_Service_Create_ExistingRole(t *testing.T) {
+	testCases := []struct {
+		name          string
+		role          string
+		config        CreateConfig
+		expectedPatch map[string]interface{}
+	}{
+		{
+			name: "new URI SANs",
+			role: `{"data":{"allowed_domains":["example.com"],"allowed_uri_sans":["spiffe://example.org/operator/*"],"max_ttl":3600}}`,
+			config: CreateConfig{
+				AllowedURISANs: []string{"spiffe://example.org/cluster/abc/*"},
+			},
+			expectedPatch: map[string]interface{}{
+				"allowed_uri_sans": "spiffe://example.org/operator/*,spiffe://example.org/cluster/abc/*",
+			},
+		},
+		{
+			name: "new other SANs",
+			role: `{"data":{"allowed_domains":["example.com"],"allowed_uri_sans":["spiffe://example.org/cluster/abc/*"],"allowed_other_sans":["1.2.3;UTF8:foo"]}}`,
+			config: CreateConfig{
+				AllowedURISANs:   []string{"spiffe://example.org/cluster/abc/*"},
+				AllowedOtherSANs: []string{"1.2.3;UTF8:foo", "1.3.6.1.4.1.311.20.2.3;UTF8:*@example.com"},
+			},
+			expectedPatch: map[string]interface{}{
+				"allowed_other_sans": "1.2.3;UTF8:foo,1.3.6.1.4.1.311.20.2.3;UTF8:*@example.com",
+			},
+		},
+		{
+			name: "SANs allowed already",
+			role: `{"data":{"allowed_domains":["example.com"],"allowed_uri_sans":["spiffe://example.org/cluster/abc/*"]}}`,
+			config: CreateConfig{
+				AllowedURISANs: []string{"spiffe://example.org/cluster/abc/*"},
+			},
+			expectedPatch: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var patch map[string]interface{}
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/v1/pki-abc/cert/ca":
+					_, _ = w.Write([]byte(`{"data":{"certificate":"-----BEGIN CERTIFICATE-----"}}`))
+				case r.URL.Path == "/v1/sys/mounts":
+					_, _ = w.Write([]byte(`{"data":{"pki-abc/":{"type":"pki"}}}`))
+				case r.URL.Path == "/v1/pki-abc/roles/" || r.URL.Path == "/v1/pki-abc/roles":
+					_, _ = w.Write([]byte(`{"data":{"keys":["role-abc"]}}`))
+				case r.URL.Path == "/v1/pki-abc/roles/role-abc" && r.Method == http.MethodGet:
+					_, _ = w.Write([]byte(tc.role))
+				case r.URL.Path == "/v1/pki-abc/roles/role-abc" && r.Method == http.MethodPatch:
+					if r.Header.Get("Content-Type") != "application/merge-patch+json" {
+						w.WriteHeader(http.StatusUnsupportedMediaType)
+						return
+					}
+					err := json.NewDecoder(r.Body).Decode(&patch)
+					if err != nil {
+						w.WriteHeader(http.StatusBadRequest)
+						return
+					}
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusMethodNotAllowed)
+				}
+			}))
+			defer s.Close()
+
+			clientConfig := vaultclient.DefaultConfig()
+			clientConfig.Address = s.URL
+			vaultClient, err := vaultclient.NewClient(clientConfig)
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			vaultClient.SetMaxRetries(0)
+			vaultClient.SetToken("token")
+
+			config := DefaultServiceConfig()
+			config.Logger = microloggertest.New()
+			config.VaultClient = vaultClient
+			service, err := NewService(config)
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+
+			createConfig := tc.config
+			createConfig.ClusterID = "abc"
+			createConfig.AllowedDomains = "example.com"
+			createConfig.CommonName = "example.com"
+			createConfig.TTL = "1h"
+			_, err = service.CreateWithContext(context.Background(), createConfig)
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+
+			if !reflect.DeepEqual(patch, tc.expectedPatch) {
+				t.Fatalf("expected patch %#v, got %#v", tc.expectedPatch, patch)
+			}
+		})
+	}
+}
+
+func Test_mergeSANs(t *testing.T) {
+	testCases := []struct {
+		name            string
+		allowed         []string
+		requested       []string
+		expectedSANs    []string
+		expectedChanged bool
+	}{
+		{
+			name:            "none allowed",
+			allowed:         nil,
+			requested:       []string{"a", "b"},
+			expectedSANs:    []string{"a", "b"},
+			expectedChanged: true,
+		},
+		{
+			name:            "some allowed",
+			allowed:         []string{"b", "c"},
+			requested:       []string{"a", "b"},
+			expectedSANs:    []string{"b", "c", "a"},
+			expectedChanged: true,
+		},
+		{
+			name:            "all allowed",
+			allowed:         []string{"b", "a"},
+			requested:       []string{"a", "b"},
+			expectedSANs:    []string{"b", "a"},
+			expectedChanged: false,
+		},
+		{
+			name:            "duplicates requested",
+			allowed:         []string{"a"},
+			requested:       []string{"b", "b"},
+			expectedSANs:    []string{"a", "b"},
+			expectedChanged: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sans, changed := mergeSANs(tc.allowed, tc.requested)
+			if !reflect.DeepEqual(sans, tc.expectedSANs) {
+				t.Fatalf("expected SANs %#v, got %#v", tc.expectedSANs, sans)
+			}
+			if changed != tc.expectedChanged {
+				t.Fatalf("expected changed %t, got %t", tc.expectedChanged, changed)
+			}
+		})
+	}
+}
@@ -1,5 +1,10 @@
 package pki
 
+import (
+	"context"
+	"time"
+)
+
 // CreateConfig is used to configure the setup of a PKI backend done by the
 // Service.
 type CreateConfig struct {
@@ -15,6 +20,18 @@ type CreateConfig struct {
 	// generated certificate authority is valid for.
 	AllowedDomains string `json:"allowed_domains"`
 
+	// AllowedURISANs, if set, are the URI SANs, e.g. SPIFFE IDs, the role
+	// created on setup allows. A '*' matches any sequence of characters. In
+	// case the role already exists, they are allowed in addition to the URI
+	// SANs it allows already.
+	AllowedURISANs []string `json:"allowed_uri_sans"`
+
+	// AllowedOtherSANs, if set, are the custom OID/UTF8-string SANs the role
+	// created on setup allows, in the format <oid>;UTF8:<value>. A '*'
+	// matches any sequence of characters. In case the role already exists,
+	// they are allowed in addition to the other SANs it allows already.
+	AllowedOtherSANs []string `json:"allowed_other_sans"`
+
 	// ClusterID represents the cluster ID a PKI backend setup should be done
 	// for. This ID is used to restrict access on Vault related operations for a
 	// specific cluster. E.g. the Vault PKI backend will be mounted on a path
@@ -26,9 +43,247 @@ type CreateConfig struct {
 	// with the current PKI backend.
 	CommonName string `json:"common_name"`
 
+	// ExportCA, if set, causes the root CA to be generated in Vault's exported
+	// mode. Then its private key is returned once as
+	// CreateResponse.CAPrivateKey, so that it can be backed up. Otherwise the
+	// private key never leaves Vault and the root CA is lost as soon as the PKI
+	// backend is deleted. In case the root CA is already generated, Create
+	// fails with an error asserted by IsCANotExportable.
+	ExportCA bool `json:"export_ca"`
+
 	// TTL configures the time to live for the root CA being set up. This is a
 	// golang time string with the allowed units s, m and h.
 	TTL string `json:"ttl"`
+
+	// PKIBaseURL, if set, is used to configure the issuing certificate and
+	// CRL distribution point URLs of the PKI backend, see
+	// URLsConfig.PKIBaseURL.
+	PKIBaseURL string `json:"pki_base_url"`
+
+	// AutoTidyInterval, if set, enables Vault's automatic tidying of the PKI
+	// backend in the given interval, see AutoTidyConfig. This is a golang time
+	// string with the allowed units s, m and h.
+	AutoTidyInterval string `json:"auto_tidy_interval"`
+
+	// TidySafetyBuffer is the safety buffer used for automatic tidying. It is
+	// only used in case AutoTidyInterval is set.
+	TidySafetyBuffer string `json:"tidy_safety_buffer"`
+}
+
+// TidyConfig is used to configure a tidy operation of a PKI backend.
+type TidyConfig struct {
+	// ClusterID is the cluster ID of the PKI backend to tidy.
+	ClusterID string `json:"cluster_id"`
+
+	// SafetyBuffer is the duration certificates must have been expired for
+	// before they are removed from the certificate store and the CRL. It
+	// guards against clock skew between Vault and its clients. This is a
+	// golang time string with the allowed units s, m and h.
+	SafetyBuffer string `json:"safety_buffer"`
+}
+
+// AutoTidyConfig is used to configure automatic tidying of a PKI backend.
+type AutoTidyConfig struct {
+	// ClusterID is the cluster ID of the PKI backend to configure.
+	ClusterID string `json:"cluster_id"`
+
+	// Interval is the interval Vault tidies the PKI backend in. This is a
+	// golang time string with the allowed units s, m and h.
+	Interval string `json:"interval"`
+
+	// SafetyBuffer is the safety buffer used on every tidy operation, see
+	// TidyConfig.SafetyBuffer.
+	SafetyBuffer string `json:"safety_buffer"`
+}
+
+// TidyStatus describes the last tidy operation of a PKI backend.
+type TidyStatus struct {
+	// State is one of "Inactive", "Running", "Finished", "Error" or
+	// "Cancelled".
+	State string `json:"state"`
+
+	// Error is the error the tidy operation failed with, if any.
+	Error string `json:"error,omitempty"`
+
+	// CertStoreDeletedCount is the number of expired certificates removed
+	// from the certificate store.
+	CertStoreDeletedCount int `json:"cert_store_deleted_count"`
+
+	// RevokedCertDeletedCount is the number of expired certificates removed
+	// from the CRL.
+	RevokedCertDeletedCount int `json:"revoked_cert_deleted_count"`
+
+	// TimeStarted is the time the tidy operation started.
+	TimeStarted *time.Time `json:"time_started,omitempty"`
+
+	// TimeFinished is the time the tidy operation finished.
+	TimeFinished *time.Time `json:"time_finished,omitempty"`
+}
+
+// URLsConfig is used to configure the URLs embedded into certificates issued
+// by a PKI backend.
+type URLsConfig struct {
+	// ClusterID is the cluster ID of the PKI backend to configure.
+	ClusterID string `json:"cluster_id"`
+
+	// PKIBaseURL is the address under which Vault is reachable by the
+	// clients verifying issued certificates, e.g.
+	// https://vault.example.com:8200. The issuing certificate URL and the CRL
+	// distribution point of the PKI backend are derived from it.
+	PKIBaseURL string `json:"pki_base_url"`
+}
+
+// URLs describes the URLs embedded into certificates issued by a PKI
+// backend.
+type URLs struct {
+	// IssuingCertificates are the URLs the root CA can be fetched from.
+	IssuingCertificates []string `json:"issuing_certificates"`
+
+	// CRLDistributionPoints are the URLs the CRL can be fetched from.
+	CRLDistributionPoints []string `json:"crl_distribution_points"`
+}
+
+// CRL describes the certificate revocation list of a PKI backend.
+type CRL struct {
+	// PEM is the PEM encoded CRL as served by Vault.
+	PEM string `json:"pem"`
+
+	// ThisUpdate is the time the CRL was generated.
+	ThisUpdate time.Time `json:"this_update"`
+
+	// NextUpdate is the time the CRL is considered stale by clients.
+	NextUpdate time.Time `json:"next_update"`
+
+	// RevokedSerialNumbers are the serial numbers of all revoked certificates
+	// in the format used by Vault.
+	RevokedSerialNumbers []string `json:"revoked_serial_numbers"`
+}
+
+// CreateResponse is returned by Service.Create.
+type CreateResponse struct {
+	// CAPrivateKey is the PEM encoded private key of the root CA. It is only
+	// set in case CreateConfig.ExportCA was given.
+	CAPrivateKey string `json:"ca_private_key,omitempty"`
+}
+
+// CA describes the root CA of a cluster's PKI backend.
+type CA struct {
+	// Certificate is the PEM encoded root CA certificate.
+	Certificate string `json:"certificate"`
+
+	// CommonName is the common name of the root CA's subject.
+	CommonName string `json:"common_name"`
+
+	// Subject is the full distinguished name of the root CA's subject.
+	Subject string `json:"subject"`
+
+	// SerialNumber is the root CA's serial number in the colon separated hex
+	// format used by Vault, e.g. 3c:0f:ae:...
+	SerialNumber string `json:"serial_number"`
+
+	// NotBefore is the time the root CA becomes valid.
+	NotBefore time.Time `json:"not_before"`
+
+	// NotAfter is the time the root CA expires.
+	NotAfter time.Time `json:"not_after"`
+
+	// KeyType describes the root CA's public key, e.g. "RSA 2048".
+	KeyType string `json:"key_type"`
+}
+
+// Certificate describes a certificate issued by a cluster's PKI backend.
+type Certificate struct {
+	// SerialNumber is the certificate's serial number in the colon separated
+	// hex format used by Vault.
+	SerialNumber string `json:"serial_number"`
+
+	// CommonName is the common name of the certificate's subject.
+	CommonName string `json:"common_name"`
+
+	// DNSNames are the DNS subject alternative names of the certificate.
+	DNSNames []string `json:"dns_names"`
+
+	// IPAddresses are the IP subject alternative names of the certificate.
+	IPAddresses []string `json:"ip_addresses"`
+
+	// URIs are the URI subject alternative names of the certificate.
+	URIs []string `json:"uris"`
+
+	// Organizations are the organizations of the certificate's subject.
+	Organizations []string `json:"organizations"`
+
+	// NotBefore is the time the certificate becomes valid.
+	NotBefore time.Time `json:"not_before"`
+
+	// NotAfter is the time the certificate expires.
+	NotAfter time.Time `json:"not_after"`
+
+	// IsCA is true for the root CA, which Vault stores along with the issued
+	// certificates.
+	IsCA bool `json:"is_ca"`
+
+	// RevocationTime is the time the certificate was revoked. It is nil in
+	// case the certificate is not revoked.
+	RevocationTime *time.Time `json:"revocation_time,omitempty"`
+}
+
+// Mount describes a PKI backend mount matching the configured mount path
+// scheme.
+type Mount struct {
+	// ClusterID is the cluster ID the mount belongs to.
+	ClusterID string `json:"cluster_id"`
+
+	// Path is the path the PKI backend is mounted under.
+	Path string `json:"path"`
+
+	// Description is the description of the mount as set on setup.
+	Description string `json:"description"`
+
+	// DefaultLeaseTTL is the default lease TTL of the mount in seconds. Zero
+	// means the system default applies.
+	DefaultLeaseTTL int `json:"default_lease_ttl"`
+
+	// MaxLeaseTTL is the maximum lease TTL of the mount in seconds. Zero means
+	// the system default applies.
+	MaxLeaseTTL int `json:"max_lease_ttl"`
+}
+
+// Role describes the settings of a role registered within a cluster's PKI
+// backend.
+type Role struct {
+	// Name is the name of the role.
+	Name string `json:"name"`
+
+	// AllowedDomains is the list of domains the role may issue certificates
+	// for.
+	AllowedDomains []string `json:"allowed_domains"`
+
+	// AllowBareDomains is true in case certificates may be issued for the
+	// allowed domains themselves.
+	AllowBareDomains bool `json:"allow_bare_domains"`
+
+	// AllowSubdomains is true in case certificates may be issued for
+	// subdomains of the allowed domains.
+	AllowSubdomains bool `json:"allow_subdomains"`
+
+	// AllowedURISANs is the list of URI SANs, e.g. SPIFFE IDs, the role may
+	// issue certificates for.
+	AllowedURISANs []string `json:"allowed_uri_sans"`
+
+	// AllowedOtherSANs is the list of other SANs, in the format
+	// <oid>;UTF8:<value>, the role may issue certificates for.
+	AllowedOtherSANs []string `json:"allowed_other_sans"`
+
+	// Organizations is the list of organizations set in the subject of issued
+	// certificates.
+	Organizations []string `json:"organizations"`
+
+	// TTL is the default time to live of issued certificates in seconds.
+	TTL int `json:"ttl"`
+
+	// MaxTTL is the maximum time to live of issued certificates in seconds.
+	// Zero means the mount's maximum lease TTL applies.
+	MaxTTL int `json:"max_ttl"`
 }
 
 // Service manages the setup of Vault's PKI backends and all other required
@@ -37,31 +292,151 @@ type Service interface {
 	// PKI management.
 
 	// Create sets up a Vault PKI backend according to the given configuration.
-	Create(config CreateConfig) error
+	Create(config CreateConfig) (CreateResponse, error)
+
+	// CreateWithContext is the context aware variant of Create.
+	CreateWithContext(ctx context.Context, config CreateConfig) (CreateResponse, error)
+
+	// CA returns the root CA associated with the given cluster ID. In case no
+	// root CA is generated an error asserted by IsCANotFound is returned.
+	CA(clusterID string) (CA, error)
+
+	// CAWithContext is the context aware variant of CA.
+	CAWithContext(ctx context.Context, clusterID string) (CA, error)
+
+	// ConfigureAutoTidy enables automatic tidying of the PKI backend. This
+	// requires Vault 1.12 or later.
+	ConfigureAutoTidy(config AutoTidyConfig) error
+
+	// ConfigureAutoTidyWithContext is the context aware variant of ConfigureAutoTidy.
+	ConfigureAutoTidyWithContext(ctx context.Context, config AutoTidyConfig) error
+
+	// ConfigureURLs configures the issuing certificate and CRL distribution
+	// point URLs embedded into certificates issued by the PKI backend.
+	ConfigureURLs(config URLsConfig) error
+
+	// ConfigureURLsWithContext is the context aware variant of ConfigureURLs.
+	ConfigureURLsWithContext(ctx context.Context, config URLsConfig) error
+
+	// CRL fetches the current certificate revocation list of the PKI backend
+	// associated with the given cluster ID.
+	CRL(clusterID string) (CRL, error)
+
+	// CRLWithContext is the context aware variant of CRL.
+	CRLWithContext(ctx context.Context, clusterID string) (CRL, error)
+
+	// Certificate returns the certificate with the given serial number issued
+	// by the PKI backend associated with the given cluster ID. In case it does
+	// not exist an error asserted by IsCertificateNotFound is returned.
+	Certificate(clusterID, serialNumber string) (Certificate, error)
+
+	// CertificateWithContext is the context aware variant of Certificate.
+	CertificateWithContext(ctx context.Context, clusterID, serialNumber string) (Certificate, error)
 
 	// Delete removes the PKI backend associated wit the given cluster ID.
 	Delete(clusterID string) error
 
+	// DeleteWithContext is the context aware variant of Delete.
+	DeleteWithContext(ctx context.Context, clusterID string) error
+
 	// IsCAGenerated checks whether the root CA associated with the given cluster
 	// ID is generated.
 	IsCAGenerated(clusterID string) (bool, error)
 
+	// IsCAGeneratedWithContext is the context aware variant of IsCAGenerated.
+	IsCAGeneratedWithContext(ctx context.Context, clusterID string) (bool, error)
+
 	// IsMounted checks whether the PKI backend associated with the given
 	// cluster ID is mounted.
 	IsMounted(clusterID string) (bool, error)
 
+	// IsMountedWithContext is the context aware variant of IsMounted.
+	IsMountedWithContext(ctx context.Context, clusterID string) (bool, error)
+
 	// IsRoleCreated checks whether the PKI role associated with the given
 	// cluster ID is created.
 	IsRoleCreated(clusterID string) (bool, error)
 
+	// IsRoleCreatedWithContext is the context aware variant of IsRoleCreated.
+	IsRoleCreatedWithContext(ctx context.Context, clusterID string) (bool, error)
+
+	// Mount returns the PKI backend mount associated with the given cluster ID.
+	// In case the PKI backend is not mounted an error asserted by
+	// IsNotMounted is returned.
+	Mount(clusterID string) (Mount, error)
+
+	// MountWithContext is the context aware variant of Mount.
+	MountWithContext(ctx context.Context, clusterID string) (Mount, error)
+
+	// List returns all PKI backends mounted according to the configured mount
+	// path scheme, sorted by cluster ID.
+	List() ([]Mount, error)
+
+	// ListWithContext is the context aware variant of List.
+	ListWithContext(ctx context.Context) ([]Mount, error)
+
+	// ListCertificates returns the serial numbers of all certificates stored
+	// by the PKI backend associated with the given cluster ID, including the
+	// root CA and expired certificates not tidied yet.
+	ListCertificates(clusterID string) ([]string, error)
+
+	// ListCertificatesWithContext is the context aware variant of ListCertificates.
+	ListCertificatesWithContext(ctx context.Context, clusterID string) ([]string, error)
+
+	// ListRoles returns the names of all roles registered within the PKI
+	// backend associated with the given cluster ID.
+	ListRoles(clusterID string) ([]string, error)
+
+	// ListRolesWithContext is the context aware variant of ListRoles.
+	ListRolesWithContext(ctx context.Context, clusterID string) ([]string, error)
+
+	// Role returns the settings of the PKI role associated with the given
+	// cluster ID. In case the role is not created an error asserted by
+	// IsRoleNotFound is returned.
+	Role(clusterID string) (Role, error)
+
+	// RoleWithContext is the context aware variant of Role.
+	RoleWithContext(ctx context.Context, clusterID string) (Role, error)
+
+	// RotateCRL forces Vault to rebuild the certificate revocation list of the
+	// PKI backend associated with the given cluster ID.
+	RotateCRL(clusterID string) error
+
+	// RotateCRLWithContext is the context aware variant of RotateCRL.
+	RotateCRLWithContext(ctx context.Context, clusterID string) error
+
+	// Tidy starts removing expired certificates from the certificate store and
+	// the CRL of the PKI backend. Vault tidies in the background, so the
+	// result has to be looked up using TidyStatus.
+	Tidy(config TidyConfig) error
+
+	// TidyWithContext is the context aware variant of Tidy.
+	TidyWithContext(ctx context.Context, config TidyConfig) error
+
+	// TidyStatus returns the status of the last tidy operation of the PKI
+	// backend associated with the given cluster ID.
+	TidyStatus(clusterID string) (TidyStatus, error)
+
+	// TidyStatusWithContext is the context aware variant of TidyStatus.
+	TidyStatusWithContext(ctx context.Context, clusterID string) (TidyStatus, error)
+
+	// URLs returns the issuing certificate and CRL distribution point URLs of
+	// the PKI backend associated with the given cluster ID.
+	URLs(clusterID string) (URLs, error)
+
+	// URLsWithContext is the context aware variant of URLs.
+	URLsWithContext(ctx context.Context, clusterID string) (URLs, error)
+
 	// RoleName returns the name used to register the PKI backend's role.
 	RoleName(clusterID string) string
 
 	// Path management.
 
 	// MountPKIPath returns the path under which a cluster's PKI backend is
-	// mounted. This is very specific to Vault. The path structure is the
-	// following.
+	// mounted. This is very specific to Vault. In case the Vault client is
+	// scoped to a namespace, the path is relative to that namespace. The path
+	// structure is defined by the configured mount path scheme and defaults to
+	// the following.
 	//
 	//     pki-<clusterID>
 	//
@@ -72,15 +447,23 @@ type Service interface {
 	// the following. See also
 	// https://github.com/hashicorp/vault/blob/6f0f46deb622ba9c7b14b2ec0be24cab3916f3d8/website/source/docs/secrets/pki/index.html.md#pkirootgenerate.
 	//
-	//     pki-<clusterID>/root/generate/exported
+	//     <mountPath>/root/generate/internal
 	//
 	WriteCAPath(clusterID string) string
 
+	// WriteExportedCAPath returns the path under which a cluster's certificate
+	// authority can be generated such that its private key is returned once.
+	// This is very specific to Vault. The path structure is the following.
+	//
+	//     <mountPath>/root/generate/exported
+	//
+	WriteExportedCAPath(clusterID string) string
+
 	// WriteRolePath returns the path under which a role is registered. This is
 	// very specific to Vault. The path structure is the following. See also
 	// https://github.com/hashicorp/vault/blob/6f0f46deb622ba9c7b14b2ec0be24cab3916f3d8/website/source/docs/secrets/pki/index.html.md#pkiroles.
 	//
-	//     pki-<clusterID>/roles/role-<clusterID>
+	//     <mountPath>/roles/role-<clusterID>
 	//
 	WriteRolePath(clusterID string) string
 }
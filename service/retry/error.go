@@ -0,0 +1,100 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/giantswarm/microerror"
+	vaultclient "github.com/hashicorp/vault/api"
+)
+
+var invalidConfigError = &microerror.Error{
+	Kind: "invalidConfigError",
+}
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return microerror.Cause(err) == invalidConfigError
+}
+
+// IsRetryable classifies the given error of a request to Vault. Errors are
+// retryable in case they are likely to be gone on a later attempt, e.g.
+// refused connections while Vault restarts, a sealed Vault or a standby
+// without active node during failover. All other errors, e.g. permission
+// denied, bad requests or a canceled context, are permanent.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// The caller gave up, so retrying is pointless.
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var responseError *vaultclient.ResponseError
+	if errors.As(err, &responseError) {
+		switch responseError.StatusCode {
+		case 412, 429, 500, 502, 503, 504:
+			// 412 is returned by performance standbys not yet having caught
+			// up with the active node, 429 when rate limited and 503 while
+			// Vault is sealed or no active node is elected.
+			return true
+		}
+
+		return false
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	// Other network errors, like failing DNS lookups or timeouts of single
+	// connections, are considered transient as well.
+	var netError net.Error
+	if errors.As(err, &netError) {
+		return true
+	}
+
+	return false
+}
+
+// IsNotSent classifies the given error of a request to Vault. Errors are
+// classified as not sent in case the request never reached Vault, e.g.
+// refused connections or failing DNS lookups, so that even non-idempotent
+// requests are safe to be retried. Errors after the request was sent, e.g.
+// server errors or a connection closed before the response arrived, are not
+// classified as such, since Vault may have executed the request.
+func IsNotSent(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// The caller gave up, so retrying is pointless.
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var dnsError *net.DNSError
+	if errors.As(err, &dnsError) {
+		return true
+	}
+
+	// Connections failing to be established carry the dial operation.
+	var opError *net.OpError
+	if errors.As(err, &opError) && opError.Op == "dial" {
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,80 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+
+	vaultclient "github.com/hashicorp/vault/api"
+)
+
+func Test_IsRetryable(t *testing.T) {
+	testCases := []struct {
+		name              string
+		err               error
+		expectedRetryable bool
+	}{
+		{name: "nil", err: nil, expectedRetryable: false},
+		{name: "412 performance standby", err: &vaultclient.ResponseError{StatusCode: http.StatusPreconditionFailed}, expectedRetryable: true},
+		{name: "429 rate limited", err: &vaultclient.ResponseError{StatusCode: http.StatusTooManyRequests}, expectedRetryable: true},
+		{name: "500", err: &vaultclient.ResponseError{StatusCode: http.StatusInternalServerError}, expectedRetryable: true},
+		{name: "502", err: &vaultclient.ResponseError{StatusCode: http.StatusBadGateway}, expectedRetryable: true},
+		{name: "503 sealed", err: &vaultclient.ResponseError{StatusCode: http.StatusServiceUnavailable}, expectedRetryable: true},
+		{name: "504", err: &vaultclient.ResponseError{StatusCode: http.StatusGatewayTimeout}, expectedRetryable: true},
+		{name: "wrapped 503", err: fmt.Errorf("cannot read: %w", &vaultclient.ResponseError{StatusCode: http.StatusServiceUnavailable}), expectedRetryable: true},
+		{name: "400", err: &vaultclient.ResponseError{StatusCode: http.StatusBadRequest}, expectedRetryable: false},
+		{name: "403 permission denied", err: &vaultclient.ResponseError{StatusCode: http.StatusForbidden}, expectedRetryable: false},
+		{name: "404", err: &vaultclient.ResponseError{StatusCode: http.StatusNotFound}, expectedRetryable: false},
+		{name: "connection refused", err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, expectedRetryable: true},
+		{name: "connection reset", err: fmt.Errorf("read: %w", syscall.ECONNRESET), expectedRetryable: true},
+		{name: "EOF", err: fmt.Errorf("Put \"https://vault:8200\": %w", io.EOF), expectedRetryable: true},
+		{name: "unexpected EOF", err: io.ErrUnexpectedEOF, expectedRetryable: true},
+		{name: "DNS lookup failed", err: &net.DNSError{Err: "no such host", Name: "vault"}, expectedRetryable: true},
+		{name: "canceled", err: context.Canceled, expectedRetryable: false},
+		{name: "deadline exceeded", err: fmt.Errorf("request: %w", context.DeadlineExceeded), expectedRetryable: false},
+		{name: "other", err: fmt.Errorf("invalid certificate"), expectedRetryable: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			retryable := IsRetryable(tc.err)
+			if retryable != tc.expectedRetryable {
+				t.Fatalf("expected retryable %t, got %t", tc.expectedRetryable, retryable)
+			}
+		})
+	}
+}
+
+func Test_IsNotSent(t *testing.T) {
+	testCases := []struct {
+		name            string
+		err             error
+		expectedNotSent bool
+	}{
+		{name: "nil", err: nil, expectedNotSent: false},
+		{name: "connection refused", err: &url.Error{Op: "Put", URL: "https://vault:8200", Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}, expectedNotSent: true},
+		{name: "dial timeout", err: &net.OpError{Op: "dial", Err: fmt.Errorf("i/o timeout")}, expectedNotSent: true},
+		{name: "DNS lookup failed", err: &net.DNSError{Err: "no such host", Name: "vault"}, expectedNotSent: true},
+		{name: "500", err: &vaultclient.ResponseError{StatusCode: http.StatusInternalServerError}, expectedNotSent: false},
+		{name: "503 sealed", err: &vaultclient.ResponseError{StatusCode: http.StatusServiceUnavailable}, expectedNotSent: false},
+		{name: "connection reset", err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}, expectedNotSent: false},
+		{name: "EOF", err: fmt.Errorf("Put \"https://vault:8200\": %w", io.EOF), expectedNotSent: false},
+		{name: "read timeout", err: &net.OpError{Op: "read", Err: fmt.Errorf("i/o timeout")}, expectedNotSent: false},
+		{name: "canceled while dialing", err: &net.OpError{Op: "dial", Err: context.Canceled}, expectedNotSent: false},
+		{name: "other", err: fmt.Errorf("invalid certificate"), expectedNotSent: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			notSent := IsNotSent(tc.err)
+			if notSent != tc.expectedNotSent {
+				t.Fatalf("expected not sent %t, got %t", tc.expectedNotSent, notSent)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package retry
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/giantswarm/backoff"
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+)
+
+// Config represents the configuration used to create a new retry policy.
+type Config struct {
+	// Dependencies.
+	Logger micrologger.Logger
+
+	// Settings.
+
+	// MaxAttempts is the maximum number of times an operation is executed,
+	// including the first attempt. 1 disables retries.
+	MaxAttempts int
+
+	// MaxInterval is the maximum time waited between two attempts. Attempts
+	// are retried with the exponential backoff of giantswarm/backoff, which
+	// starts at 500ms and randomizes every interval, so that many clients
+	// retrying at the same time, e.g. all nodes of a cluster during a Vault
+	// failover, do not hit Vault at once.
+	MaxInterval time.Duration
+}
+
+// DefaultConfig provides a default configuration to create a retry policy.
+func DefaultConfig() Config {
+	newLogger, err := micrologger.New(micrologger.Config{IOWriter: os.Stderr})
+	if err != nil {
+		panic(err)
+	}
+
+	newConfig := Config{
+		// Dependencies.
+		Logger: newLogger,
+
+		// Settings.
+		MaxAttempts: 3,
+		MaxInterval: backoff.ShortMaxInterval,
+	}
+
+	return newConfig
+}
+
+// New creates a new configured retry policy.
+func New(config Config) (Policy, error) {
+	// Dependencies.
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "logger must not be empty")
+	}
+
+	// Settings.
+	if config.MaxAttempts < 1 {
+		return nil, microerror.Maskf(invalidConfigError, "max attempts must be at least 1")
+	}
+	if config.MaxInterval <= 0 {
+		return nil, microerror.Maskf(invalidConfigError, "max interval must be greater than zero")
+	}
+
+	newPolicy := &policy{
+		Config: config,
+	}
+
+	return newPolicy, nil
+}
+
+type policy struct {
+	Config
+}
+
+func (p *policy) Do(ctx context.Context, operation func() error) error {
+	err := p.do(ctx, operation, IsRetryable)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (p *policy) DoNonIdempotent(ctx context.Context, operation func() error) error {
+	err := p.do(ctx, operation, IsNotSent)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// do executes the given operation until it succeeds or fails with an error
+// not classified as retryable by the given function.
+func (p *policy) do(ctx context.Context, operation func() error, isRetryable func(error) bool) error {
+	o := func() error {
+		err := operation()
+		if err != nil && !isRetryable(err) {
+			return backoff.Permanent(err)
+		}
+
+		return err
+	}
+
+	attempt := 0
+	n := func(err error, wait time.Duration) {
+		attempt++
+		p.Logger.LogCtx(ctx, "level", "warning", "message", "retrying operation after transient error", "attempt", attempt, "wait", wait.String(), "error", microerror.Pretty(err, false))
+	}
+
+	b := &attemptsBackOff{
+		underlying:  backoff.NewExponential(0, p.MaxInterval),
+		ctx:         ctx,
+		maxAttempts: p.MaxAttempts,
+	}
+
+	err := backoff.RetryNotify(o, b, n)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// attemptsBackOff stops the underlying backoff after the given number of
+// attempts or once the given context is done. Backoffs providing a context
+// are also waited for by backoff.RetryNotify only until the context is done.
+type attemptsBackOff struct {
+	underlying  backoff.BackOff
+	ctx         context.Context
+	maxAttempts int
+
+	attempts int
+}
+
+func (b *attemptsBackOff) NextBackOff() time.Duration {
+	b.attempts++
+	if b.attempts >= b.maxAttempts || b.ctx.Err() != nil {
+		return backoff.Stop
+	}
+
+	return b.underlying.NextBackOff()
+}
+
+func (b *attemptsBackOff) Reset() {
+	b.attempts = 0
+	b.underlying.Reset()
+}
+
+func (b *attemptsBackOff) Context() context.Context {
+	return b.ctx
+}
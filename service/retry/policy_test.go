@@ -0,0 +1,197 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	vaultclient "github.com/hashicorp/vault/api"
+)
+
+func newTestPolicy(t *testing.T, maxAttempts int) Policy {
+	config := DefaultConfig()
+	config.Logger = microloggertest.New()
+	config.MaxAttempts = maxAttempts
+	config.MaxInterval = time.Second
+
+	p, err := New(config)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return p
+}
+
+func Test_Policy_Do(t *testing.T) {
+	retryable := &vaultclient.ResponseError{StatusCode: http.StatusServiceUnavailable}
+	permanent := &vaultclient.ResponseError{StatusCode: http.StatusForbidden}
+
+	testCases := []struct {
+		name             string
+		maxAttempts      int
+		errs             []error
+		expectedAttempts int
+		expectedErr      error
+	}{
+		{
+			name:             "success",
+			maxAttempts:      3,
+			errs:             []error{nil},
+			expectedAttempts: 1,
+		},
+		{
+			name:             "success after retry",
+			maxAttempts:      3,
+			errs:             []error{retryable, nil},
+			expectedAttempts: 2,
+		},
+		{
+			name:             "max attempts reached",
+			maxAttempts:      2,
+			errs:             []error{retryable, retryable, nil},
+			expectedAttempts: 2,
+			expectedErr:      retryable,
+		},
+		{
+			name:             "retries disabled",
+			maxAttempts:      1,
+			errs:             []error{retryable, nil},
+			expectedAttempts: 1,
+			expectedErr:      retryable,
+		},
+		{
+			name:             "permanent error",
+			maxAttempts:      3,
+			errs:             []error{permanent, nil},
+			expectedAttempts: 1,
+			expectedErr:      permanent,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newTestPolicy(t, tc.maxAttempts)
+
+			var attempts int
+			err := p.Do(context.Background(), func() error {
+				err := tc.errs[attempts]
+				attempts++
+				return err
+			})
+
+			if attempts != tc.expectedAttempts {
+				t.Fatalf("expected %d attempts, got %d", tc.expectedAttempts, attempts)
+			}
+			if tc.expectedErr == nil && err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("expected error %#v, got %#v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func Test_Policy_Do_Canceled(t *testing.T) {
+	p := newTestPolicy(t, 10)
+	retryable := &vaultclient.ResponseError{StatusCode: http.StatusServiceUnavailable}
+
+	// A context canceled while waiting for the next attempt stops retrying
+	// right away.
+	ctx, cancel := context.WithCancel(context.Background())
+	var attempts int
+	start := time.Now()
+	err := p.Do(ctx, func() error {
+		attempts++
+		cancel()
+		return retryable
+	})
+
+	if attempts != 1 {
+		t.Fatalf("expected 1 attempt, got %d", attempts)
+	}
+	if !errors.Is(err, retryable) {
+		t.Fatalf("expected error %#v, got %#v", retryable, err)
+	}
+	if time.Since(start) > 200*time.Millisecond {
+		t.Fatalf("expected no wait, took %s", time.Since(start))
+	}
+
+	// A context canceled during the wait interrupts it.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	attempts = 0
+	start = time.Now()
+	time.AfterFunc(50*time.Millisecond, cancel)
+	err = p.Do(ctx, func() error {
+		attempts++
+		return retryable
+	})
+
+	if attempts != 1 {
+		t.Fatalf("expected 1 attempt, got %d", attempts)
+	}
+	if !errors.Is(err, retryable) {
+		t.Fatalf("expected error %#v, got %#v", retryable, err)
+	}
+	if time.Since(start) > 200*time.Millisecond {
+		t.Fatalf("expected wait to be interrupted, took %s", time.Since(start))
+	}
+}
+
+func Test_Policy_DoNonIdempotent(t *testing.T) {
+	notSent := &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}
+	sent := &vaultclient.ResponseError{StatusCode: http.StatusServiceUnavailable}
+
+	testCases := []struct {
+		name             string
+		errs             []error
+		expectedAttempts int
+		expectedErr      error
+	}{
+		{
+			name:             "success",
+			errs:             []error{nil},
+			expectedAttempts: 1,
+		},
+		{
+			name:             "success after request not sent",
+			errs:             []error{notSent, nil},
+			expectedAttempts: 2,
+		},
+		{
+			name:             "retryable error after request sent",
+			errs:             []error{sent, nil},
+			expectedAttempts: 1,
+			expectedErr:      sent,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newTestPolicy(t, 3)
+
+			var attempts int
+			err := p.DoNonIdempotent(context.Background(), func() error {
+				err := tc.errs[attempts]
+				attempts++
+				return err
+			})
+
+			if attempts != tc.expectedAttempts {
+				t.Fatalf("expected %d attempts, got %d", tc.expectedAttempts, attempts)
+			}
+			if tc.expectedErr == nil && err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("expected error %#v, got %#v", tc.expectedErr, err)
+			}
+		})
+	}
+}
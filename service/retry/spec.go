@@ -0,0 +1,22 @@
+package retry
+
+import (
+	"context"
+)
+
+// Policy retries operations failing with errors classified as retryable by
+// IsRetryable. Policies must only be used for operations which are safe to
+// be executed more than once, e.g. reads or idempotent writes.
+type Policy interface {
+	// Do executes the given operation until it succeeds, fails with an error
+	// not classified as retryable, the maximum number of attempts is reached
+	// or the given context is done. The error of the last attempt is
+	// returned.
+	Do(ctx context.Context, operation func() error) error
+
+	// DoNonIdempotent executes the given operation like Do, but only retries
+	// errors classified by IsNotSent. It is meant for writes which must not
+	// be executed twice, e.g. issuing a certificate, since a request which
+	// reached Vault may have succeeded even though its response failed.
+	DoNonIdempotent(ctx context.Context, operation func() error) error
+}
@@ -1,9 +1,12 @@
 package role
 
 import (
+	"errors"
+	"net/http"
 	"strings"
 
 	"github.com/giantswarm/microerror"
+	vaultclient "github.com/hashicorp/vault/api"
 )
 
 var invalidConfigError = &microerror.Error{
@@ -15,6 +18,26 @@ func IsInvalidConfig(err error) bool {
 	return microerror.Cause(err) == invalidConfigError
 }
 
+var roleNotFoundError = &microerror.Error{
+	Kind: "roleNotFoundError",
+}
+
+// IsRoleNotFound asserts roleNotFoundError.
+func IsRoleNotFound(err error) bool {
+	return microerror.Cause(err) == roleNotFoundError
+}
+
+// IsPermissionDenied asserts the error Vault responds with in case the Vault
+// token used lacks the capabilities for a request.
+func IsPermissionDenied(err error) bool {
+	var responseErr *vaultclient.ResponseError
+	if errors.As(err, &responseErr) {
+		return responseErr.StatusCode == http.StatusForbidden
+	}
+
+	return false
+}
+
 // IsNoVaultHandlerDefined asserts a dirty string matching against the error
 // message provided by err. This is necessary due to the poor error handling
 // design of the Vault library we are using.
@@ -0,0 +1,77 @@
+package role
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NormalizeOrganizations returns the canonical form of the given
+// organizations as used for role naming and policy hashing. Surrounding
+// whitespace, empty items and duplicates are removed and the result is sorted.
+// The given slice is not modified.
+func NormalizeOrganizations(organizations []string) []string {
+	seen := map[string]bool{}
+
+	var normalized []string
+	for _, o := range organizations {
+		o = strings.TrimSpace(o)
+		if o == "" || seen[o] {
+			continue
+		}
+		seen[o] = true
+		normalized = append(normalized, o)
+	}
+	sort.Strings(normalized)
+
+	return normalized
+}
+
+// Name returns the name of the role issuing certificates with the given
+// organizations for the given cluster ID. Without organizations this is the
+// role created on setup, role-<clusterID>. Otherwise it is
+// role-org-<organizationsHash>, see OrganizationsHash. For normalized
+// organizations the name equals the one computed by
+// github.com/giantswarm/vaultrole/key.RoleName.
+func Name(clusterID string, organizations []string) string {
+	normalized := NormalizeOrganizations(organizations)
+	if len(normalized) == 0 {
+		return fmt.Sprintf("role-%s", clusterID)
+	}
+
+	return fmt.Sprintf("role-org-%s", hash(normalized))
+}
+
+// OrganizationsHash returns the deterministic, URL safe hash of the given
+// organizations used in role names and policies. It neither depends on the
+// order of the organizations nor on whitespace, empty items or duplicates.
+func OrganizationsHash(organizations []string) string {
+	return hash(NormalizeOrganizations(organizations))
+}
+
+// LegacyName returns the name older versions used for the role issuing
+// certificates with the given organizations. They only sorted the
+// organizations split from a comma separated string. LegacyName equals Name
+// for normalized organizations, and is only used to keep finding roles created
+// by older versions for other input.
+func LegacyName(clusterID string, organizations []string) string {
+	if len(organizations) == 0 {
+		return fmt.Sprintf("role-%s", clusterID)
+	}
+
+	legacy := append([]string(nil), organizations...)
+	sort.Strings(legacy)
+
+	return fmt.Sprintf("role-org-%s", hash(legacy))
+}
+
+func hash(organizations []string) string {
+	h := sha512.New()
+	_, err := h.Write([]byte(strings.Join(organizations, ",")))
+	if err != nil {
+		panic(err)
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
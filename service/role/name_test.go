@@ -0,0 +1,205 @@
+package role
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// vaultroleRoleName is github.com/giantswarm/vaultrole/key.RoleName of
+// v0.2.0 with computeOrgHash inlined. It computed the role names before
+// certctl dropped the dependency.
+func vaultroleRoleName(ID string, organizations []string) string {
+	if len(organizations) == 0 {
+		return fmt.Sprintf("role-%s", ID)
+	}
+
+	sort.Strings(organizations)
+	s := strings.Join(organizations, ",")
+
+	h := sha512.New()
+	_, err := h.Write([]byte(s))
+	if err != nil {
+		panic(err)
+	}
+
+	return fmt.Sprintf("role-org-%x", h.Sum(nil))
+}
+
+// computeRoleHash is a copy of the function the token service used to hash
+// the comma separated organizations of the org policy.
+func computeRoleHash(organizations string) string {
+	organizationsSlice := strings.Split(organizations, ",")
+	sort.Strings(organizationsSlice)
+	organizations = strings.Join(organizationsSlice, ",")
+
+	h := sha512.New()
+	_, err := h.Write([]byte(organizations))
+	if err != nil {
+		panic(err)
+	}
+	bs := h.Sum(nil)
+
+	return fmt.Sprintf("%x", bs)
+}
+
+func Test_NormalizeOrganizations(t *testing.T) {
+	testCases := []struct {
+		name          string
+		organizations []string
+		expected      []string
+	}{
+		{name: "nil", organizations: nil, expected: nil},
+		{name: "empty", organizations: []string{""}, expected: nil},
+		{name: "whitespace only", organizations: []string{" ", "\t"}, expected: nil},
+		{name: "sorted", organizations: []string{"a", "b"}, expected: []string{"a", "b"}},
+		{name: "unsorted", organizations: []string{"b", "a"}, expected: []string{"a", "b"}},
+		{name: "duplicates", organizations: []string{"b", "a", "b"}, expected: []string{"a", "b"}},
+		{name: "whitespace padded", organizations: []string{" b", "a "}, expected: []string{"a", "b"}},
+		{name: "whitespace padded duplicates", organizations: []string{"a", " a "}, expected: []string{"a"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			organizations := append([]string(nil), tc.organizations...)
+
+			result := NormalizeOrganizations(organizations)
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Fatalf("expected %#v, got %#v", tc.expected, result)
+			}
+			if !reflect.DeepEqual(organizations, tc.organizations) {
+				t.Fatalf("expected organizations %#v to be unmodified, got %#v", tc.organizations, organizations)
+			}
+		})
+	}
+}
+
+func Test_Name(t *testing.T) {
+	testCases := []struct {
+		name          string
+		organizations []string
+		expected      string
+	}{
+		{
+			name:          "no organizations",
+			organizations: nil,
+			expected:      "role-abc",
+		},
+		{
+			name:          "empty organization",
+			organizations: []string{""},
+			expected:      "role-abc",
+		},
+		{
+			name:          "single organization",
+			organizations: []string{"system:masters"},
+			expected:      vaultroleRoleName("abc", []string{"system:masters"}),
+		},
+		{
+			name:          "sorted organizations",
+			organizations: []string{"a", "b"},
+			expected:      vaultroleRoleName("abc", []string{"a", "b"}),
+		},
+		{
+			name:          "unsorted organizations",
+			organizations: []string{"b", "a"},
+			expected:      vaultroleRoleName("abc", []string{"a", "b"}),
+		},
+		{
+			name:          "duplicate organizations",
+			organizations: []string{"b", "a", "b"},
+			expected:      vaultroleRoleName("abc", []string{"a", "b"}),
+		},
+		{
+			name:          "whitespace padded organizations",
+			organizations: []string{" b", "a "},
+			expected:      vaultroleRoleName("abc", []string{"a", "b"}),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := Name("abc", tc.organizations)
+			if result != tc.expected {
+				t.Fatalf("expected %q, got %q", tc.expected, result)
+			}
+		})
+	}
+}
+
+func Test_LegacyName(t *testing.T) {
+	testCases := []struct {
+		name          string
+		organizations []string
+	}{
+		{name: "no organizations", organizations: nil},
+		{name: "sorted organizations", organizations: []string{"a", "b"}},
+		{name: "unsorted organizations", organizations: []string{"b", "a"}},
+		// Older versions split " b" off "a, b" without trimming it.
+		{name: "whitespace padded organization", organizations: []string{" b"}},
+		// Older versions split "" into [""] when creating the role.
+		{name: "empty organization", organizations: []string{""}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			expected := vaultroleRoleName("abc", append([]string(nil), tc.organizations...))
+
+			result := LegacyName("abc", tc.organizations)
+			if result != expected {
+				t.Fatalf("expected %q, got %q", expected, result)
+			}
+		})
+	}
+}
+
+func Test_LegacyName_Normalized(t *testing.T) {
+	organizations := NormalizeOrganizations([]string{"b", " a", "b"})
+
+	name := Name("abc", organizations)
+	legacyName := LegacyName("abc", organizations)
+	if name != legacyName {
+		t.Fatalf("expected legacy name %q to equal name %q", legacyName, name)
+	}
+}
+
+func Test_OrganizationsHash(t *testing.T) {
+	testCases := []struct {
+		name          string
+		organizations []string
+		expected      string
+	}{
+		{
+			name:          "system masters",
+			organizations: []string{"system:masters"},
+			expected:      computeRoleHash("system:masters"),
+		},
+		{
+			name:          "unsorted organizations",
+			organizations: []string{"b", "a"},
+			expected:      computeRoleHash("b,a"),
+		},
+		{
+			name:          "duplicate organizations",
+			organizations: []string{"a", "b", "a"},
+			expected:      computeRoleHash("a,b"),
+		},
+		{
+			name:          "whitespace padded organizations",
+			organizations: []string{"b ", " a"},
+			expected:      computeRoleHash("a,b"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := OrganizationsHash(tc.organizations)
+			if result != tc.expected {
+				t.Fatalf("expected %q, got %q", tc.expected, result)
+			}
+		})
+	}
+}
@@ -1,15 +1,25 @@
 package role
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
 	vaultclient "github.com/hashicorp/vault/api"
+
+	"github.com/giantswarm/certctl/v2/service/internal/vaultdata"
 )
 
 // Config defines configurable aspects (such as dependencies) of this service.
 type Config struct {
 	// Dependencies.
+	Logger      micrologger.Logger
 	VaultClient *vaultclient.Client
 
 	// Settings.
@@ -18,7 +28,15 @@ type Config struct {
 
 // DefaultConfig returns a default configuration that can be used to create this service.
 func DefaultConfig() Config {
-	config := Config{}
+	newLogger, err := micrologger.New(micrologger.Config{IOWriter: os.Stderr})
+	if err != nil {
+		panic(err)
+	}
+
+	config := Config{
+		// Dependencies.
+		Logger: newLogger,
+	}
 
 	return config
 }
@@ -26,6 +44,9 @@ func DefaultConfig() Config {
 // New takes a configuration and returns a configured service.
 func New(config Config) (Service, error) {
 	// Dependencies.
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "logger must not be empty")
+	}
 	if config.VaultClient == nil {
 		return nil, microerror.Maskf(invalidConfigError, "Vault client must not be empty")
 	}
@@ -35,6 +56,7 @@ func New(config Config) (Service, error) {
 	}
 
 	service := &service{
+		logger:        config.Logger,
 		vaultClient:   config.VaultClient,
 		pkiMountpoint: config.PKIMountpoint,
 	}
@@ -44,39 +66,57 @@ func New(config Config) (Service, error) {
 
 type service struct {
 	// Dependencies.
+	logger      micrologger.Logger
 	vaultClient *vaultclient.Client
 
 	// Settings.
 	pkiMountpoint string
 }
 
+func (s *service) Create(params CreateParams) error {
+	return s.CreateWithContext(context.Background(), params)
+}
+
 // Create creates a role if it doesn't exist yet. Creating roles is idempotent
 // in the vault api, so no need to check if it already exists.
-func (s *service) Create(params CreateParams) error {
+func (s *service) CreateWithContext(ctx context.Context, params CreateParams) error {
 	logicalStore := s.vaultClient.Logical()
 
 	data := map[string]interface{}{
-		"allowed_domains":    params.AllowedDomains,
+		"allowed_domains":    strings.Join(params.AllowedDomains, ","),
 		"allow_subdomains":   params.AllowSubdomains,
 		"ttl":                params.TTL,
 		"allow_bare_domains": params.AllowBareDomains,
-		"organization":       params.Organizations,
+		"organization":       strings.Join(params.Organizations, ","),
+	}
+	if len(params.AllowedURISANs) != 0 {
+		data["allowed_uri_sans"] = strings.Join(params.AllowedURISANs, ",")
+	}
+	if len(params.AllowedOtherSANs) != 0 {
+		data["allowed_other_sans"] = strings.Join(params.AllowedOtherSANs, ",")
 	}
 
-	_, err := logicalStore.Write(fmt.Sprintf("%s/roles/%s", s.pkiMountpoint, params.Name), data)
+	_, err := logicalStore.WriteWithContext(ctx, s.rolePath(params.Name), data)
 	if err != nil {
 		return microerror.Mask(err)
 	}
+
+	s.logger.LogCtx(ctx, "level", "debug", "message", "created PKI role", "mount", s.pkiMountpoint, "role", params.Name)
+
 	return nil
 }
 
 func (s *service) IsRoleCreated(roleName string) (bool, error) {
+	return s.IsRoleCreatedWithContext(context.Background(), roleName)
+}
+
+func (s *service) IsRoleCreatedWithContext(ctx context.Context, roleName string) (bool, error) {
 	// Create a client for the logical backend configured with the Vault token
 	// used for the current cluster's PKI backend.
 	logicalBackend := s.vaultClient.Logical()
 
 	// Check if a PKI for the given cluster ID exists.
-	secret, err := logicalBackend.List(s.listRolesPath())
+	secret, err := logicalBackend.ListWithContext(ctx, s.listRolesPath())
 	if IsNoVaultHandlerDefined(err) {
 		return false, nil
 	} else if err != nil {
@@ -104,6 +144,66 @@ func (s *service) IsRoleCreated(roleName string) (bool, error) {
 	return false, nil
 }
 
+func (s *service) Role(roleName string) (Role, error) {
+	return s.RoleWithContext(context.Background(), roleName)
+}
+
+func (s *service) RoleWithContext(ctx context.Context, roleName string) (Role, error) {
+	logicalStore := s.vaultClient.Logical()
+
+	secret, err := logicalStore.ReadWithContext(ctx, s.rolePath(roleName))
+	if IsNoVaultHandlerDefined(err) {
+		return Role{}, microerror.Maskf(roleNotFoundError, "PKI backend '%s' is not mounted", s.pkiMountpoint)
+	} else if err != nil {
+		return Role{}, microerror.Mask(err)
+	}
+	if secret == nil {
+		return Role{}, microerror.Maskf(roleNotFoundError, "role '%s' does not exist", roleName)
+	}
+
+	// Vault omits settings of roles created by older versions, in which case
+	// the defaults of Vault apply.
+	newRole := Role{
+		Name:             roleName,
+		AllowAnyName:     vaultdata.ToBool(secret.Data["allow_any_name"], false),
+		AllowBareDomains: vaultdata.ToBool(secret.Data["allow_bare_domains"], false),
+		AllowGlobDomains: vaultdata.ToBool(secret.Data["allow_glob_domains"], false),
+		AllowIPSANs:      vaultdata.ToBool(secret.Data["allow_ip_sans"], true),
+		AllowLocalhost:   vaultdata.ToBool(secret.Data["allow_localhost"], true),
+		AllowSubdomains:  vaultdata.ToBool(secret.Data["allow_subdomains"], false),
+		AllowedDomains:   vaultdata.ToStrings(secret.Data["allowed_domains"]),
+		AllowedURISANs:   vaultdata.ToStrings(secret.Data["allowed_uri_sans"]),
+		TTL:              toDuration(secret.Data["ttl"]),
+		MaxTTL:           toDuration(secret.Data["max_ttl"]),
+	}
+
+	return newRole, nil
+}
+
+func (s *service) rolePath(roleName string) string {
+	return fmt.Sprintf("%s/roles/%s", s.pkiMountpoint, roleName)
+}
+
 func (s *service) listRolesPath() string {
 	return fmt.Sprintf("%s/roles/", s.pkiMountpoint)
 }
+
+// toDuration converts a TTL as returned by Vault, which is a number of
+// seconds.
+func toDuration(v interface{}) time.Duration {
+	var seconds int64
+	switch t := v.(type) {
+	case json.Number:
+		seconds, _ = t.Int64()
+	case float64:
+		seconds = int64(t)
+	case string:
+		d, err := time.ParseDuration(t)
+		if err == nil {
+			return d
+		}
+		seconds, _ = strconv.ParseInt(t, 10, 64)
+	}
+
+	return time.Duration(seconds) * time.Second
+}
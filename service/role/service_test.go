@@ -0,0 +1,106 @@
+package role
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	vaultclient "github.com/hashicorp/vault/api"
+)
+
+func Test_Service_Create(t *testing.T) {
+	testCases := []struct {
+		name         string
+		params       CreateParams
+		expectedData map[string]interface{}
+	}{
+		{
+			name: "without SANs",
+			params: CreateParams{
+				AllowedDomains:  []string{"example.com"},
+				AllowSubdomains: true,
+				Name:            "role-abc",
+				TTL:             "1h",
+			},
+			expectedData: map[string]interface{}{
+				"allowed_domains":    "example.com",
+				"allow_subdomains":   true,
+				"ttl":                "1h",
+				"allow_bare_domains": false,
+				"organization":       "",
+			},
+		},
+		{
+			name: "with SANs",
+			params: CreateParams{
+				AllowedDomains:   []string{"example.com", "example.org"},
+				AllowedOtherSANs: []string{"1.3.6.1.4.1.311.20.2.3;UTF8:*@example.com", "1.2.3;UTF8:foo"},
+				AllowedURISANs:   []string{"spiffe://example.org/cluster/abc/*"},
+				Name:             "role-org-123",
+				Organizations:    []string{"a", "b"},
+				TTL:              "1h",
+			},
+			expectedData: map[string]interface{}{
+				"allowed_domains":    "example.com,example.org",
+				"allow_subdomains":   false,
+				"ttl":                "1h",
+				"allow_bare_domains": false,
+				"organization":       "a,b",
+				"allowed_other_sans": "1.3.6.1.4.1.311.20.2.3;UTF8:*@example.com,1.2.3;UTF8:foo",
+				"allowed_uri_sans":   "spiffe://example.org/cluster/abc/*",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var path string
+			var data map[string]interface{}
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+				err := json.NewDecoder(r.Body).Decode(&data)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer s.Close()
+
+			clientConfig := vaultclient.DefaultConfig()
+			clientConfig.Address = s.URL
+			vaultClient, err := vaultclient.NewClient(clientConfig)
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			vaultClient.SetMaxRetries(0)
+			vaultClient.SetToken("token")
+
+			config := DefaultConfig()
+			config.Logger = microloggertest.New()
+			config.VaultClient = vaultClient
+			config.PKIMountpoint = "pki-abc"
+			service, err := New(config)
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+
+			err = service.CreateWithContext(context.Background(), tc.params)
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+
+			expectedPath := "/v1/pki-abc/roles/" + tc.params.Name
+			if path != expectedPath {
+				t.Fatalf("expected path %q, got %q", expectedPath, path)
+			}
+			if !reflect.DeepEqual(data, tc.expectedData) {
+				t.Fatalf("expected data %#v, got %#v", tc.expectedData, data)
+			}
+		})
+	}
+}
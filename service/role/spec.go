@@ -1,13 +1,46 @@
 package role
 
+import (
+	"context"
+	"time"
+)
+
 // CreateParams represent the parameters for creating a role.
 type CreateParams struct {
-	AllowBareDomains bool   `json:"allow_bare_domains"`
-	AllowSubdomains  bool   `json:"allow_sub_domains"`
-	AllowedDomains   string `json:"allowed_domains"`
-	Name             string `json:"name"`
-	Organizations    string `json:"organizations"`
-	TTL              string `json:"ttl"`
+	AllowBareDomains bool     `json:"allow_bare_domains"`
+	AllowSubdomains  bool     `json:"allow_sub_domains"`
+	AllowedDomains   []string `json:"allowed_domains"`
+	AllowedOtherSANs []string `json:"allowed_other_sans"`
+	AllowedURISANs   []string `json:"allowed_uri_sans"`
+	Name             string   `json:"name"`
+	Organizations    []string `json:"organizations"`
+	TTL              string   `json:"ttl"`
+}
+
+// Role describes the constraints a role puts on issued certificates.
+type Role struct {
+	Name string `json:"name"`
+
+	AllowAnyName     bool     `json:"allow_any_name"`
+	AllowBareDomains bool     `json:"allow_bare_domains"`
+	AllowGlobDomains bool     `json:"allow_glob_domains"`
+	AllowIPSANs      bool     `json:"allow_ip_sans"`
+	AllowLocalhost   bool     `json:"allow_localhost"`
+	AllowSubdomains  bool     `json:"allow_subdomains"`
+	AllowedDomains   []string `json:"allowed_domains"`
+
+	// AllowedURISANs are the URI SANs, e.g. SPIFFE IDs, issued certificates
+	// may contain. A '*' matches any sequence of characters. Empty means no
+	// URI SANs are allowed.
+	AllowedURISANs []string `json:"allowed_uri_sans"`
+
+	// TTL is the default time to live of issued certificates. Zero means the
+	// mount's default lease TTL applies.
+	TTL time.Duration `json:"ttl"`
+
+	// MaxTTL is the maximum time to live of issued certificates. Zero means
+	// the mount's maximum lease TTL applies.
+	MaxTTL time.Duration `json:"max_ttl"`
 }
 
 // Service manages the setup of Vault's PKI backends and all other required
@@ -18,6 +51,21 @@ type Service interface {
 	// Create creates a role.
 	Create(params CreateParams) error
 
+	// CreateWithContext is the context aware variant of Create.
+	CreateWithContext(ctx context.Context, params CreateParams) error
+
 	// IsRoleCreated checks whether a given role exists.
 	IsRoleCreated(roleName string) (bool, error)
+
+	// IsRoleCreatedWithContext is the context aware variant of IsRoleCreated.
+	IsRoleCreatedWithContext(ctx context.Context, roleName string) (bool, error)
+
+	// Role returns the constraints of the given role. In case the role does
+	// not exist an error asserted by IsRoleNotFound is returned. In case the
+	// Vault token is not allowed to read the role an error asserted by
+	// IsPermissionDenied is returned.
+	Role(roleName string) (Role, error)
+
+	// RoleWithContext is the context aware variant of Role.
+	RoleWithContext(ctx context.Context, roleName string) (Role, error)
 }
@@ -1,5 +1,11 @@
 package spec
 
+import (
+	"context"
+	"net"
+	"time"
+)
+
 // IssueConfig is used to configure the process of issuing a certificate key
 // pair using the CertSigner.
 type IssueConfig struct {
@@ -11,20 +17,39 @@ type IssueConfig struct {
 	// that is being requested.
 	CommonName string `json:"common_name"`
 
-	// Organizations is a comma seperated list of organizations ("O"'s) for the issued cert's
-	// subject line.
-	Organizations string `json:"organizations"`
+	// Organizations is the list of organizations ("O"'s) for the issued
+	// cert's subject line. The order is irrelevant, and surrounding whitespace,
+	// empty items and duplicates are ignored.
+	Organizations []string `json:"organizations"`
+
+	// IPSANs is the list of IP subject alternative names.
+	IPSANs []net.IP `json:"ip_sans"`
 
-	// IPSANs represents a comma separate lists of IPs.
-	IPSANs string `json:"ip_sans"`
+	// AltNames is the list of DNS or email subject alternative names.
+	AltNames []string `json:"alt_names"`
 
-	// AltNames names represents a comma separate list of alternative names.
-	AltNames string `json:"alt_names"`
+	// URISANs is the list of URI subject alternative names, e.g. SPIFFE IDs.
+	// The issued certificate is verified to contain exactly these URIs, which
+	// is why they cannot be combined with WrapTTL.
+	URISANs []string `json:"uri_sans"`
+
+	// OtherSANs is the list of custom OID/UTF8-string subject alternative
+	// names in the format Vault expects, <oid>;UTF8:<value>, e.g.
+	// 1.3.6.1.4.1.311.20.2.3;UTF8:devops@example.com. The role must allow
+	// them, see AllowedOtherSANs.
+	OtherSANs []string `json:"other_sans"`
 
 	// TTL configures the time to live for the requested certificate. This is a
 	// golang time string with the allowed units s, m and h.
 	TTL string `json:"ttl"`
 
+	// WrapTTL, if set, causes Vault to respond with a single-use wrapping token
+	// instead of the issued certificate key pair. The wrapping token is only
+	// valid for the given time to live and is returned as
+	// IssueResponse.WrappingToken. This is a golang time string with the
+	// allowed units s, m and h.
+	WrapTTL string `json:"wrap_ttl"`
+
 	//// QUESTIONABLE ATTRIBUTES
 	///
 
@@ -33,9 +58,11 @@ type IssueConfig struct {
 	// might also create a role in vault on the fly, and these attributes are part of a role
 	// definition.
 
-	AllowedDomains   string `json:"allowed_domains"`
-	AllowBareDomains bool   `json:"allow_bare_domains"`
-	RoleTTL          string `json:"role_ttl"`
+	AllowedDomains   []string `json:"allowed_domains"`
+	AllowBareDomains bool     `json:"allow_bare_domains"`
+	AllowedOtherSANs []string `json:"allowed_other_sans"`
+	AllowedURISANs   []string `json:"allowed_uri_sans"`
+	RoleTTL          string   `json:"role_ttl"`
 
 	///
 	//// END QUESTIONABLE
@@ -46,6 +73,59 @@ type IssueResponse struct {
 	PrivateKey   string `json:"private_key"`
 	IssuingCA    string `json:"issuing_ca"`
 	SerialNumber string `json:"serial_number"`
+
+	// WrappingToken is only set in case IssueConfig.WrapTTL was given. Then
+	// all other fields are empty, because the issued certificate key pair is
+	// only accessible by unwrapping the wrapping token.
+	WrappingToken string `json:"wrapping_token,omitempty"`
+}
+
+// SignConfig is used to configure the process of signing a certificate
+// signing request using the CertSigner.
+type SignConfig struct {
+	// ClusterID represents the cluster ID the certificate signing request
+	// should be signed for.
+	ClusterID string `json:"cluster_id"`
+
+	// CSR is the PEM encoded certificate signing request. The common name,
+	// organizations and subject alternative names it contains are requested,
+	// while its private key never leaves the requester.
+	CSR string `json:"csr"`
+
+	// TTL configures the time to live for the requested certificate. This is a
+	// golang time string with the allowed units s, m and h.
+	TTL string `json:"ttl"`
+
+	// AllowedDomains, AllowBareDomains, AllowedURISANs and RoleTTL configure
+	// the role that might get created while signing, the same as for
+	// IssueConfig.
+	AllowedDomains   []string `json:"allowed_domains"`
+	AllowBareDomains bool     `json:"allow_bare_domains"`
+	AllowedURISANs   []string `json:"allowed_uri_sans"`
+	RoleTTL          string   `json:"role_ttl"`
+}
+
+type SignResponse struct {
+	Certificate  string `json:"certificate"`
+	IssuingCA    string `json:"issuing_ca"`
+	SerialNumber string `json:"serial_number"`
+}
+
+// RevokeConfig is used to configure the revocation of a certificate using the
+// CertSigner.
+type RevokeConfig struct {
+	// ClusterID represents the cluster ID the certificate was issued for.
+	ClusterID string `json:"cluster_id"`
+
+	// SerialNumber is the serial number of the certificate to revoke, as colon
+	// or hyphen separated hex bytes, e.g. 39:dd:2e:90:...
+	SerialNumber string `json:"serial_number"`
+}
+
+type RevokeResponse struct {
+	// RevocationTime is the time the certificate was revoked. Revoking an
+	// already revoked certificate returns the original revocation time.
+	RevocationTime time.Time `json:"revocation_time"`
 }
 
 // CertSigner manages the process of issuing new certificate key pairs
@@ -54,8 +134,32 @@ type CertSigner interface {
 	// configuration.
 	Issue(config IssueConfig) (IssueResponse, error)
 
+	// IssueWithContext is the context aware variant of Issue.
+	IssueWithContext(ctx context.Context, config IssueConfig) (IssueResponse, error)
+
+	// Sign signs the given certificate signing request with respect to the
+	// given configuration. The role used is selected by the organizations of
+	// the request, the same as for Issue. In case the request is malformed or
+	// its signature is invalid, an error asserted by certsigner.IsInvalidCSR is
+	// returned.
+	Sign(config SignConfig) (SignResponse, error)
+
+	// SignWithContext is the context aware variant of Sign.
+	SignWithContext(ctx context.Context, config SignConfig) (SignResponse, error)
+
+	// Revoke revokes the certificate with the given serial number, so that it
+	// is listed in the CRL of the cluster's PKI backend. In case the
+	// certificate was not issued by the PKI backend an error asserted by
+	// certsigner.IsCertificateNotFound is returned.
+	Revoke(config RevokeConfig) (RevokeResponse, error)
+
+	// RevokeWithContext is the context aware variant of Revoke.
+	RevokeWithContext(ctx context.Context, config RevokeConfig) (RevokeResponse, error)
+
 	// SignedPath returns the path under which a certificate can be generated.
-	// This is very specific to Vault. The path structure is the following. See
+	// This is very specific to Vault. The mount path pki-<clusterID> shown
+	// below is the default of the configurable mount path scheme. The path
+	// structure is the following. See
 	// also https://github.com/hashicorp/vault/blob/6f0f46deb622ba9c7b14b2ec0be24cab3916f3d8/website/source/docs/secrets/pki/index.html.md#pkiissue.
 	//
 	//		 When organizations is blank:
@@ -65,7 +169,8 @@ type CertSigner interface {
 	//     pki-<clusterID>/issue/role-org-<organizationsHash>
 	//
 	//     organizationsHash is a deterministic urlsafe hash that is always the
-	//     same regardless of what order you give the organizations in.
+	//     same regardless of what order you give the organizations in, see
+	//     role.OrganizationsHash.
 	//
 	SignedPath(clusterID string, organizations []string) string
 }
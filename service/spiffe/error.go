@@ -0,0 +1,23 @@
+package spiffe
+
+import (
+	"github.com/giantswarm/microerror"
+)
+
+var invalidConfigError = &microerror.Error{
+	Kind: "invalidConfigError",
+}
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return microerror.Cause(err) == invalidConfigError
+}
+
+var invalidIDError = &microerror.Error{
+	Kind: "invalidIDError",
+}
+
+// IsInvalidID asserts invalidIDError.
+func IsInvalidID(err error) bool {
+	return microerror.Cause(err) == invalidIDError
+}
@@ -0,0 +1,189 @@
+package spiffe
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/giantswarm/microerror"
+)
+
+const (
+	// DefaultPathFormat allows any workload path below the cluster ID.
+	DefaultPathFormat = "/cluster/{{.ClusterID}}/*"
+
+	// URIScheme is the URI scheme of SPIFFE IDs.
+	URIScheme = "spiffe"
+)
+
+const (
+	// placeholder is rendered in place of the cluster ID in order to validate
+	// a path format independent of actual cluster IDs.
+	placeholder = "cluster-id"
+)
+
+// Config represents the configuration used to create a new SPIFFE scheme.
+type Config struct {
+	// Settings.
+
+	// TrustDomain is the SPIFFE trust domain, e.g. example.org.
+	TrustDomain string
+
+	// PathFormat is a Go template rendered with the cluster ID available as
+	// {{.ClusterID}}, e.g. "/cluster/{{.ClusterID}}/*". A '*' matches any
+	// sequence of characters, so that a single role covers all workloads of a
+	// cluster. The cluster ID must be used, so that clusters cannot issue
+	// certificates for each other's workloads.
+	PathFormat string
+}
+
+// DefaultConfig provides a default configuration to create a SPIFFE scheme.
+func DefaultConfig() Config {
+	newConfig := Config{
+		// Settings.
+		TrustDomain: "",
+		PathFormat:  DefaultPathFormat,
+	}
+
+	return newConfig
+}
+
+// New creates a new configured SPIFFE scheme.
+func New(config Config) (Scheme, error) {
+	// Settings.
+	if config.TrustDomain == "" {
+		return nil, microerror.Maskf(invalidConfigError, "trust domain must not be empty")
+	}
+	err := validateTrustDomain(config.TrustDomain)
+	if err != nil {
+		return nil, microerror.Maskf(invalidConfigError, "trust domain '%s' is invalid: %s", config.TrustDomain, err)
+	}
+	if config.PathFormat == "" {
+		return nil, microerror.Maskf(invalidConfigError, "path format must not be empty")
+	}
+
+	tmpl, err := template.New("spiffe-path").Option("missingkey=error").Parse(config.PathFormat)
+	if err != nil {
+		return nil, microerror.Maskf(invalidConfigError, "path format must be a valid Go template: %s", err)
+	}
+
+	newScheme := &scheme{
+		template:    tmpl,
+		trustDomain: config.TrustDomain,
+	}
+
+	rendered, err := newScheme.render(placeholder)
+	if err != nil {
+		return nil, microerror.Maskf(invalidConfigError, "path format cannot be rendered: %s", err)
+	}
+	if !strings.Contains(rendered, placeholder) {
+		return nil, microerror.Maskf(invalidConfigError, "path format must contain {{.ClusterID}}")
+	}
+	err = validatePath(strings.Replace(rendered, "*", "x", -1))
+	if err != nil {
+		return nil, microerror.Maskf(invalidConfigError, "path format renders an invalid path: %s", err)
+	}
+
+	return newScheme, nil
+}
+
+type scheme struct {
+	template    *template.Template
+	trustDomain string
+}
+
+func (s *scheme) AllowedURISAN(clusterID string) string {
+	// Errors cannot occur here, because the template was already rendered
+	// successfully when creating the scheme and the cluster ID is only ever
+	// inserted as plain text.
+	rendered, _ := s.render(clusterID)
+
+	return fmt.Sprintf("%s://%s%s", URIScheme, s.trustDomain, rendered)
+}
+
+func (s *scheme) TrustDomain() string {
+	return s.trustDomain
+}
+
+func (s *scheme) render(clusterID string) (string, error) {
+	var result bytes.Buffer
+
+	err := s.template.Execute(&result, struct{ ClusterID string }{ClusterID: clusterID})
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return result.String(), nil
+}
+
+// IsID returns true in case the given URI uses the spiffe scheme, regardless
+// of whether it is a valid SPIFFE ID.
+func IsID(uri string) bool {
+	return strings.HasPrefix(strings.ToLower(uri), URIScheme+":")
+}
+
+// ValidateID checks the given URI against the SPIFFE ID specification. A
+// SPIFFE ID consists of the spiffe scheme, a lower case trust domain and an
+// optional path, without port, user info, query or fragment.
+func ValidateID(uri string) error {
+	if !strings.HasPrefix(uri, URIScheme+"://") {
+		return microerror.Maskf(invalidIDError, "'%s' must start with '%s://'", uri, URIScheme)
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return microerror.Maskf(invalidIDError, "'%s' is not a valid URI: %s", uri, err)
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" || strings.ContainsAny(uri, "?#") {
+		return microerror.Maskf(invalidIDError, "'%s' must not contain user info, query or fragment", uri)
+	}
+
+	err = validateTrustDomain(u.Host)
+	if err != nil {
+		return microerror.Maskf(invalidIDError, "'%s' has an invalid trust domain: %s", uri, err)
+	}
+	if u.Path != "" {
+		err = validatePath(u.Path)
+		if err != nil {
+			return microerror.Maskf(invalidIDError, "'%s' has an invalid path: %s", uri, err)
+		}
+	}
+
+	return nil
+}
+
+func validateTrustDomain(trustDomain string) error {
+	if trustDomain == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	for _, r := range trustDomain {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_') {
+			return fmt.Errorf("must only contain lower case letters, digits, dots, dashes and underscores")
+		}
+	}
+
+	return nil
+}
+
+func validatePath(path string) error {
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("must start with a slash")
+	}
+	for _, segment := range strings.Split(path[1:], "/") {
+		if segment == "" {
+			return fmt.Errorf("must not contain empty segments or a trailing slash")
+		}
+		if segment == "." || segment == ".." {
+			return fmt.Errorf("must not contain relative segments")
+		}
+		for _, r := range segment {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_') {
+				return fmt.Errorf("must only contain letters, digits, dots, dashes and underscores")
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,231 @@
+package spiffe
+
+import (
+	"testing"
+)
+
+func Test_New(t *testing.T) {
+	testCases := []struct {
+		name                  string
+		trustDomain           string
+		pathFormat            string
+		expectedAllowedURISAN string
+		errorMatcher          func(error) bool
+	}{
+		{
+			name:                  "default path format",
+			trustDomain:           "example.org",
+			pathFormat:            DefaultPathFormat,
+			expectedAllowedURISAN: "spiffe://example.org/cluster/123/*",
+		},
+		{
+			name:                  "custom path format",
+			trustDomain:           "prod.example.org",
+			pathFormat:            "/k8s/{{.ClusterID}}/ns/*",
+			expectedAllowedURISAN: "spiffe://prod.example.org/k8s/123/ns/*",
+		},
+		{
+			name:         "empty trust domain",
+			trustDomain:  "",
+			pathFormat:   DefaultPathFormat,
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name:         "upper case trust domain",
+			trustDomain:  "Example.org",
+			pathFormat:   DefaultPathFormat,
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name:         "trust domain with port",
+			trustDomain:  "example.org:443",
+			pathFormat:   DefaultPathFormat,
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name:         "empty path format",
+			trustDomain:  "example.org",
+			pathFormat:   "",
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name:         "invalid template",
+			trustDomain:  "example.org",
+			pathFormat:   "/cluster/{{.ClusterID",
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name:         "unknown template field",
+			trustDomain:  "example.org",
+			pathFormat:   "/cluster/{{.Foo}}/*",
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name:         "path format without cluster ID",
+			trustDomain:  "example.org",
+			pathFormat:   "/cluster/*",
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name:         "path format without leading slash",
+			trustDomain:  "example.org",
+			pathFormat:   "cluster/{{.ClusterID}}/*",
+			errorMatcher: IsInvalidConfig,
+		},
+		{
+			name:         "path format with relative segment",
+			trustDomain:  "example.org",
+			pathFormat:   "/cluster/../{{.ClusterID}}/*",
+			errorMatcher: IsInvalidConfig,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.TrustDomain = tc.trustDomain
+			config.PathFormat = tc.pathFormat
+
+			s, err := New(config)
+			if tc.errorMatcher != nil {
+				if !tc.errorMatcher(err) {
+					t.Fatalf("expected error to match, got %#v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+
+			if s.TrustDomain() != tc.trustDomain {
+				t.Fatalf("expected trust domain %q, got %q", tc.trustDomain, s.TrustDomain())
+			}
+			allowed := s.AllowedURISAN("123")
+			if allowed != tc.expectedAllowedURISAN {
+				t.Fatalf("expected allowed URI SAN %q, got %q", tc.expectedAllowedURISAN, allowed)
+			}
+		})
+	}
+}
+
+func Test_IsID(t *testing.T) {
+	testCases := []struct {
+		uri      string
+		expected bool
+	}{
+		{uri: "spiffe://example.org/foo", expected: true},
+		{uri: "SPIFFE://example.org/foo", expected: true},
+		{uri: "spiffe:foo", expected: true},
+		{uri: "https://example.org/foo", expected: false},
+		{uri: "spiffe", expected: false},
+		{uri: "", expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.uri, func(t *testing.T) {
+			result := IsID(tc.uri)
+			if result != tc.expected {
+				t.Fatalf("expected %t, got %t", tc.expected, result)
+			}
+		})
+	}
+}
+
+func Test_ValidateID(t *testing.T) {
+	testCases := []struct {
+		uri           string
+		expectedValid bool
+	}{
+		{uri: "spiffe://example.org", expectedValid: true},
+		{uri: "spiffe://example.org/cluster/123/ns/default/sa/api", expectedValid: true},
+		{uri: "spiffe://example.org/Foo_bar-1.2", expectedValid: true},
+		{uri: "SPIFFE://example.org/foo", expectedValid: false},
+		{uri: "spiffe:example.org/foo", expectedValid: false},
+		{uri: "https://example.org/foo", expectedValid: false},
+		{uri: "spiffe:///foo", expectedValid: false},
+		{uri: "spiffe://Example.org/foo", expectedValid: false},
+		{uri: "spiffe://example.org:443/foo", expectedValid: false},
+		{uri: "spiffe://user@example.org/foo", expectedValid: false},
+		{uri: "spiffe://example.org/foo?bar=baz", expectedValid: false},
+		{uri: "spiffe://example.org/foo#bar", expectedValid: false},
+		{uri: "spiffe://example.org/foo?", expectedValid: false},
+		{uri: "spiffe://example.org/", expectedValid: false},
+		{uri: "spiffe://example.org/foo//bar", expectedValid: false},
+		{uri: "spiffe://example.org/foo/../bar", expectedValid: false},
+		{uri: "spiffe://example.org/foo/*", expectedValid: false},
+		{uri: "spiffe://example.org/foo%20bar", expectedValid: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.uri, func(t *testing.T) {
+			err := ValidateID(tc.uri)
+			if tc.expectedValid && err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			if !tc.expectedValid && !IsInvalidID(err) {
+				t.Fatalf("expected invalid ID error, got %#v", err)
+			}
+		})
+	}
+}
+
+func Test_validateTrustDomain(t *testing.T) {
+	testCases := []struct {
+		trustDomain   string
+		expectedValid bool
+	}{
+		{trustDomain: "example.org", expectedValid: true},
+		{trustDomain: "my-domain_1.example.org", expectedValid: true},
+		{trustDomain: "localhost", expectedValid: true},
+		{trustDomain: "", expectedValid: false},
+		{trustDomain: "Example.org", expectedValid: false},
+		{trustDomain: "example.org:443", expectedValid: false},
+		{trustDomain: "example.org/foo", expectedValid: false},
+		{trustDomain: "exämple.org", expectedValid: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.trustDomain, func(t *testing.T) {
+			err := validateTrustDomain(tc.trustDomain)
+			if tc.expectedValid && err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			if !tc.expectedValid && err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+		})
+	}
+}
+
+func Test_validatePath(t *testing.T) {
+	testCases := []struct {
+		path          string
+		expectedValid bool
+	}{
+		{path: "/foo", expectedValid: true},
+		{path: "/cluster/123/ns/default/sa/api", expectedValid: true},
+		{path: "/Foo_bar-1.2/.foo", expectedValid: true},
+		{path: "", expectedValid: false},
+		{path: "/", expectedValid: false},
+		{path: "foo", expectedValid: false},
+		{path: "/foo/", expectedValid: false},
+		{path: "/foo//bar", expectedValid: false},
+		{path: "/foo/./bar", expectedValid: false},
+		{path: "/foo/..", expectedValid: false},
+		{path: "/foo/*", expectedValid: false},
+		{path: "/foo bar", expectedValid: false},
+		{path: "/föo", expectedValid: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			err := validatePath(tc.path)
+			if tc.expectedValid && err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			if !tc.expectedValid && err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package spiffe
+
+// Scheme defines the SPIFFE IDs the PKI role of a cluster is allowed to issue
+// certificates for. See https://github.com/spiffe/spiffe/blob/main/standards/SPIFFE-ID.md.
+type Scheme interface {
+	// AllowedURISAN returns the pattern of SPIFFE IDs allowed for the given
+	// cluster ID as understood by Vault's allowed_uri_sans role setting, e.g.
+	//
+	//     spiffe://<trustDomain>/cluster/<clusterID>/*
+	//
+	AllowedURISAN(clusterID string) string
+
+	// TrustDomain returns the trust domain of the scheme, e.g. example.org.
+	TrustDomain() string
+}
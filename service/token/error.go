@@ -21,3 +21,12 @@ var policyAlreadyExistsError = &microerror.Error{
 func IsPolicyAlreadyExists(err error) bool {
 	return microerror.Cause(err) == policyAlreadyExistsError
 }
+
+var wrappingNotSupportedError = &microerror.Error{
+	Kind: "wrappingNotSupportedError",
+}
+
+// IsWrappingNotSupported asserts wrappingNotSupportedError.
+func IsWrappingNotSupported(err error) bool {
+	return microerror.Cause(err) == wrappingNotSupportedError
+}
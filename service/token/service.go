@@ -1,14 +1,19 @@
 package token
 
 import (
-	"crypto/sha512"
+	"context"
 	"fmt"
-	"sort"
-	"strings"
+	"os"
 
 	"github.com/giantswarm/go-uuid/uuid"
 	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
 	vaultclient "github.com/hashicorp/vault/api"
+
+	"github.com/giantswarm/certctl/v2/service/metrics"
+	mountpath "github.com/giantswarm/certctl/v2/service/mount-path"
+	"github.com/giantswarm/certctl/v2/service/role"
+	"github.com/giantswarm/certctl/v2/service/wrapping"
 )
 
 const (
@@ -18,7 +23,9 @@ const (
 // ServiceConfig represents the configuration used to create a new service.
 type ServiceConfig struct {
 	// Dependencies.
-	VaultClient *vaultclient.Client
+	Logger          micrologger.Logger
+	MountPathScheme mountpath.Scheme
+	VaultClient     *vaultclient.Client
 }
 
 // DefaultServiceConfig provides a default configuration to create a service.
@@ -30,9 +37,21 @@ func DefaultServiceConfig() ServiceConfig {
 		panic(err)
 	}
 
+	newLogger, err := micrologger.New(micrologger.Config{IOWriter: os.Stderr})
+	if err != nil {
+		panic(err)
+	}
+
+	newMountPathScheme, err := mountpath.New(mountpath.DefaultConfig())
+	if err != nil {
+		panic(err)
+	}
+
 	newConfig := ServiceConfig{
 		// Dependencies.
-		VaultClient: newVaultClient,
+		Logger:          newLogger,
+		MountPathScheme: newMountPathScheme,
+		VaultClient:     newVaultClient,
 	}
 
 	return newConfig
@@ -41,6 +60,12 @@ func DefaultServiceConfig() ServiceConfig {
 // NewService creates a new configured service.
 func NewService(config ServiceConfig) (Service, error) {
 	// Dependencies.
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "logger must not be empty")
+	}
+	if config.MountPathScheme == nil {
+		return nil, microerror.Maskf(invalidConfigError, "mount path scheme must not be empty")
+	}
 	if config.VaultClient == nil {
 		return nil, microerror.Maskf(invalidConfigError, "Vault client must not be empty")
 	}
@@ -57,14 +82,18 @@ type service struct {
 }
 
 func (s *service) Create(config CreateConfig) ([]string, error) {
+	return s.CreateWithContext(context.Background(), config)
+}
+
+func (s *service) CreateWithContext(ctx context.Context, config CreateConfig) ([]string, error) {
 	// In case there does no policy exist that allows to issue certificates on a
 	// PKI backend, create one.
-	policyCreated, err := s.IsPolicyCreated(config.ClusterID)
+	policyCreated, err := s.IsPolicyCreatedWithContext(ctx, config.ClusterID)
 	if err != nil {
 		return nil, microerror.Mask(err)
 	}
 	if !policyCreated {
-		err := s.CreatePolicy(config.ClusterID)
+		err := s.CreatePolicyWithContext(ctx, config.ClusterID)
 		if err != nil {
 			return nil, microerror.Mask(err)
 		}
@@ -72,25 +101,30 @@ func (s *service) Create(config CreateConfig) ([]string, error) {
 
 	// In case there is no policy exist that allows to issue certificates
 	// with organization on a PKI backend, create one.
-	orgPolicyCreated, err := s.IsOrgPolicyCreated(config.ClusterID)
+	orgPolicyCreated, err := s.IsOrgPolicyCreatedWithContext(ctx, config.ClusterID)
 	if err != nil {
 		return nil, microerror.Mask(err)
 	}
 	if !orgPolicyCreated {
-		err := s.CreateOrgPolicy(config.ClusterID)
+		err := s.CreateOrgPolicyWithContext(ctx, config.ClusterID)
 		if err != nil {
 			return nil, microerror.Mask(err)
 		}
 	}
 
-	// Get the token auth backend to create new tokens.
-	tokenAuth := s.VaultClient.Auth().Token()
+	// Get the token auth backend to create new tokens. In case response
+	// wrapping is requested, the token auth backend of a wrapping client is
+	// used.
+	newVaultClient, err := wrapping.NewClient(s.VaultClient, config.WrapTTL)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	tokenAuth := newVaultClient.Auth().Token()
 
 	// Create the requested amount of tokens.
 	var tokens []string
 	for i := 0; i < config.Num; i++ {
 		tokenID := uuid.New()
-		tokens = append(tokens, tokenID)
 		newCreateRequest := &vaultclient.TokenCreateRequest{
 			ID: tokenID,
 			Metadata: map[string]string{
@@ -100,29 +134,74 @@ func (s *service) Create(config CreateConfig) ([]string, error) {
 			Policies: []string{s.PolicyName(config.ClusterID)},
 			TTL:      config.TTL,
 		}
-		_, err := tokenAuth.Create(newCreateRequest)
+		secret, err := tokenAuth.CreateWithContext(ctx, newCreateRequest)
 		if err != nil {
 			return nil, microerror.Mask(err)
 		}
+		metrics.TokenCreations.WithLabelValues(config.ClusterID).Inc()
+		s.Logger.LogCtx(ctx, "level", "debug", "message", "created token", "cluster_id", config.ClusterID, "wrapped", config.WrapTTL != "")
+
+		if config.WrapTTL != "" {
+			if secret == nil || secret.WrapInfo == nil {
+				// The token was created nonetheless and must not be left
+				// behind unwrapped.
+				s.revokeUnwrapped(ctx, config.ClusterID, tokenID, secret)
+				return nil, microerror.Maskf(wrappingNotSupportedError, "token creation response is not wrapped")
+			}
+			tokens = append(tokens, secret.WrapInfo.Token)
+		} else {
+			tokens = append(tokens, tokenID)
+		}
 	}
 
 	return tokens, nil
 }
 
+// revokeUnwrapped revokes a token whose creation response was expected to be
+// wrapped but was not, by its accessor if the response holds one. Failing to
+// do so is only logged, so that the accessor can be revoked manually.
+func (s *service) revokeUnwrapped(ctx context.Context, clusterID, tokenID string, secret *vaultclient.Secret) {
+	tokenAuth := s.VaultClient.Auth().Token()
+
+	var accessor string
+	var err error
+	if secret != nil && secret.Auth != nil && secret.Auth.Accessor != "" {
+		accessor = secret.Auth.Accessor
+		err = tokenAuth.RevokeAccessorWithContext(ctx, accessor)
+	} else {
+		err = tokenAuth.RevokeTreeWithContext(ctx, tokenID)
+	}
+	if err != nil {
+		s.Logger.LogCtx(ctx, "level", "error", "message", "cannot revoke unwrapped token", "cluster_id", clusterID, "accessor", accessor, "error", microerror.Pretty(err, false))
+		return
+	}
+
+	s.Logger.LogCtx(ctx, "level", "debug", "message", "revoked unwrapped token", "cluster_id", clusterID, "accessor", accessor)
+}
+
 func (s *service) CreateOrgPolicy(clusterID string) error {
+	return s.CreateOrgPolicyWithContext(context.Background(), clusterID)
+}
+
+func (s *service) CreateOrgPolicyWithContext(ctx context.Context, clusterID string) error {
 	// Get the system backend for policy operations.
 	sysBackend := s.VaultClient.Sys()
 
+	err := mountpath.ValidateClusterID(clusterID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
 	// Create organization policy name and HCL policy rules.
 	orgPolicyName := s.OrgPolicyName(clusterID)
-	organizationsRoleHash := computeRoleHash(systemMastersOrganizations)
-	rules, err := execTemplate(pkiIssueOrgPolicyTemplate, pkiIssueOrgPolicyContext{ClusterID: clusterID, OrganizationsRoleHash: organizationsRoleHash})
+	organizationsRoleHash := role.OrganizationsHash([]string{systemMastersOrganizations})
+	rules, err := execTemplate(pkiIssueOrgPolicyTemplate, pkiIssueOrgPolicyContext{MountPath: s.MountPathScheme.MountPath(clusterID), OrganizationsRoleHash: organizationsRoleHash})
 	if err != nil {
 		return microerror.Mask(err)
 	}
 
 	// Actually create the policy within Vault.
-	err = sysBackend.PutPolicy(orgPolicyName, rules)
+	err = sysBackend.PutPolicyWithContext(ctx, orgPolicyName, rules)
 	if err != nil {
 		return microerror.Mask(err)
 	}
@@ -131,18 +210,27 @@ func (s *service) CreateOrgPolicy(clusterID string) error {
 }
 
 func (s *service) CreatePolicy(clusterID string) error {
+	return s.CreatePolicyWithContext(context.Background(), clusterID)
+}
+
+func (s *service) CreatePolicyWithContext(ctx context.Context, clusterID string) error {
 	// Get the system backend for policy operations.
 	sysBackend := s.VaultClient.Sys()
 
+	err := mountpath.ValidateClusterID(clusterID)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
 	// Create policy name and HCL policy rules.
 	policyName := s.PolicyName(clusterID)
-	rules, err := execTemplate(pkiIssuePolicyTemplate, pkiIssuePolicyContext{ClusterID: clusterID})
+	rules, err := execTemplate(pkiIssuePolicyTemplate, pkiIssuePolicyContext{ClusterID: clusterID, MountPath: s.MountPathScheme.MountPath(clusterID)})
 	if err != nil {
 		return microerror.Mask(err)
 	}
 
 	// Actually create the policy within Vault.
-	err = sysBackend.PutPolicy(policyName, rules)
+	err = sysBackend.PutPolicyWithContext(ctx, policyName, rules)
 	if err != nil {
 		return microerror.Mask(err)
 	}
@@ -151,16 +239,20 @@ func (s *service) CreatePolicy(clusterID string) error {
 }
 
 func (s *service) DeleteOrgPolicy(clusterID string) error {
+	return s.DeleteOrgPolicyWithContext(context.Background(), clusterID)
+}
+
+func (s *service) DeleteOrgPolicyWithContext(ctx context.Context, clusterID string) error {
 	// Get the system backend for policy operations.
 	sysBackend := s.VaultClient.Sys()
 
 	// Delete the policy by name if it is created.
-	created, err := s.IsOrgPolicyCreated(clusterID)
+	created, err := s.IsOrgPolicyCreatedWithContext(ctx, clusterID)
 	if err != nil {
 		return microerror.Mask(err)
 	}
 	if created {
-		err := sysBackend.DeletePolicy(s.OrgPolicyName(clusterID))
+		err := sysBackend.DeletePolicyWithContext(ctx, s.OrgPolicyName(clusterID))
 		if err != nil {
 			return microerror.Mask(err)
 		}
@@ -170,16 +262,20 @@ func (s *service) DeleteOrgPolicy(clusterID string) error {
 }
 
 func (s *service) DeletePolicy(clusterID string) error {
+	return s.DeletePolicyWithContext(context.Background(), clusterID)
+}
+
+func (s *service) DeletePolicyWithContext(ctx context.Context, clusterID string) error {
 	// Get the system backend for policy operations.
 	sysBackend := s.VaultClient.Sys()
 
 	// Delete the policy by name if it is created.
-	created, err := s.IsPolicyCreated(clusterID)
+	created, err := s.IsPolicyCreatedWithContext(ctx, clusterID)
 	if err != nil {
 		return microerror.Mask(err)
 	}
 	if created {
-		err := sysBackend.DeletePolicy(s.PolicyName(clusterID))
+		err := sysBackend.DeletePolicyWithContext(ctx, s.PolicyName(clusterID))
 		if err != nil {
 			return microerror.Mask(err)
 		}
@@ -189,11 +285,15 @@ func (s *service) DeletePolicy(clusterID string) error {
 }
 
 func (s *service) IsPolicyCreated(clusterID string) (bool, error) {
+	return s.IsPolicyCreatedWithContext(context.Background(), clusterID)
+}
+
+func (s *service) IsPolicyCreatedWithContext(ctx context.Context, clusterID string) (bool, error) {
 	// Get the system backend for policy operations.
 	sysBackend := s.VaultClient.Sys()
 
 	// Check if the policy is already there.
-	policies, err := sysBackend.ListPolicies()
+	policies, err := sysBackend.ListPoliciesWithContext(ctx)
 	if err != nil {
 		return false, microerror.Mask(err)
 	}
@@ -207,11 +307,15 @@ func (s *service) IsPolicyCreated(clusterID string) (bool, error) {
 }
 
 func (s *service) IsOrgPolicyCreated(clusterID string) (bool, error) {
+	return s.IsOrgPolicyCreatedWithContext(context.Background(), clusterID)
+}
+
+func (s *service) IsOrgPolicyCreatedWithContext(ctx context.Context, clusterID string) (bool, error) {
 	// Get the system backend for policy operations.
 	sysBackend := s.VaultClient.Sys()
 
 	// Check if the policy is already there.
-	policies, err := sysBackend.ListPolicies()
+	policies, err := sysBackend.ListPoliciesWithContext(ctx)
 	if err != nil {
 		return false, microerror.Mask(err)
 	}
@@ -224,32 +328,42 @@ func (s *service) IsOrgPolicyCreated(clusterID string) (bool, error) {
 	return false, nil
 }
 
+func (s *service) OrgPolicy(clusterID string) (string, error) {
+	return s.OrgPolicyWithContext(context.Background(), clusterID)
+}
+
+func (s *service) OrgPolicyWithContext(ctx context.Context, clusterID string) (string, error) {
+	// Get the system backend for policy operations.
+	sysBackend := s.VaultClient.Sys()
+
+	rules, err := sysBackend.GetPolicyWithContext(ctx, s.OrgPolicyName(clusterID))
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return rules, nil
+}
+
 func (s *service) OrgPolicyName(clusterID string) string {
 	return fmt.Sprintf("pki-issue-policy-%s-org", clusterID)
 }
 
-func (s *service) PolicyName(clusterID string) string {
-	return fmt.Sprintf("pki-issue-policy-%s", clusterID)
+func (s *service) Policy(clusterID string) (string, error) {
+	return s.PolicyWithContext(context.Background(), clusterID)
 }
 
-// computeRoleHash computes a hash for the role that can issue these organizations.
-// Since we want to reuse roles when possible, we should try to make sure that
-// the same list of organizations returns the same hash (regardless of the order).
-// The reason we don't use just the organizations that the user provided is because
-// that could potentially be a very long list, or otherwise contain characters
-// that are not allowed in URLs.
-func computeRoleHash(organizations string) string {
-	// Sort organizations alphabetically
-	organizationsSlice := strings.Split(organizations, ",")
-	sort.Strings(organizationsSlice)
-	organizations = strings.Join(organizationsSlice, ",")
+func (s *service) PolicyWithContext(ctx context.Context, clusterID string) (string, error) {
+	// Get the system backend for policy operations.
+	sysBackend := s.VaultClient.Sys()
 
-	h := sha512.New()
-	_, err := h.Write([]byte(organizations))
+	rules, err := sysBackend.GetPolicyWithContext(ctx, s.PolicyName(clusterID))
 	if err != nil {
-		panic(err)
+		return "", microerror.Mask(err)
 	}
-	bs := h.Sum(nil)
 
-	return fmt.Sprintf("%x", bs)
+	return rules, nil
+}
+
+func (s *service) PolicyName(clusterID string) string {
+	return fmt.Sprintf("pki-issue-policy-%s", clusterID)
 }
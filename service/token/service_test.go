@@ -0,0 +1,108 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	vaultclient "github.com/hashicorp/vault/api"
+)
+
+// Test_Service_Create_NotWrapped verifies that tokens are revoked in case
+// Vault does not wrap the response creating them, so that no unwrapped
+// orphan token is left behind.
+func Test_Service_Create_NotWrapped(t *testing.T) {
+	testCases := []struct {
+		name             string
+		response         string
+		expectedPath     string
+		expectedRevoked  string
+		expectedRevokeBy string
+	}{
+		{
+			name:             "by accessor",
+			response:         `{"auth":{"client_token":"token-abc","accessor":"accessor-abc"}}`,
+			expectedPath:     "/v1/auth/token/revoke-accessor",
+			expectedRevokeBy: "accessor",
+			expectedRevoked:  "accessor-abc",
+		},
+		{
+			name:             "by token without accessor",
+			response:         `{"auth":{"client_token":"token-abc"}}`,
+			expectedPath:     "/v1/auth/token/revoke",
+			expectedRevokeBy: "token",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var createdToken string
+			var revokePath string
+			var revokeData map[string]interface{}
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v1/sys/policies/acl":
+					_, _ = w.Write([]byte(`{"data":{"keys":["pki-issue-policy-abc","pki-issue-policy-abc-org"]}}`))
+				case "/v1/auth/token/create-orphan", "/v1/auth/token/create":
+					var data map[string]interface{}
+					err := json.NewDecoder(r.Body).Decode(&data)
+					if err != nil {
+						w.WriteHeader(http.StatusBadRequest)
+						return
+					}
+					createdToken, _ = data["id"].(string)
+					// The wrapping TTL header is ignored, e.g. by a proxy
+					// in front of Vault.
+					_, _ = w.Write([]byte(tc.response))
+				case "/v1/auth/token/revoke-accessor", "/v1/auth/token/revoke":
+					revokePath = r.URL.Path
+					err := json.NewDecoder(r.Body).Decode(&revokeData)
+					if err != nil {
+						w.WriteHeader(http.StatusBadRequest)
+						return
+					}
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer s.Close()
+
+			clientConfig := vaultclient.DefaultConfig()
+			clientConfig.Address = s.URL
+			vaultClient, err := vaultclient.NewClient(clientConfig)
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			vaultClient.SetMaxRetries(0)
+			vaultClient.SetToken("token")
+
+			config := DefaultServiceConfig()
+			config.Logger = microloggertest.New()
+			config.VaultClient = vaultClient
+			service, err := NewService(config)
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+
+			_, err = service.CreateWithContext(context.Background(), CreateConfig{ClusterID: "abc", Num: 1, TTL: "1h", WrapTTL: "5m"})
+			if !IsWrappingNotSupported(err) {
+				t.Fatalf("expected wrapping not supported error, got %#v", err)
+			}
+
+			expectedRevoked := tc.expectedRevoked
+			if expectedRevoked == "" {
+				expectedRevoked = createdToken
+			}
+			if revokePath != tc.expectedPath {
+				t.Fatalf("expected revoke path %q, got %q", tc.expectedPath, revokePath)
+			}
+			if revokeData[tc.expectedRevokeBy] != expectedRevoked {
+				t.Fatalf("expected %s %q to be revoked, got %#v", tc.expectedRevokeBy, expectedRevoked, revokeData)
+			}
+		})
+	}
+}
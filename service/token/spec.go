@@ -1,5 +1,9 @@
 package token
 
+import (
+	"context"
+)
+
 // CreateConfig is a data structure used to configure the token creation process
 // implemented by Service.Create.
 type CreateConfig struct {
@@ -15,44 +19,88 @@ type CreateConfig struct {
 	// TTL configures the time to live for the requested token. This is a golang
 	// time string with the allowed units s, m and h.
 	TTL string `json:"ttl"`
+
+	// WrapTTL, if set, causes Vault to respond with single-use wrapping tokens
+	// instead of the created tokens themselves. The wrapping tokens are only
+	// valid for the given time to live and can be exchanged once for the
+	// actual tokens using the wrapping service. This is a golang time string
+	// with the allowed units s, m and h.
+	WrapTTL string `json:"wrap_ttl"`
 }
 
 // Service creates new Vault policies to restrict access capabilities
 // of e.g. Vault tokens.
 type Service interface {
 	// Create generates new Vault tokens allowed to be used to issue signed
-	// certificates with respect to the given configuration.
+	// certificates with respect to the given configuration. In case
+	// CreateConfig.WrapTTL is set, wrapping tokens are returned instead.
 	Create(config CreateConfig) ([]string, error)
 
+	// CreateWithContext is the context aware variant of Create.
+	CreateWithContext(ctx context.Context, config CreateConfig) ([]string, error)
+
 	// CreateOrgPolicy creates a new policy to restrict access to only being able to
 	// issue signed certificates on the Vault PKI backend specific to the given
 	// cluster ID and organization.
 	CreateOrgPolicy(clusterID string) error
 
+	// CreateOrgPolicyWithContext is the context aware variant of CreateOrgPolicy.
+	CreateOrgPolicyWithContext(ctx context.Context, clusterID string) error
+
 	// CreatePolicy creates a new policy to restrict access to only being able to
 	// issue signed certificates on the Vault PKI backend specific to the given
 	// cluster ID. Here the given cluster ID is used to create the policy name and
 	// the policy specific rules matching certain paths within the Vault file
 	// system like path structure. This policy name can be used to e.g. apply it
-	// to some Vault token.
+	// to some Vault token. The policy is created in the namespace the Vault
+	// client is scoped to, if any.
 	CreatePolicy(clusterID string) error
 
+	// CreatePolicyWithContext is the context aware variant of CreatePolicy.
+	CreatePolicyWithContext(ctx context.Context, clusterID string) error
+
 	// DeleteOrgPolicy removes an org policy from Vault using its name.
 	DeleteOrgPolicy(clusterID string) error
 
+	// DeleteOrgPolicyWithContext is the context aware variant of DeleteOrgPolicy.
+	DeleteOrgPolicyWithContext(ctx context.Context, clusterID string) error
+
 	// DeletePolicy removes a policy from Vault using its name.
 	DeletePolicy(clusterID string) error
 
+	// DeletePolicyWithContext is the context aware variant of DeletePolicy.
+	DeletePolicyWithContext(ctx context.Context, clusterID string) error
+
 	// IsOrgPolicyCreated checks whether the PKI org issue policy already exists.
 	IsOrgPolicyCreated(clusterID string) (bool, error)
 
+	// IsOrgPolicyCreatedWithContext is the context aware variant of IsOrgPolicyCreated.
+	IsOrgPolicyCreatedWithContext(ctx context.Context, clusterID string) (bool, error)
+
 	// IsPolicyCreated checks whether the PKI issue policy already exists.
 	IsPolicyCreated(clusterID string) (bool, error)
 
+	// IsPolicyCreatedWithContext is the context aware variant of IsPolicyCreated.
+	IsPolicyCreatedWithContext(ctx context.Context, clusterID string) (bool, error)
+
+	// OrgPolicy returns the HCL rules of the org policy as stored in Vault. In
+	// case the org policy is not created, an empty string is returned.
+	OrgPolicy(clusterID string) (string, error)
+
+	// OrgPolicyWithContext is the context aware variant of OrgPolicy.
+	OrgPolicyWithContext(ctx context.Context, clusterID string) (string, error)
+
 	// OrgPolicyName returns the name of an org policy used to restrict access to Vault
 	// for PKI issue requests. This policy is scoped to the given cluster ID.
 	OrgPolicyName(clusterID string) string
 
+	// Policy returns the HCL rules of the policy as stored in Vault. In case
+	// the policy is not created, an empty string is returned.
+	Policy(clusterID string) (string, error)
+
+	// PolicyWithContext is the context aware variant of Policy.
+	PolicyWithContext(ctx context.Context, clusterID string) (string, error)
+
 	// PolicyName returns the name of a policy used to restrict access to Vault
 	// for PKI issue requests. This policy is scoped to the given cluster ID.
 	PolicyName(clusterID string) string
@@ -9,12 +9,13 @@ import (
 // the pkiIssuePolicyTemplate.
 type pkiIssuePolicyContext struct {
 	ClusterID string
+	MountPath string
 }
 
 // pkiIssueOrgPolicyContext is the template context provided to the rendering of
 // the pkiIssueOrgPolicyTemplate.
 type pkiIssueOrgPolicyContext struct {
-	ClusterID             string
+	MountPath             string
 	OrganizationsRoleHash string
 }
 
@@ -22,23 +23,29 @@ type pkiIssueOrgPolicyContext struct {
 // restrict access to only being able to issue signed certificates specific to
 // a Vault PKI backend of a cluster ID.
 var pkiIssuePolicyTemplate = `
-	path "pki-{{.ClusterID}}/issue/role-{{.ClusterID}}" {
+	path "{{.MountPath}}/issue/role-{{.ClusterID}}" {
 		capabilities = ["create", "update", "delete"]
 	}
-	path "pki-{{.ClusterID}}/roles/" {
+	path "{{.MountPath}}/roles/" {
 		capabilities = ["list"]
 	}
+	path "{{.MountPath}}/roles/role-{{.ClusterID}}" {
+		capabilities = ["read"]
+	}
+	path "sys/mounts/{{.MountPath}}/tune" {
+		capabilities = ["read"]
+	}
 `
 
 // pkiIssueOrgPolicyTemplate provides a template of Vault policy used to
 // restrict access to only being able to issue signed certificates specific to
 // a Vault PKI backend of a organization.
 var pkiIssueOrgPolicyTemplate = `
-	path "pki-{{.ClusterID}}/issue/role-org-{{.OrganizationsRoleHash}}" {
+	path "{{.MountPath}}/issue/role-org-{{.OrganizationsRoleHash}}" {
 		capabilities = ["create", "update", "delete"]
 	}
-	path "pki-{{.ClusterID}}/roles/role-org-{{.OrganizationsRoleHash}}" {
-		capabilities = ["create", "update", "delete"]
+	path "{{.MountPath}}/roles/role-org-{{.OrganizationsRoleHash}}" {
+		capabilities = ["create", "read", "update", "delete"]
 	}
 `
 
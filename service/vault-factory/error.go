@@ -12,3 +12,12 @@ var invalidConfigError = &microerror.Error{
 func IsInvalidConfig(err error) bool {
 	return microerror.Cause(err) == invalidConfigError
 }
+
+var noHealthyVaultError = &microerror.Error{
+	Kind: "noHealthyVaultError",
+}
+
+// IsNoHealthyVault asserts noHealthyVaultError.
+func IsNoHealthyVault(err error) bool {
+	return microerror.Cause(err) == noHealthyVaultError
+}
@@ -0,0 +1,97 @@
+package vaultfactory
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+)
+
+// health is the state of a Vault server as reported by its sys/health
+// endpoint. See https://www.vaultproject.io/api-docs/system/health.
+type health int
+
+const (
+	healthUnreachable health = iota
+	healthSealed
+	healthStandby
+	healthActive
+)
+
+func (h health) String() string {
+	switch h {
+	case healthActive:
+		return "active"
+	case healthStandby:
+		return "standby"
+	case healthSealed:
+		return "sealed or not initialized"
+	}
+
+	return "unreachable"
+}
+
+// probe requests the health of the Vault server at the given address. Only
+// the status code is evaluated, so that any Vault version is understood.
+func probe(ctx context.Context, client *http.Client, address string) (health, error) {
+	req, err := http.NewRequest("GET", strings.TrimSuffix(address, "/")+"/v1/sys/health", nil)
+	if err != nil {
+		return healthUnreachable, microerror.Mask(err)
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return healthUnreachable, microerror.Mask(err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return healthActive, nil
+	case 429, 473:
+		// Standbys and performance standbys forward requests to the active
+		// node or serve them themselves.
+		return healthStandby, nil
+	case 472, 501, 503:
+		// Disaster recovery secondaries cannot serve requests, neither can
+		// uninitialized or sealed servers.
+		return healthSealed, nil
+	}
+
+	return healthUnreachable, microerror.Maskf(noHealthyVaultError, "unexpected status code %d", resp.StatusCode)
+}
+
+// selectAddress probes the given addresses in order and returns the first
+// active one. In case there is none, the first standby is returned. Addresses
+// for which skip returns true are not probed.
+func selectAddress(ctx context.Context, client *http.Client, addresses []string, skip func(string) bool) (string, error) {
+	var standby string
+	var report []string
+	for _, address := range addresses {
+		if skip != nil && skip(address) {
+			continue
+		}
+
+		h, err := probe(ctx, client, address)
+		if err != nil {
+			report = append(report, fmt.Sprintf("%s: %s", address, err))
+			continue
+		}
+		if h == healthActive {
+			return address, nil
+		}
+		if h == healthStandby && standby == "" {
+			standby = address
+		}
+		report = append(report, fmt.Sprintf("%s: %s", address, h))
+	}
+
+	if standby != "" {
+		return standby, nil
+	}
+
+	return "", microerror.Maskf(noHealthyVaultError, "no Vault server is active or standby: %s", strings.Join(report, ", "))
+}
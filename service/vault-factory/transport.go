@@ -0,0 +1,201 @@
+package vaultfactory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+
+	"github.com/giantswarm/certctl/v2/service/metrics"
+)
+
+// failoverTransport sends requests to the currently selected Vault address.
+// In case the connection to it cannot be established, another address is
+// selected and the request is sent there instead. Only connection errors
+// cause a failover, because the request has not reached Vault then and can
+// safely be sent again, regardless of whether it is idempotent.
+type failoverTransport struct {
+	logger micrologger.Logger
+
+	base               http.RoundTripper
+	addresses          []string
+	healthCheckTimeout time.Duration
+
+	// reprobeInterval is the time addresses which failed are not failed over
+	// to again, so that they are considered again once they may be back.
+	reprobeInterval time.Duration
+
+	mutex   sync.Mutex
+	current string
+
+	// failed holds the time every address failed at.
+	failed map[string]time.Time
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The body is buffered so that it can be sent again after a failover.
+	// Request bodies sent to Vault are small JSON documents.
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		current := t.currentAddress()
+
+		r, err := rewrite(req, current, body)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := t.base.RoundTrip(r)
+		if err == nil || !isConnectionError(err) {
+			return resp, err
+		}
+
+		if !t.failover(req.Context(), current) {
+			return nil, err
+		}
+	}
+}
+
+func (t *failoverTransport) currentAddress() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.current
+}
+
+// failover selects another address after the given one failed. False is
+// returned in case there is none left. Addresses are probed without holding
+// the lock, so that requests to the current address are not blocked by
+// probes of unreachable ones.
+func (t *failoverTransport) failover(ctx context.Context, failed string) bool {
+	skip, ok := t.markFailed(failed)
+	if !ok {
+		// Another request failed over already.
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.healthCheckTimeout)
+	defer cancel()
+
+	client := &http.Client{Transport: t.base}
+	address, err := selectAddress(ctx, client, t.addresses, func(a string) bool { return skip[a] })
+	if err != nil {
+		t.logger.LogCtx(ctx, "level", "warning", "message", "cannot fail over to another Vault", "address", failed, "error", microerror.Pretty(err, false))
+		return false
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// Another request may have failed over while probing, in which case its
+	// selection is kept.
+	if t.current != failed {
+		return true
+	}
+	t.current = address
+
+	t.logger.LogCtx(ctx, "level", "warning", "message", "failed over to another Vault", "from", failed, "to", address)
+
+	return true
+}
+
+// markFailed records the given address as failed and returns the addresses
+// to be skipped when selecting another one. False is returned in case the
+// given address is not the current one anymore, i.e. another request failed
+// over already.
+func (t *failoverTransport) markFailed(failed string) (map[string]bool, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.current != failed {
+		return nil, false
+	}
+
+	// Addresses which failed recently are skipped, unless all of them did.
+	// Then all but the one failing right now are probed again, since any of
+	// them may be back by now.
+	now := time.Now()
+	for a, at := range t.failed {
+		if a == failed || now.Sub(at) >= t.reprobeInterval {
+			delete(t.failed, a)
+		}
+	}
+	if len(t.failed)+1 >= len(t.addresses) {
+		t.failed = map[string]time.Time{}
+	}
+	t.failed[failed] = now
+
+	skip := make(map[string]bool, len(t.failed))
+	for a := range t.failed {
+		skip[a] = true
+	}
+
+	return skip, true
+}
+
+// rewrite returns a copy of the given request sent to the given address
+// instead, carrying the given body.
+func rewrite(req *http.Request, address string, body []byte) (*http.Request, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	r := req.Clone(req.Context())
+	r.URL.Scheme = u.Scheme
+	r.URL.Host = u.Host
+	r.Host = ""
+	if body != nil {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+	}
+
+	return r, nil
+}
+
+// isConnectionError returns true in case the given error occurred before the
+// request was sent.
+func isConnectionError(err error) bool {
+	var opError *net.OpError
+	if errors.As(err, &opError) && opError.Op == "dial" {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// instrumentedTransport observes the latency of requests to Vault.
+type instrumentedTransport struct {
+	base http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+
+	code := metrics.CodeError
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	metrics.VaultRequestDuration.WithLabelValues(req.Method, code).Observe(time.Since(start).Seconds())
+
+	return resp, err
+}
@@ -0,0 +1,192 @@
+package vaultfactory
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+)
+
+// unreachableTransport fails to connect to the hosts marked as down, and
+// sends requests to all other hosts using the default transport.
+type unreachableTransport struct {
+	mutex sync.Mutex
+	down  map[string]bool
+}
+
+func (t *unreachableTransport) setDown(address string, down bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	u, _ := url.Parse(address)
+	t.down[u.Host] = down
+}
+
+func (t *unreachableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mutex.Lock()
+	down := t.down[req.URL.Host]
+	t.mutex.Unlock()
+
+	if down {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: &net.AddrError{Err: "connection refused", Addr: req.URL.Host}}
+	}
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func Test_failoverTransport_ConsecutiveFailovers(t *testing.T) {
+	var firstRequests, secondRequests int32
+	first := newVaultServer(t, http.StatusOK, &firstRequests)
+	second := newVaultServer(t, http.StatusOK, &secondRequests)
+
+	base := &unreachableTransport{down: map[string]bool{}}
+	transport := &failoverTransport{
+		logger: microloggertest.New(),
+
+		base:               base,
+		addresses:          []string{first.URL, second.URL},
+		healthCheckTimeout: time.Second,
+		reprobeInterval:    time.Hour,
+
+		current: first.URL,
+		failed:  map[string]time.Time{},
+	}
+	client := &http.Client{Transport: transport}
+
+	get := func() {
+		resp, err := client.Get(first.URL + "/v1/secret/foo")
+		if err != nil {
+			t.Fatalf("expected no error, got %#v", err)
+		}
+		resp.Body.Close()
+	}
+
+	// The first Vault goes away, so that requests fail over to the second
+	// one.
+	base.setDown(first.URL, true)
+	get()
+	if atomic.LoadInt32(&secondRequests) != 1 {
+		t.Fatalf("expected request to fail over to second Vault, got %d requests", secondRequests)
+	}
+
+	// Then the first Vault is back and the second one goes away. Requests
+	// fail over to the first one again, even though it failed recently,
+	// since there is no other one left.
+	base.setDown(first.URL, false)
+	base.setDown(second.URL, true)
+	get()
+	if atomic.LoadInt32(&firstRequests) != 1 {
+		t.Fatalf("expected request to fail over to first Vault again, got %d requests", firstRequests)
+	}
+}
+
+func Test_failoverTransport_ReprobeInterval(t *testing.T) {
+	var firstRequests, secondRequests, thirdRequests int32
+	first := newVaultServer(t, http.StatusOK, &firstRequests)
+	second := newVaultServer(t, http.StatusOK, &secondRequests)
+	third := newVaultServer(t, http.StatusOK, &thirdRequests)
+
+	base := &unreachableTransport{down: map[string]bool{}}
+	transport := &failoverTransport{
+		logger: microloggertest.New(),
+
+		base:               base,
+		addresses:          []string{first.URL, second.URL, third.URL},
+		healthCheckTimeout: time.Second,
+		reprobeInterval:    time.Hour,
+
+		current: second.URL,
+		failed: map[string]time.Time{
+			// The first Vault failed long ago, so that it is preferred
+			// again according to the order of the addresses.
+			first.URL: time.Now().Add(-2 * time.Hour),
+		},
+	}
+	client := &http.Client{Transport: transport}
+
+	base.setDown(second.URL, true)
+	resp, err := client.Get(second.URL + "/v1/secret/foo")
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	resp.Body.Close()
+
+	if atomic.LoadInt32(&firstRequests) != 1 || atomic.LoadInt32(&thirdRequests) != 0 {
+		t.Fatalf("expected request to fail over to first Vault, got %d and %d requests", firstRequests, thirdRequests)
+	}
+}
+
+// Test_failoverTransport_ProbeWithoutLock verifies that probing addresses
+// during a failover does not block other requests from looking up the
+// current address.
+func Test_failoverTransport_ProbeWithoutLock(t *testing.T) {
+	probing := make(chan struct{})
+	release := make(chan struct{})
+	var probingOnce, releaseOnce sync.Once
+	second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/sys/health" {
+			probingOnce.Do(func() { close(probing) })
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"key":"value"}}`))
+	}))
+	defer second.Close()
+	// The probe is released before the server is closed, so that a failing
+	// test does not wait for it.
+	defer releaseOnce.Do(func() { close(release) })
+	first := newVaultServer(t, http.StatusOK, nil)
+
+	base := &unreachableTransport{down: map[string]bool{}}
+	transport := &failoverTransport{
+		logger: microloggertest.New(),
+
+		base:               base,
+		addresses:          []string{first.URL, second.URL},
+		healthCheckTimeout: 5 * time.Second,
+		reprobeInterval:    time.Hour,
+
+		current: first.URL,
+		failed:  map[string]time.Time{},
+	}
+	client := &http.Client{Transport: transport}
+
+	base.setDown(first.URL, true)
+	done := make(chan error, 1)
+	go func() {
+		resp, err := client.Get(first.URL + "/v1/secret/foo")
+		if err == nil {
+			resp.Body.Close()
+		}
+		done <- err
+	}()
+
+	<-probing
+	current := make(chan string, 1)
+	go func() {
+		current <- transport.currentAddress()
+	}()
+	select {
+	case address := <-current:
+		if address != first.URL {
+			t.Fatalf("expected current address %q while probing, got %q", first.URL, address)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected current address to be looked up while probing")
+	}
+
+	releaseOnce.Do(func() { close(release) })
+	err := <-done
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	if transport.currentAddress() != second.URL {
+		t.Fatalf("expected current address %q, got %q", second.URL, transport.currentAddress())
+	}
+}
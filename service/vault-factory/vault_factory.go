@@ -1,26 +1,76 @@
 package vaultfactory
 
 import (
+	"context"
+	"net/url"
+	"os"
+	"time"
+
 	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
 	vaultclient "github.com/hashicorp/vault/api"
 
 	"github.com/giantswarm/certctl/v2/service/spec"
 )
 
+// failoverReprobeInterval is the time a Vault address which failed is not
+// failed over to again.
+const failoverReprobeInterval = time.Minute
+
 // Config represents the configuration used to create a new Vault factory.
 type Config struct {
+	// Dependencies.
+	Logger micrologger.Logger
+
 	// Settings.
-	Address    string
+
+	// Address is the address of the Vault server. It is only used in case
+	// Addresses is empty.
+	Address string
+
+	// Addresses is the ordered list of addresses of Vault servers serving the
+	// same data, e.g. replicated regional clusters. The created clients are
+	// connected to the first active one, or the first standby in case none is
+	// active, as reported by sys/health. In case the connection to it fails
+	// later on, requests fail over to the next healthy one. The addresses may
+	// only differ in their scheme, host and port.
+	Addresses []string
+
 	AdminToken string
 	TLS        *vaultclient.TLSConfig
+
+	// DisableClientRetries disables the retries of single requests by the
+	// created clients, which otherwise retry requests failing with 412 or 5xx
+	// twice, writes included. Disable them in case operations are retried by
+	// a retry policy, so that requests are not retried on both levels.
+	DisableClientRetries bool
+
+	// HealthCheckTimeout is the maximum duration of probing the health of all
+	// addresses. It is only used for multiple addresses.
+	HealthCheckTimeout time.Duration
+
+	// Namespace is the Vault Enterprise namespace all requests of the created
+	// clients are scoped to. All paths used by the services, e.g. PKI mounts
+	// and policies, are then relative to this namespace. Empty means the root
+	// namespace.
+	Namespace string
 }
 
 // DefaultConfig provides a default configuration to create a Vault factory.
 func DefaultConfig() Config {
+	newLogger, err := micrologger.New(micrologger.Config{IOWriter: os.Stderr})
+	if err != nil {
+		panic(err)
+	}
+
 	newConfig := Config{
+		// Dependencies.
+		Logger: newLogger,
+
 		// Settings.
-		Address:    "http://127.0.0.1:8200",
-		AdminToken: "admin-token",
+		Address:            "http://127.0.0.1:8200",
+		AdminToken:         "admin-token",
+		HealthCheckTimeout: 10 * time.Second,
 	}
 
 	return newConfig
@@ -33,8 +83,27 @@ func New(config Config) (spec.VaultFactory, error) {
 	}
 
 	// Dependencies.
-	if newVaultFactory.Address == "" {
-		return nil, microerror.Maskf(invalidConfigError, "Vault address must not be empty")
+	if newVaultFactory.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "logger must not be empty")
+	}
+
+	// Settings.
+	if len(newVaultFactory.Addresses) == 0 {
+		newVaultFactory.Addresses = []string{newVaultFactory.Address}
+	}
+	for _, address := range newVaultFactory.Addresses {
+		if address == "" {
+			return nil, microerror.Maskf(invalidConfigError, "Vault address must not be empty")
+		}
+		if len(newVaultFactory.Addresses) > 1 {
+			u, err := url.Parse(address)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, microerror.Maskf(invalidConfigError, "Vault address '%s' must be an HTTP or HTTPS URL when using multiple addresses", address)
+			}
+		}
+	}
+	if len(newVaultFactory.Addresses) > 1 && newVaultFactory.HealthCheckTimeout <= 0 {
+		return nil, microerror.Maskf(invalidConfigError, "health check timeout must be greater than zero")
 	}
 	if newVaultFactory.AdminToken == "" {
 		return nil, microerror.Maskf(invalidConfigError, "Vault admin token must not be empty")
@@ -49,7 +118,7 @@ type vaultFactory struct {
 
 func (vf *vaultFactory) NewClient() (*vaultclient.Client, error) {
 	newClientConfig := vaultclient.DefaultConfig()
-	newClientConfig.Address = vf.Address
+	newClientConfig.Address = vf.Addresses[0]
 
 	// Setup TLS
 	err := newClientConfig.ConfigureTLS(vf.TLS)
@@ -57,11 +126,54 @@ func (vf *vaultFactory) NewClient() (*vaultclient.Client, error) {
 		return nil, microerror.Mask(err)
 	}
 
+	// In case of multiple addresses, the client is connected to a healthy
+	// one and fails over to another one later on if necessary. Health checks
+	// use the same TLS settings as the client.
+	if len(vf.Addresses) > 1 {
+		ctx, cancel := context.WithTimeout(context.Background(), vf.HealthCheckTimeout)
+		defer cancel()
+
+		address, err := selectAddress(ctx, newClientConfig.HttpClient, vf.Addresses, nil)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+		newClientConfig.Address = address
+
+		vf.Logger.Log("level", "debug", "message", "selected Vault address", "address", address)
+
+		newClientConfig.HttpClient.Transport = &failoverTransport{
+			logger: vf.Logger,
+
+			base:               newClientConfig.HttpClient.Transport,
+			addresses:          vf.Addresses,
+			healthCheckTimeout: vf.HealthCheckTimeout,
+
+			reprobeInterval: failoverReprobeInterval,
+
+			current: address,
+			failed:  map[string]time.Time{},
+		}
+	}
+
 	newVaultClient, err := vaultclient.NewClient(newClientConfig)
 	if err != nil {
 		return nil, microerror.Mask(err)
 	}
+
+	// The latency of all requests is observed. The transport is wrapped only
+	// now, because the Vault client requires the plain one for unix sockets
+	// on creation.
+	newClientConfig.HttpClient.Transport = &instrumentedTransport{
+		base: newClientConfig.HttpClient.Transport,
+	}
+
+	if vf.DisableClientRetries {
+		newVaultClient.SetMaxRetries(0)
+	}
 	newVaultClient.SetToken(vf.AdminToken)
+	if vf.Namespace != "" {
+		newVaultClient.SetNamespace(vf.Namespace)
+	}
 
 	return newVaultClient, nil
 }
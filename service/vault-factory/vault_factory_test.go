@@ -0,0 +1,270 @@
+package vaultfactory
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	vaultclient "github.com/hashicorp/vault/api"
+
+	"github.com/giantswarm/certctl/v2/service/spec"
+)
+
+// newVaultServer returns a fake Vault server reporting the given status code
+// on sys/health and responding to all other requests with an empty secret.
+// The number of requests other than health checks is counted in requests.
+func newVaultServer(t *testing.T, healthStatus int, requests *int32) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/sys/health" {
+			w.WriteHeader(healthStatus)
+			return
+		}
+
+		if requests != nil {
+			atomic.AddInt32(requests, 1)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"key":"value"}}`))
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func newTestFactory(t *testing.T, addresses ...string) spec.VaultFactory {
+	config := DefaultConfig()
+	config.Addresses = addresses
+	config.TLS = &vaultclient.TLSConfig{}
+
+	f, err := New(config)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return f
+}
+
+func Test_probe(t *testing.T) {
+	testCases := []struct {
+		name          string
+		status        int
+		expected      health
+		errorExpected bool
+	}{
+		{name: "active", status: http.StatusOK, expected: healthActive},
+		{name: "standby", status: http.StatusTooManyRequests, expected: healthStandby},
+		{name: "performance standby", status: 473, expected: healthStandby},
+		{name: "DR secondary", status: 472, expected: healthSealed},
+		{name: "not initialized", status: http.StatusNotImplemented, expected: healthSealed},
+		{name: "sealed", status: http.StatusServiceUnavailable, expected: healthSealed},
+		{name: "unexpected", status: http.StatusInternalServerError, expected: healthUnreachable, errorExpected: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newVaultServer(t, tc.status, nil)
+
+			h, err := probe(context.Background(), s.Client(), s.URL)
+			if tc.errorExpected && err == nil {
+				t.Fatalf("expected error, got none")
+			}
+			if !tc.errorExpected && err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			if h != tc.expected {
+				t.Fatalf("expected %s, got %s", tc.expected, h)
+			}
+		})
+	}
+}
+
+func Test_selectAddress(t *testing.T) {
+	sealed := newVaultServer(t, http.StatusServiceUnavailable, nil)
+	standby := newVaultServer(t, http.StatusTooManyRequests, nil)
+	active := newVaultServer(t, http.StatusOK, nil)
+	secondActive := newVaultServer(t, http.StatusOK, nil)
+
+	unreachable := newVaultServer(t, http.StatusOK, nil)
+	unreachable.Close()
+
+	testCases := []struct {
+		name          string
+		addresses     []string
+		expected      string
+		errorExpected bool
+	}{
+		{
+			name:      "first active in order",
+			addresses: []string{unreachable.URL, sealed.URL, active.URL, secondActive.URL},
+			expected:  active.URL,
+		},
+		{
+			name:      "active preferred over standby",
+			addresses: []string{standby.URL, active.URL},
+			expected:  active.URL,
+		},
+		{
+			name:      "standby without active",
+			addresses: []string{sealed.URL, standby.URL},
+			expected:  standby.URL,
+		},
+		{
+			name:          "none healthy",
+			addresses:     []string{unreachable.URL, sealed.URL},
+			errorExpected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			address, err := selectAddress(context.Background(), http.DefaultClient, tc.addresses, nil)
+			if tc.errorExpected {
+				if !IsNoHealthyVault(err) {
+					t.Fatalf("expected no healthy Vault error, got %#v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %#v", err)
+			}
+			if address != tc.expected {
+				t.Fatalf("expected %s, got %s", tc.expected, address)
+			}
+		})
+	}
+}
+
+func Test_VaultFactory_NewClient_NoHealthyVault(t *testing.T) {
+	first := newVaultServer(t, http.StatusServiceUnavailable, nil)
+	second := newVaultServer(t, http.StatusServiceUnavailable, nil)
+
+	f := newTestFactory(t, first.URL, second.URL)
+
+	_, err := f.NewClient()
+	if !IsNoHealthyVault(err) {
+		t.Fatalf("expected no healthy Vault error, got %#v", err)
+	}
+}
+
+func Test_VaultFactory_NewClient_Failover(t *testing.T) {
+	var firstRequests, secondRequests int32
+	standby := newVaultServer(t, http.StatusTooManyRequests, nil)
+	first := newVaultServer(t, http.StatusOK, &firstRequests)
+	second := newVaultServer(t, http.StatusOK, &secondRequests)
+
+	f := newTestFactory(t, standby.URL, first.URL, second.URL)
+
+	c, err := f.NewClient()
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	if c.Address() != first.URL {
+		t.Fatalf("expected client to be connected to %s, got %s", first.URL, c.Address())
+	}
+
+	_, err = c.Logical().Write("secret/foo", map[string]interface{}{"key": "value"})
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	if atomic.LoadInt32(&firstRequests) != 1 || atomic.LoadInt32(&secondRequests) != 0 {
+		t.Fatalf("expected request to be sent to first Vault only, got %d and %d requests", firstRequests, secondRequests)
+	}
+
+	// Once the active Vault goes away mid-session, requests fail over to the
+	// next active one instead of the standby listed first.
+	first.Close()
+
+	secret, err := c.Logical().Write("secret/foo", map[string]interface{}{"key": "value"})
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	if secret == nil || secret.Data["key"] != "value" {
+		t.Fatalf("expected secret to be returned, got %#v", secret)
+	}
+	if atomic.LoadInt32(&secondRequests) != 1 {
+		t.Fatalf("expected request to fail over to second Vault, got %d requests", secondRequests)
+	}
+}
+
+func Test_VaultFactory_NewClient_AllFailed(t *testing.T) {
+	first := newVaultServer(t, http.StatusOK, nil)
+	second := newVaultServer(t, http.StatusOK, nil)
+
+	f := newTestFactory(t, first.URL, second.URL)
+
+	c, err := f.NewClient()
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	// The Vault client retries failed requests itself, which only slows down
+	// the test here.
+	c.SetMaxRetries(0)
+
+	first.Close()
+	second.Close()
+
+	_, err = c.Logical().Read("secret/foo")
+	if err == nil {
+		t.Fatalf("expected error, got none")
+	}
+}
+
+func Test_VaultFactory_NewClient_SingleAddress(t *testing.T) {
+	// A single address is used as is, without probing its health, so a sealed
+	// Vault reports its state on actual requests as before.
+	s := newVaultServer(t, http.StatusServiceUnavailable, nil)
+
+	f := newTestFactory(t, s.URL)
+
+	c, err := f.NewClient()
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	if c.Address() != s.URL {
+		t.Fatalf("expected client to be connected to %s, got %s", s.URL, c.Address())
+	}
+}
+
+func Test_New_InvalidAddresses(t *testing.T) {
+	config := DefaultConfig()
+	config.Addresses = []string{"http://127.0.0.1:8200", "unix:///var/run/vault.sock"}
+
+	_, err := New(config)
+	if !IsInvalidConfig(err) {
+		t.Fatalf("expected invalid config error, got %#v", err)
+	}
+}
+
+func Test_VaultFactory_NewClient_DisableClientRetries(t *testing.T) {
+	var requests int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(s.Close)
+
+	config := DefaultConfig()
+	config.Addresses = []string{s.URL}
+	config.TLS = &vaultclient.TLSConfig{}
+	config.DisableClientRetries = true
+	f, err := New(config)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	c, err := f.NewClient()
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	_, err = c.Logical().Write("secret/foo", map[string]interface{}{"key": "value"})
+	if err == nil {
+		t.Fatalf("expected error, got none")
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", requests)
+	}
+}
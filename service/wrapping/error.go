@@ -0,0 +1,23 @@
+package wrapping
+
+import (
+	"github.com/giantswarm/microerror"
+)
+
+var invalidConfigError = &microerror.Error{
+	Kind: "invalidConfigError",
+}
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return microerror.Cause(err) == invalidConfigError
+}
+
+var wrappedSecretNotFoundError = &microerror.Error{
+	Kind: "wrappedSecretNotFoundError",
+}
+
+// IsWrappedSecretNotFound asserts wrappedSecretNotFoundError.
+func IsWrappedSecretNotFound(err error) bool {
+	return microerror.Cause(err) == wrappedSecretNotFoundError
+}
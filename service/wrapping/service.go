@@ -0,0 +1,157 @@
+package wrapping
+
+import (
+	"context"
+	"os"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+	vaultclient "github.com/hashicorp/vault/api"
+
+	"github.com/giantswarm/certctl/v2/service/spec"
+)
+
+// Config represents the configuration used to create a new wrapping service.
+type Config struct {
+	// Dependencies.
+	Logger      micrologger.Logger
+	VaultClient *vaultclient.Client
+}
+
+// DefaultConfig provides a default configuration to create a wrapping
+// service.
+func DefaultConfig() Config {
+	newClientConfig := vaultclient.DefaultConfig()
+	newClientConfig.Address = "http://127.0.0.1:8200"
+	newVaultClient, err := vaultclient.NewClient(newClientConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	newLogger, err := micrologger.New(micrologger.Config{IOWriter: os.Stderr})
+	if err != nil {
+		panic(err)
+	}
+
+	newConfig := Config{
+		// Dependencies.
+		Logger:      newLogger,
+		VaultClient: newVaultClient,
+	}
+
+	return newConfig
+}
+
+// New creates a new configured wrapping service.
+func New(config Config) (Service, error) {
+	// Dependencies.
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "logger must not be empty")
+	}
+	if config.VaultClient == nil {
+		return nil, microerror.Maskf(invalidConfigError, "Vault client must not be empty")
+	}
+
+	newService := &service{
+		Config: config,
+	}
+
+	return newService, nil
+}
+
+type service struct {
+	Config
+}
+
+func (s *service) Unwrap(wrappingToken string) (UnwrapResponse, error) {
+	return s.UnwrapWithContext(context.Background(), wrappingToken)
+}
+
+func (s *service) UnwrapWithContext(ctx context.Context, wrappingToken string) (UnwrapResponse, error) {
+	if wrappingToken == "" {
+		return UnwrapResponse{}, microerror.Maskf(invalidConfigError, "wrapping token must not be empty")
+	}
+
+	// Unwrapping is authenticated by the wrapping token itself. A clone of the
+	// configured client is used so that the wrapping token does not leak into
+	// other requests.
+	newVaultClient, err := s.VaultClient.Clone()
+	if err != nil {
+		return UnwrapResponse{}, microerror.Mask(err)
+	}
+	newVaultClient.SetHeaders(s.VaultClient.Headers())
+	newVaultClient.SetToken(wrappingToken)
+
+	secret, err := newVaultClient.Logical().UnwrapWithContext(ctx, wrappingToken)
+	if err != nil {
+		return UnwrapResponse{}, microerror.Mask(err)
+	}
+	if secret == nil {
+		return UnwrapResponse{}, microerror.Maskf(wrappedSecretNotFoundError, "wrapped response is empty")
+	}
+
+	// Token creation responses carry the created token in the auth section.
+	if secret.Auth != nil && secret.Auth.ClientToken != "" {
+		newUnwrapResponse := UnwrapResponse{
+			Token: secret.Auth.ClientToken,
+		}
+
+		return newUnwrapResponse, nil
+	}
+
+	// Issue responses carry the signed certificate key pair in the data
+	// section.
+	if _, ok := secret.Data["certificate"]; ok {
+		crt, ok := secret.Data["certificate"].(string)
+		if !ok {
+			return UnwrapResponse{}, microerror.Maskf(wrappedSecretNotFoundError, "public key missing")
+		}
+		key, ok := secret.Data["private_key"].(string)
+		if !ok {
+			return UnwrapResponse{}, microerror.Maskf(wrappedSecretNotFoundError, "private key missing")
+		}
+		ca, ok := secret.Data["issuing_ca"].(string)
+		if !ok {
+			return UnwrapResponse{}, microerror.Maskf(wrappedSecretNotFoundError, "root CA missing")
+		}
+		serial, ok := secret.Data["serial_number"].(string)
+		if !ok {
+			return UnwrapResponse{}, microerror.Maskf(wrappedSecretNotFoundError, "serial number missing")
+		}
+
+		newUnwrapResponse := UnwrapResponse{
+			IssueResponse: &spec.IssueResponse{
+				Certificate:  crt,
+				PrivateKey:   key,
+				IssuingCA:    ca,
+				SerialNumber: serial,
+			},
+		}
+
+		return newUnwrapResponse, nil
+	}
+
+	return UnwrapResponse{}, microerror.Maskf(wrappedSecretNotFoundError, "wrapped response contains neither a token nor a key pair")
+}
+
+// NewClient returns a copy of the given Vault client that requests every
+// response to be wrapped using the given TTL. The returned client shares the
+// token and the headers of the given client. An empty TTL disables response
+// wrapping and returns the given client as it is.
+func NewClient(vaultClient *vaultclient.Client, wrapTTL string) (*vaultclient.Client, error) {
+	if wrapTTL == "" {
+		return vaultClient, nil
+	}
+
+	newVaultClient, err := vaultClient.Clone()
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	newVaultClient.SetHeaders(vaultClient.Headers())
+	newVaultClient.SetToken(vaultClient.Token())
+	newVaultClient.SetWrappingLookupFunc(func(operation, path string) string {
+		return wrapTTL
+	})
+
+	return newVaultClient, nil
+}
@@ -0,0 +1,195 @@
+package wrapping
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	vaultclient "github.com/hashicorp/vault/api"
+
+	"github.com/giantswarm/certctl/v2/service/spec"
+)
+
+func newTestVaultClient(t *testing.T, address string) *vaultclient.Client {
+	clientConfig := vaultclient.DefaultConfig()
+	clientConfig.Address = address
+	vaultClient, err := vaultclient.NewClient(clientConfig)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	vaultClient.SetMaxRetries(0)
+	vaultClient.SetToken("token")
+
+	return vaultClient
+}
+
+func newTestService(t *testing.T, vaultClient *vaultclient.Client) Service {
+	config := DefaultConfig()
+	config.Logger = microloggertest.New()
+	config.VaultClient = vaultClient
+	service, err := New(config)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return service
+}
+
+func Test_Service_Unwrap(t *testing.T) {
+	testCases := []struct {
+		name             string
+		response         string
+		expectedResponse UnwrapResponse
+		errorMatcher     func(error) bool
+	}{
+		{
+			name:     "token",
+			response: `{"auth":{"client_token":"unwrapped-token"}}`,
+			expectedResponse: UnwrapResponse{
+				Token: "unwrapped-token",
+			},
+		},
+		{
+			name:     "key pair",
+			response: `{"data":{"certificate":"crt","private_key":"key","issuing_ca":"ca","serial_number":"01"}}`,
+			expectedResponse: UnwrapResponse{
+				IssueResponse: &spec.IssueResponse{
+					Certificate:  "crt",
+					PrivateKey:   "key",
+					IssuingCA:    "ca",
+					SerialNumber: "01",
+				},
+			},
+		},
+		{
+			name:         "private key missing",
+			response:     `{"data":{"certificate":"crt","issuing_ca":"ca","serial_number":"01"}}`,
+			errorMatcher: IsWrappedSecretNotFound,
+		},
+		{
+			name:         "neither token nor key pair",
+			response:     `{"data":{"key":"value"}}`,
+			errorMatcher: IsWrappedSecretNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var token string
+			var body []byte
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/sys/wrapping/unwrap" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				token = r.Header.Get("X-Vault-Token")
+				body, _ = io.ReadAll(r.Body)
+				_, _ = w.Write([]byte(tc.response))
+			}))
+			defer s.Close()
+
+			vaultClient := newTestVaultClient(t, s.URL)
+			service := newTestService(t, vaultClient)
+
+			response, err := service.UnwrapWithContext(context.Background(), "wrapping-token")
+
+			switch {
+			case err == nil && tc.errorMatcher == nil:
+				// correct; carry on
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("expected no error, got %#v", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("expected error, got nil")
+			case !tc.errorMatcher(err):
+				t.Fatalf("unexpected error: %#v", err)
+			}
+
+			// The wrapping token authenticates the request and is not sent
+			// again in the body.
+			if token != "wrapping-token" {
+				t.Fatalf("expected wrapping token %q, got %q", "wrapping-token", token)
+			}
+			if bytes.Contains(body, []byte("wrapping-token")) {
+				t.Fatalf("expected wrapping token not to be sent in body, got %q", body)
+			}
+			if vaultClient.Token() != "token" {
+				t.Fatalf("expected token of configured client to be unchanged, got %q", vaultClient.Token())
+			}
+
+			if tc.errorMatcher == nil && !reflect.DeepEqual(response, tc.expectedResponse) {
+				t.Fatalf("expected response %#v, got %#v", tc.expectedResponse, response)
+			}
+		})
+	}
+}
+
+func Test_Service_Unwrap_Canceled(t *testing.T) {
+	var requests int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(`{"auth":{"client_token":"unwrapped-token"}}`))
+	}))
+	defer s.Close()
+
+	service := newTestService(t, newTestVaultClient(t, s.URL))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := service.UnwrapWithContext(ctx, "wrapping-token")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled error, got %#v", err)
+	}
+	if requests != 0 {
+		t.Fatalf("expected no request, got %d", requests)
+	}
+}
+
+func Test_NewClient(t *testing.T) {
+	var wrapTTL string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wrapTTL = r.Header.Get("X-Vault-Wrap-TTL")
+		_, _ = w.Write([]byte(`{"wrap_info":{"token":"wrapping-token","ttl":300}}`))
+	}))
+	defer s.Close()
+
+	vaultClient := newTestVaultClient(t, s.URL)
+
+	newVaultClient, err := NewClient(vaultClient, "5m")
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	secret, err := newVaultClient.Logical().WriteWithContext(context.Background(), "pki-abc/issue/role-abc", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	if wrapTTL != "5m" {
+		t.Fatalf("expected wrap TTL %q, got %q", "5m", wrapTTL)
+	}
+	if secret.WrapInfo == nil || secret.WrapInfo.Token != "wrapping-token" {
+		t.Fatalf("expected wrapping token, got %#v", secret.WrapInfo)
+	}
+
+	// The configured client does not wrap responses.
+	_, err = vaultClient.Logical().WriteWithContext(context.Background(), "pki-abc/issue/role-abc", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	if wrapTTL != "" {
+		t.Fatalf("expected no wrap TTL, got %q", wrapTTL)
+	}
+
+	// An empty TTL returns the configured client.
+	newVaultClient, err = NewClient(vaultClient, "")
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	if newVaultClient != vaultClient {
+		t.Fatalf("expected configured client to be returned")
+	}
+}
@@ -0,0 +1,30 @@
+package wrapping
+
+import (
+	"context"
+
+	"github.com/giantswarm/certctl/v2/service/spec"
+)
+
+// UnwrapResponse is the secret that was wrapped by Vault. Exactly one of its
+// fields is set, depending on the kind of response that got wrapped.
+type UnwrapResponse struct {
+	// Token is the Vault token in case the wrapped response was a token
+	// creation as done by the token service.
+	Token string `json:"token,omitempty"`
+
+	// IssueResponse is the signed certificate key pair in case the wrapped
+	// response was an issue request as done by the certificate signer.
+	IssueResponse *spec.IssueResponse `json:"issue_response,omitempty"`
+}
+
+// Service manages the delivery of secrets using Vault's response wrapping.
+// See also https://www.vaultproject.io/docs/concepts/response-wrapping.
+type Service interface {
+	// Unwrap exchanges the given single-use wrapping token for the secret it
+	// wraps. Once unwrapped, the wrapping token cannot be used again.
+	Unwrap(wrappingToken string) (UnwrapResponse, error)
+
+	// UnwrapWithContext is the context aware variant of Unwrap.
+	UnwrapWithContext(ctx context.Context, wrappingToken string) (UnwrapResponse, error)
+}